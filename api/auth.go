@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+var (
+	errUnauthorized = errors.New("missing or unknown api token")
+	errForbidden    = errors.New("the api token isn't allowed to access this")
+	errReadOnly     = errors.New("the api token has the read role, this needs the admin role")
+)
+
+type scopeKey struct{}
+
+// scope is the set of tenants a request may see, a nil scope sees everything
+type scope map[string]bool
+
+// withAuth rejects the /v1 requests without a configured token, and the ones changing something
+// without an admin token, and attaches the scope of the token to the others,
+// the probes stay open, nothing is checked if no token is configured
+func withAuth(tokens []*config.ApiToken, h http.Handler) http.Handler {
+	if len(tokens) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		token := lookupToken(tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if token == nil {
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		if token.Role != "admin" && !readOnly(r) {
+			writeError(w, http.StatusForbidden, errReadOnly)
+			return
+		}
+		var sc scope
+		if len(token.Tenants) > 0 {
+			sc = make(scope, len(token.Tenants))
+			for _, tenant := range token.Tenants {
+				sc[tenant] = true
+			}
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey{}, sc)))
+	})
+}
+
+func lookupToken(tokens []*config.ApiToken, value string) *config.ApiToken {
+	if value == "" {
+		return nil
+	}
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(value)) == 1 {
+			return token
+		}
+	}
+	return nil
+}
+
+// readOnly reports whether a request only reads, the preview posts a rule but changes nothing
+func readOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return r.Method == http.MethodPost && (r.URL.Path == "/v1/rules/preview" || r.URL.Path == "/v1/hooks/evaluate")
+}
+
+func scopeOf(r *http.Request) scope {
+	sc, _ := r.Context().Value(scopeKey{}).(scope)
+	return sc
+}
+
+func (sc scope) allows(tenant string) bool {
+	return sc == nil || sc[tenant]
+}
+
+// canSee reports whether the request may see a group
+func (s *Server) canSee(r *http.Request, cluster, group string) bool {
+	return scopeOf(r).allows(s.fetcher.Tenants().Of(s.fetcher.ClusterID(cluster), group))
+}
+
+// requireUnscoped answers 403 to the tokens limited to tenants, for the cluster wide operations
+func requireUnscoped(w http.ResponseWriter, r *http.Request) bool {
+	if scopeOf(r) != nil {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// authorize sends a request through withAuth, it returns the code of the answer and the request the handler got,
+// nil if withAuth rejected it
+func authorize(tokens []*config.ApiToken, method, path, token string) (int, *http.Request) {
+	var served *http.Request
+	h := withAuth(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r
+	}))
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, served
+}
+
+func TestAuthScope(t *testing.T) {
+	tokens := []*config.ApiToken{
+		{Token: "ops", Role: "admin"},
+		{Token: "pay", Tenants: []string{"payments", "payments-eu"}},
+	}
+	for _, c := range []struct {
+		name, token string
+		code        int
+		// tenants the request may see and may not see
+		sees, hidden []string
+		// whether the cluster wide operations are allowed
+		unscoped bool
+	}{
+		{"unscoped", "ops", http.StatusOK, []string{"payments", "search", ""}, nil, true},
+		{"scoped", "pay", http.StatusOK, []string{"payments", "payments-eu"}, []string{"search", ""}, false},
+		{"unknown token", "nope", http.StatusUnauthorized, nil, nil, false},
+		{"no token", "", http.StatusUnauthorized, nil, nil, false},
+	} {
+		code, r := authorize(tokens, http.MethodGet, "/v1/statuses", c.token)
+		if code != c.code {
+			t.Errorf("%s: answered %d, want %d", c.name, code, c.code)
+			continue
+		}
+		if r == nil {
+			continue
+		}
+		for _, tenant := range c.sees {
+			if !scopeOf(r).allows(tenant) {
+				t.Errorf("%s: tenant %q hidden", c.name, tenant)
+			}
+		}
+		for _, tenant := range c.hidden {
+			if scopeOf(r).allows(tenant) {
+				t.Errorf("%s: tenant %q visible", c.name, tenant)
+			}
+		}
+		if unscoped := requireUnscoped(httptest.NewRecorder(), r); unscoped != c.unscoped {
+			t.Errorf("%s: cluster wide operations allowed %v, want %v", c.name, unscoped, c.unscoped)
+		}
+	}
+	// the probes stay open
+	if code, _ := authorize(tokens, http.MethodGet, "/healthz", ""); code != http.StatusOK {
+		t.Errorf("probe without a token answered %d", code)
+	}
+	// nothing is checked without tokens
+	if code, r := authorize(nil, http.MethodGet, "/v1/statuses", ""); code != http.StatusOK || scopeOf(r) != nil {
+		t.Errorf("request without configured tokens answered %d", code)
+	}
+}
+
+func TestAuthRoles(t *testing.T) {
+	tokens := []*config.ApiToken{
+		{Token: "ops", Role: "admin"},
+		{Token: "dash"},
+		{Token: "pay", Role: "read", Tenants: []string{"payments"}},
+	}
+	for _, c := range []struct {
+		method, path, token string
+		code                int
+	}{
+		{http.MethodGet, "/v1/statuses", "dash", http.StatusOK},
+		{http.MethodHead, "/v1/statuses", "dash", http.StatusOK},
+		{http.MethodPost, "/v1/rules/preview", "dash", http.StatusOK},
+		{http.MethodPost, "/v1/hooks/evaluate", "pay", http.StatusOK},
+		{http.MethodPost, "/v1/mutes", "dash", http.StatusForbidden},
+		{http.MethodDelete, "/v1/mutes", "pay", http.StatusForbidden},
+		{http.MethodPut, "/v1/admin/loglevel", "dash", http.StatusForbidden},
+		{http.MethodPost, "/v1/mutes", "ops", http.StatusOK},
+		{http.MethodDelete, "/v1/mutes", "ops", http.StatusOK},
+	} {
+		if code, _ := authorize(tokens, c.method, c.path, c.token); code != c.code {
+			t.Errorf("%s %s with the %s token answered %d, want %d", c.method, c.path, c.token, code, c.code)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// the comment sent on an idle stream, so the proxies keep it open
+var eventsKeepalive = 30 * time.Second
+
+// handleEvents returns the kept events after the since query value, of the cluster and group query values if
+// set. Asked for text/event-stream, or with stream=true, it replays them and streams the new ones as server sent
+// events, resuming after the Last-Event-ID header of a reconnection. The events are the ones of this instance.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if q := r.FormValue("since"); q != "" {
+		var err error
+		if since, err = strconv.ParseInt(q, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	keep := func(event *monitor.Event) bool {
+		if cluster := r.FormValue("cluster"); cluster != "" && cluster != event.Cluster {
+			return false
+		}
+		if group := r.FormValue("group"); group != "" && group != event.Group {
+			return false
+		}
+		return s.canSee(r, event.Cluster, event.Group)
+	}
+	if r.FormValue("stream") != "true" && !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		events := []*monitor.Event{}
+		for _, event := range s.fetcher.Events(since) {
+			if keep(event) {
+				events = append(events, event)
+			}
+		}
+		writeJSON(w, http.StatusOK, events)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+	if id, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		since = id
+	}
+	// subscribed before the replay, so no event falls in between
+	ch, cancel := s.fetcher.SubscribeEvents()
+	defer cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	write := func(event *monitor.Event) error {
+		since = event.ID
+		if !keep(event) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		return err
+	}
+	for _, event := range s.fetcher.Events(since) {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case event := <-ch:
+			if event.ID <= since {
+				continue
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// query value marking the requests between peers, which are answered with the local data only
+const localParam = "local"
+
+var peerClient = &http.Client{Timeout: 10 * time.Second}
+
+// federated reports whether the request must be forwarded to the peers
+func (s *Server) federated(r *http.Request) bool {
+	return len(s.cfg.Api.Peers) > 0 && r.FormValue(localParam) == ""
+}
+
+// queryPeers forwards the request with its api token to every peer and decodes the successful answers with decode,
+// which is called by one peer at a time, the peers which fail are logged and counted in a header
+func (s *Server) queryPeers(w http.ResponseWriter, r *http.Request, decode func(body []byte) error) {
+	query := r.URL.Query()
+	query.Set(localParam, "true")
+	var (
+		lock   sync.Mutex
+		wg     sync.WaitGroup
+		failed int
+	)
+	for _, peer := range s.cfg.Api.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			body, err := getPeer(strings.TrimSuffix(peer, "/")+r.URL.Path+"?"+query.Encode(), r.Header.Get("Authorization"))
+			lock.Lock()
+			defer lock.Unlock()
+			if err == nil {
+				err = decode(body)
+			}
+			if err != nil {
+				s.log.WithField("peer", peer).Warnf("federated query failed: %v", err)
+				failed++
+			}
+		}(peer)
+	}
+	wg.Wait()
+	if failed > 0 {
+		w.Header().Set("X-Burrowx-Failed-Peers", fmt.Sprint(failed))
+	}
+}
+
+// getPeer returns the body of a successful answer of a peer, a 404 is returned as a nil body
+func getPeer(url, authorization string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s", resp.Status)
+}
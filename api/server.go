@@ -0,0 +1,835 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// Server serves the http api of burrowx
+type Server struct {
+	cfg     *config.Config
+	fetcher *monitor.Fetcher
+	mux     *http.ServeMux
+	server  *http.Server
+	// of api.adminListen, nil if the admin endpoints are served by server
+	admin *http.Server
+	log   *logrus.Entry
+}
+
+func NewServer(cfg *config.Config, fetcher *monitor.Fetcher) *Server {
+	s := &Server{
+		cfg:     cfg,
+		fetcher: fetcher,
+		mux:     http.NewServeMux(),
+		log:     mylog.Module("api"),
+	}
+	s.mux.HandleFunc("/v1/admin/loglevel", s.handleLogLevel)
+	s.mux.HandleFunc("/v1/admin/state", s.handleState)
+	s.mux.HandleFunc("/v1/admin/info", s.handleInfo)
+	s.mux.HandleFunc("/v1/admin/migration", s.handleMigration)
+	s.mux.HandleFunc("/v1/admin/quarantine", s.handleQuarantine)
+	s.mux.HandleFunc("/v1/statuses", s.handleStatuses)
+	s.mux.HandleFunc("/v1/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/v1/config/schema", s.handleConfigSchema)
+	s.mux.HandleFunc("/v1/forecast", s.handleForecast)
+	s.mux.HandleFunc("/v1/heatmap", s.handleHeatmap)
+	s.mux.HandleFunc("/v1/history", s.handleHistory)
+	s.mux.HandleFunc("/v1/compare", s.handleCompare)
+	s.mux.HandleFunc("/v1/events", s.handleEvents)
+	s.mux.HandleFunc("/v1/idle", s.handleIdle)
+	s.mux.HandleFunc("/v1/mutes", s.handleMutes)
+	s.mux.HandleFunc("/v1/coverage", s.handleCoverage)
+	s.mux.HandleFunc("/v1/clients", s.handleClients)
+	s.mux.HandleFunc("/v1/health", s.handleHealth)
+	s.mux.HandleFunc("/v1/rules/preview", s.handlePreview)
+	s.mux.HandleFunc("/v1/hooks/evaluate", s.handleEvaluate)
+	s.mux.HandleFunc("/v1/clusters", s.handleClusterList)
+	s.mux.HandleFunc("/v1/clusters/", s.handleClusters)
+	s.mux.HandleFunc("/v1/notifiers/", s.handleNotifiers)
+	s.mux.HandleFunc("/healthz", s.handleLiveness)
+	s.mux.HandleFunc("/readyz", s.handleReadiness)
+	s.mux.HandleFunc("/ui/", s.handleUI)
+	handler := withIdentity(monitor.NewIdentity(cfg), withAuth(cfg.Api.Tokens, s.mux))
+	if cfg.Api.AdminListen != "" {
+		s.admin = &http.Server{Addr: cfg.Api.AdminListen, Handler: handler}
+		handler = withoutAdmin(handler)
+	}
+	s.server = &http.Server{Addr: cfg.Api.Listen, Handler: handler}
+	return s
+}
+
+// withoutAdmin answers 404 to the admin requests, the ones of /v1/admin and the ones changing something,
+// for the listener of the public api
+func withoutAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/admin/") || !readOnly(r) {
+			writeError(w, http.StatusNotFound, errors.New("served on api.adminListen"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) Start() error {
+	servers := []*http.Server{s.server}
+	if s.admin != nil {
+		servers = append(servers, s.admin)
+	}
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, server := range servers {
+		ln, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	for i, server := range servers {
+		go func(server *http.Server, ln net.Listener) {
+			if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				s.log.Errorf("api server error: %v", err)
+			}
+		}(server, listeners[i])
+	}
+	s.log.Infof("api listening on %s", s.cfg.Api.Listen)
+	if s.admin != nil {
+		s.log.Infof("admin api listening on %s", s.cfg.Api.AdminListen)
+	}
+	return nil
+}
+
+func (s *Server) Stop() {
+	s.server.Close()
+	if s.admin != nil {
+		s.admin.Close()
+	}
+}
+
+// handleLogLevel returns the log levels on GET, and sets the level of a module on POST/PUT,
+// with the module and level form values, an empty module sets the default level
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		module, level := r.FormValue("module"), r.FormValue("level")
+		if err := mylog.SetLevel(module, level); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.log.Warnf("log level of module %q set to %s", module, level)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, mylog.Levels())
+}
+
+// handleState exports the in-memory state on GET, and replaces it with the posted snapshot on POST/PUT
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.fetcher.ExportState())
+	case http.MethodPost, http.MethodPut:
+		var state monitor.State
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.fetcher.ImportState(&state); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.log.Warnf("state of %d clusters imported", len(state.Clusters))
+		writeJSON(w, http.StatusOK, map[string]int{"clusters": len(state.Clusters)})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+// handleInfo returns the build info, the enabled importers and notifiers and the sanitized config
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	info, err := s.fetcher.Info()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// handleMigration returns the reports of the verified sinks, the cluster query value filters them
+func (s *Server) handleMigration(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fetcher.MigrationReports(r.FormValue("cluster")))
+}
+
+// handleConfigSchema returns the json schema of the config file, for the validation tools and config editors
+func (s *Server) handleConfigSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := config.Schema()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schema)
+}
+
+// handleStatuses returns the statuses of the last evaluation with their window, the cluster and group query
+// values filter them
+func (s *Server) handleStatuses(w http.ResponseWriter, r *http.Request) {
+	group := r.FormValue("group")
+	res := []*monitor.GroupStatus{}
+	for _, status := range s.fetcher.Statuses(r.FormValue("cluster")) {
+		if (group == "" || group == status.Group) && scopeOf(r).allows(status.Tenant) {
+			res = append(res, status)
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleMetrics returns the metrics for Prometheus, in OpenMetrics if the scraper accepts it, with the created
+// timestamps and the exemplars of the canary latency
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	if err := s.fetcher.WriteMetrics(w, openMetrics, scopeOf(r).allows); err != nil {
+		s.log.Warnf("Cannot write the metrics: %v", err)
+	}
+}
+
+// handleQuarantine returns the decoded offsets which failed the sanity checks, the cluster query value filters them
+func (s *Server) handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fetcher.Quarantine(r.FormValue("cluster")))
+}
+
+type forecast struct {
+	Cluster     string  `json:"cluster"`
+	Group       string  `json:"group"`
+	TotalLag    int64   `json:"total_lag"`
+	LagRate     float64 `json:"lag_rate"`
+	Forecast15m int64   `json:"forecast_15m"`
+	Forecast60m int64   `json:"forecast_60m"`
+}
+
+// handleForecast returns the lag of the groups in 15 and 60 minutes if their trend continues, fastest growing first,
+// the cluster and group query values filter them
+func (s *Server) handleForecast(w http.ResponseWriter, r *http.Request) {
+	group := r.FormValue("group")
+	res := []*forecast{}
+	for _, status := range s.fetcher.Statuses(r.FormValue("cluster")) {
+		if (group != "" && group != status.Group) || !scopeOf(r).allows(status.Tenant) {
+			continue
+		}
+		res = append(res, &forecast{
+			Cluster:     status.Cluster,
+			Group:       status.Group,
+			TotalLag:    status.TotalLag,
+			LagRate:     status.LagRate,
+			Forecast15m: status.Forecast15m,
+			Forecast60m: status.Forecast60m,
+		})
+	}
+	if s.federated(r) {
+		s.queryPeers(w, r, func(body []byte) error {
+			var peerRes []*forecast
+			if body == nil {
+				return nil
+			}
+			if err := json.Unmarshal(body, &peerRes); err != nil {
+				return err
+			}
+			res = append(res, peerRes...)
+			return nil
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LagRate > res[j].LagRate })
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleHistory returns the lag history of the cluster and group query values between the from and to
+// query values, timestamps(ms) which default to the last 24 hours
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	to := time.Now().UnixNano() / int64(time.Millisecond)
+	from := to - int64(24*time.Hour/time.Millisecond)
+	for name, v := range map[string]*int64{"from": &from, "to": &to} {
+		if q := r.FormValue(name); q != "" {
+			var err error
+			if *v, err = strconv.ParseInt(q, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+	if !s.canSee(r, r.FormValue("cluster"), r.FormValue("group")) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	history, err := s.fetcher.History(r.FormValue("cluster"), r.FormValue("group"), from, to)
+	if err != nil && s.federated(r) {
+		// the cluster may be monitored by a peer
+		s.queryPeers(w, r, func(body []byte) error {
+			if body == nil || history != nil {
+				return nil
+			}
+			history = &monitor.History{}
+			return json.Unmarshal(body, history)
+		})
+	}
+	if history == nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// handleCompare pairs the groups found in several clusters and returns how their lag and consume rate diverge,
+// the group query value and the clusters one, comma separated, filter them. The peers answer their sides,
+// the groups per cluster, which are paired with the local ones.
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	group := r.FormValue("group")
+	clusters := make(map[string]bool)
+	for _, cluster := range strings.Split(r.FormValue("clusters"), ",") {
+		if cluster != "" {
+			clusters[cluster] = true
+		}
+	}
+	keep := func(side *monitor.CompareSide) bool {
+		return (group == "" || group == side.Group) && (len(clusters) == 0 || clusters[side.Cluster]) && scopeOf(r).allows(side.Tenant)
+	}
+	sides := []*monitor.CompareSide{}
+	for _, side := range monitor.CompareSides(s.fetcher.Statuses("")) {
+		if keep(side) {
+			sides = append(sides, side)
+		}
+	}
+	if r.FormValue("sides") == "true" {
+		writeJSON(w, http.StatusOK, sides)
+		return
+	}
+	if s.federated(r) {
+		u := *r.URL
+		query := u.Query()
+		query.Set("sides", "true")
+		u.RawQuery = query.Encode()
+		peerReq := *r
+		peerReq.URL = &u
+		s.queryPeers(w, &peerReq, func(body []byte) error {
+			var peerSides []*monitor.CompareSide
+			if body == nil {
+				return nil
+			}
+			if err := json.Unmarshal(body, &peerSides); err != nil {
+				return err
+			}
+			for _, side := range peerSides {
+				if keep(side) {
+					sides = append(sides, side)
+				}
+			}
+			return nil
+		})
+	}
+	writeJSON(w, http.StatusOK, monitor.CompareGroups(sides))
+}
+
+// handleHeatmap returns the lag per partition and time of the cluster, group and topic query values,
+// downsampled to the buckets query value
+func (s *Server) handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	buckets := 0
+	if b := r.FormValue("buckets"); b != "" {
+		var err error
+		if buckets, err = strconv.Atoi(b); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if !s.canSee(r, r.FormValue("cluster"), r.FormValue("group")) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	hm, err := s.fetcher.Heatmap(r.FormValue("cluster"), r.FormValue("group"), r.FormValue("topic"), buckets)
+	if err != nil && s.federated(r) {
+		// the cluster may be monitored by a peer
+		s.queryPeers(w, r, func(body []byte) error {
+			if body == nil || hm != nil {
+				return nil
+			}
+			hm = &monitor.Heatmap{}
+			return json.Unmarshal(body, hm)
+		})
+	}
+	if hm == nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hm)
+}
+
+// handleIdle returns the groups without members which still have offsets, of the cluster query value if set
+func (s *Server) handleIdle(w http.ResponseWriter, r *http.Request) {
+	idle := []*monitor.IdleGroup{}
+	for _, group := range s.fetcher.IdleGroups(r.FormValue("cluster")) {
+		if s.canSee(r, group.Cluster, group.Group) {
+			idle = append(idle, group)
+		}
+	}
+	if s.federated(r) {
+		s.queryPeers(w, r, func(body []byte) error {
+			var peerIdle []*monitor.IdleGroup
+			if body == nil {
+				return nil
+			}
+			if err := json.Unmarshal(body, &peerIdle); err != nil {
+				return err
+			}
+			idle = append(idle, peerIdle...)
+			return nil
+		})
+		sort.Slice(idle, func(i, j int) bool { return idle[i].ExpiresAt < idle[j].ExpiresAt })
+	}
+	writeJSON(w, http.StatusOK, idle)
+}
+
+// handleMutes returns the topics muted now, the cluster query value filters them
+func (s *Server) handleMutes(w http.ResponseWriter, r *http.Request) {
+	mutes := []*monitor.TopicMute{}
+	for _, mute := range s.fetcher.Mutes(r.FormValue("cluster")) {
+		if s.canSee(r, mute.Cluster, mute.Group) {
+			mutes = append(mutes, mute)
+		}
+	}
+	writeJSON(w, http.StatusOK, mutes)
+}
+
+// handleCoverage returns the topics without consumers and the groups of missing topics per cluster, the cluster
+// query value filters them. The tokens limited to tenants only see the orphaned groups of their tenants, and
+// the unconsumed topics of the clusters the tenants own.
+func (s *Server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	coverage := []*monitor.Coverage{}
+	for _, c := range s.fetcher.Coverage(r.FormValue("cluster")) {
+		owned := scopeOf(r).allows(s.fetcher.Tenants().Cluster(c.Cluster))
+		if !owned {
+			c.Unconsumed = []*monitor.UnconsumedTopic{}
+		}
+		orphaned := []*monitor.OrphanedGroup{}
+		for _, group := range c.Orphaned {
+			if s.canSee(r, c.Cluster, group.Group) {
+				orphaned = append(orphaned, group)
+			}
+		}
+		c.Orphaned = orphaned
+		if owned || len(orphaned) > 0 {
+			coverage = append(coverage, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, coverage)
+}
+
+// handleClients returns the clients of the groups, the cluster query value filters them
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	clients := []*monitor.GroupClients{}
+	for _, gc := range s.fetcher.GroupClients(r.FormValue("cluster")) {
+		if s.canSee(r, gc.Cluster, gc.Group) {
+			clients = append(clients, gc)
+		}
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+// handleMute mutes a topic of a group on POST, until the until timestamp(ms) or for minutes, and unmutes it on
+// DELETE with the topic query value
+func (s *Server) handleMute(w http.ResponseWriter, r *http.Request, cluster, group string) {
+	if !s.canSee(r, cluster, group) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Topic   string `json:"topic"`
+			Until   int64  `json:"until"`
+			Minutes int64  `json:"minutes"`
+			Reason  string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Until == 0 && body.Minutes > 0 {
+			body.Until = time.Now().Add(time.Duration(body.Minutes)*time.Minute).UnixNano() / int64(time.Millisecond)
+		}
+		mute, err := s.fetcher.Mute(cluster, &monitor.TopicMute{Group: group, Topic: body.Topic, Until: body.Until, Reason: body.Reason})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.log.Warnf("topic %s of group %s of cluster %s muted until %d", mute.Topic, group, cluster, mute.Until)
+		writeJSON(w, http.StatusOK, mute)
+	case http.MethodDelete:
+		topic := r.FormValue("topic")
+		if err := s.fetcher.Unmute(cluster, group, topic); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		s.log.Warnf("topic %s of group %s of cluster %s unmuted", topic, group, cluster)
+		writeJSON(w, http.StatusOK, map[string]string{"cluster": cluster, "group": group, "topic": topic})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+// handleHealth returns the rollup of the clusters, the cluster query value filters them,
+// the tokens limited to tenants only see the clusters of their tenants
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := []*monitor.ClusterHealth{}
+	for _, h := range s.fetcher.Health(r.FormValue("cluster")) {
+		if scopeOf(r).allows(s.fetcher.Tenants().Cluster(h.Cluster)) {
+			health = append(health, h)
+		}
+	}
+	if s.federated(r) {
+		s.queryPeers(w, r, func(body []byte) error {
+			var peerHealth []*monitor.ClusterHealth
+			if body == nil {
+				return nil
+			}
+			if err := json.Unmarshal(body, &peerHealth); err != nil {
+				return err
+			}
+			health = append(health, peerHealth...)
+			return nil
+		})
+		sort.Slice(health, func(i, j int) bool { return health[i].Cluster < health[j].Cluster })
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// handlePreview returns the groups the posted rule would fire for now, on this instance only
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	var rule monitor.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	matches, err := s.fetcher.Preview(&rule)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	visible := []*monitor.RuleMatch{}
+	for _, match := range matches {
+		if s.canSee(r, match.Cluster, match.Group) {
+			visible = append(visible, match)
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+// handleEvaluate evaluates a group now and returns its fresh status, for the deployment pipelines to check
+// a consumer after a rollout, the body is {"cluster": "...", "group": "..."}
+func (s *Server) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	var hook struct {
+		Cluster string `json:"cluster"`
+		Group   string `json:"group"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if hook.Cluster == "" || hook.Group == "" {
+		writeError(w, http.StatusBadRequest, errors.New("cluster and group are required"))
+		return
+	}
+	if !s.canSee(r, hook.Cluster, hook.Group) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	status, err := s.fetcher.EvaluateNow(r.Context(), hook.Cluster, hook.Group)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleClusters routes the /v1/clusters/{cluster}/... paths
+func (s *Server) handleClusters(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/clusters/"), "/"), "/")
+	if len(parts) == 4 && parts[1] == "consumers" && parts[3] == "lag" && r.Method == http.MethodGet {
+		s.handleLag(w, r, parts[0], parts[2])
+		return
+	}
+	if len(parts) == 4 && parts[1] == "consumers" && parts[3] == "assignments" && r.Method == http.MethodGet {
+		s.handleAssignments(w, r, parts[0], parts[2])
+		return
+	}
+	if len(parts) == 4 && parts[1] == "consumers" && parts[3] == "mute" {
+		s.handleMute(w, r, parts[0], parts[2])
+		return
+	}
+	if len(parts) == 3 && parts[1] == "consumers" && r.Method == http.MethodDelete {
+		s.handlePurge(w, r, parts[0], parts[2])
+		return
+	}
+	if len(parts) == 2 && (parts[1] == "pause" || parts[1] == "resume") && r.Method == http.MethodPost {
+		s.handlePause(w, r, parts[0], parts[1] == "pause")
+		return
+	}
+	if len(parts) == 2 && parts[1] == "allowlist" {
+		s.handleAllowlist(w, r, parts[0])
+		return
+	}
+	if len(parts) == 2 && parts[1] == "inventory" && r.Method == http.MethodGet {
+		s.handleInventory(w, r, parts[0])
+		return
+	}
+	writeError(w, http.StatusNotFound, nil)
+}
+
+// handleInventory returns the brokers and the topics of a cluster at the last inventory refresh
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request, cluster string) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	inv, err := s.fetcher.Inventory(cluster)
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusOK, inv)
+	case monitor.ErrInventoryPending:
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusNotFound, err)
+	}
+}
+
+// handleAllowlist returns the allowlist the learned groups propose for a cluster, accepts it, or the groups
+// of the body, with POST, and monitors all the groups again with DELETE
+func (s *Server) handleAllowlist(w http.ResponseWriter, r *http.Request, cluster string) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	proposal, err := s.fetcher.GroupProposal(cluster)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, proposal)
+		return
+	case http.MethodPost:
+		var body struct {
+			Groups []string `json:"groups"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		var groups []string
+		if groups, err = s.fetcher.AcceptGroups(cluster, body.Groups); err == nil {
+			s.log.Warnf("monitoring of cluster %s locked down to %d groups", cluster, len(groups))
+			writeJSON(w, http.StatusOK, map[string][]string{"accepted": groups})
+			return
+		}
+	case http.MethodDelete:
+		if err = s.fetcher.RejectGroups(cluster); err == nil {
+			s.log.Warnf("monitoring of cluster %s back to all groups", cluster)
+			writeJSON(w, http.StatusOK, map[string][]string{"accepted": {}})
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+	if err == monitor.ErrLearning {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+// handleClusterList returns the monitored clusters with their display names and aliases, merged with the peers'
+func (s *Server) handleClusterList(w http.ResponseWriter, r *http.Request) {
+	clusters := []*monitor.ClusterInfo{}
+	for _, c := range s.fetcher.Clusters() {
+		if scopeOf(r).allows(s.fetcher.Tenants().Cluster(c.Cluster)) {
+			clusters = append(clusters, c)
+		}
+	}
+	if s.federated(r) {
+		s.queryPeers(w, r, func(body []byte) error {
+			var peerClusters []*monitor.ClusterInfo
+			if body == nil {
+				return nil
+			}
+			if err := json.Unmarshal(body, &peerClusters); err != nil {
+				return err
+			}
+			clusters = append(clusters, peerClusters...)
+			return nil
+		})
+		sort.Slice(clusters, func(i, j int) bool { return clusters[i].Cluster < clusters[j].Cluster })
+	}
+	writeJSON(w, http.StatusOK, clusters)
+}
+
+// handlePause pauses or resumes the monitoring of a cluster, it returns the paused clusters
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request, cluster string, pause bool) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	var err error
+	if pause {
+		err = s.fetcher.Pause(cluster)
+	} else {
+		err = s.fetcher.Resume(cluster)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.log.Warnf("monitoring of cluster %s paused: %v", cluster, pause)
+	writeJSON(w, http.StatusOK, map[string][]string{"paused": s.fetcher.PausedClusters()})
+}
+
+// handlePurge drops the stored state of a group
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request, cluster, group string) {
+	if !s.canSee(r, cluster, group) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	if err := s.fetcher.Purge(cluster, group); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.log.Warnf("group %s of cluster %s purged", group, cluster)
+	writeJSON(w, http.StatusOK, map[string]string{"cluster": cluster, "group": group})
+}
+
+// handleNotifiers sends a synthetic alert through a notifier on POST /v1/notifiers/{name}/test
+func (s *Server) handleNotifiers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/notifiers/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "test" || r.Method != http.MethodPost {
+		writeError(w, http.StatusNotFound, nil)
+		return
+	}
+	if !requireUnscoped(w, r) {
+		return
+	}
+	clusters, err := s.fetcher.TestNotifier(parts[0])
+	if err == monitor.ErrUnknownNotifier {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"clusters": clusters})
+}
+
+// handleLag returns the lag of a group at the last sweep, or fetched from the brokers with fresh=true
+func (s *Server) handleLag(w http.ResponseWriter, r *http.Request, cluster, group string) {
+	if !s.canSee(r, cluster, group) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	lag, err := s.fetcher.Lag(r.Context(), cluster, group, r.FormValue("fresh") == "true")
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lag)
+}
+
+// handleAssignments returns the members of a group with the partitions they own and their lag
+func (s *Server) handleAssignments(w http.ResponseWriter, r *http.Request, cluster, group string) {
+	if !s.canSee(r, cluster, group) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	assignment, err := s.fetcher.Assignment(cluster, group)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, assignment)
+}
+
+// handleLiveness answers as long as the process serves, a restart doesn't cure a kafka outage
+// so the offsets being stale only fails readiness
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadiness fails while the offsets of any cluster are stale
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if stale := s.fetcher.StaleClusters(); len(stale) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "stale", "clusters": stale})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// withIdentity adds the identity of the instance to the headers of every response
+func withIdentity(id monitor.Identity, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Burrowx-Instance", id.Instance)
+		w.Header().Set("X-Burrowx-Host", id.Host)
+		w.Header().Set("X-Burrowx-Version", id.Version)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	msg := http.StatusText(code)
+	if err != nil {
+		msg = err.Error()
+	}
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+)
+
+// handleUI serves the single page of the web ui, which only reads the /v1 api with the token it's given,
+// the page itself holds no data and is open like the probes
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		writeError(w, http.StatusNotFound, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Write([]byte(uiPage))
+}
+
+// uiPage lists the clusters with their health and the groups of a cluster with their status, lags and a sparkline
+// of the total lag over the evaluation window, it refreshes every 10s, a click on a header sorts the groups
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>burrowx</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+h1 { font-size: 1.4em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { padding: 4px 10px; text-align: left; border-bottom: 1px solid #ddd; }
+th { cursor: pointer; background: #f4f4f4; user-select: none; }
+tr.cluster { cursor: pointer; }
+tr.selected { background: #e8f0fe; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.OK { color: #188038; } .WARN { color: #b06000; } .ERR, .STOP, .STALL, .REWIND { color: #c5221f; font-weight: bold; }
+#error { color: #c5221f; }
+</style>
+</head>
+<body>
+<h1>burrowx</h1>
+<p>Token <input id="token" type="password" size="30"> <span id="error"></span></p>
+<table id="clusters"><thead><tr><th>cluster</th><th>groups</th><th>ok</th><th>warn</th><th>err</th><th>total lag</th><th>stale</th><th>paused</th></tr></thead><tbody></tbody></table>
+<h2 id="title"></h2>
+<input id="filter" placeholder="filter groups">
+<table id="groups"><thead><tr>
+<th data-key="group">group</th><th data-key="status">status</th><th data-key="total_lag">total lag</th>
+<th data-key="max_lag">max lag</th><th data-key="time_lag">time lag (s)</th><th data-key="lag_rate">lag rate</th><th>window</th>
+</tr></thead><tbody></tbody></table>
+<script>
+var statusOrder = {OK: 0, WARN: 1, REWIND: 2, STALL: 3, STOP: 4, ERR: 5};
+var cluster = "", statuses = [], sortKey = "status", sortDesc = true;
+var token = document.getElementById("token");
+token.value = localStorage.getItem("burrowx-token") || "";
+token.onchange = function() { localStorage.setItem("burrowx-token", token.value); refresh(); };
+document.getElementById("filter").oninput = render;
+
+function get(path) {
+	var headers = token.value ? {Authorization: "Bearer " + token.value} : {};
+	return fetch(path, {headers: headers}).then(function(r) {
+		if (!r.ok) { return r.text().then(function(t) { throw new Error(r.status + " " + t); }); }
+		return r.json();
+	});
+}
+
+function cell(tr, text, cls) {
+	var td = document.createElement("td");
+	td.textContent = text;
+	if (cls) { td.className = cls; }
+	tr.appendChild(td);
+	return td;
+}
+
+function sparkline(window) {
+	var w = 100, h = 20, lags = (window || []).map(function(e) { return e.total_lag; });
+	if (lags.length < 2) { return ""; }
+	var max = Math.max.apply(null, lags) || 1;
+	var points = lags.map(function(lag, i) {
+		return (i * w / (lags.length - 1)).toFixed(1) + "," + (h - lag * h / max).toFixed(1);
+	}).join(" ");
+	return '<svg width="' + w + '" height="' + h + '"><polyline fill="none" stroke="#1a73e8" stroke-width="1.5" points="' + points + '"/></svg>';
+}
+
+function refresh() {
+	get("/v1/health").then(function(health) {
+		document.getElementById("error").textContent = "";
+		var tbody = document.querySelector("#clusters tbody");
+		tbody.innerHTML = "";
+		health.forEach(function(h) {
+			if (!cluster) { cluster = h.cluster; }
+			var tr = document.createElement("tr");
+			tr.className = "cluster" + (h.cluster === cluster ? " selected" : "");
+			cell(tr, h.cluster_name || h.cluster);
+			[h.groups, h.ok, h.warn, h.err, h.total_lag].forEach(function(v) { cell(tr, v, "num"); });
+			cell(tr, h.stale ? "yes" : "");
+			cell(tr, h.paused ? "yes" : "");
+			tr.onclick = function() { cluster = h.cluster; refresh(); };
+			tbody.appendChild(tr);
+		});
+		if (!cluster) { return; }
+		return get("/v1/statuses?cluster=" + encodeURIComponent(cluster)).then(function(res) {
+			statuses = res;
+			render();
+		});
+	}).catch(function(err) { document.getElementById("error").textContent = err.message; });
+}
+
+function render() {
+	document.getElementById("title").textContent = cluster;
+	var filter = document.getElementById("filter").value;
+	var rows = statuses.filter(function(s) { return s.group.indexOf(filter) >= 0; });
+	rows.sort(function(a, b) {
+		var x = a[sortKey], y = b[sortKey];
+		if (sortKey === "status") { x = statusOrder[x] || 0; y = statusOrder[y] || 0; }
+		var c = x < y ? -1 : x > y ? 1 : 0;
+		return sortDesc ? -c : c;
+	});
+	var tbody = document.querySelector("#groups tbody");
+	tbody.innerHTML = "";
+	rows.forEach(function(s) {
+		var tr = document.createElement("tr");
+		cell(tr, s.group);
+		cell(tr, s.status, s.status);
+		cell(tr, s.total_lag, "num");
+		cell(tr, s.max_lag, "num");
+		cell(tr, s.time_lag.toFixed(1), "num");
+		cell(tr, s.lag_rate.toFixed(2), "num");
+		cell(tr, "").innerHTML = sparkline(s.window);
+		tbody.appendChild(tr);
+	});
+}
+
+document.querySelectorAll("#groups th[data-key]").forEach(function(th) {
+	th.onclick = function() {
+		var key = th.getAttribute("data-key");
+		sortDesc = key === sortKey ? !sortDesc : key !== "group";
+		sortKey = key;
+		render();
+	};
+});
+
+refresh();
+setInterval(refresh, 10000);
+</script>
+</body>
+</html>
+`
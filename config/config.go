@@ -2,41 +2,393 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	General struct {
-		ClientId  string `json:"clientId"`
-		Logconfig string `json:"logconfig"`
-		Pidfile   string `json:"pidfile"`
+		ClientId string    `json:"clientId"`
+		Log      LogConfig `json:"log"`
+		Pidfile  string    `json:"pidfile"`
+		// tags the data of this instance, the hostname if empty
+		InstanceId string `json:"instanceId"`
+		// split the groups of the clusters among Shards instances, this one monitors the groups of ShardIndex
+		Shards     int `json:"shards"`
+		ShardIndex int `json:"shardIndex"`
 
 		TopicFilter string `json:"topicFilter"`
 		GroupFilter string `json:"groupFilter"`
+
+		// sweep each cluster at a random phase of the fetch interval, with a random jitter of up to
+		// SweepJitterPercent of the interval, and at most MaxConcurrentSweeps clusters at once, unlimited if 0
+		SweepPhaseSpread    bool `json:"sweepPhaseSpread"`
+		SweepJitterPercent  int  `json:"sweepJitterPercent"`
+		MaxConcurrentSweeps int  `json:"maxConcurrentSweeps"`
+
+		// data older than StaleIntervals fetch intervals is flagged as stale
+		StaleIntervals int `json:"staleIntervals"`
+		// a sweep taking longer is cancelled, with its requests in flight, 30 by default
+		SweepTimeoutSeconds int `json:"sweepTimeoutSeconds"`
+		// the shutdown gives up on the sweeps, the importer and the sinks after this, 30 by default
+		ShutdownTimeoutSeconds int `json:"shutdownTimeoutSeconds"`
+
+		// flag as WARN the groups whose lag is abnormally high for them, even if it's not growing steadily
+		AnomalyDetection bool `json:"anomalyDetection"`
+		// flag as WARN the groups with a topic whose max partition lag is more than this times its mean, disabled if 0
+		SkewThreshold float64 `json:"skewThreshold"`
+		// flag as WARN the OK groups which rebalanced more than RebalanceStormCount times in RebalanceStormMinutes, disabled if 0
+		RebalanceStormCount   int `json:"rebalanceStormCount"`
+		RebalanceStormMinutes int `json:"rebalanceStormMinutes"`
+		// a committed offset going back by at most this many messages is an out of order commit, not a deliberate rewind
+		OutOfOrderMaxRewind int64 `json:"outOfOrderMaxRewind"`
+
+		// offsets.retention.minutes of the brokers, to report when the offsets of empty groups expire
+		OffsetsRetentionMinutes int `json:"offsetsRetentionMinutes"`
+		// also fetch the log start offsets every sweep, and the retention of the topics, to know how much they retain
+		FetchStartOffsets bool `json:"fetchStartOffsets"`
+		// topic regexps of the compacted topics, on top of the ones whose described cleanup.policy is compact
+		CompactedTopics string `json:"compactedTopics"`
+		// the lag of the compacted topics never makes a group WARN or ERR
+		SuppressCompactedLag bool `json:"suppressCompactedLag"`
+		// describe the retention.ms and cleanup.policy of the topics, also done with FetchStartOffsets
+		DescribeTopicConfigs bool `json:"describeTopicConfigs"`
+		// flag as WARN the OK groups whose retention pressure is above this, e.g. 0.8, disabled if 0
+		RetentionPressureThreshold float64 `json:"retentionPressureThreshold"`
+		// refresh the metadata at every metadata refresh to detect the partitions being reassigned,
+		// and with SuppressReassigningLag their lag never makes a group WARN or ERR
+		DetectReassignments    bool `json:"detectReassignments"`
+		SuppressReassigningLag bool `json:"suppressReassigningLag"`
+		// count the brokers, the under replicated and offline partitions and the controller changes
+		// at every metadata refresh, in the cluster health
+		BrokerHealth bool `json:"brokerHealth"`
+		// refresh the inventory of the brokers and topics every InventoryMinutes, served by the api and written
+		// as info points, disabled if 0
+		InventoryMinutes int `json:"inventoryMinutes"`
+		// what to do with the groups consuming a topic the cached metadata doesn't know yet, e.g. just created:
+		// drop (default) them until it does, counted, warn too, or refresh the metadata to monitor it at once
+		UnknownTopics string `json:"unknownTopics"`
+		// what to do with a committed offset ahead of the log end offset of the last sweep:
+		// clamp (default) it to the log end offset, drop the partition from the sweep, or flag its point
+		StaleBrokerOffset string `json:"staleBrokerOffset"`
+		// fetch the log end offset of the partitions which didn't move for IdleEndOffsetSweeps sweeps only every
+		// IdleRecheckSweeps sweeps (6 by default), the other sweeps reuse the last one, disabled if 0
+		IdleEndOffsetSweeps int `json:"idleEndOffsetSweeps"`
+		IdleRecheckSweeps   int `json:"idleRecheckSweeps"`
+		// consume __consumer_offsets to measure the commit latency of the groups, how long after the
+		// commit timestamp the coordinator appended their commits
+		CommitLatency bool `json:"commitLatency"`
+
+		// skip the consumer_metrics points of partitions whose offsets didn't move, for at most MaxSilenceSeconds
+		Dedup             bool `json:"dedup"`
+		MaxSilenceSeconds int  `json:"maxSilenceSeconds"`
+		// write at most one consumer_metrics point per partition every MinEmitIntervalSeconds,
+		// and skip it if its lag changed by MinLagDelta or less, for at most MaxSilenceSeconds too
+		MinEmitIntervalSeconds int   `json:"minEmitIntervalSeconds"`
+		MinLagDelta            int64 `json:"minLagDelta"`
+		// groups whose last written points are kept for the three above, the least recent ones are
+		// forgotten past it
+		EmitStateMaxGroups int `json:"emitStateMaxGroups"`
+		// after a downtime of the monitor, reconstruct the lag of the groups over its last BackfillMaxHours,
+		// one point every BackfillStepSeconds (60 by default), disabled if 0
+		BackfillMaxHours    int `json:"backfillMaxHours"`
+		BackfillStepSeconds int `json:"backfillStepSeconds"`
+		// observe the groups for LearnGroupsHours, then propose an allowlist of the groups committing regularly,
+		// kept with the accepted allowlist in LearnGroupsDir if set, disabled if 0
+		LearnGroupsHours int    `json:"learnGroupsHours"`
+		LearnGroupsDir   string `json:"learnGroupsDir"`
+
+		// run the whole pipeline but only log what would be written
+		DryRun bool `json:"dryRun"`
+		// append the offsets of every sweep to this file, to replay them later
+		RecordFile string `json:"recordFile"`
+		// proxy to the brokers, influxdb and grafana, socks5://[user:pass@]host:port or http://[user:pass@]host:port,
+		// the http clients use the HTTP(S)_PROXY env vars if empty
+		Proxy string `json:"proxy"`
+		// file or http(s) url of a json list of owner rules, replacing the owners of the config, reloaded every minute
+		OwnersSource string `json:"ownersSource"`
+		// go plugins (.so) loaded at startup, they register sink types
+		Plugins []string `json:"plugins"`
 	} `json:"general"`
 
-	Influxdb struct {
-		Db       string `json:"db"`
-		Enable   bool   `json:"enable"`
-		Hosts    string `json:"hosts"`
-		Pwd      string `json:"pwd"`
-		Username string `json:"username"`
-	} `json:"influxdb"`
+	Api struct {
+		// the api is disabled if empty
+		Listen string `json:"listen"`
+		// serves the admin endpoints, /v1/admin and the requests changing something, which Listen refuses then,
+		// e.g. on localhost while Listen is exposed to the dashboards
+		AdminListen string `json:"adminListen"`
+		// base urls of other burrowx instances, the /v1 queries merge their answers
+		Peers []string `json:"peers"`
+		// once set, every /v1 request needs one of these tokens as "Authorization: Bearer <token>"
+		Tokens []*ApiToken `json:"tokens"`
+	} `json:"api"`
+
+	// Grafana annotates the dashboards when the status of a group changes, disabled if url is empty
+	Grafana struct {
+		Url    string   `json:"url"`
+		ApiKey string   `json:"apiKey"`
+		Tags   []string `json:"tags"`
+	} `json:"grafana"`
+
+	// SLOs on the time lag of the groups, their compliance and burn rate are written every sweep
+	SLOs []*SLO `json:"slos"`
+
+	// GroupRewrite maps the raw group ids to logical names before they're evaluated and written,
+	// the first rule matching a group applies
+	GroupRewrite []*GroupRewrite `json:"groupRewrite"`
+
+	// Tenants assign the groups to teams, the first rule matching a group applies,
+	// the groups no rule matches belong to the tenant of their cluster
+	Tenants []*TenantRule `json:"tenants"`
+
+	// Owners assign the groups to the teams owning them, the first rule matching a group applies
+	Owners []*OwnerRule `json:"owners"`
+
+	// Alerting routes the alerts of the notifiers by severity and time of day
+	Alerting struct {
+		// of the time windows of the routes, the local time by default, e.g. Europe/Paris
+		Timezone string        `json:"timezone"`
+		Routes   []*AlertRoute `json:"routes"`
+	} `json:"alerting"`
+
+	// Enrich rules rewrite the tags of the consumer_metrics points, or drop them, in order
+	Enrich []*EnrichRule `json:"enrich"`
+
+	// Sinks receive the results of every sweep next to influxdb, their types are registered by plugins
+	Sinks []*SinkConfig `json:"sinks"`
+
+	// Evaluation selects the engine deciding the statuses of the groups, window by default,
+	// other types are registered by plugins
+	Evaluation *EngineConfig `json:"evaluation"`
+
+	Influxdb InfluxdbConfig `json:"influxdb"`
+
+	// Tracing exports spans of the sweeps, the commit decoding, the writes and the canary to an OTLP/HTTP
+	// collector, disabled if endpoint is empty
+	Tracing struct {
+		// base url of the collector, the spans are posted to its /v1/traces, e.g. http://localhost:4318
+		Endpoint string `json:"endpoint"`
+		// of the sweeps and probes traced, 1 (all) by default
+		SampleRatio float64 `json:"sampleRatio"`
+		// sent with every export, e.g. an authorization header
+		Headers map[string]string `json:"headers"`
+	} `json:"tracing"`
 
+	// Kubernetes monitors the clusters of the KafkaMonitor resources (burrowx.io/v1alpha1) of a namespace too,
+	// added, restarted and removed as the resources change, see ClusterSpec for their spec
+	Kubernetes struct {
+		WatchKafkaMonitors bool `json:"watchKafkaMonitors"`
+		// of the resources, the namespace of the pod if empty
+		Namespace string `json:"namespace"`
+	} `json:"kubernetes"`
+
+	// the name of a cluster is its id in the tags and the api, it should stay when its brokers change
 	Kafka map[string]*struct {
 		Brokers       string `json:"brokers"`
 		ClientProfile string `json:"ClientProfile"`
+		// shown to the humans, carried by the cluster_name tag and the api next to the id
+		DisplayName string `json:"displayName"`
+		Description string `json:"description"`
+		// other names the api accepts for the cluster, e.g. its name before a rename
+		Aliases []string `json:"aliases"`
+		// write one consumer_metrics point per group and topic instead of one per partition
+		AggregateOnly bool `json:"aggregateOnly"`
+		// write the partition points of a sample of the partitions of the huge topics only
+		PartitionSampling *PartitionSampling `json:"partitionSampling"`
+		// of the timestamps written to influxdb, s (default), ms, u or ns
+		Precision string `json:"precision"`
+		// tenant of the groups of the cluster no tenant rule matches
+		Tenant string `json:"tenant"`
+		// monitor only these topics instead of the ones metadata lists, when the principal can't describe all topics
+		Topics []string `json:"topics"`
+		// monitor only these groups, e.g. the allowlist proposed by general.learnGroupsHours, which doesn't learn them then
+		Groups []string `json:"groups"`
+
+		// the influxdb of the cluster, its empty fields are the ones of the global influxdb
+		Influxdb *InfluxdbConfig `json:"influxdb"`
+		// the sinks of the cluster instead of the global sinks if set, [] for none
+		Sinks []*SinkConfig `json:"sinks"`
+		// the evaluation engine of the cluster instead of the global one if set
+		Evaluation *EngineConfig `json:"evaluation"`
+		// only log what would be written to the influxdb of the cluster, like general.dryRun
+		DryRun bool `json:"dryRun"`
+		// the kafka client library the metadata, the list offsets and the consumption of the offsets topics go
+		// through, sarama (default), other backends are registered by plugins
+		Backend string `json:"backend"`
+		// Flavor of the brokers, kafka (default), kraft for kafka without zookeeper or redpanda,
+		// it adjusts the protocol version and the checks which don't apply to them
+		Flavor string `json:"flavor"`
+		// the topics of the offset commits read by general.commitLatency and general.backfillMaxHours,
+		// __consumer_offsets by default
+		OffsetsTopics []*OffsetsTopicConfig `json:"offsetsTopics"`
 
 		Sasl struct {
 			Username string
 			Password string
 		}
+
+		// Canary produces to and consumes from a dedicated topic to check the cluster end to end
+		Canary struct {
+			Enable bool   `json:"enable"`
+			Topic  string `json:"topic"`
+			Group  string `json:"group"`
+		} `json:"canary"`
+
+		// Confluent sets up a Confluent Cloud cluster from its bootstrap server and api key,
+		// the brokers and sasl are derived from it
+		Confluent struct {
+			Bootstrap string `json:"bootstrap"`
+			ApiKey    string `json:"apiKey"`
+			ApiSecret string `json:"apiSecret"`
+		} `json:"confluent"`
+
+		// EventHubs sets up the kafka endpoint of an Azure Event Hubs namespace from its connection string
+		EventHubs struct {
+			ConnectionString string `json:"connectionString"`
+		} `json:"eventHubs"`
 	} `json:"kafka"`
 
 	ClientProfile map[string]*Profile `json:"ClientProfile"`
 }
 
+// GroupRewrite renames the groups matching Match to Replace, expanded with the submatches,
+// e.g. {"match": "^(\\w+)-[0-9a-f-]{36}$", "replace": "$1"} collapses groups suffixed with a uuid
+type GroupRewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// TenantRule assigns the groups matching the Group regexp to Name, on the cluster Cluster or all clusters if empty
+type TenantRule struct {
+	Name    string `json:"name"`
+	Cluster string `json:"cluster"`
+	Group   string `json:"group"`
+}
+
+// OwnerRule assigns the groups matching the Group regexp, on the cluster Cluster or all clusters if empty,
+// to Team, whose alerts only go to the Notifiers if set
+type OwnerRule struct {
+	Team      string   `json:"team"`
+	Cluster   string   `json:"cluster"`
+	Group     string   `json:"group"`
+	Notifiers []string `json:"notifiers"`
+}
+
+// ApiToken grants access to the consumers of Tenants, or to everything and the cluster wide operations if empty,
+// the read role (default) can only read, the admin role can change things too
+type ApiToken struct {
+	Token   string   `json:"token"`
+	Role    string   `json:"role"`
+	Tenants []string `json:"tenants"`
+}
+
+// EnrichRule applies to the points whose Tag matches the Match regexp, it drops them, or sets the tags of Set,
+// whose values are expanded with the submatches, e.g. {"tag": "consumer_group", "match": "^(\\w+)-", "set": {"team": "$1"}}
+type EnrichRule struct {
+	Tag   string            `json:"tag"`
+	Match string            `json:"match"`
+	Drop  bool              `json:"drop"`
+	Set   map[string]string `json:"set"`
+}
+
+// SLO is met by a group of Group (a regexp, all groups if empty) while it's less than MaxTimeLag seconds behind,
+// for Objective (e.g. 0.99) of the evaluations of the last WindowHours
+type SLO struct {
+	Name        string  `json:"name"`
+	Group       string  `json:"group"`
+	MaxTimeLag  float64 `json:"maxTimeLag"`
+	Objective   float64 `json:"objective"`
+	WindowHours int     `json:"windowHours"`
+}
+
+type InfluxdbConfig struct {
+	Db       string `json:"db"`
+	Enable   bool   `json:"enable"`
+	Hosts    string `json:"hosts"`
+	Pwd      string `json:"pwd"`
+	Username string `json:"username"`
+	// above this rate the consumer_metrics points of a group and topic are written as one aggregate point, unlimited if 0
+	MaxPointsPerSecond float64 `json:"maxPointsPerSecond"`
+	// a write taking longer is cancelled, 10 by default
+	WriteTimeoutSeconds int `json:"writeTimeoutSeconds"`
+}
+
+// PartitionSampling writes, for the topics of at least MinPartitions partitions, the consumer_metrics points
+// of every Every-th partition and of the Worst partitions by their recent lag only, next to the aggregate point
+type PartitionSampling struct {
+	MinPartitions int `json:"minPartitions"`
+	Every         int `json:"every"`
+	Worst         int `json:"worst"`
+}
+
+type SinkConfig struct {
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options"`
+	// RFC3339 timestamps, the sink only receives the sweeps from Enable until Disable, to cut over between sinks
+	Enable  string `json:"enable,omitempty"`
+	Disable string `json:"disable,omitempty"`
+	// counts what the sink receives and writes next to the influxdb points, for /v1/admin/migration
+	Verify bool `json:"verify,omitempty"`
+	// above this rate of partition offsets and statuses the sink only receives the statuses, unlimited if 0
+	MaxPointsPerSecond float64 `json:"maxPointsPerSecond,omitempty"`
+}
+
+// Window returns the timestamps of Enable and Disable, zero if unset
+func (sc *SinkConfig) Window() (enable, disable time.Time, err error) {
+	if sc.Enable != "" {
+		if enable, err = time.Parse(time.RFC3339, sc.Enable); err != nil {
+			return
+		}
+	}
+	if sc.Disable != "" {
+		if disable, err = time.Parse(time.RFC3339, sc.Disable); err != nil {
+			return
+		}
+	}
+	if !enable.IsZero() && !disable.IsZero() && !disable.After(enable) {
+		err = errors.New("the sink is disabled before it's enabled")
+	}
+	return
+}
+
+// OffsetsTopicConfig is a topic of offset commits and the codec of its records: binary (default), the format of
+// __consumer_offsets, json or avro for the commits mirrored by other platforms, other codecs are registered by plugins
+type OffsetsTopicConfig struct {
+	Name    string            `json:"name"`
+	Codec   string            `json:"codec"`
+	Options map[string]string `json:"options"`
+}
+
+type EngineConfig struct {
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options"`
+}
+
+// EngineRegistered reports whether an evaluation engine type is registered. The engines are registered by
+// monitor and the plugins, which config can't import, so monitor sets it, and Validate doesn't check the
+// types while it's nil.
+var EngineRegistered func(typ string) bool
+
+// BackendRegistered reports whether a kafka client backend is registered, set by monitor like EngineRegistered
+var BackendRegistered func(name string) bool
+
+type LogConfig struct {
+	// text or json
+	Format string `json:"format"`
+	Level  string `json:"level"`
+	// log to stderr if empty
+	File string `json:"file"`
+	// module => level, overrides Level for the module
+	Modules map[string]string `json:"modules"`
+}
+
 type Profile struct {
 	ClientId        string `json:"clientId"`
 	TLS             bool   `json:"tls"`
@@ -44,20 +396,601 @@ type Profile struct {
 	TLSCertFilePath string `json:"tlsCertfilepath"`
 	TLSKeyFilePath  string `json:"tlsKeyfilepath"`
 	TLSCAFilePath   string `json:"tlsCafilepath"`
+	// trust the system CAs, next to the tlsCafilepath if set
+	TLSSystemCA bool `json:"tlsSystemCa"`
+	// what to do with the tls fields set while tls is disabled: warn (default) to ignore them, error,
+	// or enable to enable tls
+	TLSDisabledFields string `json:"tlsDisabledFields"`
+
+	// network and fetch tuning, sarama's defaults if 0
+	DialTimeoutSeconds  int   `json:"dialTimeoutSeconds"`
+	ReadTimeoutSeconds  int   `json:"readTimeoutSeconds"`
+	WriteTimeoutSeconds int   `json:"writeTimeoutSeconds"`
+	FetchDefaultBytes   int32 `json:"fetchDefaultBytes"`
+	FetchMaxBytes       int32 `json:"fetchMaxBytes"`
+	ChannelBufferSize   int   `json:"channelBufferSize"`
+}
+
+// ClusterSpec defines a cluster out of the config file, the spec of a KafkaMonitor resource
+type ClusterSpec struct {
+	// the entry of the cluster, as in kafka
+	Kafka json.RawMessage `json:"kafka"`
+	// the client profile of the cluster instead of the clientProfile of its entry if set
+	Profile *Profile `json:"profile"`
+	// alert routes of the cluster, after the ones of alerting, their cluster is the one of the spec
+	AlertRoutes []*AlertRoute `json:"alertRoutes"`
+}
+
+// WithClusters returns a copy of the config with the clusters of specs added, initialized and validated,
+// the config itself isn't changed
+func (cfg *Config) WithClusters(specs map[string]*ClusterSpec) (*Config, error) {
+	// the entries are decoded into a config to get the type of kafka
+	entries := make(map[string]json.RawMessage, len(specs))
+	for name, spec := range specs {
+		if len(spec.Kafka) == 0 {
+			return nil, fmt.Errorf("kafka cluster %s has no kafka entry", name)
+		}
+		entries[name] = spec.Kafka
+	}
+	data, err := json.Marshal(map[string]interface{}{"kafka": entries})
+	if err != nil {
+		return nil, err
+	}
+	var added Config
+	if err := json.Unmarshal(data, &added); err != nil {
+		return nil, err
+	}
+	c := *cfg
+	// {} is decoded to an empty map
+	c.Kafka = added.Kafka
+	for name, k := range cfg.Kafka {
+		if _, ok := c.Kafka[name]; ok {
+			return nil, fmt.Errorf("kafka cluster %s is already in the config file", name)
+		}
+		c.Kafka[name] = k
+	}
+	c.ClientProfile = make(map[string]*Profile, len(cfg.ClientProfile)+len(specs))
+	for name, p := range cfg.ClientProfile {
+		c.ClientProfile[name] = p
+	}
+	c.Alerting.Routes = append([]*AlertRoute{}, cfg.Alerting.Routes...)
+	for name, spec := range specs {
+		if spec.Profile != nil {
+			c.ClientProfile["kafkamonitor/"+name] = spec.Profile
+			c.Kafka[name].ClientProfile = "kafkamonitor/" + name
+		}
+		for _, route := range spec.AlertRoutes {
+			route.Cluster = name
+			c.Alerting.Routes = append(c.Alerting.Routes, route)
+		}
+	}
+	c.Init()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ClusterID returns the cluster named or aliased name, name if none, the first one if an alias is shared
+func (cfg *Config) ClusterID(name string) string {
+	if _, ok := cfg.Kafka[name]; ok {
+		return name
+	}
+	ids := make([]string, 0, len(cfg.Kafka))
+	for id := range cfg.Kafka {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, alias := range cfg.Kafka[id].Aliases {
+			if alias == name {
+				return id
+			}
+		}
+	}
+	return name
+}
+
+// DisplayNameOf returns the display name of a cluster, empty if unset
+func (cfg *Config) DisplayNameOf(cluster string) string {
+	if k, ok := cfg.Kafka[cluster]; ok {
+		return k.DisplayName
+	}
+	return ""
+}
+
+// HasTLSFields reports whether a tls field of the profile is set, tls aside
+func (p *Profile) HasTLSFields() bool {
+	return p.TLSNoVerify || p.TLSSystemCA || p.TLSCertFilePath != "" || p.TLSKeyFilePath != "" || p.TLSCAFilePath != ""
+}
+
+// TLSEnabled reports whether the clients of the profile use tls, tlsDisabledFields enable included
+func (p *Profile) TLSEnabled() bool {
+	return p.TLS || (p.TLSDisabledFields == "enable" && p.HasTLSFields())
+}
+
+// CheckTLS rejects the inconsistent tls fields of the profile
+func (p *Profile) CheckTLS() error {
+	switch p.TLSDisabledFields {
+	case "", "error", "warn", "enable":
+	default:
+		return fmt.Errorf("invalid tlsDisabledFields %s, warn, error or enable", p.TLSDisabledFields)
+	}
+	if !p.TLSEnabled() {
+		if p.HasTLSFields() && p.TLSDisabledFields == "error" {
+			return errors.New("tls fields are set but tls is disabled, set tls, or tlsDisabledFields to warn or enable")
+		}
+		return nil
+	}
+	if (p.TLSCertFilePath == "") != (p.TLSKeyFilePath == "") {
+		return errors.New("tlsCertfilepath and tlsKeyfilepath go together")
+	}
+	if p.TLSNoVerify && (p.TLSCAFilePath != "" || p.TLSSystemCA) {
+		return errors.New("tlsNoverify doesn't verify the brokers, the CAs are useless")
+	}
+	if !p.TLSNoVerify && p.TLSCAFilePath == "" && !p.TLSSystemCA {
+		return errors.New("no CA to verify the brokers, set tlsCafilepath, tlsSystemCa, or tlsNoverify")
+	}
+	return nil
 }
 
 func ReadConfig(cfgFile string) *Config {
+	cfg, err := LoadConfig(cfgFile)
+	errAndExit(err)
+	return cfg
+}
+
+// LoadConfig reads and initializes the config file, without exiting on error
+func LoadConfig(cfgFile string) (*Config, error) {
 	var cfg Config
 	f, err := os.OpenFile(cfgFile, os.O_RDONLY, 0660)
-	errAndExit(err)
-	err = json.NewDecoder(f).Decode(&cfg)
-	errAndExit(err)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err = json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, err
+	}
 
 	cfg.Init()
-	return &cfg
+	return &cfg, nil
+}
+
+// Validate checks the config for errors which would only show up once burrowx is running
+func (cfg *Config) Validate() error {
+	if len(cfg.Kafka) == 0 && !cfg.Kubernetes.WatchKafkaMonitors {
+		return errors.New("no kafka cluster configured")
+	}
+	//alias => cluster
+	aliased := make(map[string]string)
+	for name, k := range cfg.Kafka {
+		if k.EventHubs.ConnectionString != "" && k.Brokers == "" {
+			return fmt.Errorf("event hubs cluster %s has no Endpoint in its connection string", name)
+		}
+		if k.Brokers == "" {
+			return fmt.Errorf("kafka cluster %s has no brokers", name)
+		}
+		if k.Confluent.Bootstrap != "" && (k.Confluent.ApiKey == "" || k.Confluent.ApiSecret == "") {
+			return fmt.Errorf("confluent cluster %s needs an apiKey and apiSecret", name)
+		}
+		if ps := k.PartitionSampling; ps != nil {
+			if ps.MinPartitions < 0 || ps.Every < 0 || ps.Worst < 0 || ps.Every+ps.Worst == 0 {
+				return fmt.Errorf("kafka cluster %s samples no partition, set partitionSampling.every or worst", name)
+			}
+		}
+		switch k.Precision {
+		case "s", "ms", "u", "ns":
+		default:
+			return fmt.Errorf("kafka cluster %s has the invalid precision %s, s, ms, u or ns", name, k.Precision)
+		}
+		for _, alias := range k.Aliases {
+			if _, ok := cfg.Kafka[alias]; ok {
+				return fmt.Errorf("kafka cluster %s has the alias %s, the name of a cluster", name, alias)
+			}
+			if aliased[alias] != "" {
+				return fmt.Errorf("kafka clusters %s and %s share the alias %s", aliased[alias], name, alias)
+			}
+			aliased[alias] = name
+		}
+		if _, ok := cfg.ClientProfile[k.ClientProfile]; !ok {
+			return fmt.Errorf("kafka cluster %s uses the unknown client profile %s", name, k.ClientProfile)
+		}
+		switch k.Flavor {
+		case "kafka":
+		case "kraft", "redpanda":
+			if k.Confluent.Bootstrap != "" || k.EventHubs.ConnectionString != "" {
+				return fmt.Errorf("kafka cluster %s is a managed cluster, its flavor can't be %s", name, k.Flavor)
+			}
+		default:
+			return fmt.Errorf("kafka cluster %s has the invalid flavor %s, kafka, kraft or redpanda", name, k.Flavor)
+		}
+		topics := make(map[string]bool, len(k.OffsetsTopics))
+		for _, ot := range k.OffsetsTopics {
+			if ot.Name == "" || topics[ot.Name] {
+				return fmt.Errorf("kafka cluster %s has an offsets topic without name or listed twice", name)
+			}
+			topics[ot.Name] = true
+		}
+	}
+	for name, p := range cfg.ClientProfile {
+		if err := p.CheckTLS(); err != nil {
+			return fmt.Errorf("client profile %s: %v", name, err)
+		}
+		if p.DialTimeoutSeconds < 0 || p.ReadTimeoutSeconds < 0 || p.WriteTimeoutSeconds < 0 ||
+			p.FetchDefaultBytes < 0 || p.FetchMaxBytes < 0 || p.ChannelBufferSize < 0 {
+			return fmt.Errorf("client profile %s has a negative timeout, fetch size or buffer size", name)
+		}
+		if p.FetchMaxBytes > 0 && p.FetchDefaultBytes > p.FetchMaxBytes {
+			return fmt.Errorf("client profile %s has a fetchDefaultBytes above fetchMaxBytes", name)
+		}
+	}
+	for _, filter := range []string{cfg.General.TopicFilter, cfg.General.GroupFilter, cfg.General.CompactedTopics} {
+		if filter == "" {
+			continue
+		}
+		for _, p := range strings.Split(filter, ",") {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("invalid filter %s: %v", p, err)
+			}
+		}
+	}
+	if cfg.General.SweepJitterPercent < 0 || cfg.General.SweepJitterPercent > 50 {
+		return errors.New("sweepJitterPercent must be between 0 and 50")
+	}
+	if cfg.General.MaxConcurrentSweeps < 0 {
+		return errors.New("maxConcurrentSweeps can't be negative")
+	}
+	switch cfg.General.StaleBrokerOffset {
+	case "clamp", "drop", "flag":
+	default:
+		return fmt.Errorf("invalid staleBrokerOffset %s, clamp, drop or flag", cfg.General.StaleBrokerOffset)
+	}
+	switch cfg.General.UnknownTopics {
+	case "drop", "warn", "refresh":
+	default:
+		return fmt.Errorf("invalid unknownTopics %s, drop, warn or refresh", cfg.General.UnknownTopics)
+	}
+	if cfg.General.IdleEndOffsetSweeps < 0 {
+		return errors.New("idleEndOffsetSweeps can't be negative")
+	}
+	if cfg.General.Shards > 1 && (cfg.General.ShardIndex < 0 || cfg.General.ShardIndex >= cfg.General.Shards) {
+		return fmt.Errorf("shardIndex must be between 0 and %d", cfg.General.Shards-1)
+	}
+	for _, slo := range cfg.SLOs {
+		if slo.Name == "" {
+			return errors.New("slo without name")
+		}
+		if slo.Objective <= 0 || slo.Objective >= 1 {
+			return fmt.Errorf("slo %s: objective must be between 0 and 1", slo.Name)
+		}
+		if _, err := regexp.Compile(slo.Group); err != nil {
+			return fmt.Errorf("slo %s: invalid group %s: %v", slo.Name, slo.Group, err)
+		}
+	}
+	for _, rule := range cfg.GroupRewrite {
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("invalid group rewrite %s: %v", rule.Match, err)
+		}
+	}
+	for _, rule := range cfg.Tenants {
+		if rule.Name == "" {
+			return errors.New("tenant rule without name")
+		}
+		if _, ok := cfg.Kafka[rule.Cluster]; rule.Cluster != "" && !ok {
+			return fmt.Errorf("tenant %s uses the unknown cluster %s", rule.Name, rule.Cluster)
+		}
+		if _, err := regexp.Compile(rule.Group); err != nil {
+			return fmt.Errorf("tenant %s: invalid group %s: %v", rule.Name, rule.Group, err)
+		}
+	}
+	if err := ValidateOwners(cfg.Owners); err != nil {
+		return err
+	}
+	if err := validateAlerting(cfg); err != nil {
+		return err
+	}
+	if cfg.Api.AdminListen != "" && (cfg.Api.Listen == "" || cfg.Api.AdminListen == cfg.Api.Listen) {
+		return errors.New("api.adminListen needs api.listen, on another address")
+	}
+	for _, token := range cfg.Api.Tokens {
+		if token.Token == "" {
+			return errors.New("api token without token")
+		}
+		if token.Role != "read" && token.Role != "admin" {
+			return fmt.Errorf("api token with the invalid role %s, read or admin", token.Role)
+		}
+	}
+	if cfg.Tracing.Endpoint != "" {
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid tracing endpoint %s, http(s)://host:port", cfg.Tracing.Endpoint)
+		}
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return errors.New("the tracing sampleRatio must be between 0 and 1")
+	}
+	for _, rule := range cfg.Enrich {
+		if rule.Tag == "" {
+			return errors.New("enrich rule without tag")
+		}
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("invalid enrich match %s: %v", rule.Match, err)
+		}
+	}
+	for _, sink := range cfg.Sinks {
+		if sink.Type == "" {
+			return errors.New("sink without type")
+		}
+		if _, _, err := sink.Window(); err != nil {
+			return fmt.Errorf("sink %s: %v", sink.Type, err)
+		}
+		if sink.MaxPointsPerSecond < 0 {
+			return fmt.Errorf("the maxPointsPerSecond of sink %s can't be negative", sink.Type)
+		}
+	}
+	for name, k := range cfg.Kafka {
+		for _, sink := range k.Sinks {
+			if sink.Type == "" {
+				return fmt.Errorf("kafka cluster %s has a sink without type", name)
+			}
+			if _, _, err := sink.Window(); err != nil {
+				return fmt.Errorf("kafka cluster %s sink %s: %v", name, sink.Type, err)
+			}
+			if sink.MaxPointsPerSecond < 0 {
+				return fmt.Errorf("the maxPointsPerSecond of kafka cluster %s sink %s can't be negative", name, sink.Type)
+			}
+		}
+		if ec := cfg.EvaluationOf(name); EngineRegistered != nil && !EngineRegistered(ec.Type) {
+			return fmt.Errorf("kafka cluster %s uses the unknown evaluation engine type %s, is its plugin loaded", name, ec.Type)
+		}
+		if BackendRegistered != nil && !BackendRegistered(k.Backend) {
+			return fmt.Errorf("kafka cluster %s uses the unknown backend %s, is its plugin loaded", name, k.Backend)
+		}
+		influxdb := cfg.InfluxdbOf(name)
+		if influxdb.Hosts == "" {
+			return fmt.Errorf("no influxdb hosts configured for kafka cluster %s", name)
+		}
+		if influxdb.MaxPointsPerSecond < 0 {
+			return fmt.Errorf("the influxdb maxPointsPerSecond of kafka cluster %s can't be negative", name)
+		}
+	}
+	return nil
+}
+
+// InfluxdbOf returns the influxdb of a cluster, the global one completed by the overrides of the cluster
+func (cfg *Config) InfluxdbOf(cluster string) InfluxdbConfig {
+	res := cfg.Influxdb
+	k, ok := cfg.Kafka[cluster]
+	if !ok || k.Influxdb == nil {
+		return res
+	}
+	if k.Influxdb.Db != "" {
+		res.Db = k.Influxdb.Db
+	}
+	if k.Influxdb.Hosts != "" {
+		res.Hosts = k.Influxdb.Hosts
+		// the credentials of the global influxdb are not sent to another one
+		res.Username, res.Pwd = "", ""
+	}
+	if k.Influxdb.Username != "" {
+		res.Username = k.Influxdb.Username
+	}
+	if k.Influxdb.Pwd != "" {
+		res.Pwd = k.Influxdb.Pwd
+	}
+	if k.Influxdb.MaxPointsPerSecond != 0 {
+		res.MaxPointsPerSecond = k.Influxdb.MaxPointsPerSecond
+	}
+	if k.Influxdb.WriteTimeoutSeconds != 0 {
+		res.WriteTimeoutSeconds = k.Influxdb.WriteTimeoutSeconds
+	}
+	return res
+}
+
+// SinksOf returns the sinks of a cluster, the global ones unless the cluster has its own
+func (cfg *Config) SinksOf(cluster string) []*SinkConfig {
+	if k, ok := cfg.Kafka[cluster]; ok && k.Sinks != nil {
+		return k.Sinks
+	}
+	return cfg.Sinks
+}
+
+// EvaluationOf returns the evaluation engine of a cluster, the global one unless the cluster has its own,
+// the window engine if neither is set
+func (cfg *Config) EvaluationOf(cluster string) *EngineConfig {
+	ec := cfg.Evaluation
+	if k, ok := cfg.Kafka[cluster]; ok && k.Evaluation != nil {
+		ec = k.Evaluation
+	}
+	if ec == nil || ec.Type == "" {
+		res := &EngineConfig{Type: "window"}
+		if ec != nil {
+			res.Options = ec.Options
+		}
+		return res
+	}
+	return ec
+}
+
+// AlertRoute sends the alerts of the groups of Cluster and Team, all if empty, whose severity is between
+// MinStatus (WARN by default) and MaxStatus (ERR by default) to Notifiers, during its OnCall windows if set,
+// but not during its QuietHours. The severity of an alert is the worst of the previous and the new status,
+// so a recovery goes where the alert went.
+type AlertRoute struct {
+	Cluster    string        `json:"cluster"`
+	Team       string        `json:"team"`
+	MinStatus  string        `json:"minStatus"`
+	MaxStatus  string        `json:"maxStatus"`
+	Notifiers  []string      `json:"notifiers"`
+	OnCall     []*TimeWindow `json:"onCall"`
+	QuietHours []*TimeWindow `json:"quietHours"`
+}
+
+// TimeWindow is From to To, "HH:MM", on Days, mon to sun, every day if empty, a window ending before it starts
+// ends the next day, e.g. {"days": ["fri"], "from": "22:00", "to": "07:00"} is friday night
+type TimeWindow struct {
+	Days []string `json:"days"`
+	From string   `json:"from"`
+	To   string   `json:"to"`
+}
+
+var weekdays = map[string]time.Weekday{"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday}
+
+// Contains reports whether the window contains t, in the location of t
+func (w *TimeWindow) Contains(t time.Time) bool {
+	from, to, err := w.minutes()
+	if err != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if from > to {
+		// the part after midnight belongs to the window of the day before
+		if minute >= from {
+			return w.on(day)
+		}
+		return minute < to && w.on((day+6)%7)
+	}
+	return minute >= from && minute < to && w.on(day)
+}
+
+func (w *TimeWindow) on(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *TimeWindow) minutes() (int, int, error) {
+	from, err := parseClock(w.From)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseClock(w.To)
+	return from, to, err
+}
+
+// parseClock returns the minutes since midnight of HH:MM, 24:00 included
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m > 0) {
+		return 0, fmt.Errorf("invalid time %q, HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+func (w *TimeWindow) validate() error {
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("invalid day %s, mon to sun", d)
+		}
+	}
+	_, _, err := w.minutes()
+	return err
+}
+
+func validateAlerting(cfg *Config) error {
+	if _, err := time.LoadLocation(cfg.Alerting.Timezone); cfg.Alerting.Timezone != "" && err != nil {
+		return fmt.Errorf("alerting: invalid timezone %s: %v", cfg.Alerting.Timezone, err)
+	}
+	rank := map[string]int{"OK": 0, "WARN": 1, "ERR": 4}
+	for i, route := range cfg.Alerting.Routes {
+		if len(route.Notifiers) == 0 {
+			return fmt.Errorf("alerting route %d has no notifiers", i)
+		}
+		min, ok := rank[route.MinStatus]
+		if !ok {
+			return fmt.Errorf("alerting route %d has the invalid minStatus %s, OK, WARN or ERR", i, route.MinStatus)
+		}
+		max, ok := rank[route.MaxStatus]
+		if !ok {
+			return fmt.Errorf("alerting route %d has the invalid maxStatus %s, OK, WARN or ERR", i, route.MaxStatus)
+		}
+		if min > max {
+			return fmt.Errorf("alerting route %d has a minStatus above its maxStatus", i)
+		}
+		for _, w := range append(append([]*TimeWindow{}, route.OnCall...), route.QuietHours...) {
+			if err := w.validate(); err != nil {
+				return fmt.Errorf("alerting route %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateOwners checks owner rules, of the config or of general.ownersSource
+func ValidateOwners(rules []*OwnerRule) error {
+	for _, rule := range rules {
+		if rule.Team == "" {
+			return errors.New("owner rule without team")
+		}
+		if _, err := regexp.Compile(rule.Group); err != nil {
+			return fmt.Errorf("owner %s: invalid group %s: %v", rule.Team, rule.Group, err)
+		}
+	}
+	return nil
 }
 
 func (cfg *Config) Init() {
+	if cfg.General.Log.Level == "" {
+		cfg.General.Log.Level = "info"
+	}
+	if cfg.General.StaleIntervals <= 0 {
+		cfg.General.StaleIntervals = 3
+	}
+	if cfg.General.EmitStateMaxGroups <= 0 {
+		cfg.General.EmitStateMaxGroups = 10000
+	}
+	if cfg.General.MaxSilenceSeconds <= 0 {
+		cfg.General.MaxSilenceSeconds = 300
+	}
+	if cfg.General.SweepTimeoutSeconds <= 0 {
+		cfg.General.SweepTimeoutSeconds = 30
+	}
+	if cfg.General.ShutdownTimeoutSeconds <= 0 {
+		cfg.General.ShutdownTimeoutSeconds = 30
+	}
+	if cfg.Influxdb.WriteTimeoutSeconds <= 0 {
+		cfg.Influxdb.WriteTimeoutSeconds = 10
+	}
+	if cfg.General.BackfillStepSeconds <= 0 {
+		cfg.General.BackfillStepSeconds = 60
+	}
+	if cfg.General.OutOfOrderMaxRewind <= 0 {
+		cfg.General.OutOfOrderMaxRewind = 1000
+	}
+	if cfg.General.StaleBrokerOffset == "" {
+		cfg.General.StaleBrokerOffset = "clamp"
+	}
+	if cfg.General.UnknownTopics == "" {
+		cfg.General.UnknownTopics = "drop"
+	}
+	if cfg.General.IdleRecheckSweeps <= 0 {
+		cfg.General.IdleRecheckSweeps = 6
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	for _, route := range cfg.Alerting.Routes {
+		if route.MinStatus == "" {
+			route.MinStatus = "WARN"
+		}
+		if route.MaxStatus == "" {
+			route.MaxStatus = "ERR"
+		}
+	}
+	if cfg.General.RebalanceStormMinutes <= 0 {
+		cfg.General.RebalanceStormMinutes = 10
+	}
+	if cfg.General.OffsetsRetentionMinutes <= 0 {
+		// the default of kafka since 2.0
+		cfg.General.OffsetsRetentionMinutes = 7 * 24 * 60
+	}
 	if cfg.ClientProfile == nil {
 		cfg.ClientProfile = make(map[string]*Profile)
 	}
@@ -67,12 +1000,77 @@ func (cfg *Config) Init() {
 			TLS:      false,
 		}
 	}
+	for _, p := range cfg.ClientProfile {
+		if p.TLSDisabledFields == "" {
+			p.TLSDisabledFields = "warn"
+		}
+	}
+
+	for _, slo := range cfg.SLOs {
+		if slo.WindowHours <= 0 {
+			slo.WindowHours = 30 * 24
+		}
+	}
+
+	for _, token := range cfg.Api.Tokens {
+		if token.Role == "" {
+			token.Role = "read"
+		}
+	}
 
 	for _, k := range cfg.Kafka {
 		if k.ClientProfile == "" {
 			k.ClientProfile = "default"
 		}
+		if k.PartitionSampling != nil && k.PartitionSampling.MinPartitions == 0 {
+			k.PartitionSampling.MinPartitions = 256
+		}
+		if k.Precision == "" {
+			k.Precision = "s"
+		}
+		if k.Flavor == "" {
+			k.Flavor = "kafka"
+		}
+		if k.Backend == "" {
+			k.Backend = "sarama"
+		}
+		if len(k.OffsetsTopics) == 0 {
+			k.OffsetsTopics = []*OffsetsTopicConfig{{Name: "__consumer_offsets"}}
+		}
+		for _, ot := range k.OffsetsTopics {
+			if ot.Codec == "" {
+				ot.Codec = "binary"
+			}
+		}
+		if k.Canary.Topic == "" {
+			k.Canary.Topic = "burrowx-canary"
+		}
+		if k.Canary.Group == "" {
+			k.Canary.Group = "burrowx-canary"
+		}
+		if k.Confluent.Bootstrap != "" {
+			k.Brokers = strings.TrimPrefix(k.Confluent.Bootstrap, "SASL_SSL://")
+			k.Sasl.Username = k.Confluent.ApiKey
+			k.Sasl.Password = k.Confluent.ApiSecret
+		}
+		if k.EventHubs.ConnectionString != "" {
+			k.Brokers = eventHubsBroker(k.EventHubs.ConnectionString)
+			k.Sasl.Username = "$ConnectionString"
+			k.Sasl.Password = k.EventHubs.ConnectionString
+		}
+	}
+}
+
+// eventHubsBroker returns the kafka endpoint of the namespace in an Event Hubs connection string,
+// Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=...;SharedAccessKey=...
+func eventHubsBroker(connectionString string) string {
+	for _, part := range strings.Split(connectionString, ";") {
+		if kv := strings.SplitN(part, "=", 2); len(kv) == 2 && strings.EqualFold(kv[0], "Endpoint") {
+			host := strings.TrimPrefix(kv[1], "sb://")
+			return strings.TrimSuffix(host, "/") + ":9093"
+		}
 	}
+	return ""
 }
 
 func errAndExit(err error) {
@@ -0,0 +1,144 @@
+// Code generated by gendocs.go; DO NOT EDIT.
+
+package config
+
+// name => comment of the named types of the config
+var typeDocs = map[string]string{
+	"AlertRoute":         "AlertRoute sends the alerts of the groups of Cluster and Team, all if empty, whose severity is between MinStatus (WARN by default) and MaxStatus (ERR by default) to Notifiers, during its OnCall windows if set, but not during its QuietHours. The severity of an alert is the worst of the previous and the new status, so a recovery goes where the alert went.",
+	"ApiToken":           "ApiToken grants access to the consumers of Tenants, or to everything and the cluster wide operations if empty, the read role (default) can only read, the admin role can change things too",
+	"ClusterSpec":        "ClusterSpec defines a cluster out of the config file, the spec of a KafkaMonitor resource",
+	"EnrichRule":         "EnrichRule applies to the points whose Tag matches the Match regexp, it drops them, or sets the tags of Set, whose values are expanded with the submatches, e.g. {\"tag\": \"consumer_group\", \"match\": \"^(\\\\w+)-\", \"set\": {\"team\": \"$1\"}}",
+	"GroupRewrite":       "GroupRewrite renames the groups matching Match to Replace, expanded with the submatches, e.g. {\"match\": \"^(\\\\w+)-[0-9a-f-]{36}$\", \"replace\": \"$1\"} collapses groups suffixed with a uuid",
+	"JSONSchema":         "JSONSchema is a JSON Schema (draft-07) of the config file",
+	"OffsetsTopicConfig": "OffsetsTopicConfig is a topic of offset commits and the codec of its records: binary (default), the format of __consumer_offsets, json or avro for the commits mirrored by other platforms, other codecs are registered by plugins",
+	"OwnerRule":          "OwnerRule assigns the groups matching the Group regexp, on the cluster Cluster or all clusters if empty, to Team, whose alerts only go to the Notifiers if set",
+	"PartitionSampling":  "PartitionSampling writes, for the topics of at least MinPartitions partitions, the consumer_metrics points of every Every-th partition and of the Worst partitions by their recent lag only, next to the aggregate point",
+	"SLO":                "SLO is met by a group of Group (a regexp, all groups if empty) while it's less than MaxTimeLag seconds behind, for Objective (e.g. 0.99) of the evaluations of the last WindowHours",
+	"TenantRule":         "TenantRule assigns the groups matching the Group regexp to Name, on the cluster Cluster or all clusters if empty",
+	"TimeWindow":         "TimeWindow is From to To, \"HH:MM\", on Days, mon to sun, every day if empty, a window ending before it starts ends the next day, e.g. {\"days\": [\"fri\"], \"from\": \"22:00\", \"to\": \"07:00\"} is friday night",
+}
+
+// struct => field => comment, the struct is a named type or the path of an anonymous struct
+var fieldDocs = map[string]map[string]string{
+	"ClusterSpec": {
+		"AlertRoutes": "alert routes of the cluster, after the ones of alerting, their cluster is the one of the spec",
+		"Kafka":       "the entry of the cluster, as in kafka",
+		"Profile":     "the client profile of the cluster instead of the clientProfile of its entry if set",
+	},
+	"Config": {
+		"Alerting":     "Alerting routes the alerts of the notifiers by severity and time of day",
+		"Enrich":       "Enrich rules rewrite the tags of the consumer_metrics points, or drop them, in order",
+		"Evaluation":   "Evaluation selects the engine deciding the statuses of the groups, window by default, other types are registered by plugins",
+		"Grafana":      "Grafana annotates the dashboards when the status of a group changes, disabled if url is empty",
+		"GroupRewrite": "GroupRewrite maps the raw group ids to logical names before they're evaluated and written, the first rule matching a group applies",
+		"Kafka":        "the name of a cluster is its id in the tags and the api, it should stay when its brokers change",
+		"Kubernetes":   "Kubernetes monitors the clusters of the KafkaMonitor resources (burrowx.io/v1alpha1) of a namespace too, added, restarted and removed as the resources change, see ClusterSpec for their spec",
+		"Owners":       "Owners assign the groups to the teams owning them, the first rule matching a group applies",
+		"SLOs":         "SLOs on the time lag of the groups, their compliance and burn rate are written every sweep",
+		"Sinks":        "Sinks receive the results of every sweep next to influxdb, their types are registered by plugins",
+		"Tenants":      "Tenants assign the groups to teams, the first rule matching a group applies, the groups no rule matches belong to the tenant of their cluster",
+		"Tracing":      "Tracing exports spans of the sweeps, the commit decoding, the writes and the canary to an OTLP/HTTP collector, disabled if endpoint is empty",
+	},
+	"Config.Alerting": {
+		"Timezone": "of the time windows of the routes, the local time by default, e.g. Europe/Paris",
+	},
+	"Config.Api": {
+		"AdminListen": "serves the admin endpoints, /v1/admin and the requests changing something, which Listen refuses then, e.g. on localhost while Listen is exposed to the dashboards",
+		"Listen":      "the api is disabled if empty",
+		"Peers":       "base urls of other burrowx instances, the /v1 queries merge their answers",
+		"Tokens":      "once set, every /v1 request needs one of these tokens as \"Authorization: Bearer <token>\"",
+	},
+	"Config.General": {
+		"AnomalyDetection":           "flag as WARN the groups whose lag is abnormally high for them, even if it's not growing steadily",
+		"BackfillMaxHours":           "after a downtime of the monitor, reconstruct the lag of the groups over its last BackfillMaxHours, one point every BackfillStepSeconds (60 by default), disabled if 0",
+		"BackfillStepSeconds":        "after a downtime of the monitor, reconstruct the lag of the groups over its last BackfillMaxHours, one point every BackfillStepSeconds (60 by default), disabled if 0",
+		"BrokerHealth":               "count the brokers, the under replicated and offline partitions and the controller changes at every metadata refresh, in the cluster health",
+		"CommitLatency":              "consume __consumer_offsets to measure the commit latency of the groups, how long after the commit timestamp the coordinator appended their commits",
+		"CompactedTopics":            "topic regexps of the compacted topics, on top of the ones whose described cleanup.policy is compact",
+		"Dedup":                      "skip the consumer_metrics points of partitions whose offsets didn't move, for at most MaxSilenceSeconds",
+		"DescribeTopicConfigs":       "describe the retention.ms and cleanup.policy of the topics, also done with FetchStartOffsets",
+		"DetectReassignments":        "refresh the metadata at every metadata refresh to detect the partitions being reassigned, and with SuppressReassigningLag their lag never makes a group WARN or ERR",
+		"DryRun":                     "run the whole pipeline but only log what would be written",
+		"EmitStateMaxGroups":         "groups whose last written points are kept for the three above, the least recent ones are forgotten past it",
+		"FetchStartOffsets":          "also fetch the log start offsets every sweep, and the retention of the topics, to know how much they retain",
+		"IdleEndOffsetSweeps":        "fetch the log end offset of the partitions which didn't move for IdleEndOffsetSweeps sweeps only every IdleRecheckSweeps sweeps (6 by default), the other sweeps reuse the last one, disabled if 0",
+		"IdleRecheckSweeps":          "fetch the log end offset of the partitions which didn't move for IdleEndOffsetSweeps sweeps only every IdleRecheckSweeps sweeps (6 by default), the other sweeps reuse the last one, disabled if 0",
+		"InstanceId":                 "tags the data of this instance, the hostname if empty",
+		"InventoryMinutes":           "refresh the inventory of the brokers and topics every InventoryMinutes, served by the api and written as info points, disabled if 0",
+		"LearnGroupsDir":             "observe the groups for LearnGroupsHours, then propose an allowlist of the groups committing regularly, kept with the accepted allowlist in LearnGroupsDir if set, disabled if 0",
+		"LearnGroupsHours":           "observe the groups for LearnGroupsHours, then propose an allowlist of the groups committing regularly, kept with the accepted allowlist in LearnGroupsDir if set, disabled if 0",
+		"MaxConcurrentSweeps":        "sweep each cluster at a random phase of the fetch interval, with a random jitter of up to SweepJitterPercent of the interval, and at most MaxConcurrentSweeps clusters at once, unlimited if 0",
+		"MaxSilenceSeconds":          "skip the consumer_metrics points of partitions whose offsets didn't move, for at most MaxSilenceSeconds",
+		"MinEmitIntervalSeconds":     "write at most one consumer_metrics point per partition every MinEmitIntervalSeconds, and skip it if its lag changed by MinLagDelta or less, for at most MaxSilenceSeconds too",
+		"MinLagDelta":                "write at most one consumer_metrics point per partition every MinEmitIntervalSeconds, and skip it if its lag changed by MinLagDelta or less, for at most MaxSilenceSeconds too",
+		"OffsetsRetentionMinutes":    "offsets.retention.minutes of the brokers, to report when the offsets of empty groups expire",
+		"OutOfOrderMaxRewind":        "a committed offset going back by at most this many messages is an out of order commit, not a deliberate rewind",
+		"OwnersSource":               "file or http(s) url of a json list of owner rules, replacing the owners of the config, reloaded every minute",
+		"Plugins":                    "go plugins (.so) loaded at startup, they register sink types",
+		"Proxy":                      "proxy to the brokers, influxdb and grafana, socks5://[user:pass@]host:port or http://[user:pass@]host:port, the http clients use the HTTP(S)_PROXY env vars if empty",
+		"RebalanceStormCount":        "flag as WARN the OK groups which rebalanced more than RebalanceStormCount times in RebalanceStormMinutes, disabled if 0",
+		"RebalanceStormMinutes":      "flag as WARN the OK groups which rebalanced more than RebalanceStormCount times in RebalanceStormMinutes, disabled if 0",
+		"RecordFile":                 "append the offsets of every sweep to this file, to replay them later",
+		"RetentionPressureThreshold": "flag as WARN the OK groups whose retention pressure is above this, e.g. 0.8, disabled if 0",
+		"ShardIndex":                 "split the groups of the clusters among Shards instances, this one monitors the groups of ShardIndex",
+		"Shards":                     "split the groups of the clusters among Shards instances, this one monitors the groups of ShardIndex",
+		"ShutdownTimeoutSeconds":     "the shutdown gives up on the sweeps, the importer and the sinks after this, 30 by default",
+		"SkewThreshold":              "flag as WARN the groups with a topic whose max partition lag is more than this times its mean, disabled if 0",
+		"StaleBrokerOffset":          "what to do with a committed offset ahead of the log end offset of the last sweep: clamp (default) it to the log end offset, drop the partition from the sweep, or flag its point",
+		"StaleIntervals":             "data older than StaleIntervals fetch intervals is flagged as stale",
+		"SuppressCompactedLag":       "the lag of the compacted topics never makes a group WARN or ERR",
+		"SuppressReassigningLag":     "refresh the metadata at every metadata refresh to detect the partitions being reassigned, and with SuppressReassigningLag their lag never makes a group WARN or ERR",
+		"SweepJitterPercent":         "sweep each cluster at a random phase of the fetch interval, with a random jitter of up to SweepJitterPercent of the interval, and at most MaxConcurrentSweeps clusters at once, unlimited if 0",
+		"SweepPhaseSpread":           "sweep each cluster at a random phase of the fetch interval, with a random jitter of up to SweepJitterPercent of the interval, and at most MaxConcurrentSweeps clusters at once, unlimited if 0",
+		"SweepTimeoutSeconds":        "a sweep taking longer is cancelled, with its requests in flight, 30 by default",
+		"UnknownTopics":              "what to do with the groups consuming a topic the cached metadata doesn't know yet, e.g. just created: drop (default) them until it does, counted, warn too, or refresh the metadata to monitor it at once",
+	},
+	"Config.Kafka": {
+		"AggregateOnly":     "write one consumer_metrics point per group and topic instead of one per partition",
+		"Aliases":           "other names the api accepts for the cluster, e.g. its name before a rename",
+		"Backend":           "the kafka client library the metadata, the list offsets and the consumption of the offsets topics go through, sarama (default), other backends are registered by plugins",
+		"Canary":            "Canary produces to and consumes from a dedicated topic to check the cluster end to end",
+		"Confluent":         "Confluent sets up a Confluent Cloud cluster from its bootstrap server and api key, the brokers and sasl are derived from it",
+		"DisplayName":       "shown to the humans, carried by the cluster_name tag and the api next to the id",
+		"DryRun":            "only log what would be written to the influxdb of the cluster, like general.dryRun",
+		"Evaluation":        "the evaluation engine of the cluster instead of the global one if set",
+		"EventHubs":         "EventHubs sets up the kafka endpoint of an Azure Event Hubs namespace from its connection string",
+		"Flavor":            "Flavor of the brokers, kafka (default), kraft for kafka without zookeeper or redpanda, it adjusts the protocol version and the checks which don't apply to them",
+		"Groups":            "monitor only these groups, e.g. the allowlist proposed by general.learnGroupsHours, which doesn't learn them then",
+		"Influxdb":          "the influxdb of the cluster, its empty fields are the ones of the global influxdb",
+		"OffsetsTopics":     "the topics of the offset commits read by general.commitLatency and general.backfillMaxHours, __consumer_offsets by default",
+		"PartitionSampling": "write the partition points of a sample of the partitions of the huge topics only",
+		"Precision":         "of the timestamps written to influxdb, s (default), ms, u or ns",
+		"Sinks":             "the sinks of the cluster instead of the global sinks if set, [] for none",
+		"Tenant":            "tenant of the groups of the cluster no tenant rule matches",
+		"Topics":            "monitor only these topics instead of the ones metadata lists, when the principal can't describe all topics",
+	},
+	"Config.Kubernetes": {
+		"Namespace": "of the resources, the namespace of the pod if empty",
+	},
+	"Config.Tracing": {
+		"Endpoint":    "base url of the collector, the spans are posted to its /v1/traces, e.g. http://localhost:4318",
+		"Headers":     "sent with every export, e.g. an authorization header",
+		"SampleRatio": "of the sweeps and probes traced, 1 (all) by default",
+	},
+	"InfluxdbConfig": {
+		"MaxPointsPerSecond":  "above this rate the consumer_metrics points of a group and topic are written as one aggregate point, unlimited if 0",
+		"WriteTimeoutSeconds": "a write taking longer is cancelled, 10 by default",
+	},
+	"LogConfig": {
+		"File":    "log to stderr if empty",
+		"Format":  "text or json",
+		"Modules": "module => level, overrides Level for the module",
+	},
+	"Profile": {
+		"DialTimeoutSeconds": "network and fetch tuning, sarama's defaults if 0",
+		"TLSDisabledFields":  "what to do with the tls fields set while tls is disabled: warn (default) to ignore them, error, or enable to enable tls",
+		"TLSSystemCA":        "trust the system CAs, next to the tlsCafilepath if set",
+	},
+	"SinkConfig": {
+		"Disable":            "RFC3339 timestamps, the sink only receives the sweeps from Enable until Disable, to cut over between sinks",
+		"Enable":             "RFC3339 timestamps, the sink only receives the sweeps from Enable until Disable, to cut over between sinks",
+		"MaxPointsPerSecond": "above this rate of partition offsets and statuses the sink only receives the statuses, unlimited if 0",
+		"Verify":             "counts what the sink receives and writes next to the influxdb points, for /v1/admin/migration",
+	},
+}
@@ -0,0 +1,159 @@
+//go:build ignore
+// +build ignore
+
+// gendocs writes docs_generated.go, the comments of the config structs of every file of the package, which are the
+// descriptions of the schema. Run go generate in config after changing a struct of the config.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+const output = "docs_generated.go"
+
+type docs struct {
+	fset *token.FileSet
+	// name => comment of the named types
+	types map[string]string
+	// struct => field => comment, the struct is a named type or the path of an anonymous struct, e.g. Config.General
+	fields map[string]map[string]string
+}
+
+func main() {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != output && name != "gendocs.go"
+	}, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d := &docs{fset: fset, types: make(map[string]string), fields: make(map[string]map[string]string)}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if doc := ts.Doc; doc != nil {
+						d.types[ts.Name.Name] = commentText(doc)
+					} else if gen.Doc != nil && len(gen.Specs) == 1 {
+						d.types[ts.Name.Name] = commentText(gen.Doc)
+					}
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						d.addStruct(ts.Name.Name, st)
+					}
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gendocs.go; DO NOT EDIT.\n\npackage config\n\n")
+	buf.WriteString("// name => comment of the named types of the config\nvar typeDocs = map[string]string{\n")
+	for _, name := range sortedKeys(d.types) {
+		fmt.Fprintf(&buf, "%q: %q,\n", name, d.types[name])
+	}
+	buf.WriteString("}\n\n// struct => field => comment, the struct is a named type or the path of an anonymous struct\n")
+	buf.WriteString("var fieldDocs = map[string]map[string]string{\n")
+	for _, st := range sortedKeys(d.fields) {
+		fmt.Fprintf(&buf, "%q: {\n", st)
+		for _, field := range sortedKeys(d.fields[st]) {
+			fmt.Fprintf(&buf, "%q: %q,\n", field, d.fields[st][field])
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// addStruct adds the comments of the fields of a struct, a field without one takes the comment of the field on
+// the line above if it names it, it documents them both, and the anonymous structs of its fields
+func (d *docs) addStruct(path string, st *ast.StructType) {
+	res := make(map[string]string)
+	var last string
+	lastLine := -1
+	for _, field := range st.Fields.List {
+		doc := ""
+		switch {
+		case field.Doc != nil:
+			doc = commentText(field.Doc)
+		case field.Comment != nil:
+			doc = commentText(field.Comment)
+		}
+		line := d.fset.Position(field.Pos()).Line
+		for _, name := range field.Names {
+			if doc != "" {
+				res[name.Name] = doc
+			} else if line == lastLine+1 && strings.Contains(last, name.Name) {
+				res[name.Name] = last
+			}
+			if inner := anonymousStruct(field.Type); inner != nil {
+				d.addStruct(path+"."+name.Name, inner)
+			}
+		}
+		if doc != "" || line != lastLine+1 {
+			last = doc
+		}
+		lastLine = d.fset.Position(field.End()).Line
+	}
+	if len(res) > 0 {
+		d.fields[path] = res
+	}
+}
+
+// anonymousStruct returns the struct a field type declares under its pointer, slice or map, nil if it's named
+func anonymousStruct(expr ast.Expr) *ast.StructType {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ArrayType:
+			expr = e.Elt
+		case *ast.MapType:
+			expr = e.Value
+		case *ast.StructType:
+			return e
+		default:
+			return nil
+		}
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func commentText(group *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
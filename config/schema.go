@@ -0,0 +1,170 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// the descriptions of the schema are the comments of the config structs, extracted into docs_generated.go
+//go:generate go run gendocs.go
+
+// JSONSchema is a JSON Schema (draft-07) of the config file
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type"`
+	Description          string                 `json:"description,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// Schema returns the schema of the config file with the types of the fields, their defaults, the values
+// Init sets when they're unset, and their descriptions, the comments of the structs
+func Schema() (*JSONSchema, error) {
+	// one element in every map and slice of structs, so Init sets the defaults of their fields too
+	cfg := &Config{}
+	fillCollections(reflect.ValueOf(cfg).Elem())
+	cfg.Init()
+
+	s := schemaOf(reflect.TypeOf(*cfg), "", reflect.ValueOf(*cfg))
+	s.Schema = "http://json-schema.org/draft-07/schema#"
+	s.Title = "burrowx config"
+	return s, nil
+}
+
+// schemaOf returns the schema of a type, path is the path of its struct in fieldDocs if it's anonymous,
+// def its value with the defaults
+func schemaOf(t reflect.Type, path string, def reflect.Value) *JSONSchema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if def.IsValid() {
+			def = def.Elem()
+		}
+	}
+	s := &JSONSchema{}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() != "" {
+			path = t.Name()
+		}
+		s.Type = "object"
+		s.Properties = make(map[string]*JSONSchema)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := jsonName(field)
+			if name == "" {
+				continue
+			}
+			var fieldDef reflect.Value
+			if def.IsValid() {
+				fieldDef = def.Field(i)
+			}
+			fs := schemaOf(field.Type, path+"."+field.Name, fieldDef)
+			if fs.Description = fieldDocs[path][field.Name]; fs.Description == "" {
+				fs.Description = typeDocs[namedType(field.Type)]
+			}
+			s.Properties[name] = fs
+		}
+	case reflect.Slice:
+		s.Type = "array"
+		s.Items = schemaOf(t.Elem(), path, firstElem(def))
+	case reflect.Map:
+		s.Type = "object"
+		s.AdditionalProperties = schemaOf(t.Elem(), path, firstElem(def))
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	default:
+		s.Type = "integer"
+	}
+	if t.Kind() != reflect.Struct && t.Kind() != reflect.Slice && t.Kind() != reflect.Map && def.IsValid() &&
+		def.Interface() != reflect.Zero(def.Type()).Interface() {
+		s.Default = def.Interface()
+	}
+	return s
+}
+
+// fillCollections adds a zero element to the nil maps, slices and pointers of structs under v
+func fillCollections(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() && v.Type().Elem().Kind() == reflect.Struct {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if !v.IsNil() {
+			fillCollections(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fillCollections(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.Len() == 0 && holdsStruct(v.Type().Elem()) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			fillCollections(elem)
+			v.Set(reflect.Append(v, elem))
+		}
+	case reflect.Map:
+		if v.Len() == 0 && holdsStruct(v.Type().Elem()) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			fillCollections(elem)
+			v.Set(reflect.MakeMap(v.Type()))
+			v.SetMapIndex(reflect.ValueOf("*"), elem)
+		}
+	}
+}
+
+func holdsStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// firstElem returns the element fillCollections added to a slice or map, the zero value if there is none
+func firstElem(v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Len() > 0 {
+			return v.Index(0)
+		}
+	case reflect.Map:
+		if elem := v.MapIndex(reflect.ValueOf("*")); elem.IsValid() {
+			return elem
+		}
+	}
+	return reflect.Value{}
+}
+
+// jsonName returns the key of a field in the config file, empty if it has none
+func jsonName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// namedType returns the name of the config type under the pointers, slices and maps of t, empty if it's unnamed
+func namedType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	return t.Name()
+}
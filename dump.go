@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	. "github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// dumpCmd fetches the lag of every group once and prints it
+func dumpCmd(args []string) error {
+	var cfgFile, cluster, format string
+	fs := newFlagSet("dump", &cfgFile)
+	fs.StringVar(&cluster, "cluster", "", "cluster to dump, all clusters if empty")
+	fs.StringVar(&format, "format", "table", "output format, table or json")
+	fs.Parse(args)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	cfg := ReadConfig(cfgFile)
+	if err := mylog.InitLogger(cfg.General.Log); err != nil {
+		return err
+	}
+	clusters := make([]string, 0, len(cfg.Kafka))
+	for name := range cfg.Kafka {
+		if cluster == "" || cluster == name {
+			clusters = append(clusters, name)
+		}
+	}
+	if len(clusters) == 0 {
+		return fmt.Errorf("unknown cluster %s", cluster)
+	}
+	sort.Strings(clusters)
+
+	var msgs []*monitor.ConsumerFullOffset
+	for _, name := range clusters {
+		client, err := monitor.NewKafkaClient(cfg, name)
+		if err != nil {
+			return err
+		}
+		groupOffsets, err := client.Dump(context.Background())
+		client.Close()
+		if err != nil {
+			return err
+		}
+		for _, offsets := range groupOffsets {
+			msgs = append(msgs, offsets...)
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].Cluster != msgs[j].Cluster {
+			return msgs[i].Cluster < msgs[j].Cluster
+		}
+		if msgs[i].Group != msgs[j].Group {
+			return msgs[i].Group < msgs[j].Group
+		}
+		return msgs[i].Topic < msgs[j].Topic
+	})
+
+	if format == "json" {
+		for _, msg := range msgs {
+			data, err := monitor.EncodeJSON(msg)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tGROUP\tTOPIC\tPARTITIONS\tLOGSIZE\tOFFSET\tLAG\tMAX LAG")
+	for _, msg := range msgs {
+		logsize, offset, lag, maxLag := summarize(msg)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", msg.Cluster, msg.Group, msg.Topic, len(msg.Partitions()), logsize, offset, lag, maxLag)
+	}
+	return w.Flush()
+}
+
+// summarize sums the offsets of the committed partitions of a group on a topic
+func summarize(msg *monitor.ConsumerFullOffset) (logsize, offset, lag, maxLag int64) {
+	for _, p := range msg.Partitions() {
+		if p.Offset < 0 {
+			continue
+		}
+		logsize += p.Logsize
+		offset += p.Offset
+		lag += p.Lag
+		if p.Lag > maxLag {
+			maxLag = p.Lag
+		}
+	}
+	return
+}
@@ -1,12 +1,127 @@
 package log
 
-import log "github.com/cihub/seelog"
+import (
+	"io"
+	"os"
+	"sync"
 
-//return main file path
-func InitLogger(cfgfile string) {
-	logger, err := log.LoggerFromConfigAsFile(cfgfile)
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+)
+
+var (
+	lock      sync.Mutex
+	out       io.Writer        = os.Stderr
+	formatter logrus.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	level                      = logrus.InfoLevel
+	//module => configured level
+	levels = map[string]logrus.Level{}
+	//module => logger
+	modules = map[string]*logrus.Logger{}
+	// all modules log at debug level while set, toggled by ToggleDebug
+	debug bool
+)
+
+// InitLogger applies the log config to the loggers of all modules, existing and future
+func InitLogger(cfg config.LogConfig) error {
+	lvl, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	lvls := make(map[string]logrus.Level, len(cfg.Modules))
+	for module, l := range cfg.Modules {
+		if lvls[module], err = logrus.ParseLevel(l); err != nil {
+			return err
+		}
+	}
+	var w io.Writer = os.Stderr
+	if cfg.File != "" {
+		if w, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return err
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	out, level, levels = w, lvl, lvls
+	if cfg.Format == "json" {
+		formatter = &logrus.JSONFormatter{}
+	} else {
+		formatter = &logrus.TextFormatter{FullTimestamp: true, DisableColors: cfg.File != ""}
+	}
+	for name, logger := range modules {
+		logger.Out = out
+		logger.Formatter = formatter
+		logger.SetLevel(levelOf(name))
+	}
+	return nil
+}
+
+// Module returns the logger of a module, tagged with the module name
+func Module(name string) *logrus.Entry {
+	lock.Lock()
+	defer lock.Unlock()
+	logger, ok := modules[name]
+	if !ok {
+		logger = logrus.New()
+		logger.Out = out
+		logger.Formatter = formatter
+		logger.SetLevel(levelOf(name))
+		modules[name] = logger
+	}
+	return logger.WithField("module", name)
+}
+
+// SetLevel changes the level of a module at runtime, or the default level of all modules if module is empty
+func SetLevel(module, l string) error {
+	lvl, err := logrus.ParseLevel(l)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if module == "" {
+		level = lvl
+	} else {
+		levels[module] = lvl
+	}
+	for name, logger := range modules {
+		logger.SetLevel(levelOf(name))
+	}
+	return nil
+}
+
+// Levels returns the current level of every module, the default level is keyed by an empty module
+func Levels() map[string]string {
+	lock.Lock()
+	defer lock.Unlock()
+	res := map[string]string{"": level.String()}
+	for name := range modules {
+		res[name] = levelOf(name).String()
+	}
+	for name := range levels {
+		res[name] = levelOf(name).String()
+	}
+	return res
+}
+
+// ToggleDebug switches all modules to debug level, or back to their levels, it returns whether debug is on
+func ToggleDebug() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	debug = !debug
+	for name, logger := range modules {
+		logger.SetLevel(levelOf(name))
+	}
+	return debug
+}
+
+func levelOf(name string) logrus.Level {
+	if debug {
+		return logrus.DebugLevel
+	}
+	if l, ok := levels[name]; ok {
+		return l
 	}
-	log.ReplaceLogger(logger)
+	return level
 }
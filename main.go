@@ -1,40 +1,211 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
-	"log"
+	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/sundy-li/burrowx/api"
 	. "github.com/sundy-li/burrowx/config"
 	mylog "github.com/sundy-li/burrowx/log"
 	"github.com/sundy-li/burrowx/monitor"
 )
 
 var (
-	cfgFile string
+	// set at build time by -ldflags "-X main.Version=... -X main.GitCommit=..."
+	Version   = "dev"
+	GitCommit = ""
 )
 
-func init() {
-	flag.StringVar(&cfgFile, "config", "config/server.json", "config file path")
-	flag.Parse()
+type command struct {
+	usage string
+	run   func(args []string) error
 }
+
+var commands = map[string]*command{
+	"run":             {"run the monitor daemon (default)", runCmd},
+	"validate-config": {"check the config file and exit", validateConfigCmd},
+	"config-schema":   {"print the json schema of the config file, with the defaults and descriptions of the fields", configSchemaCmd},
+	"dump":            {"print the lag of every group once and exit", dumpCmd},
+	"preflight":       {"check the clusters and sinks are reachable and allowed, and print a readiness report", preflightCmd},
+	"top":             {"watch the lag of the groups, or the partitions of one group", topCmd},
+	"replay":          {"replay offsets recorded by run --record through the evaluator and importer", replayCmd},
+	"state":           {"export or import the in-memory state of a running burrowx, or compare two exports: state export|import|diff", stateCmd},
+	"version":         {"print the version and build info", versionCmd},
+}
+
 func main() {
-	cfg := ReadConfig(cfgFile)
-	mylog.InitLogger(cfg.General.Logconfig)
+	monitor.Version = Version
+	monitor.GitCommit = GitCommit
+	if err := monitor.InjectFaults(os.Getenv("BURROWX_FAULTS")); err != nil {
+		fmt.Fprintf(os.Stderr, "burrowx: %v\n", err)
+		os.Exit(2)
+	}
+	name, args := "run", os.Args[1:]
+	// `burrowx --config xx` without subcommand still runs the daemon
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "burrowx %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
 
-	log.Printf("burrowx started,using server config:%s, logfile cfg:%s\n", cfgFile, cfg.General.Logconfig)
-	log.Printf("You could press [Ctrl+c] to stop burrowx\n")
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: burrowx <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+}
+
+// newFlagSet returns the flags of a command, with the config flag every command takes
+func newFlagSet(name string, cfgFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("burrowx "+name, flag.ExitOnError)
+	fs.StringVar(cfgFile, "config", "config/server.json", "config file path")
+	return fs
+}
+
+func runCmd(args []string) error {
+	var cfgFile string
+	var dryRun bool
+	fs := newFlagSet("run", &cfgFile)
+	var recordFile string
+	fs.BoolVar(&dryRun, "dry-run", false, "don't write to influxdb, log a summary of the points instead")
+	fs.StringVar(&recordFile, "record", "", "append the offsets of every sweep to this file")
+	fs.Parse(args)
+
+	return serve(func(svc service) error {
+		cfg := ReadConfig(cfgFile)
+		cfg.General.DryRun = cfg.General.DryRun || dryRun
+		if recordFile != "" {
+			cfg.General.RecordFile = recordFile
+		}
+		if err := mylog.InitLogger(cfg.General.Log); err != nil {
+			return err
+		}
+		log := mylog.Module("main")
+
+		log.Infof("burrowx %s started,using server config:%s", Version, cfgFile)
+		log.Infof("You could press [Ctrl+c] to stop burrowx")
+
+		fetcher, err := monitor.NewFetcher(cfg)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fetcher.Start(ctx)
+
+		var server *api.Server
+		if cfg.Api.Listen != "" {
+			server = api.NewServer(cfg, fetcher)
+			if err := server.Start(); err != nil {
+				return err
+			}
+		}
+		go ToggleDebugOnSignal()
+
+		svc.ready(fetcher.StaleClusters)
+		svc.wait()
+		svc.stopping()
+		if server != nil {
+			server.Stop()
+		}
+		stopCtx, stop := context.WithTimeout(context.Background(), time.Duration(cfg.General.ShutdownTimeoutSeconds)*time.Second)
+		defer stop()
+		if err := fetcher.Stop(stopCtx); err != nil {
+			log.Warnf("Cannot stop burrowx cleanly: %v", err)
+		}
+		log.Infof("signal catched,burrowx will be shutdown, goodbye")
+		return nil
+	})
+}
 
-	fetcher, err := monitor.NewFetcher(cfg)
+func validateConfigCmd(args []string) error {
+	var cfgFile string
+	newFlagSet("validate-config", &cfgFile).Parse(args)
+
+	cfg, err := LoadConfig(cfgFile)
+	if err != nil {
+		return err
+	}
+	// the evaluation engines of the plugins are checked too
+	if err := monitor.LoadPlugins(cfg.General.Plugins); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid, %d kafka clusters configured\n", cfgFile, len(cfg.Kafka))
+	return nil
+}
+
+func configSchemaCmd(args []string) error {
+	flag.NewFlagSet("burrowx config-schema", flag.ExitOnError).Parse(args)
+	schema, err := Schema()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func replayCmd(args []string) error {
+	var cfgFile, file string
+	var speed float64
+	var dryRun bool
+	fs := newFlagSet("replay", &cfgFile)
+	fs.StringVar(&file, "file", "", "file recorded by run --record")
+	fs.Float64Var(&speed, "speed", 1, "replay speed relative to the recording, 0 for as fast as possible")
+	fs.BoolVar(&dryRun, "dry-run", false, "don't write to influxdb, log a summary of the points instead")
+	fs.Parse(args)
+	if file == "" {
+		return fmt.Errorf("no file to replay")
+	}
+
+	cfg := ReadConfig(cfgFile)
+	cfg.General.DryRun = cfg.General.DryRun || dryRun
+	if err := mylog.InitLogger(cfg.General.Log); err != nil {
+		return err
+	}
+	f, err := os.Open(file)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer f.Close()
+	return monitor.Replay(cfg, f, speed)
+}
+
+func versionCmd(args []string) error {
+	fmt.Printf("burrowx %s\n", Version)
+	if GitCommit != "" {
+		fmt.Printf("git commit: %s\n", GitCommit)
 	}
-	fetcher.Start()
-	WaitForExitSign()
-	fetcher.Stop()
-	log.Printf("signal catched,burrowx will be shutdown, goodbye")
+	fmt.Printf("go version: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
 }
 
 func WaitForExitSign() {
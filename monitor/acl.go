@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// refreshTopics looks up the partitions of the listed topics into topicMap, a topic the principal may not
+// describe is reported instead of silently missing as with the full metadata
+func (client *KafkaClient) refreshTopics(topics []string, topicMap map[string]int) {
+	if err := client.backend.RefreshMetadata(topics...); err != nil {
+		client.warnLimiter.warnf(client.log, "topics-metadata", "Cannot refresh the metadata of the listed topics: %v", err)
+	}
+	for _, topic := range topics {
+		partitions, err := client.backend.Partitions(topic)
+		if err != nil {
+			client.warnLimiter.warnf(client.failed(client.log.WithField("topic", topic), "", err), "topic-metadata:"+topic,
+				"Cannot describe the listed topic: %v, check it exists and the Describe ACL of the topic", err)
+			continue
+		}
+		topicMap[topic] = len(partitions)
+	}
+}
+
+func isAuthorizationError(err error) bool {
+	switch err {
+	case sarama.ErrTopicAuthorizationFailed, sarama.ErrGroupAuthorizationFailed, sarama.ErrClusterAuthorizationFailed:
+		return true
+	}
+	return false
+}
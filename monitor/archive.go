@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterSink("archive", newArchiveSink)
+}
+
+// archiveSink writes the offsets and statuses of every sweep to gzipped json lines files, one file per cluster
+// and rotation period, for long term retention in an object store, e.g. synced to s3 or gcs, and queried
+// with athena or bigquery, which both read gzipped json lines. A file is only renamed to its final name
+// once complete, the sync never picks a partial file.
+type archiveSink struct {
+	dir     string
+	cluster string
+	rotate  time.Duration
+
+	start time.Time
+	f     *os.File
+	gz    *gzip.Writer
+	w     *bufio.Writer
+}
+
+// newArchiveSink takes the dir option and rotateMinutes, 60 by default
+func newArchiveSink(cluster string, options map[string]string) (Sink, error) {
+	s := &archiveSink{dir: options["dir"], cluster: cluster, rotate: time.Hour}
+	if s.dir == "" {
+		return nil, errors.New("no dir")
+	}
+	if m := options["rotateMinutes"]; m != "" {
+		minutes, err := strconv.Atoi(m)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("invalid rotateMinutes %s", m)
+		}
+		s.rotate = time.Duration(minutes) * time.Minute
+	}
+	return s, os.MkdirAll(s.dir, 0755)
+}
+
+func (s *archiveSink) Name() string { return "archive" }
+
+func (s *archiveSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	now := clockNow()
+	if s.f != nil && now.Sub(s.start) >= s.rotate {
+		if err := s.Close(); err != nil {
+			return err
+		}
+	}
+	if s.f == nil {
+		if err := s.open(now); err != nil {
+			return err
+		}
+	}
+	for _, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			if err := s.write(msg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, status := range statuses {
+		if err := s.write(status); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+func (s *archiveSink) write(v interface{}) error {
+	data, err := EncodeJSON(v)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *archiveSink) open(now time.Time) error {
+	f, err := os.Create(filepath.Join(s.dir, s.fileName(now)+".tmp"))
+	if err != nil {
+		return err
+	}
+	s.start, s.f = now, f
+	s.gz = gzip.NewWriter(f)
+	s.w = bufio.NewWriter(s.gz)
+	return nil
+}
+
+func (s *archiveSink) fileName(start time.Time) string {
+	return fmt.Sprintf("burrowx-%s-%s.jsonl.gz", s.cluster, start.UTC().Format("20060102T150405Z"))
+}
+
+// Close completes the current file
+func (s *archiveSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	defer func() { s.f = nil }()
+	s.w.Flush()
+	if err := s.gz.Close(); err != nil {
+		s.f.Close()
+		return err
+	}
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, s.fileName(s.start))
+	return os.Rename(name+".tmp", name)
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GroupAssignment maps the partitions of a group to the members owning them at the last metadata refresh
+type GroupAssignment struct {
+	Cluster string              `json:"cluster"`
+	Group   string              `json:"group"`
+	State   string              `json:"state"`
+	Members []*MemberAssignment `json:"members"`
+	// partitions of the assigned topics no member owns
+	Unassigned []*AssignedPartition `json:"unassigned"`
+}
+
+// MemberAssignment is a member of a group with its partitions, the most lagging first, none if it owns none
+type MemberAssignment struct {
+	MemberId   string               `json:"member_id"`
+	ClientId   string               `json:"client_id"`
+	ClientHost string               `json:"client_host"`
+	TotalLag   int64                `json:"total_lag"`
+	Partitions []*AssignedPartition `json:"partitions"`
+}
+
+// AssignedPartition is a partition with its lag at the last sweep, -1 if it has none
+type AssignedPartition struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Lag       int64  `json:"lag"`
+}
+
+// Assignment returns the assignment of a group of a cluster
+func (f *Fetcher) Assignment(cluster, group string) (*GroupAssignment, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Assignment(group)
+}
+
+// Assignment returns the members of the group with the partitions they own, the most lagging first, then the
+// idle members owning none. It takes the group of the metadata, its lag is the lag of its logical group.
+func (client *KafkaClient) Assignment(group string) (*GroupAssignment, error) {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	state, ok := client.groupState[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown group %s", group)
+	}
+	var last *Evaluation
+	if window := client.evaluator.windows[rewriteGroup(client.groupRewrites, group)]; len(window) > 0 {
+		last = window[len(window)-1]
+	}
+	lagOf := func(topic string, partition int32) int64 {
+		if last == nil {
+			return -1
+		}
+		if offset, ok := last.offsets[topic][partition]; ok && offset.Offset >= 0 {
+			return offset.Lag
+		}
+		return -1
+	}
+
+	a := &GroupAssignment{Cluster: client.cluster, Group: group, State: state, Members: []*MemberAssignment{}, Unassigned: []*AssignedPartition{}}
+	members := make(map[string]*MemberAssignment)
+	for _, member := range client.members[group] {
+		ma := &MemberAssignment{MemberId: member.MemberId, ClientId: member.ClientId, ClientHost: member.ClientHost, Partitions: []*AssignedPartition{}}
+		members[member.MemberId] = ma
+		a.Members = append(a.Members, ma)
+	}
+	for topic, partitions := range client.partitionOwner[group] {
+		owned := make(map[int32]bool, len(partitions))
+		for partition, member := range partitions {
+			owned[partition] = true
+			ma, ok := members[member.MemberId]
+			if !ok {
+				ma = &MemberAssignment{MemberId: member.MemberId, ClientId: member.ClientId, ClientHost: member.ClientHost, Partitions: []*AssignedPartition{}}
+				members[member.MemberId] = ma
+				a.Members = append(a.Members, ma)
+			}
+			p := &AssignedPartition{Topic: topic, Partition: partition, Lag: lagOf(topic, partition)}
+			ma.Partitions = append(ma.Partitions, p)
+			if p.Lag > 0 {
+				ma.TotalLag += p.Lag
+			}
+		}
+		for i := 0; i < client.topicMap[topic]; i++ {
+			if !owned[int32(i)] {
+				a.Unassigned = append(a.Unassigned, &AssignedPartition{Topic: topic, Partition: int32(i), Lag: lagOf(topic, int32(i))})
+			}
+		}
+	}
+	byLag := func(partitions []*AssignedPartition) {
+		sort.Slice(partitions, func(i, j int) bool {
+			if partitions[i].Lag != partitions[j].Lag {
+				return partitions[i].Lag > partitions[j].Lag
+			}
+			if partitions[i].Topic != partitions[j].Topic {
+				return partitions[i].Topic < partitions[j].Topic
+			}
+			return partitions[i].Partition < partitions[j].Partition
+		})
+	}
+	for _, ma := range a.Members {
+		byLag(ma.Partitions)
+	}
+	byLag(a.Unassigned)
+	sort.Slice(a.Members, func(i, j int) bool {
+		if idle := len(a.Members[i].Partitions) == 0; idle != (len(a.Members[j].Partitions) == 0) {
+			return !idle
+		}
+		if a.Members[i].TotalLag != a.Members[j].TotalLag {
+			return a.Members[i].TotalLag > a.Members[j].TotalLag
+		}
+		return a.Members[i].MemberId < a.Members[j].MemberId
+	})
+	return a, nil
+}
@@ -0,0 +1,394 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// avroCodec decodes the commits of avro records in the wire format of the Confluent schema registry, a zero
+// byte, the id of the schema and the avro binary, their schemas are fetched from the registry once per id.
+// A key which isn't in the wire format is only a partitioning key.
+//
+// A failed fetch is retried after a backoff doubling from 1s to 5m, the records of the id fail to decode
+// meanwhile, so a registry down doesn't stall the consumption of the offsets topics.
+type avroCodec struct {
+	fields   fieldMapping
+	registry string
+	username string
+	password string
+	http     *http.Client
+
+	lock sync.Mutex
+	//schema id => its fetch, done or in flight
+	schemas map[int32]*schemaFetch
+}
+
+// schemaFetch is the fetch of a schema from the registry, shared by the records of its id
+type schemaFetch struct {
+	// closed once schema or err is set
+	done   chan struct{}
+	schema *avroSchema
+	err    error
+	// consecutive failures of the id, and when to retry after the last one
+	failures int
+	retryAt  time.Time
+}
+
+const maxSchemaBackoff = 5 * time.Minute
+
+// newAvroCodec takes the schemaRegistry url option, its basic auth username and password, tlsCaFile for a private
+// CA, and the field options of newFieldMapping
+func newAvroCodec(options map[string]string) (OffsetCodec, error) {
+	c := &avroCodec{
+		fields:   newFieldMapping(options),
+		registry: strings.TrimSuffix(options["schemaRegistry"], "/"),
+		username: options["username"],
+		password: options["password"],
+		schemas:  make(map[int32]*schemaFetch),
+	}
+	if c.registry == "" {
+		return nil, errors.New("no schemaRegistry")
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if file := options["tlsCaFile"]; file != "" {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", file)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	c.http = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return c, nil
+}
+
+func (c *avroCodec) Decode(key, value []byte) (*OffsetRecord, error) {
+	var keyFields map[string]interface{}
+	if len(key) >= 5 && key[0] == 0 {
+		fields, err := c.decode(key)
+		if err != nil {
+			return nil, fmt.Errorf("key: %v", err)
+		}
+		keyFields = fields
+	}
+	if value == nil {
+		return c.fields.record(keyFields, nil)
+	}
+	if len(value) < 5 || value[0] != 0 {
+		return nil, errors.New("value not in the wire format of the schema registry")
+	}
+	valueFields, err := c.decode(value)
+	if err != nil {
+		return nil, err
+	}
+	return c.fields.record(keyFields, valueFields)
+}
+
+// decode decodes a record in the wire format, whose schema must be a record
+func (c *avroCodec) decode(b []byte) (map[string]interface{}, error) {
+	schema, err := c.schema(int32(binary.BigEndian.Uint32(b[1:5])))
+	if err != nil {
+		return nil, err
+	}
+	d := &avroDecoder{b: b[5:]}
+	v := d.decode(schema)
+	if d.err != nil {
+		return nil, d.err
+	}
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the schema is a %s, not a record", schema.typ)
+	}
+	return fields, nil
+}
+
+// schema returns the schema of an id, fetched from the registry the first time, one fetch at a time per id
+// and outside the lock, so the records of the known ids don't wait for it
+func (c *avroCodec) schema(id int32) (*avroSchema, error) {
+	c.lock.Lock()
+	f, ok := c.schemas[id]
+	if ok {
+		select {
+		case <-f.done:
+			// the backoff of a failed fetch is over, the record refetches it
+			ok = f.err == nil || clockNow().Before(f.retryAt)
+		default:
+		}
+	}
+	if !ok {
+		failures := 0
+		if f != nil {
+			failures = f.failures
+		}
+		f = &schemaFetch{done: make(chan struct{}), failures: failures}
+		c.schemas[id] = f
+		c.lock.Unlock()
+		if f.schema, f.err = c.fetchSchema(id); f.err != nil {
+			f.failures++
+			f.retryAt = clockNow().Add(schemaBackoff(f.failures))
+		}
+		close(f.done)
+		return f.schema, f.err
+	}
+	c.lock.Unlock()
+	<-f.done
+	return f.schema, f.err
+}
+
+// schemaBackoff returns how long to wait before refetching a schema after its failures
+func schemaBackoff(failures int) time.Duration {
+	if failures > 9 {
+		return maxSchemaBackoff
+	}
+	if backoff := time.Second << uint(failures-1); backoff < maxSchemaBackoff {
+		return backoff
+	}
+	return maxSchemaBackoff
+}
+
+// fetchSchema fetches and parses the schema of an id from the registry
+func (c *avroCodec) fetchSchema(id int32) (*avroSchema, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", c.registry, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema registry answered %s for the schema %d: %s", resp.Status, id, body)
+	}
+	var res struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(res.Schema), &doc); err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+	schema, err := parseAvroSchema(doc, make(map[string]*avroSchema))
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+	return schema, nil
+}
+
+// avroSchema is a parsed avro schema, typ is a primitive type, record, enum, array, map, fixed or union
+type avroSchema struct {
+	typ     string
+	fields  []*avroField
+	symbols []string
+	// of the items of an array or the values of a map
+	items *avroSchema
+	size  int
+	union []*avroSchema
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+}
+
+// parseAvroSchema parses the json of a schema, names holds the named types defined so far
+func parseAvroSchema(doc interface{}, names map[string]*avroSchema) (*avroSchema, error) {
+	switch v := doc.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{typ: v}, nil
+		}
+		if named, ok := names[v]; ok {
+			return named, nil
+		}
+		return nil, fmt.Errorf("unknown type %s", v)
+	case []interface{}:
+		s := &avroSchema{typ: "union"}
+		for _, branch := range v {
+			bs, err := parseAvroSchema(branch, names)
+			if err != nil {
+				return nil, err
+			}
+			s.union = append(s.union, bs)
+		}
+		return s, nil
+	case map[string]interface{}:
+		typ, _ := v["type"].(string)
+		s := &avroSchema{typ: typ}
+		if name, ok := v["name"].(string); ok {
+			names[name] = s
+			if ns, ok := v["namespace"].(string); ok && ns != "" && !strings.Contains(name, ".") {
+				names[ns+"."+name] = s
+			}
+			if i := strings.LastIndex(name, "."); i >= 0 {
+				names[name[i+1:]] = s
+			}
+		}
+		switch typ {
+		case "record", "error":
+			s.typ = "record"
+			fields, _ := v["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				name, _ := field["name"].(string)
+				fs, err := parseAvroSchema(field["type"], names)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %v", name, err)
+				}
+				s.fields = append(s.fields, &avroField{name: name, schema: fs})
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				s.symbols = append(s.symbols, fmt.Sprint(symbol))
+			}
+		case "array", "map":
+			key := "items"
+			if typ == "map" {
+				key = "values"
+			}
+			items, err := parseAvroSchema(v[key], names)
+			if err != nil {
+				return nil, err
+			}
+			s.items = items
+		case "fixed":
+			size, _ := v["size"].(float64)
+			s.size = int(size)
+		default:
+			// a primitive type with a logical type, e.g. {"type": "long", "logicalType": "timestamp-millis"}
+			return parseAvroSchema(v["type"], names)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid schema %v", doc)
+}
+
+// avroDecoder reads the avro binary encoding, the records are decoded as maps, int as int32, long as int64,
+// float and double as float64, bytes, fixed and enum as strings
+type avroDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *avroDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		if d.err == nil {
+			d.err = errors.New("truncated avro record")
+		}
+		return make([]byte, 8)
+	}
+	res := d.b[:n]
+	d.b = d.b[n:]
+	return res
+}
+
+// long reads a zigzag varint
+func (d *avroDecoder) long() int64 {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b := d.next(1)[0]
+		if d.err != nil {
+			return 0
+		}
+		u |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int64(u>>1) ^ -int64(u&1)
+		}
+	}
+	d.err = errors.New("invalid avro varint")
+	return 0
+}
+
+func (d *avroDecoder) decode(s *avroSchema) interface{} {
+	if d.err != nil {
+		return nil
+	}
+	switch s.typ {
+	case "null":
+		return nil
+	case "boolean":
+		return d.next(1)[0] != 0
+	case "int":
+		return int32(d.long())
+	case "long":
+		return d.long()
+	case "float":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(d.next(4))))
+	case "double":
+		return math.Float64frombits(binary.LittleEndian.Uint64(d.next(8)))
+	case "bytes", "string":
+		return string(d.next(int(d.long())))
+	case "fixed":
+		return string(d.next(s.size))
+	case "enum":
+		i := int(d.long())
+		if i < 0 || i >= len(s.symbols) {
+			d.err = fmt.Errorf("enum index %d out of range", i)
+			return nil
+		}
+		return s.symbols[i]
+	case "union":
+		i := int(d.long())
+		if i < 0 || i >= len(s.union) {
+			d.err = fmt.Errorf("union index %d out of range", i)
+			return nil
+		}
+		return d.decode(s.union[i])
+	case "record":
+		fields := make(map[string]interface{}, len(s.fields))
+		for _, f := range s.fields {
+			fields[f.name] = d.decode(f.schema)
+		}
+		return fields
+	case "array", "map":
+		var items []interface{}
+		entries := make(map[string]interface{})
+		for d.err == nil {
+			n := d.long()
+			if n == 0 {
+				break
+			}
+			if n < 0 {
+				// the block size in bytes follows a negative count
+				n = -n
+				d.long()
+			}
+			for i := int64(0); i < n && d.err == nil; i++ {
+				if s.typ == "map" {
+					key := string(d.next(int(d.long())))
+					entries[key] = d.decode(s.items)
+				} else {
+					items = append(items, d.decode(s.items))
+				}
+			}
+		}
+		if s.typ == "map" {
+			return entries
+		}
+		return items
+	}
+	d.err = fmt.Errorf("unsupported avro type %s", s.typ)
+	return nil
+}
@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/sundy-li/burrowx/config"
+)
+
+func init() {
+	RegisterBackend("sarama", newSaramaBackend)
+	config.BackendRegistered = backendRegistered
+}
+
+// Backend is the kafka client library a cluster is monitored with, kafka.<cluster>.backend, sarama by default.
+// The metadata of the topics, the list offsets of the sweeps, the backfill and the commit latency, and the
+// consumption of the offsets topics go through it. The other requests, the committed offsets and the groups,
+// the admin requests and the canary, are sarama's. A backend must be safe for concurrent use.
+type Backend interface {
+	// Topics returns the topics of the cached metadata
+	Topics() ([]string, error)
+	// Partitions returns the partitions of a topic of the cached metadata
+	Partitions(topic string) ([]int32, error)
+	// RefreshMetadata refreshes the cached metadata of the topics, of all topics if none
+	RefreshMetadata(topics ...string) error
+	// Leader returns the id and address of the leader of a partition
+	Leader(topic string, partition int32) (int32, string, error)
+	// ListOffsets sends one list offsets request to a broker for the offsets at time of the partitions, topic =>
+	// partitions, time is a timestamp(ms), sarama.OffsetNewest or sarama.OffsetOldest. It returns topic =>
+	// partition => offset, an error is the failure of the request, the failure of a partition is its Err.
+	ListOffsets(ctx context.Context, broker int32, partitions map[string][]int32, time int64) (map[string]map[int32]PartitionOffset, error)
+	// GetOffset returns the offset at time of a partition, from its leader
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+	// ConsumePartition consumes a partition from offset, until the consumer is closed
+	ConsumePartition(topic string, partition int32, offset int64) (PartitionConsumer, error)
+	// Close releases the connections and consumers of the backend, not the sarama client it was created with
+	Close() error
+}
+
+// PartitionOffset is the offset of a partition in a list offsets response
+type PartitionOffset struct {
+	// -1 if the response has none
+	Offset int64
+	// the error of the partition, nil if none
+	Err error
+}
+
+// PartitionConsumer consumes a partition, a sarama.PartitionConsumer is one
+type PartitionConsumer interface {
+	Messages() <-chan *sarama.ConsumerMessage
+	Errors() <-chan *sarama.ConsumerError
+	// AsyncClose closes Messages once the consumer stopped
+	AsyncClose()
+	Close() error
+}
+
+// BackendFactory creates the backend of a cluster, client is the sarama client of the cluster, for the
+// backends built on it
+type BackendFactory func(cfg *config.Config, cluster string, client sarama.Client) (Backend, error)
+
+var (
+	backendLock      sync.Mutex
+	backendFactories = make(map[string]BackendFactory)
+)
+
+// RegisterBackend makes a kafka client backend available to the config, like RegisterSink, and panics if the
+// name is registered twice. A plugin can register a backend on a library the vendored tree can't build, e.g.
+// franz-go, which needs a newer Go.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	if _, ok := backendFactories[name]; ok {
+		panic("backend registered twice: " + name)
+	}
+	backendFactories[name] = factory
+}
+
+// backendRegistered reports whether a backend is registered, for the validation of the config
+func backendRegistered(name string) bool {
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	_, ok := backendFactories[name]
+	return ok
+}
+
+func newBackend(cfg *config.Config, cluster string, client sarama.Client) (Backend, error) {
+	name := cfg.Kafka[cluster].Backend
+	if name == "" {
+		name = "sarama"
+	}
+	backendLock.Lock()
+	factory, ok := backendFactories[name]
+	backendLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %s, is its plugin loaded", name)
+	}
+	return factory(cfg, cluster, client)
+}
+
+// saramaBackend is the default backend, on the sarama client of the cluster
+type saramaBackend struct {
+	client sarama.Client
+}
+
+func newSaramaBackend(cfg *config.Config, cluster string, client sarama.Client) (Backend, error) {
+	return &saramaBackend{client: client}, nil
+}
+
+func (b *saramaBackend) Topics() ([]string, error) { return b.client.Topics() }
+
+func (b *saramaBackend) Partitions(topic string) ([]int32, error) { return b.client.Partitions(topic) }
+
+func (b *saramaBackend) RefreshMetadata(topics ...string) error {
+	return b.client.RefreshMetadata(topics...)
+}
+
+func (b *saramaBackend) Leader(topic string, partition int32) (int32, string, error) {
+	broker, err := b.client.Leader(topic, partition)
+	if err != nil {
+		return 0, "", err
+	}
+	return broker.ID(), broker.Addr(), nil
+}
+
+// ListOffsets sends the version 0 of the request for OffsetNewest and OffsetOldest, as the sweeps always did,
+// and the version 1 for a timestamp. A failed request closes the connection to the broker, reopened by the
+// next Leader.
+func (b *saramaBackend) ListOffsets(ctx context.Context, id int32, partitions map[string][]int32, time int64) (map[string]map[int32]PartitionOffset, error) {
+	var broker *sarama.Broker
+	for _, br := range b.client.Brokers() {
+		if br.ID() == id {
+			broker = br
+			break
+		}
+	}
+	if broker == nil {
+		return nil, fmt.Errorf("unknown broker %d", id)
+	}
+	request := &sarama.OffsetRequest{}
+	if time >= 0 {
+		request.Version = 1
+	}
+	for topic, ps := range partitions {
+		for _, partition := range ps {
+			request.AddBlock(topic, partition, time, 1)
+		}
+	}
+	var response *sarama.OffsetResponse
+	err := withContext(ctx, func() (err error) {
+		response, err = broker.GetAvailableOffsets(request)
+		return
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			_ = broker.Close()
+		}
+		return nil, err
+	}
+	offsets := make(map[string]map[int32]PartitionOffset, len(response.Blocks))
+	for topic, blocks := range response.Blocks {
+		offsets[topic] = make(map[int32]PartitionOffset, len(blocks))
+		for partition, block := range blocks {
+			po := PartitionOffset{Offset: -1}
+			if block.Err != sarama.ErrNoError {
+				po.Err = block.Err
+			} else if request.Version == 1 {
+				po.Offset = block.Offset
+			} else if len(block.Offsets) > 0 {
+				po.Offset = block.Offsets[0]
+			}
+			offsets[topic][partition] = po
+		}
+	}
+	return offsets, nil
+}
+
+func (b *saramaBackend) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	return b.client.GetOffset(topic, partition, time)
+}
+
+// ConsumePartition consumes with a consumer of its own: a sarama consumer refuses to consume a partition twice,
+// and the backfill and the commit latency both consume the offsets topics. Closing the partition consumer is
+// enough, the consumer doesn't close the client.
+func (b *saramaBackend) ConsumePartition(topic string, partition int32, offset int64) (PartitionConsumer, error) {
+	consumer, err := sarama.NewConsumerFromClient(b.client)
+	if err != nil {
+		return nil, err
+	}
+	return consumer.ConsumePartition(topic, partition, offset)
+}
+
+// Close does nothing, the sarama client is closed with the cluster
+func (b *saramaBackend) Close() error { return nil }
+
+// leaderRequests are the partitions of list offsets requests by leader, broker => topic => partitions
+type leaderRequests map[int32]map[string][]int32
+
+func (r leaderRequests) add(broker int32, topic string, partition int32) {
+	if _, ok := r[broker]; !ok {
+		r[broker] = make(map[string][]int32)
+	}
+	r[broker][topic] = append(r[broker][topic], partition)
+}
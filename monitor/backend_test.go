@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sundy-li/burrowx/config"
+	"github.com/sundy-li/burrowx/monitor/monitortest"
+)
+
+// countingBackend is the sarama backend counting its list offsets requests and whether it was closed
+type countingBackend struct {
+	Backend
+	client   sarama.Client
+	requests int32
+	closed   int32
+}
+
+func (b *countingBackend) Close() error {
+	atomic.AddInt32(&b.closed, 1)
+	return b.Backend.Close()
+}
+
+func (b *countingBackend) ListOffsets(ctx context.Context, broker int32, partitions map[string][]int32, time int64) (map[string]map[int32]PartitionOffset, error) {
+	atomic.AddInt32(&b.requests, 1)
+	return b.Backend.ListOffsets(ctx, broker, partitions, time)
+}
+
+var counting *countingBackend
+
+func init() {
+	RegisterBackend("counting", func(cfg *config.Config, cluster string, client sarama.Client) (Backend, error) {
+		backend, err := newSaramaBackend(cfg, cluster, client)
+		if err != nil {
+			return nil, err
+		}
+		counting = &countingBackend{Backend: backend, client: client}
+		return counting, nil
+	})
+}
+
+func TestSweepBackend(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	// two topics on the only broker, an empty partition included
+	c.AddTopic("clicks", 3)
+	c.AddTopic("views", 1)
+	c.SetLogsize("clicks", 0, 7)
+	c.SetLogsize("clicks", 2, 12)
+	c.SetLogsize("views", 0, 30)
+
+	cfg := c.Config()
+	cfg.Kafka[monitortest.ClusterName].Backend = "counting"
+	client, err := NewKafkaClient(cfg, monitortest.ClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.RefreshMetaData()
+	logsizes, err := client.fetchLogsizes(context.Background(), map[string]int{"clicks": 3, "views": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clicks := logsizes["clicks"]
+	if clicks[0] != 7 || clicks[1] != 0 || clicks[2] != 12 || logsizes["views"][0] != 30 {
+		t.Errorf("log end offsets %v, want 7, 0 and 12 of clicks and 30 of views", logsizes)
+	}
+	if n := atomic.LoadInt32(&counting.requests); n != 1 {
+		t.Errorf("%d list offsets requests through the backend, want 1 to the only broker", n)
+	}
+
+	cfg.Kafka[monitortest.ClusterName].Backend = "franz-go"
+	if _, err := NewKafkaClient(cfg, monitortest.ClusterName); err == nil {
+		t.Error("created a client with an unknown backend")
+	}
+}
+
+func TestNewKafkaClientFailureCloses(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+
+	cfg := c.Config()
+	cfg.Kafka[monitortest.ClusterName].Backend = "counting"
+	// validate-config would reject it, the setup fails after the connections are open
+	cfg.GroupRewrite = []*config.GroupRewrite{{Match: "(", Replace: "$1"}}
+	if _, err := NewKafkaClient(cfg, monitortest.ClusterName); err == nil {
+		t.Fatal("created a client with an invalid group rewrite")
+	}
+	if atomic.LoadInt32(&counting.closed) != 1 || !counting.client.Closed() {
+		t.Error("the backend and the sarama client of the failed setup are left open")
+	}
+}
+
+func TestFetcherStopCloses(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	c.AddTopic("shipments", 1)
+
+	cfg := c.Config()
+	cfg.Kafka[monitortest.ClusterName].Backend = "counting"
+	client, err := NewKafkaClient(cfg, monitortest.ClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Fetcher{cfg: cfg, clients: []*KafkaClient{client}, current: cfg, tenants: NewTenants(cfg)}
+	f.Start(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&counting.closed) != 1 || !counting.client.Closed() {
+		t.Error("the backend and the sarama client are left open by Stop")
+	}
+}
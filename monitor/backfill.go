@@ -0,0 +1,330 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+)
+
+// how long the consumption of a partition of an offsets topic may wait for its next record
+var backfillReadTimeout = 30 * time.Second
+
+// commitPoint is a committed offset and the timestamp(ms) of its record
+type commitPoint struct {
+	ts     int64
+	offset int64
+}
+
+// commitHistory is group => topic => partition => commits of the window, in the order of their records
+type commitHistory map[string]map[string]map[int32][]commitPoint
+
+func (h commitHistory) add(group, topic string, partition int32, point commitPoint) {
+	if _, ok := h[group]; !ok {
+		h[group] = make(map[string]map[int32][]commitPoint)
+	}
+	if _, ok := h[group][topic]; !ok {
+		h[group][topic] = make(map[int32][]commitPoint)
+	}
+	h[group][topic][partition] = append(h[group][topic][partition], point)
+}
+
+// at returns the offset committed at ts, and false if the only commits of the window came after it. A partition
+// without commit in the window kept the current committed offset all along.
+func (h commitHistory) at(group, topic string, partition int32, ts, current int64) (int64, bool) {
+	points := h[group][topic][partition]
+	if len(points) == 0 {
+		return current, current >= 0
+	}
+	i := sort.Search(len(points), func(i int) bool { return points[i].ts > ts })
+	if i == 0 {
+		return 0, false
+	}
+	return points[i-1].offset, true
+}
+
+// backfill reconstructs the lag of the groups over the downtime of the monitor, since the last sweep of its
+// heartbeat and until the first sweep of this run, and writes it as consumer_metrics points tagged backfill=true.
+// The offsets committed at a step are the last ones of the commit records of __consumer_offsets, read from the
+// start of the downtime, and the log end offsets the offsets of the first records produced after it, listed by
+// timestamp. Compacted commits and producer timestamps make it approximate. It stops once ctx is done.
+func (client *KafkaClient) backfill(ctx context.Context, since, until int64) {
+	step := int64(client.cfg.General.BackfillStepSeconds) * 1000
+	from := since + step
+	if oldest := until - int64(client.cfg.General.BackfillMaxHours)*3600*1000; from < oldest {
+		from = oldest
+	}
+	from = (from + step - 1) / step * step
+	// the first sweep of this run covers its own interval
+	until -= int64(METRIC_FETCH_INTERVAL_SECOND) * 1000
+	if from >= until {
+		return
+	}
+	log := client.log.WithFields(logrus.Fields{"from": msTime(from), "until": msTime(until)})
+	if !client.client.Config().Version.IsAtLeast(sarama.V0_10_1_0) {
+		log.Warnf("Cannot backfill the downtime, listing the offsets by timestamp needs the kafka version 0.10.1 or later")
+		return
+	}
+	var snap *sweepSnapshot
+	withReadLock(client.schemaUpdateMtx, func() {
+		snap = client.snapshot()
+	})
+	history, err := client.readCommits(ctx, snap, since)
+	if err != nil {
+		log.Warnf("Cannot backfill the downtime, reading the offsets topics failed: %v", err)
+		return
+	}
+
+	//group => topic => partition => committed offset now
+	current := make(map[string]map[string]map[int32]int64)
+	for topic, consumers := range snap.topic2Consumer {
+		for _, group := range consumers {
+			blocks, err := client.fetchCommittedOffsets(ctx, group, topic, snap.topicMap[topic])
+			if err != nil {
+				log.WithFields(logrus.Fields{"topic": topic, "group": group}).Warnf("Cannot backfill the group: %v", err)
+				continue
+			}
+			if _, ok := current[group]; !ok {
+				current[group] = make(map[string]map[int32]int64)
+			}
+			current[group][topic] = make(map[int32]int64, len(blocks))
+			for partition, block := range blocks {
+				if block.Err == sarama.ErrNoError {
+					current[group][topic][partition] = block.Offset
+				}
+			}
+		}
+	}
+
+	written := 0
+	for ts := from; ts < until && ctx.Err() == nil; ts += step {
+		logsizes, err := client.logsizesAt(ctx, snap, ts)
+		if err != nil {
+			log.Warnf("Cannot backfill the downtime past %v, listing the offsets by timestamp failed: %v", msTime(ts), err)
+			break
+		}
+		groupOffsets := make(map[string][]*ConsumerFullOffset)
+		for group, topics := range current {
+			for topic, partitions := range topics {
+				msg := &ConsumerFullOffset{
+					Cluster:      client.cluster,
+					Topic:        topic,
+					Group:        group,
+					Timestamp:    ts,
+					partitionMap: make(map[int32]LogOffset),
+					backfill:     true,
+				}
+				if config, ok := snap.topicConfigs[topic]; ok {
+					msg.CleanupPolicy = config.CleanupPolicy
+				}
+				for partition, now := range partitions {
+					logsize, ok := logsizes[topic][partition]
+					if !ok {
+						continue
+					}
+					offset, ok := history.at(group, topic, partition, ts, now)
+					if !ok {
+						continue
+					}
+					entry := LogOffset{Logsize: logsize, Offset: offset, LeaderEpoch: -1}
+					if entry.Lag = logsize - offset; entry.Lag < 0 {
+						entry.Lag = 0
+					}
+					msg.partitionMap[partition] = entry
+				}
+				if len(msg.partitionMap) > 0 {
+					groupOffsets[group] = append(groupOffsets[group], msg)
+				}
+			}
+		}
+		written += client.importer.saveBackfill(ctx, rewriteGroups(client.groupRewrites, groupOffsets))
+	}
+	log.Infof("Backfilled the downtime with %d points", written)
+}
+
+// logsizesAt lists the log end offsets of the consumed partitions at ts, one request per leader, the partitions
+// without record produced since are at their current log end offset
+func (client *KafkaClient) logsizesAt(ctx context.Context, snap *sweepSnapshot, ts int64) (map[string]map[int32]int64, error) {
+	requests := make(leaderRequests)
+	for topic, consumers := range snap.topic2Consumer {
+		if len(consumers) == 0 {
+			continue
+		}
+		for i := 0; i < snap.topicMap[topic]; i++ {
+			leader, _, err := client.backend.Leader(topic, int32(i))
+			if err != nil {
+				return nil, err
+			}
+			requests.add(leader, topic, int32(i))
+		}
+	}
+	// the sweeps merge into the current log end offsets
+	latest := make(map[string]map[int32]int64)
+	withReadLock(client.topicOffsetMapLock, func() {
+		for topic := range snap.topic2Consumer {
+			latest[topic] = make(map[int32]int64, len(client.topicOffset[topic]))
+			for partition, offset := range client.topicOffset[topic] {
+				latest[topic][partition] = offset
+			}
+		}
+	})
+	logsizes := make(map[string]map[int32]int64)
+	for broker, request := range requests {
+		response, err := client.backend.ListOffsets(ctx, broker, request, ts)
+		if err != nil {
+			return nil, err
+		}
+		for topic, blocks := range response {
+			for partition, block := range blocks {
+				if block.Err != nil {
+					continue
+				}
+				offset := block.Offset
+				if offset < 0 {
+					var ok bool
+					if offset, ok = latest[topic][partition]; !ok {
+						continue
+					}
+				}
+				if _, ok := logsizes[topic]; !ok {
+					logsizes[topic] = make(map[int32]int64)
+				}
+				logsizes[topic][partition] = offset
+			}
+		}
+	}
+	return logsizes, nil
+}
+
+// readCommits consumes the offsets topics from the records appended at since to its current end, and returns
+// the commits of the groups and topics of the snapshot
+func (client *KafkaClient) readCommits(ctx context.Context, snap *sweepSnapshot, since int64) (commitHistory, error) {
+	//group => topic => consumed
+	pairings := make(map[string]map[string]bool)
+	for topic, consumers := range snap.topic2Consumer {
+		for _, group := range consumers {
+			if _, ok := pairings[group]; !ok {
+				pairings[group] = make(map[string]bool)
+			}
+			pairings[group][topic] = true
+		}
+	}
+
+	history := make(commitHistory)
+	var (
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		errs    []string
+		errLock sync.Mutex
+	)
+	for _, ot := range client.offsetsTopics {
+		partitions, err := client.backend.Partitions(ot.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, partition := range partitions {
+			wg.Add(1)
+			go func(ot *offsetsTopic, partition int32) {
+				defer wg.Done()
+				err := client.readCommitPartition(ctx, ot, partition, since, func(group, topic string, p int32, point commitPoint) {
+					if !pairings[group][topic] {
+						return
+					}
+					partitions, known := snap.topicMap[topic]
+					if reason := checkCommitRecord(p, point.offset, point.ts, partitions, known); reason != "" {
+						client.quarantine.add(&QuarantinedRecord{Source: ot.name, Group: group, Topic: topic, Partition: p,
+							Offset: point.offset, Timestamp: point.ts, Reason: reason, Dropped: true})
+						return
+					}
+					lock.Lock()
+					history.add(group, topic, p, point)
+					lock.Unlock()
+				})
+				if err != nil {
+					errLock.Lock()
+					errs = append(errs, fmt.Sprintf("%s partition %d: %v", ot.name, partition, err))
+					errLock.Unlock()
+				}
+			}(ot, partition)
+		}
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, errors.New(strings.Join(errs, ", "))
+	}
+	return history, nil
+}
+
+// readCommitPartition consumes a partition of an offsets topic from the records appended at since to its end,
+// or until ctx is done
+func (client *KafkaClient) readCommitPartition(ctx context.Context, ot *offsetsTopic, partition int32, since int64, fn func(string, string, int32, commitPoint)) error {
+	end, err := client.backend.GetOffset(ot.name, partition, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	start, err := client.backend.GetOffset(ot.name, partition, since)
+	if err != nil {
+		return err
+	}
+	if start < 0 || start >= end {
+		return nil
+	}
+	pc, err := client.backend.ConsumePartition(ot.name, partition, start)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	timeout := time.NewTimer(backfillReadTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case msg := <-pc.Messages():
+			if r, err := ot.codec.Decode(msg.Key, msg.Value); err == nil && !r.Tombstone && r.Group != "" {
+				ts := msg.Timestamp.UnixNano() / int64(time.Millisecond)
+				fn(r.Group, r.Topic, r.Partition, commitPoint{ts: ts, offset: r.Offset})
+			}
+			if msg.Offset >= end-1 {
+				return nil
+			}
+			if !timeout.Stop() {
+				<-timeout.C
+			}
+			timeout.Reset(backfillReadTimeout)
+		case err := <-pc.Errors():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			// the last offsets are control records, or compacted away
+			return nil
+		}
+	}
+}
+
+// lastSweep returns the timestamp(ms) of the last sweep of the cluster in the heartbeats written to influxdb,
+// of any instance, 0 if there is none
+func (i *Importer) lastSweep(cluster string) (int64, error) {
+	res, err := i.runCmd(fmt.Sprintf(`SELECT last("last_sweep") FROM "monitor_heartbeat" WHERE "cluster" = '%s'`,
+		strings.Replace(cluster, "'", `\'`, -1)))
+	if err != nil {
+		return 0, err
+	}
+	if len(res) == 0 || len(res[0].Series) == 0 || len(res[0].Series[0].Values) == 0 || len(res[0].Series[0].Values[0]) < 2 {
+		return 0, nil
+	}
+	switch v := res[0].Series[0].Values[0][1].(type) {
+	case json.Number:
+		return v.Int64()
+	case float64:
+		return int64(v), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterSink("backup", newBackupSink)
+}
+
+// backupSink periodically writes the committed offsets of every group, to restore them after a coordinator
+// disaster. The csv format writes a dir per cluster with a file per group, as read by
+// kafka-consumer-groups --reset-offsets --from-file, the json format one file per cluster.
+// A file replaces the previous one only once complete.
+type backupSink struct {
+	dir      string
+	cluster  string
+	format   string
+	interval time.Duration
+	last     time.Time
+}
+
+// backupOffsets is the json backup of a cluster, group => topic => partition => committed offset
+type backupOffsets struct {
+	Cluster   string                                `json:"cluster"`
+	Timestamp int64                                 `json:"timestamp"`
+	Groups    map[string]map[string]map[int32]int64 `json:"groups"`
+}
+
+// newBackupSink takes the dir option, format, csv by default, and intervalSeconds, 300 by default
+func newBackupSink(cluster string, options map[string]string) (Sink, error) {
+	s := &backupSink{dir: options["dir"], cluster: cluster, format: options["format"], interval: 5 * time.Minute}
+	if s.dir == "" {
+		return nil, errors.New("no dir")
+	}
+	switch s.format {
+	case "":
+		s.format = "csv"
+	case "csv", "json":
+	default:
+		return nil, fmt.Errorf("invalid format %s, csv or json", s.format)
+	}
+	if v := options["intervalSeconds"]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid intervalSeconds %s", v)
+		}
+		s.interval = time.Duration(seconds) * time.Second
+	}
+	if s.format == "csv" {
+		return s, os.MkdirAll(filepath.Join(s.dir, s.cluster), 0755)
+	}
+	return s, os.MkdirAll(s.dir, 0755)
+}
+
+func (s *backupSink) Name() string { return "backup" }
+
+func (s *backupSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	now := clockNow()
+	if now.Sub(s.last) < s.interval {
+		return nil
+	}
+	s.last = now
+	if s.format == "json" {
+		return s.saveJSON(now, groupOffsets)
+	}
+	for group, msgs := range groupOffsets {
+		if err := s.saveCSV(group, msgs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCSV writes the TOPIC,PARTITION,OFFSET lines of the partitions the group committed
+func (s *backupSink) saveCSV(group string, msgs []*ConsumerFullOffset) error {
+	return writeFileAtomic(filepath.Join(s.dir, s.cluster, url.PathEscape(group)+".csv"), func(w *bufio.Writer) error {
+		for _, msg := range msgs {
+			partitions := make([]int, 0, len(msg.partitionMap))
+			for partition, offset := range msg.partitionMap {
+				if offset.Offset >= 0 {
+					partitions = append(partitions, int(partition))
+				}
+			}
+			sort.Ints(partitions)
+			for _, partition := range partitions {
+				fmt.Fprintf(w, "%s,%d,%d\n", msg.Topic, partition, msg.partitionMap[int32(partition)].Offset)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *backupSink) saveJSON(now time.Time, groupOffsets map[string][]*ConsumerFullOffset) error {
+	backup := &backupOffsets{
+		Cluster:   s.cluster,
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+		Groups:    make(map[string]map[string]map[int32]int64, len(groupOffsets)),
+	}
+	for group, msgs := range groupOffsets {
+		topics := make(map[string]map[int32]int64, len(msgs))
+		for _, msg := range msgs {
+			partitions := make(map[int32]int64, len(msg.partitionMap))
+			for partition, offset := range msg.partitionMap {
+				if offset.Offset >= 0 {
+					partitions[partition] = offset.Offset
+				}
+			}
+			topics[msg.Topic] = partitions
+		}
+		backup.Groups[group] = topics
+	}
+	return writeFileAtomic(filepath.Join(s.dir, "burrowx-offsets-"+s.cluster+".json"), func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(backup)
+	})
+}
+
+func (s *backupSink) Close() error { return nil }
+
+// writeFileAtomic writes a temporary file next to name and renames it to name once complete
+func writeFileAtomic(name string, write func(w *bufio.Writer) error) error {
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
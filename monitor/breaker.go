@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// consecutive failures before a broker's offset requests are suspended
+	BROKER_FAILURE_THRESHOLD = 3
+	// max backoff for a broker whose circuit is open
+	BROKER_MAX_BACKOFF_SECOND = 300
+)
+
+// brokerBreaker is a per-broker circuit breaker, after BROKER_FAILURE_THRESHOLD consecutive failures
+// the broker is skipped until the backoff expires, then a single probe request is let through (half-open),
+// a successful probe closes the circuit, a failed one doubles the backoff
+type brokerBreaker struct {
+	lock     sync.Mutex
+	failures int
+	backoff  time.Duration
+	retryAt  time.Time
+	probing  bool
+}
+
+// allow reports whether a request may be sent to the broker now
+func (b *brokerBreaker) allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures < BROKER_FAILURE_THRESHOLD {
+		return true
+	}
+	if b.probing || now.Before(b.retryAt) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success closes the circuit, it returns true if the circuit was open before
+func (b *brokerBreaker) success() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	recovered := b.failures >= BROKER_FAILURE_THRESHOLD
+	b.failures = 0
+	b.backoff = 0
+	b.probing = false
+	return recovered
+}
+
+// cancel releases the probe of a request cancelled before the broker answered, the cancellation is neither a
+// success nor a failure of the broker, and the next sweep probes it again
+func (b *brokerBreaker) cancel() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+}
+
+// failure records a failed request, it returns true if the circuit has just been opened
+func (b *brokerBreaker) failure(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures < BROKER_FAILURE_THRESHOLD {
+		return false
+	}
+	maxBackoff := time.Duration(BROKER_MAX_BACKOFF_SECOND) * time.Second
+	if b.backoff == 0 {
+		b.backoff = time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second
+	} else if b.backoff < maxBackoff {
+		b.backoff *= 2
+	}
+	if b.backoff > maxBackoff {
+		b.backoff = maxBackoff
+	}
+	b.retryAt = now.Add(b.backoff)
+	return b.failures == BROKER_FAILURE_THRESHOLD
+}
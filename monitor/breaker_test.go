@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerCancelledProbe(t *testing.T) {
+	now := clockStart
+	b := &brokerBreaker{}
+	for i := 0; i < BROKER_FAILURE_THRESHOLD; i++ {
+		b.failure(now)
+	}
+	now = b.retryAt
+	if !b.allow(now) {
+		t.Fatal("no probe once the backoff expired")
+	}
+	if b.allow(now) {
+		t.Fatal("a second request let through while probing")
+	}
+	// the sweep of the probe timed out
+	b.cancel()
+	if !b.allow(now.Add(time.Second)) {
+		t.Fatal("no probe after the cancelled one")
+	}
+	if b.failures != BROKER_FAILURE_THRESHOLD {
+		t.Errorf("%d failures after the cancelled probe, want %d", b.failures, BROKER_FAILURE_THRESHOLD)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	interval := time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second
+	b := &brokerBreaker{}
+	for i, step := range []struct {
+		op string
+		at time.Duration
+		// the result of allow, that the circuit opened for failure, that it recovered for success
+		want bool
+	}{
+		{"failure", 0, false},
+		{"allow", 0, true},
+		{"failure", 0, false},
+		{"failure", 0, true},
+		{"allow", 0, false},
+		{"allow", interval, true},
+		{"allow", interval, false},
+		// the failed probe doubles the backoff
+		{"failure", interval, false},
+		{"allow", 2 * interval, false},
+		{"allow", 3 * interval, true},
+		{"success", 3 * interval, true},
+		{"allow", 3 * interval, true},
+		{"success", 3 * interval, false},
+		{"failure", 3 * interval, false},
+	} {
+		now := clockStart.Add(step.at)
+		var got bool
+		switch step.op {
+		case "allow":
+			got = b.allow(now)
+		case "success":
+			got = b.success()
+		case "failure":
+			got = b.failure(now)
+		}
+		if got != step.want {
+			t.Errorf("step %d: %s at %v is %v, want %v", i, step.op, step.at, got, step.want)
+		}
+	}
+}
+
+func TestBreakerMaxBackoff(t *testing.T) {
+	b := &brokerBreaker{}
+	for i := 0; i < BROKER_FAILURE_THRESHOLD+20; i++ {
+		b.failure(clockStart)
+	}
+	if max := time.Duration(BROKER_MAX_BACKOFF_SECOND) * time.Second; b.backoff != max {
+		t.Errorf("backoff of %v after a long outage, want the max %v", b.backoff, max)
+	}
+}
@@ -0,0 +1,61 @@
+package monitor
+
+// BrokerHealth is what the metadata tells about the brokers of a cluster
+type BrokerHealth struct {
+	Brokers int `json:"brokers"`
+	// partitions with fewer in sync replicas than replicas
+	UnderReplicated int `json:"under_replicated_partitions"`
+	// partitions without leader
+	Offline int `json:"offline_partitions"`
+	// -1 if unknown
+	ControllerID int32 `json:"controller_id"`
+	// since the start
+	ControllerChanges int64 `json:"controller_changes"`
+}
+
+// updateBrokerHealth counts the under replicated and offline partitions of all topics of the metadata,
+// not only of the monitored ones, and the controller changes, from the metadata of the sarama client.
+// The brokers of a kraft cluster answer a random broker as the controller, its changes aren't counted
+func (client *KafkaClient) updateBrokerHealth() {
+	topics, err := client.client.Topics()
+	if err != nil {
+		client.warnLimiter.warnf(client.log, "broker-health", "Cannot list the topics of the metadata: %v", err)
+		return
+	}
+	h := &BrokerHealth{Brokers: len(client.client.Brokers()), ControllerID: -1}
+	for _, topic := range topics {
+		partitions, err := client.client.Partitions(topic)
+		if err != nil {
+			continue
+		}
+		writable, _ := client.client.WritablePartitions(topic)
+		h.Offline += len(partitions) - len(writable)
+		for _, partition := range partitions {
+			replicas, err := client.client.Replicas(topic, partition)
+			if err != nil {
+				continue
+			}
+			isr, err := client.client.InSyncReplicas(topic, partition)
+			if err != nil {
+				continue
+			}
+			if len(isr) < len(replicas) {
+				h.UnderReplicated++
+			}
+		}
+	}
+	kraft := client.cfg.Kafka[client.cluster].Flavor == "kraft"
+	if controller, err := client.client.Controller(); err == nil && !kraft {
+		h.ControllerID = controller.ID()
+	}
+	withWriteLock(client.heartbeatLock, func() {
+		if previous := client.brokerHealth; previous != nil {
+			h.ControllerChanges = previous.ControllerChanges
+			if previous.ControllerID >= 0 && h.ControllerID >= 0 && h.ControllerID != previous.ControllerID {
+				h.ControllerChanges++
+				client.log.Warnf("The controller moved from broker %d to broker %d", previous.ControllerID, h.ControllerID)
+			}
+		}
+		client.brokerHealth = h
+	})
+}
@@ -0,0 +1,250 @@
+package monitor
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// BurrowStatus is a status as Burrow numbers it, its templates compare the statuses to these numbers
+// and its json payloads carry the names
+type BurrowStatus int
+
+const (
+	BurrowNotFound BurrowStatus = iota
+	BurrowOK
+	BurrowWarn
+	BurrowErr
+	BurrowStop
+	BurrowStall
+	BurrowRewind
+)
+
+var burrowStatusNames = []string{"NOTFOUND", "OK", "WARN", "ERR", "STOP", "STALL", "REWIND"}
+
+func (s BurrowStatus) String() string {
+	if s < 0 || int(s) >= len(burrowStatusNames) {
+		return "UNKNOWN"
+	}
+	return burrowStatusNames[s]
+}
+
+func (s BurrowStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func burrowStatusOf(s Status) BurrowStatus {
+	switch s {
+	case StatusOK:
+		return BurrowOK
+	case StatusWarn:
+		return BurrowWarn
+	case StatusRewind:
+		return BurrowRewind
+	case StatusStall:
+		return BurrowStall
+	case StatusErr:
+		return BurrowErr
+	}
+	return BurrowNotFound
+}
+
+// BurrowEvent is the data of the notifier templates of the burrow format, the one Burrow renders its http
+// notifier templates with, so the templates and the receivers of Burrow keep working
+type BurrowEvent struct {
+	// of the incident, from the status change away from OK to the one back to OK
+	Id      string
+	Cluster string
+	Group   string
+	Start   time.Time
+	// the extras.<name> options of the notifier
+	Extras map[string]string
+	Result *BurrowGroupStatus
+}
+
+// BurrowGroupStatus is the consumer status of Burrow, its Partitions are the ones not OK
+type BurrowGroupStatus struct {
+	Cluster         string             `json:"cluster"`
+	Group           string             `json:"group"`
+	Status          BurrowStatus       `json:"status"`
+	Complete        float32            `json:"complete"`
+	Partitions      []*BurrowPartition `json:"partitions"`
+	TotalPartitions int                `json:"partition_count"`
+	Maxlag          *BurrowPartition   `json:"maxlag"`
+	TotalLag        uint64             `json:"totallag"`
+}
+
+// BurrowPartition is a partition of the window of a group, from its first to its last committed offset
+type BurrowPartition struct {
+	Topic      string        `json:"topic"`
+	Partition  int32         `json:"partition"`
+	Owner      string        `json:"owner"`
+	ClientID   string        `json:"client_id"`
+	Status     BurrowStatus  `json:"status"`
+	Start      *BurrowOffset `json:"start"`
+	End        *BurrowOffset `json:"end"`
+	CurrentLag uint64        `json:"current_lag"`
+	Complete   float32       `json:"complete"`
+}
+
+type BurrowOffset struct {
+	Offset     int64  `json:"offset"`
+	Timestamp  int64  `json:"timestamp"`
+	ObservedAt int64  `json:"observedAt"`
+	Lag        uint64 `json:"lag"`
+}
+
+// burrowTemplateFuncs are the functions of the templates of Burrow
+var burrowTemplateFuncs = template.FuncMap{
+	"jsonencoder": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"topicsbystatus":  burrowTopicsByStatus,
+	"partitioncounts": burrowPartitionCounts,
+	"add":             func(a, b int) int { return a + b },
+	"minus":           func(a, b int) int { return a - b },
+	"multiply":        func(a, b int) int { return a * b },
+	"divide":          func(a, b int) int { return a / b },
+	"formattimestamp": func(ms int64, layout string) string {
+		return msTime(ms).UTC().Format(layout)
+	},
+}
+
+// burrowTemplate is the payload of the default http notifier template of Burrow, its extras api_key, app and tier
+// are the extras.api_key, extras.app and extras.tier options
+const burrowTemplate = `{"api_key":{{jsonencoder (index .Extras "api_key")}},"app":{{jsonencoder (index .Extras "app")}},"block":false,` +
+	`"events":[{"event":{"severity":"{{if eq .Result.Status 2}}WARN{{else if eq .Result.Status 1}}OK{{else}}ERR{{end}}",` +
+	`"tier":{{jsonencoder (index .Extras "tier")}},"group":{{jsonencoder .Group}},"start":"{{.Start.UTC.Format "Jan 02, 2006 15:04:05 UTC"}}",` +
+	`"complete":{{.Result.Complete}},"partitions":{{jsonencoder .Result.Partitions}}}}]}`
+
+// burrowTopicsByStatus returns the topics of the partitions per status name
+func burrowTopicsByStatus(partitions []*BurrowPartition) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	res := make(map[string][]string)
+	for _, p := range partitions {
+		status := p.Status.String()
+		if seen[status] == nil {
+			seen[status] = make(map[string]bool)
+		}
+		if !seen[status][p.Topic] {
+			seen[status][p.Topic] = true
+			res[status] = append(res[status], p.Topic)
+		}
+	}
+	return res
+}
+
+// burrowPartitionCounts returns the number of partitions per lowercase status name
+func burrowPartitionCounts(partitions []*BurrowPartition) map[string]int {
+	counts := map[string]int{"warn": 0, "stop": 0, "stall": 0, "rewind": 0}
+	for _, p := range partitions {
+		counts[strings.ToLower(p.Status.String())]++
+	}
+	return counts
+}
+
+// burrowIncident is the id and the start of the incident of a group for the burrow payloads
+type burrowIncident struct {
+	id    string
+	start time.Time
+}
+
+func newBurrowIncident(ts int64) *burrowIncident {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return &burrowIncident{
+		id:    fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]),
+		start: msTime(ts),
+	}
+}
+
+// newBurrowGroupStatus converts a status with its window to the consumer status of Burrow: a partition of the
+// window is complete once it's in a full window, and the group is as complete as its share of complete partitions
+func newBurrowGroupStatus(status *GroupStatus) *BurrowGroupStatus {
+	res := &BurrowGroupStatus{
+		Cluster:    status.Cluster,
+		Group:      status.Group,
+		Status:     burrowStatusOf(status.Status),
+		Partitions: []*BurrowPartition{},
+	}
+	if status.TotalLag > 0 {
+		res.TotalLag = uint64(status.TotalLag)
+	}
+	statuses := make(map[string]map[int32]Status)
+	for _, ps := range status.partitions {
+		if statuses[ps.Topic] == nil {
+			statuses[ps.Topic] = make(map[int32]Status)
+		}
+		statuses[ps.Topic][ps.Partition] = ps.Status
+	}
+	if len(status.Window) == 0 {
+		return res
+	}
+	current := status.Window[len(status.Window)-1]
+	complete := 0
+	for topic, partitions := range current.offsets {
+		for partition := range partitions {
+			p := burrowPartition(status.Window, topic, partition)
+			if p == nil {
+				continue
+			}
+			res.TotalPartitions++
+			if p.Complete >= 1 {
+				complete++
+			}
+			if s, ok := statuses[topic][partition]; ok {
+				p.Status = burrowStatusOf(s)
+				res.Partitions = append(res.Partitions, p)
+			}
+			if res.Maxlag == nil || p.CurrentLag > res.Maxlag.CurrentLag {
+				res.Maxlag = p
+			}
+		}
+	}
+	if res.TotalPartitions > 0 {
+		res.Complete = float32(complete) / float32(res.TotalPartitions)
+	}
+	sort.Slice(res.Partitions, func(i, j int) bool {
+		if res.Partitions[i].Topic != res.Partitions[j].Topic {
+			return res.Partitions[i].Topic < res.Partitions[j].Topic
+		}
+		return res.Partitions[i].Partition < res.Partitions[j].Partition
+	})
+	return res
+}
+
+// burrowPartition returns a partition from its first to its last committed offset of the window, nil if it has none
+func burrowPartition(window []*Evaluation, topic string, partition int32) *BurrowPartition {
+	var p *BurrowPartition
+	count := 0
+	for _, evaluation := range window {
+		offset, ok := evaluation.offsets[topic][partition]
+		if !ok || offset.Offset < 0 {
+			continue
+		}
+		count++
+		point := &BurrowOffset{Offset: offset.Offset, Timestamp: evaluation.Timestamp, ObservedAt: evaluation.Timestamp}
+		if offset.Lag > 0 {
+			point.Lag = uint64(offset.Lag)
+		}
+		if p == nil {
+			p = &BurrowPartition{Topic: topic, Partition: partition, Status: BurrowOK, Start: point}
+		}
+		p.End, p.CurrentLag = point, point.Lag
+		p.Owner, p.ClientID = offset.Owner, offset.ClientID
+	}
+	if p != nil {
+		p.Complete = float32(count) / float32(EVALUATION_WINDOW)
+		if p.Complete > 1 {
+			p.Complete = 1
+		}
+	}
+	return p
+}
@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+// Canary produces timestamped messages to a dedicated topic and consumes them back with its own group,
+// so both the write and the read path of the cluster are checked end to end
+type Canary struct {
+	cluster  string
+	topic    string
+	client   sarama.Client
+	producer sarama.SyncProducer
+	group    sarama.ConsumerGroup
+	importer *Importer
+	paused   func() bool
+	log      *logrus.Entry
+	// traces the probes, nil if tracing is disabled
+	tracer *tracer
+	// of the end to end latencies, the exemplars are the traces of the probes
+	latency *latencyHistogram
+
+	staleAfter time.Duration
+	ticker     *time.Ticker
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	lastConsumeLock *sync.RWMutex
+	lastConsumed    time.Time
+}
+
+func NewCanary(client *KafkaClient) (*Canary, error) {
+	kcfg := client.cfg.Kafka[client.cluster]
+	producer, err := sarama.NewSyncProducerFromClient(client.client)
+	if err != nil {
+		return nil, err
+	}
+	group, err := sarama.NewConsumerGroupFromClient(kcfg.Canary.Group, client.client)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	return &Canary{
+		cluster:  client.cluster,
+		topic:    kcfg.Canary.Topic,
+		client:   client.client,
+		producer: producer,
+		group:    group,
+		importer: client.importer,
+		paused:   client.Paused,
+		log:      mylog.Module("canary").WithField("cluster", client.cluster),
+		tracer:   client.tracer,
+		latency:  newLatencyHistogram(CANARY_LATENCY_BUCKETS),
+
+		staleAfter:      time.Duration(client.cfg.General.StaleIntervals*METRIC_FETCH_INTERVAL_SECOND) * time.Second,
+		lastConsumeLock: &sync.RWMutex{},
+	}, nil
+}
+
+func (c *Canary) start() {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	ctx := c.ctx
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			err := c.group.Consume(ctx, []string{c.topic}, c)
+			if err == sarama.ErrClosedConsumerGroup || ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				c.log.Warnf("Canary consume error: %v", err)
+				time.Sleep(time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second)
+			}
+		}
+	}()
+
+	c.ticker = time.NewTicker(time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second)
+	go func() {
+		for _ = range c.ticker.C {
+			if !c.paused() {
+				c.produce()
+			}
+		}
+	}()
+}
+
+// stop stops the canary and closes its producer and consumer group, started or not
+func (c *Canary) stop() {
+	if c.cancel != nil {
+		c.ticker.Stop()
+		c.cancel()
+	}
+	c.group.Close()
+	c.wg.Wait()
+	c.producer.Close()
+}
+
+// produce sends one canary message and reports the write path, plus the read path health. The message is the
+// send time in nanoseconds, followed by ";" and the traceparent of the probe if it's traced, so its consumption
+// joins the trace.
+func (c *Canary) produce() {
+	ctx, probe := startSpan(c.ctx, c.tracer, "canary.probe")
+	probe.setAttr("cluster", c.cluster)
+	_, sp := startSpan(ctx, nil, "canary.produce")
+	now := time.Now()
+	value := strconv.FormatInt(now.UnixNano(), 10)
+	if parent := sp.traceparent(); parent != "" {
+		value += ";" + parent
+	}
+	_, _, err := c.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: c.topic,
+		Value: sarama.StringEncoder(value),
+	})
+	sp.finish(err)
+	defer probe.finish(err)
+	fields := map[string]interface{}{
+		"produce_ok": err == nil,
+	}
+	if err != nil {
+		c.log.WithField("topic", c.topic).Warnf("Canary produce error: %v", err)
+	} else {
+		fields["produce_latency_ms"] = time.Since(now).Nanoseconds() / int64(time.Millisecond)
+	}
+
+	fields["consume_ok"] = c.consumeOK(now)
+	c.importer.writePoint(ctx, "canary", map[string]string{"cluster": c.cluster}, fields, now)
+}
+
+// consumeOK reports whether a canary message was consumed in the last StaleIntervals intervals
+func (c *Canary) consumeOK(now time.Time) bool {
+	var lastConsumed time.Time
+	withReadLock(c.lastConsumeLock, func() {
+		lastConsumed = c.lastConsumed
+	})
+	return now.Sub(lastConsumed) <= c.staleAfter
+}
+
+func (c *Canary) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (c *Canary) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim measures the end to end latency of every canary message
+func (c *Canary) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		sess.MarkMessage(msg, "")
+		// the messages of the versions before the tracing have no traceparent
+		value := strings.SplitN(string(msg.Value), ";", 2)
+		sent, err := strconv.ParseInt(value[0], 10, 64)
+		if err != nil {
+			c.log.WithFields(logrus.Fields{"topic": msg.Topic, "partition": msg.Partition}).Warnf("Canary got an unknown message at offset %d", msg.Offset)
+			continue
+		}
+		now := time.Now()
+		withWriteLock(c.lastConsumeLock, func() {
+			c.lastConsumed = now
+		})
+		tags := map[string]string{
+			"cluster":   c.cluster,
+			"partition": strconv.Itoa(int(msg.Partition)),
+		}
+		latencyMs := (now.UnixNano() - sent) / int64(time.Millisecond)
+		var sp *span
+		if len(value) == 2 {
+			sp = startRemoteSpan(c.tracer, value[1], "canary.consume", time.Unix(0, sent))
+			sp.setAttr("partition", msg.Partition)
+			sp.setAttr("e2e_latency_ms", latencyMs)
+			sp.finish(nil)
+		}
+		c.latency.observe(float64(now.UnixNano()-sent)/1e9, sp.TraceID())
+		fields := map[string]interface{}{
+			"e2e_latency_ms": latencyMs,
+		}
+		c.importer.writePoint(c.ctx, "canary", tags, fields, now)
+	}
+	return nil
+}
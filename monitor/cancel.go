@@ -0,0 +1,25 @@
+package monitor
+
+import (
+	"context"
+)
+
+// withContext runs a broker request until ctx is done. The requests of sarama can't be cancelled, and closing
+// the broker doesn't help, Close waits for the response in flight and the broker is shared with the other
+// sweeps and the api. So the request is left to finish in the background, bounded by the net timeouts of
+// sarama, and its response is dropped.
+func withContext(ctx context.Context, request func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- request()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,38 +1,162 @@
 package monitor
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
+	"context"
+	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
-	log "github.com/cihub/seelog"
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
 )
 
 type KafkaClient struct {
-	cluster        string
-	cfg            *config.Config
-	client         sarama.Client
+	cluster string
+	log     *logrus.Entry
+	cfg     *config.Config
+	client  sarama.Client
+	// of the metadata, the list offsets and the consumption of the offsets topics, on client by default
+	backend        Backend
 	topicMap       map[string]int
 	topic2Consumer map[string][]string
 
 	schemaUpdateMtx *sync.RWMutex
+	// serializes the metadata refreshes, schemaUpdateMtx is only held to swap in their results
+	refreshLock sync.Mutex
 
-	brokerOffsetTicker *time.Ticker
+	// of the goroutines of the client, cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	brokerOffsetTicker *Ticker
+	// a sweep out of the ticks, asked by the metadata refresh
+	sweepRequests   chan struct{}
+	heartbeatTicker *Ticker
+	metadataTicker  *Ticker
+	// nil without general.inventoryMinutes
+	inventoryTicker *Ticker
+	schedule        sweepSchedule
+	// shared by the clusters of the fetcher, nil if the concurrent sweeps are unlimited
+	sweepSlots chan struct{}
+
+	heartbeatLock *sync.RWMutex
+	//last successful offset sweep and last consumer offset fetch
+	lastSweep       time.Time
+	lastOffsetFetch time.Time
 
 	topicOffsetMapLock *sync.RWMutex
 	//topic => parition => offset
 	topicOffset map[string]map[int32]int64
+	// of the previous sweep, for the partitions whose broker failed this sweep
+	previousTopicOffset map[string]map[int32]int64
+	//topic => partition => sweep its log end offset was fetched in, of this and the previous sweep
+	topicOffsetStamp         map[string]map[int32]sweepStamp
+	previousTopicOffsetStamp map[string]map[int32]sweepStamp
+	// the origin of the monotonic timeline of the sweep stamps
+	started time.Time
+	//topic => partition => sweeps its log end offset didn't move, with general.idleEndOffsetSweeps,
+	// only used by the sweep goroutine
+	unmoved map[string]map[int32]int
+	sweeps  int
+	//topic => partition => log start offset, if general.fetchStartOffsets
+	topicStartOffset map[string]map[int32]int64
+	topicStats       *TopicStats
+	//topic => config, if general.describeTopicConfigs or general.fetchStartOffsets
+	topicConfigs map[string]*TopicConfig
 
-	importer *Importer
+	importer  *Importer
+	annotator *Annotator
+	sinks     []Sink
+	// of the sinks, in their order
+	sinkWindows []*sinkWindow
+	// of the sinks, in their order, nil for the unlimited ones
+	sinkThrottles []*writeThrottle
+	// partition offsets a throttled sink didn't receive
+	sinkThrottled metrics.Counter
+	canary        *Canary
+	commits       *commitLatency
+	// read by the commit latency and the backfill
+	offsetsTopics []*offsetsTopic
+	evaluator     *Evaluator
+	slos          *SLOTracker
+	recorder      *Recorder
+	events        *eventHub
+	// traces the sweeps, nil if tracing is disabled
+	tracer *tracer
 
 	topicFilterRegexps []*regexp.Regexp
 	groupFilterRegexps []*regexp.Regexp
+	// kafka.<cluster>.groups, all groups if empty
+	groupAllowlist map[string]bool
+	// with general.learnGroupsHours, the accepted allowlist of the learned groups
+	learner          *groupLearner
+	groupRewrites    []*groupRewrite
+	router           *alertRouter
+	compactedRegexps []*regexp.Regexp
+
+	//group => state of the group
+	groupState map[string]string
+	//group => topic => partition => member owning it
+	partitionOwner map[string]map[string]map[int32]*GroupMember
+	//group => its members, the ones owning no partition included
+	members map[string][]*GroupMember
+	//topic => partitions being reassigned, with general.detectReassignments
+	reassigning map[string]map[int32]bool
+	// of the last metadata refresh, with general.brokerHealth, guarded by heartbeatLock
+	brokerHealth *BrokerHealth
+	// of the last refresh, with general.inventoryMinutes, guarded by heartbeatLock
+	inventory *Inventory
+
+	//group => topic => when the pairing was first and last observed
+	groupSeen map[string]map[string]*Seen
+	//group => timestamp(ms) it was first observed without members
+	emptySince map[string]int64
+	//topic => message in rate at the last sweep
+	inRates map[string]float64
+	//topic => groups subscribed to it while it's missing from the metadata
+	missingTopics map[string]map[string]bool
+	//group => clients of its members at the last metadata refresh
+	groupClients map[string][]*GroupClients
+	rebalances   *rebalanceTracker
+	//group => topic => timestamp(ms) of the last sweep it had a commit, only used by the sweep goroutine
+	committed map[string]map[string]int64
+
+	//statuses of the last evaluation
+	statuses []*GroupStatus
+
+	//broker id => circuit breaker of the offset requests
+	brokerBreakers map[int32]*brokerBreaker
+
+	//metrics of burrowx itself
+	metrics        metrics.Registry
+	sweepTimer     metrics.Timer
+	brokerFailures metrics.Counter
+	fetchFailures  metrics.Counter
+	// commits ahead of the log end offset, handled by general.staleBrokerOffset
+	staleBrokerOffsets metrics.Counter
+	// pairings of groups with topics unknown to the metadata, handled by general.unknownTopics
+	unknownTopics metrics.Counter
+	// commits of partitions without log end offset in the last two sweeps
+	unresolvedCommits metrics.Counter
+	// log end offsets of idle partitions reused instead of fetched
+	cachedEndOffsets metrics.Counter
+	// the failures per kind
+	errors errorCounters
+
+	warnLimiter *warnLimiter
+	// the decoded offsets which failed the sanity checks
+	quarantine *quarantine
+
+	// set while the monitoring of the cluster is paused, read atomically
+	paused int32
 }
 
 type BrokerTopicRequest struct {
@@ -44,6 +168,8 @@ var (
 	// we may use a fixed interval
 	METRIC_FETCH_INTERVAL_SECOND = 10
 	META_UPDATE_INTERVAL_SECOND  = 60
+	// group and topic pairings not observed for this long are forgotten
+	SEEN_EXPIRE_SECOND = 7 * 24 * 3600
 )
 
 func NewKafkaClient(cfg *config.Config, cluster string) (*KafkaClient, error) {
@@ -52,57 +178,137 @@ func NewKafkaClient(cfg *config.Config, cluster string) (*KafkaClient, error) {
 	clientConfig.Version = sarama.V0_10_2_0
 	profile := cfg.ClientProfile[cfg.Kafka[cluster].ClientProfile]
 	clientConfig.ClientID = profile.ClientId
-	clientConfig.Net.TLS.Enable = profile.TLS
-	if profile.TLSCertFilePath == "" || profile.TLSKeyFilePath == "" || profile.TLSCAFilePath == "" {
-		clientConfig.Net.TLS.Config = &tls.Config{}
-	} else {
-		caCert, err := ioutil.ReadFile(profile.TLSCAFilePath)
-		if err != nil {
-			return nil, err
-		}
-		cert, err := tls.LoadX509KeyPair(profile.TLSCertFilePath, profile.TLSKeyFilePath)
-		if err != nil {
-			return nil, err
-		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-		clientConfig.Net.TLS.Config = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			RootCAs:      caCertPool,
-		}
-		clientConfig.Net.TLS.Config.BuildNameToCertificate()
+	var err error
+	clientConfig.Net.TLS.Enable, clientConfig.Net.TLS.Config, err = profileTLS(profile, mylog.Module("fetcher").WithField("cluster", cluster))
+	if err != nil {
+		return nil, fmt.Errorf("client profile %s: %v", cfg.Kafka[cluster].ClientProfile, err)
 	}
-	clientConfig.Net.TLS.Config.InsecureSkipVerify = profile.TLSNoVerify
 
 	if cfg.Kafka[cluster].Sasl.Username != "" {
 		clientConfig.Net.SASL.Enable = true
 		clientConfig.Net.SASL.User = cfg.Kafka[cluster].Sasl.Username
 		clientConfig.Net.SASL.Password = cfg.Kafka[cluster].Sasl.Password
 	}
-	sclient, err := sarama.NewClient(strings.Split(cfg.Kafka[cluster].Brokers, ","), clientConfig)
+	if cfg.Kafka[cluster].Canary.Enable {
+		clientConfig.Producer.Return.Successes = true
+	}
+	flavorConfig(clientConfig, cfg.Kafka[cluster].Flavor)
+	if cfg.Kafka[cluster].Confluent.Bootstrap != "" {
+		confluentConfig(clientConfig)
+	}
+	if cfg.Kafka[cluster].EventHubs.ConnectionString != "" {
+		eventHubsConfig(clientConfig)
+	}
+	tuneConfig(clientConfig, profile)
+	if cfg.General.Proxy != "" {
+		dialer, err := proxyDialer(cfg.General.Proxy, &net.Dialer{Timeout: clientConfig.Net.DialTimeout})
+		if err != nil {
+			return nil, err
+		}
+		clientConfig.Net.Proxy.Enable = true
+		clientConfig.Net.Proxy.Dialer = dialer
+	}
+	brokers, err := resolveBrokers(cfg.Kafka[cluster].Brokers)
+	if err != nil {
+		return nil, err
+	}
+	sclient, err := sarama.NewClient(brokers, clientConfig)
 	if err != nil {
 		return nil, err
 	}
+	backend, err := newBackend(cfg, cluster, sclient)
+	if err != nil {
+		sclient.Close()
+		return nil, err
+	}
+	// a failing setup doesn't leave the connections behind
+	closeConns := func() {
+		backend.Close()
+		sclient.Close()
+	}
 
-	importer, err := NewImporter(cfg)
+	registry := metrics.NewRegistry()
+	importer, err := NewImporter(cfg, cluster, registry)
+	if err != nil {
+		closeConns()
+		return nil, err
+	}
+	if cfg.Kafka[cluster].Confluent.Bootstrap != "" {
+		id, err := clusterId(sclient)
+		if err != nil {
+			closeConns()
+			return nil, err
+		}
+		importer.tags["confluent_cluster_id"] = id
+	}
+	evaluator, err := NewEvaluator(cfg, cluster)
 	if err != nil {
+		closeConns()
 		return nil, err
 	}
 
 	client := &KafkaClient{
 		cluster:        cluster,
+		log:            mylog.Module("fetcher").WithField("cluster", cluster),
 		cfg:            cfg,
 		client:         sclient,
+		backend:        backend,
 		topicMap:       make(map[string]int),
 		topic2Consumer: make(map[string][]string),
+		groupState:     make(map[string]string),
+		partitionOwner: make(map[string]map[string]map[int32]*GroupMember),
+		members:        make(map[string][]*GroupMember),
+		groupSeen:      make(map[string]map[string]*Seen),
+		emptySince:     make(map[string]int64),
+		rebalances:     newRebalanceTracker(cfg.General.RebalanceStormCount, cfg.General.RebalanceStormMinutes),
 
 		schemaUpdateMtx: &sync.RWMutex{},
+		sweepRequests:   make(chan struct{}, 1),
 
 		topicOffset:        make(map[string]map[int32]int64),
+		topicOffsetStamp:   make(map[string]map[int32]sweepStamp),
+		started:            clockNow(),
+		topicStartOffset:   make(map[string]map[int32]int64),
+		unmoved:            make(map[string]map[int32]int),
+		topicStats:         NewTopicStats(cluster),
 		topicOffsetMapLock: &sync.RWMutex{},
 
-		importer: importer,
+		importer:  importer,
+		evaluator: evaluator,
+		tracer:    importer.tracer,
+		slos:      NewSLOTracker(cfg.SLOs),
+
+		brokerBreakers: make(map[int32]*brokerBreaker),
+
+		heartbeatLock: &sync.RWMutex{},
+
+		metrics:        registry,
+		sweepTimer:     metrics.GetOrRegisterTimer("offset-sweep", registry),
+		brokerFailures: metrics.GetOrRegisterCounter("broker-request-failures", registry),
+		fetchFailures:  metrics.GetOrRegisterCounter("offset-fetch-failures", registry),
+
+		staleBrokerOffsets: metrics.GetOrRegisterCounter("stale-broker-offsets", registry),
+		unknownTopics:      metrics.GetOrRegisterCounter("unknown-topics", registry),
+		unresolvedCommits:  metrics.GetOrRegisterCounter("unresolved-commits", registry),
+		sinkThrottled:      metrics.GetOrRegisterCounter("sink-throttled-records", registry),
+		cachedEndOffsets:   metrics.GetOrRegisterCounter("cached-end-offsets", registry),
+		errors:             newErrorCounters(registry),
+
+		warnLimiter: newWarnLimiter(registry),
 	}
+	client.quarantine = newQuarantine(cluster, client.log, client.warnLimiter, registry)
+	// replaced by Start, for the clients which are never started
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	registry.GetOrRegister("topics", metrics.NewFunctionalGauge(func() int64 {
+		client.schemaUpdateMtx.RLock()
+		defer client.schemaUpdateMtx.RUnlock()
+		return int64(len(client.topicMap))
+	}))
+	registry.GetOrRegister("groups", metrics.NewFunctionalGauge(func() int64 {
+		client.schemaUpdateMtx.RLock()
+		defer client.schemaUpdateMtx.RUnlock()
+		return int64(len(client.groupSeen))
+	}))
 
 	// TopicFilter
 	{
@@ -128,107 +334,638 @@ func NewKafkaClient(cfg *config.Config, cluster string) (*KafkaClient, error) {
 			client.groupFilterRegexps = append(client.groupFilterRegexps, regexp.MustCompile(p))
 		}
 	}
+	if groups := cfg.Kafka[cluster].Groups; len(groups) > 0 {
+		client.groupAllowlist = make(map[string]bool, len(groups))
+		for _, group := range groups {
+			client.groupAllowlist[group] = true
+		}
+	} else if cfg.General.LearnGroupsHours > 0 {
+		if client.learner, err = newGroupLearner(cluster, cfg.General.LearnGroupsHours, cfg.General.LearnGroupsDir, client.log); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("cannot read the learned groups: %v", err)
+		}
+	}
+
+	client.compactedRegexps = newCompactedRegexps(cfg.General.CompactedTopics)
+	client.schedule = newSweepSchedule(cfg)
+	client.evaluator.owners = importer.owners
+
+	// Close also stops the canary once it's created
+	if client.groupRewrites, err = newGroupRewrites(cfg.GroupRewrite); err != nil {
+		client.Close()
+		return nil, err
+	}
+	if client.router, err = newAlertRouter(cfg); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if cfg.Grafana.Url != "" {
+		if client.annotator, err = NewAnnotator(cfg, cluster); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	if cfg.Kafka[cluster].Canary.Enable {
+		client.canary, err = NewCanary(client)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if client.offsetsTopics, err = newOffsetsTopics(cfg, cluster); err != nil {
+		client.Close()
+		return nil, err
+	}
+	if cfg.General.CommitLatency {
+		client.commits = newCommitLatency(client)
+	}
 
 	return client, nil
 }
 
-func (client *KafkaClient) Start() {
+// tuneConfig applies the network and fetch settings of the profile, over the ones of confluent and event hubs
+func tuneConfig(c *sarama.Config, profile *config.Profile) {
+	if profile.DialTimeoutSeconds > 0 {
+		c.Net.DialTimeout = time.Duration(profile.DialTimeoutSeconds) * time.Second
+	}
+	if profile.ReadTimeoutSeconds > 0 {
+		c.Net.ReadTimeout = time.Duration(profile.ReadTimeoutSeconds) * time.Second
+	}
+	if profile.WriteTimeoutSeconds > 0 {
+		c.Net.WriteTimeout = time.Duration(profile.WriteTimeoutSeconds) * time.Second
+	}
+	if profile.FetchDefaultBytes > 0 {
+		c.Consumer.Fetch.Default = profile.FetchDefaultBytes
+	}
+	if profile.FetchMaxBytes > 0 {
+		c.Consumer.Fetch.Max = profile.FetchMaxBytes
+	}
+	if profile.ChannelBufferSize > 0 {
+		c.ChannelBufferSize = profile.ChannelBufferSize
+	}
+}
+
+// Start monitors the cluster until Stop or until ctx is done
+func (client *KafkaClient) Start(ctx context.Context) {
+	client.ctx, client.cancel = context.WithCancel(ctx)
 	client.importer.start()
+	// the end of the downtime to backfill, read before the first heartbeat of this run
+	var lastSweep int64
+	if client.cfg.General.BackfillMaxHours > 0 && !client.importer.dryRun {
+		var err error
+		if lastSweep, err = client.importer.lastSweep(client.cluster); err != nil {
+			client.log.Warnf("Cannot backfill the downtime, no last sweep: %v", err)
+		}
+	}
 	// Start the main processor goroutines for __consumer_offsets messages
 	client.RefreshMetaData()
-	client.getOffsets()
+	started := clockNow().UnixNano() / int64(time.Millisecond)
+	client.sweep()
+	if lastSweep > 0 {
+		client.wg.Add(1)
+		go func() {
+			defer client.wg.Done()
+			client.backfill(client.ctx, lastSweep, started)
+		}()
+	}
 
-	client.brokerOffsetTicker = time.NewTicker(time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second)
+	client.brokerOffsetTicker = clockTicker(time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second)
+	client.wg.Add(1)
 	go func() {
-		for _ = range client.brokerOffsetTicker.C {
-			client.getOffsets()
+		defer client.wg.Done()
+		for {
+			select {
+			case <-client.brokerOffsetTicker.C:
+				client.schedule.wait()
+			case <-client.sweepRequests:
+			case <-client.ctx.Done():
+				return
+			}
+			client.sweep()
 		}
 	}()
 
 	// Refresh metadata
+	client.metadataTicker = clockTicker(time.Duration(META_UPDATE_INTERVAL_SECOND) * time.Second)
+	client.wg.Add(1)
 	go func() {
-		ticker := time.NewTicker(time.Duration(META_UPDATE_INTERVAL_SECOND) * time.Second)
-		for _ = range ticker.C {
+		defer client.wg.Done()
+		for {
+			select {
+			case <-client.metadataTicker.C:
+			case <-client.ctx.Done():
+				return
+			}
+			if client.Paused() {
+				continue
+			}
+			client.schedule.wait()
 			client.RefreshMetaData()
+			client.importer.saveIdle(client.ctx, client.IdleGroups())
+			client.importer.saveClients(client.ctx, client.GroupClients())
+		}
+	}()
+
+	client.heartbeatTicker = clockTicker(time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second)
+	client.wg.Add(1)
+	go func() {
+		defer client.wg.Done()
+		for {
+			select {
+			case <-client.heartbeatTicker.C:
+			case <-client.ctx.Done():
+				return
+			}
+			if client.Paused() {
+				continue
+			}
+			client.heartbeat()
 		}
 	}()
+
+	if minutes := client.cfg.General.InventoryMinutes; minutes > 0 {
+		client.inventoryTicker = clockTicker(time.Duration(minutes) * time.Minute)
+		client.wg.Add(1)
+		go func() {
+			defer client.wg.Done()
+			for {
+				if !client.Paused() {
+					client.refreshInventory(client.ctx)
+				}
+				select {
+				case <-client.inventoryTicker.C:
+				case <-client.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if client.canary != nil {
+		client.canary.start()
+	}
+	if client.commits != nil {
+		if err := client.commits.start(); err != nil {
+			client.log.Errorf("Cannot consume the offsets topics, no commit latency: %v", err)
+			client.commits = nil
+		}
+	}
 }
 
-// Stop the client
-func (client *KafkaClient) Stop() {
-	// Stop the offset checker and the topic metdata refresh and request channel
+// Stop cancels the sweep in flight, which stops waiting for its broker requests, waits for the goroutines of the client, flushes
+// the queued points and closes the sinks, until ctx is done. The points not written by then are lost and counted.
+func (client *KafkaClient) Stop(ctx context.Context) error {
 	client.brokerOffsetTicker.Stop()
-	client.importer.stop()
+	client.metadataTicker.Stop()
+	client.heartbeatTicker.Stop()
+	if client.inventoryTicker != nil {
+		client.inventoryTicker.Stop()
+	}
+	client.cancel()
+	stopped := make(chan struct{})
+	go func() {
+		client.wg.Wait()
+		close(stopped)
+	}()
+	err := waitStopped(ctx, client.log, "the sweeps", stopped, func() string {
+		return fmt.Sprintf("%d records queued", client.importer.queued())
+	})
+	// the canary, the commit consumers and the sinks are stopped even if a sweep is stuck past the deadline
+	if client.canary != nil {
+		client.canary.stop()
+	}
+	if client.commits != nil {
+		client.commits.stop()
+	}
+	if err != nil {
+		client.log.Warnf("The sweeps didn't stop in time, dropping the queued records")
+	}
+	lost, e := client.importer.stop(ctx)
+	if lost > 0 {
+		client.log.Warnf("Lost %d in-flight records, not written to influxdb before the shutdown deadline", lost)
+	}
+	client.closeSinks(ctx)
+	if err == nil {
+		err = e
+	}
+	return err
+}
+
+// Pause stops sweeping the offsets and emitting points until Resume, keeping the state,
+// e.g. during a planned maintenance of the cluster
+func (client *KafkaClient) Pause() {
+	atomic.StoreInt32(&client.paused, 1)
+}
+
+// Resume restarts the monitoring of a paused cluster
+func (client *KafkaClient) Resume() {
+	atomic.StoreInt32(&client.paused, 0)
+}
+
+// Paused reports whether the monitoring of the cluster is paused
+func (client *KafkaClient) Paused() bool {
+	return atomic.LoadInt32(&client.paused) == 1
+}
+
+// Statuses returns the statuses of the groups at the last evaluation
+func (client *KafkaClient) Statuses() []*GroupStatus {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+	return client.statuses
+}
+
+// Stale reports whether no offset sweep succeeded in the last StaleIntervals intervals, a paused cluster isn't stale
+func (client *KafkaClient) Stale() bool {
+	if client.Paused() {
+		return false
+	}
+	var lastSweep, lastOffsetFetch time.Time
+	withReadLock(client.heartbeatLock, func() {
+		lastSweep, lastOffsetFetch = client.lastSweep, client.lastOffsetFetch
+	})
+	return client.stale(clockNow(), lastSweep, lastOffsetFetch)
+}
+
+func (client *KafkaClient) stale(now, lastSweep, lastOffsetFetch time.Time) bool {
+	staleAfter := time.Duration(client.cfg.General.StaleIntervals*METRIC_FETCH_INTERVAL_SECOND) * time.Second
+	return now.Sub(lastSweep) > staleAfter || now.Sub(lastOffsetFetch) > staleAfter
+}
+
+// heartbeat emits the monitor's own liveness, the data is stale if no offset sweep succeeded in the last StaleIntervals intervals
+func (client *KafkaClient) heartbeat() {
+	now := clockNow()
+	hb := &Heartbeat{
+		Cluster:   client.cluster,
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+	}
+	var lastSweep, lastOffsetFetch time.Time
+	withReadLock(client.heartbeatLock, func() {
+		lastSweep, lastOffsetFetch = client.lastSweep, client.lastOffsetFetch
+	})
+	hb.Stale = client.stale(now, lastSweep, lastOffsetFetch)
+	if !lastSweep.IsZero() {
+		hb.LastSweep = lastSweep.UnixNano() / int64(time.Millisecond)
+	}
+	if !lastOffsetFetch.IsZero() {
+		hb.LastOffsetFetch = lastOffsetFetch.UnixNano() / int64(time.Millisecond)
+	}
+	if hb.Stale {
+		client.log.Warnf("Offsets are stale, last sweep at %v, last offset fetch at %v", lastSweep, lastOffsetFetch)
+	}
+	client.importer.saveHeartbeat(client.ctx, hb)
+	client.importer.saveInternalMetrics(client.ctx, client.cluster, hb.Timestamp, client.metrics)
+}
+
+// sweep runs a sweep within general.sweepTimeoutSeconds
+func (client *KafkaClient) sweep() {
+	ctx, cancel := context.WithTimeout(client.ctx, time.Duration(client.cfg.General.SweepTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := client.getOffsets(ctx); err == context.DeadlineExceeded {
+		client.warnLimiter.warnf(client.log, "sweep-timeout", "Sweep cancelled after %ds", client.cfg.General.SweepTimeoutSeconds)
+	}
+}
+
+// getOffsets sweeps the log end offsets then the committed offsets of the groups and imports them, a sweep
+// cancelled by ctx returns its error and imports nothing
+func (client *KafkaClient) getOffsets(ctx context.Context) error {
+	if client.Paused() {
+		return nil
+	}
+	if client.sweepSlots != nil {
+		select {
+		case client.sweepSlots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-client.sweepSlots }()
+	}
+	// the network requests run from a snapshot, schemaUpdateMtx is only held to copy it and to evaluate
+	var snap *sweepSnapshot
+	withReadLock(client.schemaUpdateMtx, func() {
+		snap = client.snapshot()
+	})
+	ctx, sp := startSpan(ctx, client.tracer, "sweep")
+	sp.setAttr("cluster", client.cluster)
+	endCtx, endSpan := startSpan(ctx, nil, "sweep.end_offsets")
+	err := client.sweepOffsets(endCtx, snap)
+	endSpan.finish(err)
+	if err == nil {
+		err = client.offsetFetchImport(ctx, snap)
+	}
+	sp.finish(err)
+	return err
+}
+
+// Dump refreshes the metadata, then fetches the broker and consumer offsets once, without importing them
+func (client *KafkaClient) Dump(ctx context.Context) (map[string][]*ConsumerFullOffset, error) {
+	client.RefreshMetaData()
+
+	var snap *sweepSnapshot
+	withReadLock(client.schemaUpdateMtx, func() {
+		snap = client.snapshot()
+	})
+	if err := client.sweepOffsets(ctx, snap); err != nil {
+		return nil, err
+	}
+	groupOffsets := client.fetchConsumerOffsets(ctx, snap, clockNow().UnixNano()/int64(time.Millisecond))
+	return groupOffsets, ctx.Err()
+}
+
+// Close the connections of the client, the producer and the consumer group of the canary and the consumer of
+// the commit latency included, only needed if it was never started, e.g. by dump and top
+func (client *KafkaClient) Close() error {
+	if client.canary != nil {
+		client.canary.stop()
+	}
+	if client.commits != nil {
+		client.commits.stop()
+	}
+	client.backend.Close()
+	return client.client.Close()
 }
 
+// sweepOffsets fetches the newest offsets of the topics of the snapshot, only the sweep goroutine calls it.
 // This function performs massively parallel OffsetRequests, which is better than Sarama's internal implementation,
 // which does one at a time. Several orders of magnitude faster.
-func (client *KafkaClient) getOffsets() error {
+func (client *KafkaClient) sweepOffsets(ctx context.Context, snap *sweepSnapshot) error {
 	var (
-		offsetsReqs = make(map[int32]*sarama.OffsetRequest)
-		brokers     = make(map[int32]*sarama.Broker)
+		offsetsReqs = make(leaderRequests)
+		//broker => address
+		brokers = make(map[int32]string)
+		//broker => partitions requested
+		requested   = make(map[int32]int)
 		offsetReqWg sync.WaitGroup
+		sweepFailed int32
+		latencies   []*BrokerLatency
+		latencyLock sync.Mutex
+		//topic => idle partitions whose log end offset isn't fetched this sweep
+		cached = make(map[string][]int32)
 	)
 
-	client.schemaUpdateMtx.Lock()
-	defer client.schemaUpdateMtx.Unlock()
+	defer client.sweepTimer.UpdateSince(time.Now())
+	// updateUnmoved counts the sweep once it's done
+	seq := client.sweeps + 1
 
 	// Generate an OffsetRequest for each topic:partition and bucket it to the leader broker
-	for topic, partitions := range client.topicMap {
+	for topic, partitions := range snap.topicMap {
+		if client.cfg.General.Shards > 1 && len(snap.topic2Consumer[topic]) == 0 {
+			// consumed by the groups of other shards at most
+			continue
+		}
 		for i := 0; i < partitions; i++ {
-			broker, err := client.client.Leader(topic, int32(i))
-			if err != nil {
-				log.Errorf("Topic leader error on %s:%v: %v", topic, int32(i), err)
-				return err
+			if client.endOffsetCached(topic, int32(i)) {
+				cached[topic] = append(cached[topic], int32(i))
+				continue
 			}
-			if _, ok := offsetsReqs[broker.ID()]; !ok {
-				offsetsReqs[broker.ID()] = &sarama.OffsetRequest{}
+			broker, addr, err := client.backend.Leader(topic, int32(i))
+			if err != nil {
+				client.failed(client.log.WithFields(logrus.Fields{"topic": topic, "partition": i}), "", err).Errorf("Topic leader error: %v", err)
+				return &MonitorError{Kind: kindOf(err), Cluster: client.cluster, Err: err}
 			}
-			brokers[broker.ID()] = broker
-			offsetsReqs[broker.ID()].AddBlock(topic, int32(i), sarama.OffsetNewest, 1)
+			brokers[broker] = addr
+			requested[broker]++
+			offsetsReqs.add(broker, topic, int32(i))
 		}
 	}
 
-	offsetReqFunc := func(brokerId int32, request *sarama.OffsetRequest) {
+	offsetReqFunc := func(brokerId int32, request map[string][]int32, breaker *brokerBreaker) {
 		defer offsetReqWg.Done()
-		response, err := brokers[brokerId].GetAvailableOffsets(request)
+		_, sp := startSpan(ctx, nil, "broker.list_offsets")
+		sp.setAttr("broker", brokerId)
+		sp.setAttr("addr", brokers[brokerId])
+		sp.setAttr("partitions", requested[brokerId])
+		var spanErr error
+		defer func() { sp.finish(spanErr) }()
+		start := time.Now()
+		response, err := client.backend.ListOffsets(ctx, brokerId, request, sarama.OffsetNewest)
+		if err == nil && injectFault(faults.brokerRate) {
+			err = errInjected
+		}
+		if ctx.Err() != nil {
+			// cancelled, not the failure of the broker
+			breaker.cancel()
+			spanErr = ctx.Err()
+			atomic.StoreInt32(&sweepFailed, 1)
+			return
+		}
+		latency := &BrokerLatency{Broker: brokerId, Addr: brokers[brokerId], Latency: time.Since(start), OK: err == nil}
+		latencyLock.Lock()
+		latencies = append(latencies, latency)
+		latencyLock.Unlock()
 		if err != nil {
-			log.Errorf("Cannot fetch offsets from broker %v: %v", brokerId, err)
-			_ = brokers[brokerId].Close()
+			spanErr = err
+			log := client.failed(client.log.WithField("broker", brokerId), "", err)
+			if breaker.failure(clockNow()) {
+				log.Errorf("Cannot fetch offsets from broker: %v, backing off the broker", err)
+			} else {
+				log.Warnf("Cannot fetch offsets from broker: %v", err)
+			}
+			client.brokerFailures.Inc(1)
+			atomic.StoreInt32(&sweepFailed, 1)
+			return
+		}
+		if breaker.success() {
+			client.log.WithField("broker", brokerId).Infof("Broker recovered, offset requests resumed")
+		}
+		topicOffsetMap, ok := client.parseOffsetResponse(brokerId, response)
+		if !ok {
 			return
 		}
-		topicOffsetMap := make(map[string]map[int32]int64)
-		for topic, partitions := range response.Blocks {
-			if _, ok := topicOffsetMap[topic]; !ok {
-				topicOffsetMap[topic] = map[int32]int64{}
+		client.flagRewoundLogs(topicOffsetMap)
+		client.MergeMaps(topicOffsetMap)
+		client.stampOffsets(topicOffsetMap, seq)
+
+		if client.cfg.General.FetchStartOffsets {
+			response, err := client.backend.ListOffsets(ctx, brokerId, request, sarama.OffsetOldest)
+			if err != nil {
+				client.warnLimiter.warnf(client.failed(client.log.WithField("broker", brokerId), "", err), "start-offsets:"+fmt.Sprint(brokerId), "Cannot fetch start offsets from broker: %v", err)
+				return
 			}
-			tp := topicOffsetMap[topic]
-			for partition, offsetResponse := range partitions {
-				if offsetResponse.Err != sarama.ErrNoError {
-					log.Warnf("Error in OffsetResponse for %s:%v from broker %v: %s", topic, partition, brokerId, offsetResponse.Err.Error())
-					return
-				}
-				tp[partition] = offsetResponse.Offsets[0]
+			if startOffsetMap, ok := client.parseOffsetResponse(brokerId, response); ok {
+				withWriteLock(client.topicOffsetMapLock, func() {
+					for topic, partitions := range startOffsetMap {
+						if _, ok := client.topicStartOffset[topic]; !ok {
+							client.topicStartOffset[topic] = partitions
+							continue
+						}
+						for partition, offset := range partitions {
+							client.topicStartOffset[topic][partition] = offset
+						}
+					}
+				})
 			}
 		}
-		client.MergeMaps(topicOffsetMap)
 	}
 	//initial
-	client.topicOffset = make(map[string]map[int32]int64)
+	var previousStartOffset map[string]map[int32]int64
+	withWriteLock(client.topicOffsetMapLock, func() {
+		client.previousTopicOffset, previousStartOffset = client.topicOffset, client.topicStartOffset
+		client.previousTopicOffsetStamp = client.topicOffsetStamp
+		client.topicOffset = make(map[string]map[int32]int64)
+		client.topicOffsetStamp = make(map[string]map[int32]sweepStamp)
+		client.topicStartOffset = make(map[string]map[int32]int64)
+	})
+	now := clockNow()
 	for brokerId, request := range offsetsReqs {
+		breaker, ok := client.brokerBreakers[brokerId]
+		if !ok {
+			breaker = &brokerBreaker{}
+			client.brokerBreakers[brokerId] = breaker
+		}
+		if !breaker.allow(now) {
+			client.log.WithField("broker", brokerId).Debugf("Skip offset request to broker, it is backing off")
+			atomic.StoreInt32(&sweepFailed, 1)
+			continue
+		}
 		offsetReqWg.Add(1)
-		go offsetReqFunc(brokerId, request)
-
+		go offsetReqFunc(brokerId, request, breaker)
 	}
 	offsetReqWg.Wait()
-	client.offsetFetchImport()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	client.updateUnmoved(snap, cached, previousStartOffset)
+	client.importer.saveBrokerLatencies(ctx, client.cluster, now.UnixNano()/int64(time.Millisecond), latencies)
+	if atomic.LoadInt32(&sweepFailed) == 0 {
+		withWriteLock(client.heartbeatLock, func() {
+			client.lastSweep = clockNow()
+		})
+	}
+	return nil
+}
+
+// parseOffsetResponse returns topic => partition => offset of the response, or false if a partition failed
+func (client *KafkaClient) parseOffsetResponse(brokerId int32, response map[string]map[int32]PartitionOffset) (map[string]map[int32]int64, bool) {
+	if injectFault(faults.decodeRate) {
+		client.warnLimiter.warnf(client.failed(client.log.WithField("broker", brokerId), ErrorDecode, errInjected),
+			"offset-response-fault", "Error in OffsetResponse: %v", errInjected)
+		return nil, false
+	}
+	topicOffsetMap := make(map[string]map[int32]int64)
+	for topic, partitions := range response {
+		if _, ok := topicOffsetMap[topic]; !ok {
+			topicOffsetMap[topic] = map[int32]int64{}
+		}
+		tp := topicOffsetMap[topic]
+		for partition, offsetResponse := range partitions {
+			if offsetResponse.Err != nil {
+				client.warnLimiter.warnf(client.failed(client.log.WithFields(logrus.Fields{"topic": topic, "partition": partition, "broker": brokerId}), "", offsetResponse.Err),
+					"offset-response:"+topic, "Error in OffsetResponse: %s", offsetResponse.Err.Error())
+				return nil, false
+			}
+			if offsetResponse.Offset < 0 {
+				record := &QuarantinedRecord{Source: "offset-response", Topic: topic, Partition: partition, Offset: -1, Reason: "no offset", Dropped: true}
+				if offsetResponse.Offset != -1 {
+					record.Offset, record.Reason = offsetResponse.Offset, "negative offset"
+				}
+				client.quarantine.add(record)
+				continue
+			}
+			tp[partition] = offsetResponse.Offset
+		}
+	}
+	return topicOffsetMap, true
+}
+
+func (client *KafkaClient) offsetFetchImport(ctx context.Context, snap *sweepSnapshot) error {
+	var ts = sweepNow().Unix() / int64(METRIC_FETCH_INTERVAL_SECOND) * int64(METRIC_FETCH_INTERVAL_SECOND) * 1000
+	fetchCtx, fetchSpan := startSpan(ctx, nil, "sweep.committed_offsets")
+	groupOffsets := client.fetchConsumerOffsets(fetchCtx, snap, ts)
+	fetchSpan.setAttr("groups", len(groupOffsets))
+	fetchSpan.finish(ctx.Err())
+	if err := ctx.Err(); err != nil {
+		// the groups missing from a partial sweep would be forgotten by the evaluation
+		return err
+	}
+	if client.recorder != nil {
+		if err := client.recorder.record(groupOffsets); err != nil {
+			client.log.Errorf("Cannot record offsets: %v", err)
+		}
+	}
+	deferred := client.queueOffsets(groupOffsets)
+	inRates := make(map[string]float64)
+	withReadLock(client.topicOffsetMapLock, func() {
+		stats, fresh := client.topicStats.update(ts, client.topicOffset, client.topicStartOffset)
+		for _, stat := range stats {
+			inRates[stat.Topic] = stat.InRate
+		}
+		if fresh {
+			for _, stat := range stats {
+				stat.Config = snap.topicConfigs[stat.Topic]
+			}
+			client.importer.saveTopics(ctx, stats)
+		}
+	})
+	if client.commits != nil {
+		if err := client.commits.measureLag(ctx); err != nil {
+			client.warnLimiter.warnf(client.log, "consumer-offsets-lag", "Cannot measure the lag of the consumption of the offsets topics: %v", err)
+		}
+	}
+	var statuses []*GroupStatus
+	var slos []*SLOStatus
+	_, evalSpan := startSpan(ctx, nil, "sweep.evaluate")
+	withWriteLock(client.schemaUpdateMtx, func() {
+		statuses = client.evaluator.evaluate(ts, groupOffsets)
+		client.rebalances.apply(client.groupRewrites, statuses)
+		if client.commits != nil {
+			client.commits.apply(statuses)
+		}
+		client.router.route(statuses, clockNow())
+		client.statuses = statuses
+		client.inRates = inRates
+		slos = client.slos.track(statuses)
+	})
+	evalSpan.setAttr("groups", len(statuses))
+	evalSpan.finish(nil)
+	client.emitEvents(client.commitEvents(ts, groupOffsets, statuses))
+	client.importer.saveStatus(ctx, statuses)
+	client.importer.saveSLOs(ctx, slos)
+	if client.annotator != nil {
+		client.annotator.annotate(statuses)
+	}
+	now := clockNow()
+	records := sinkRecords(groupOffsets, statuses)
+	for i, sink := range client.sinks {
+		window := client.sinkWindow(i)
+		if !window.active(now) {
+			continue
+		}
+		offsets, saved := groupOffsets, records
+		if i < len(client.sinkThrottles) && client.sinkThrottles[i] != nil && !client.sinkThrottles[i].take(records) {
+			// over its rate the sink gets the statuses only, the aggregates of the groups
+			client.sinkThrottles[i].force(len(statuses))
+			client.sinkThrottled.Inc(int64(records - len(statuses)))
+			offsets, saved = map[string][]*ConsumerFullOffset{}, len(statuses)
+		}
+		_, sp := startSpan(ctx, nil, "sink.save")
+		sp.setAttr("sink", sink.Name())
+		sp.setAttr("records", saved)
+		injectSinkLatency()
+		err := sink.Save(client.cluster, offsets, statuses)
+		sp.finish(err)
+		window.record(sink, now, saved, client.importer.writtenPoints.Count(), err)
+		if err != nil {
+			client.warnLimiter.warnf(client.failed(client.log.WithField("sink", sink.Name()), ErrorSink, err), "sink:"+sink.Name(), "Sink failed: %v", err)
+		}
+	}
+	client.importer.saveSeen(ctx, client.cluster, ts, snap.groupSeen)
+	withWriteLock(client.heartbeatLock, func() {
+		client.lastOffsetFetch = clockNow()
+	})
+	client.importer.saveHealth(ctx, client.health(clockNow(), statuses))
+	for _, msg := range deferred {
+		client.importer.saveMsg(msg)
+	}
 	return nil
 }
 
-func (client *KafkaClient) offsetFetchImport() {
-	var ts = time.Now().Unix() / int64(METRIC_FETCH_INTERVAL_SECOND) * int64(METRIC_FETCH_INTERVAL_SECOND) * 1000
-	//offset manager
-	for topic, consumers := range client.topic2Consumer {
+// fetchConsumerOffsets fetches the committed offsets of the groups of the snapshot and computes their lag from
+// the last sweep, it returns group => offsets per topic
+func (client *KafkaClient) fetchConsumerOffsets(ctx context.Context, snap *sweepSnapshot, ts int64) map[string][]*ConsumerFullOffset {
+	groupOffsets := make(map[string][]*ConsumerFullOffset)
+	for topic, consumers := range snap.topic2Consumer {
 		for _, consumer := range consumers {
 			msg := &ConsumerFullOffset{
 				Cluster:      client.cluster,
@@ -237,28 +974,140 @@ func (client *KafkaClient) offsetFetchImport() {
 				Timestamp:    ts,
 				partitionMap: make(map[int32]LogOffset),
 			}
+			if config, ok := snap.topicConfigs[topic]; ok {
+				msg.CleanupPolicy = config.CleanupPolicy
+			}
+			if seen, ok := snap.groupSeen[consumer][topic]; ok {
+				msg.FirstSeen, msg.LastSeen = seen.FirstSeen, seen.LastSeen
+			}
 
-			manager, _ := sarama.NewOffsetManagerFromClient(consumer, client.client)
-			defer manager.Close()
+			blocks, err := client.fetchCommittedOffsets(ctx, consumer, topic, snap.topicMap[topic])
+			if ctx.Err() != nil {
+				return groupOffsets
+			}
+			if err != nil {
+				client.warnLimiter.warnf(client.failed(client.log.WithFields(logrus.Fields{"topic": topic, "group": consumer}), "", err),
+					"offset-fetch:"+consumer+":"+topic, "Cannot fetch offsets of group: %v", err)
+				client.fetchFailures.Inc(1)
+				continue
+			}
+			var logsizes, previousLogsizes, logStarts map[int32]int64
+			var stamps, previousStamps map[int32]sweepStamp
+			withReadLock(client.topicOffsetMapLock, func() {
+				logsizes, logStarts = client.topicOffset[topic], client.topicStartOffset[topic]
+				previousLogsizes = client.previousTopicOffset[topic]
+				stamps, previousStamps = client.topicOffsetStamp[topic], client.previousTopicOffsetStamp[topic]
+			})
+			owners := snap.partitionOwner[consumer][topic]
 			var parition int32
-			for parition = 0; parition < int32(client.topicMap[topic]); parition++ {
-				pmanager, _ := manager.ManagePartition(topic, parition)
-				offset, _ := pmanager.NextOffset()
-
+			for parition = 0; parition < int32(snap.topicMap[topic]); parition++ {
+				// the commit is matched to the latest sweep which fetched the log end offset of the partition
+				logsize, ok := logsizes[parition]
+				stamp := stamps[parition]
+				if !ok {
+					// the broker of the partition failed this sweep, its commit is resolved against the
+					// log end offset of the previous sweep, at most one interval old
+					logsize, ok = previousLogsizes[parition]
+					stamp = previousStamps[parition]
+				}
+				if !ok {
+					// a lag computed from no log end offset would be negative
+					client.unresolvedCommits.Inc(1)
+					client.log.WithFields(logrus.Fields{"topic": topic, "group": consumer, "partition": parition}).
+						Debugf("No log end offset in the last two sweeps, skipping the commit")
+					continue
+				}
 				logOffset := LogOffset{
-					Logsize: client.topicOffset[topic][parition],
-					Offset:  offset,
+					Logsize:     logsize,
+					LogStart:    logStarts[parition],
+					Offset:      -1,
+					LeaderEpoch: -1,
+					GroupState:  snap.groupState[consumer],
+					Reassigning: snap.reassigning[topic][parition],
+					Sweep:       stamp.seq,
+					sweptAt:     stamp.at,
+				}
+				if block, ok := blocks[parition]; ok && block.Err == sarama.ErrNoError && block.Offset < -1 {
+					client.quarantine.add(&QuarantinedRecord{Source: "offset-fetch", Group: consumer, Topic: topic, Partition: parition,
+						Offset: block.Offset, Reason: "negative offset", Dropped: true})
+				} else if ok && block.Err == sarama.ErrNoError {
+					logOffset.Offset = block.Offset
+					logOffset.LeaderEpoch = block.LeaderEpoch
+					logOffset.Metadata = block.Metadata
+				} else if ok && isAuthorizationError(block.Err) {
+					client.warnLimiter.warnf(client.failed(client.log.WithFields(logrus.Fields{"topic": topic, "group": consumer}), ErrorAuth, block.Err),
+						"offset-fetch-acl:"+consumer+":"+topic, "Not allowed to fetch the offsets of the group: %v, check the Describe ACLs of the group and topic", block.Err)
 				}
 				if logOffset.Logsize < logOffset.Offset && logOffset.Logsize != 0 {
-					logOffset.Offset = logOffset.Logsize
+					// the log end offset was fetched before the commit, or reused while the partition moved
+					client.resetUnmoved(topic, parition)
+					logOffset.StaleBrokerOffset = true
+					client.staleBrokerOffsets.Inc(1)
+					client.log.WithFields(logrus.Fields{"topic": topic, "group": consumer, "partition": parition}).
+						Debugf("Committed offset %d ahead of the log end offset %d, %s", logOffset.Offset, logOffset.Logsize, client.cfg.General.StaleBrokerOffset)
+					switch client.cfg.General.StaleBrokerOffset {
+					case "drop":
+						logOffset.Offset = -1
+					case "clamp":
+						logOffset.Offset = logOffset.Logsize
+					}
+				}
+				if logOffset.StaleBrokerOffset && logOffset.Offset >= 0 {
+					logOffset.Lag = 0
+				} else if logOffset.Offset >= 0 {
+					logOffset.Lag = logOffset.Logsize - logOffset.Offset
+				} else {
+					logOffset.Lag = -1
+				}
+				if owner, ok := owners[parition]; ok {
+					logOffset.Owner = owner.MemberId
+					logOffset.ClientID = owner.ClientId
+					logOffset.ClientHost = owner.ClientHost
 				}
 				msg.partitionMap[parition] = logOffset
 			}
 			if len(msg.partitionMap) > 0 {
-				client.importer.saveMsg(msg)
+				groupOffsets[consumer] = append(groupOffsets[consumer], msg)
 			}
 		}
 	}
+	if client.learner != nil {
+		client.learner.observe(ts, groupOffsets)
+	}
+	return rewriteGroups(client.groupRewrites, groupOffsets)
+}
+
+// fetchCommittedOffsets sends an OffsetFetchRequest for all partitions of the topic to the group coordinator
+func (client *KafkaClient) fetchCommittedOffsets(ctx context.Context, group, topic string, partitions int) (map[int32]*sarama.OffsetFetchResponseBlock, error) {
+	coordinator, err := client.client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+	request := &sarama.OffsetFetchRequest{ConsumerGroup: group, Version: 1}
+	if client.client.Config().Version.IsAtLeast(sarama.V2_1_0_0) {
+		// leader epoch is returned since v5
+		request.Version = 5
+	}
+	var i int32
+	for i = 0; i < int32(partitions); i++ {
+		request.AddPartition(topic, i)
+	}
+	var response *sarama.OffsetFetchResponse
+	err = withContext(ctx, func() (err error) {
+		response, err = coordinator.FetchOffset(request)
+		return
+	})
+	if err == nil && injectFault(faults.brokerRate) {
+		err = errInjected
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			// cancelled requests don't close the shared broker
+			_ = coordinator.Close()
+		}
+		return nil, err
+	}
+	return response.Blocks[topic], nil
 }
 
 // MergeMaps merge the offset of the topic
@@ -276,35 +1125,66 @@ func (client *KafkaClient) MergeMaps(topicOffsetMap map[string]map[int32]int64)
 	})
 }
 
+// RefreshMetaData refreshes the topics, the groups and their members. The requests to the brokers are sent
+// without schemaUpdateMtx, the sweeps and the api only wait for the results to be swapped in.
 func (client *KafkaClient) RefreshMetaData() {
-	client.schemaUpdateMtx.Lock()
-	defer client.schemaUpdateMtx.Unlock()
+	client.refreshLock.Lock()
+	defer client.refreshLock.Unlock()
+	client.importer.owners.refresh()
 
-	topics, _ := client.client.Topics()
-	//filter topic by topicFilter
-	for _, topic := range topics {
-		if topic == "__consumer_offsets" {
-			continue
+	// only the refresh changes the topics, the copy is the next topicMap
+	var previous map[string]int
+	withReadLock(client.schemaUpdateMtx, func() {
+		previous = make(map[string]int, len(client.topicMap))
+		for topic, partitions := range client.topicMap {
+			previous[topic] = partitions
 		}
-		for _, reg := range client.topicFilterRegexps {
-			if reg.MatchString(topic) {
-				partitions, _ := client.client.Partitions(topic)
-				client.topicMap[topic] = len(partitions)
-				break
-			}
+	})
+	topicMap := make(map[string]int, len(previous))
+	for topic, partitions := range previous {
+		topicMap[topic] = partitions
+	}
+	if topics := client.cfg.Kafka[client.cluster].Topics; len(topics) > 0 {
+		client.refreshTopics(topics, topicMap)
+	} else {
+		// the cached metadata would only show the added partitions every Metadata.RefreshFrequency
+		if err := client.backend.RefreshMetadata(); err != nil {
+			client.warnLimiter.warnf(client.log, "topics-metadata", "Cannot refresh the metadata of the topics: %v", err)
 		}
+		topics, _ := client.backend.Topics()
+		//filter topic by topicFilter
+		for _, topic := range topics {
+			if internalTopic(client.cfg.Kafka[client.cluster].Flavor, topic) {
+				continue
+			}
+			for _, reg := range client.topicFilterRegexps {
+				if reg.MatchString(topic) {
+					partitions, _ := client.backend.Partitions(topic)
+					topicMap[topic] = len(partitions)
+					break
+				}
+			}
 
+		}
+	}
+	// swapTopics swaps in the topics and returns the partitions added since the previous refresh
+	swapTopics := func() map[string][]int32 {
+		client.topicMap = topicMap
+		return client.addedPartitions(previous)
 	}
 
 	// list groups
 	groups := map[string]bool{}
+	// a group missing from a partial listing isn't gone
+	listedAll := true
 	for _, broker := range client.client.Brokers() {
 		if ok, _ := broker.Connected(); !ok {
 			broker.Open(client.client.Config())
 		}
 		resp, err := broker.ListGroups(&sarama.ListGroupsRequest{})
 		if err != nil {
-			log.Warnf("ListGroups error : %v", err)
+			client.failed(client.log.WithField("broker", broker.ID()), "", err).Warnf("ListGroups error : %v", err)
+			listedAll = false
 			continue
 		}
 		for group := range resp.Groups {
@@ -316,6 +1196,9 @@ func (client *KafkaClient) RefreshMetaData() {
 		if group == "" {
 			continue
 		}
+		if !client.ownsGroup(group) || !client.allowsGroup(group) {
+			continue
+		}
 		for _, reg := range client.groupFilterRegexps {
 			if reg.MatchString(group) {
 				groupList = append(groupList, group)
@@ -326,11 +1209,23 @@ func (client *KafkaClient) RefreshMetaData() {
 
 	//group description
 	topic2Consumer := map[string]map[string]bool{}
+	groupState := map[string]string{}
+	groupMembers := map[string][]string{}
+	partitionOwner := map[string]map[string]map[int32]*GroupMember{}
+	members := map[string][]*GroupMember{}
+	//topic => groups, of the topics missing from the metadata
+	unknownTopics := map[string]map[string]bool{}
 	groupsPerBroker := make(map[*sarama.Broker][]string)
+	var descs []*sarama.GroupDescription
 	for _, group := range groupList {
 		controller, err := client.client.Coordinator(group)
 		if err != nil {
-			log.Warnf("Coordinator group:%s error : %v", group, err)
+			client.warnLimiter.warnf(client.failed(client.log.WithField("group", group), "", err), "coordinator:"+group, "Coordinator error : %v", err)
+			var added map[string][]int32
+			withWriteLock(client.schemaUpdateMtx, func() {
+				added = swapTopics()
+			})
+			client.partitionsAdded(added)
 			return
 		}
 		groupsPerBroker[controller] = append(groupsPerBroker[controller], group)
@@ -341,18 +1236,42 @@ func (client *KafkaClient) RefreshMetaData() {
 			Groups: brokerGroups,
 		})
 		if err != nil {
-			log.Warnf("get groupDescribe fail:%v", err)
+			client.failed(client.log.WithField("broker", broker.ID()), "", err).Warnf("get groupDescribe fail:%v", err)
 			continue
 		}
+		descs = append(descs, response.Groups...)
 		for _, desc := range response.Groups {
-			for _, gmd := range desc.Members {
-				metadata, err2 := gmd.GetMemberMetadata()
+			groupState[desc.GroupId] = desc.State
+			for memberId, gmd := range desc.Members {
+				groupMembers[desc.GroupId] = append(groupMembers[desc.GroupId], memberId)
+				member := &GroupMember{MemberId: memberId, ClientId: gmd.ClientId, ClientHost: gmd.ClientHost}
+				members[desc.GroupId] = append(members[desc.GroupId], member)
+				if assignment, err := gmd.GetMemberAssignment(); err == nil {
+					for topic, partitions := range assignment.Topics {
+						if _, ok := partitionOwner[desc.GroupId]; !ok {
+							partitionOwner[desc.GroupId] = make(map[string]map[int32]*GroupMember)
+						}
+						if _, ok := partitionOwner[desc.GroupId][topic]; !ok {
+							partitionOwner[desc.GroupId][topic] = make(map[int32]*GroupMember)
+						}
+						for _, partition := range partitions {
+							partitionOwner[desc.GroupId][topic][partition] = member
+						}
+					}
+				}
+				metadata, err2 := decodeMemberMetadata(gmd.MemberMetadata)
 				if err2 != nil {
-					log.Warnf("GetMemberMetadata error : %v", err)
+					client.warnLimiter.warnf(client.failed(client.log.WithField("group", desc.GroupId), ErrorDecode, err2), "member-metadata:"+desc.GroupId, "GetMemberMetadata error : %v", err2)
 					continue
 				} else {
 					for _, topic := range metadata.Topics {
-						if _, ok := client.topicMap[topic]; !ok {
+						if _, ok := topicMap[topic]; !ok {
+							if client.monitorsTopic(topic) {
+								if _, ok := unknownTopics[topic]; !ok {
+									unknownTopics[topic] = make(map[string]bool)
+								}
+								unknownTopics[topic][desc.GroupId] = true
+							}
 							continue
 						}
 						if _, ok := topic2Consumer[topic]; !ok {
@@ -365,21 +1284,95 @@ func (client *KafkaClient) RefreshMetaData() {
 		}
 	}
 
+	client.resolveUnknownTopics(unknownTopics, topic2Consumer, topicMap)
+	var topicConfigs map[string]*TopicConfig
+	var retention map[string]float64
+	if client.cfg.General.FetchStartOffsets || client.cfg.General.DescribeTopicConfigs {
+		topicConfigs, retention = client.describeTopicConfigs(topicMap)
+	}
+	refreshed := false
+	if client.cfg.General.DetectReassignments || client.cfg.General.BrokerHealth {
+		// the offset requests only refresh the metadata of the failing partitions
+		if err := client.client.RefreshMetadata(); err != nil {
+			client.warnLimiter.warnf(client.log, "metadata", "Cannot refresh the metadata: %v", err)
+		} else {
+			refreshed = true
+			if client.cfg.General.BrokerHealth {
+				client.updateBrokerHealth()
+			}
+		}
+	}
+	clients := groupClients(client.cluster, descs)
+
+	var added map[string][]int32
+	var vanished []*Event
+	withWriteLock(client.schemaUpdateMtx, func() {
+		added = swapTopics()
+		client.missingTopics = unknownTopics
+		if listedAll {
+			vanished = client.vanishedEvents(groups)
+		}
+		client.groupState = groupState
+		client.groupClients = clients
+		client.updateEmpty(groupState)
+		if topicConfigs != nil {
+			client.topicConfigs = topicConfigs
+			client.evaluator.retention = retention
+		}
+		client.updateCompacted()
+		if refreshed && client.cfg.General.DetectReassignments {
+			client.updateReassigning()
+		}
+		client.rebalances.observe(groupState, groupMembers)
+		client.partitionOwner = partitionOwner
+		client.members = members
+		client.updateSeen(topic2Consumer)
+		for topic, consumerMap := range topic2Consumer {
+			client.topic2Consumer[topic] = make([]string, 0, len(consumerMap))
+			for group := range consumerMap {
+				if group == "" {
+					continue
+				}
+				for _, reg := range client.groupFilterRegexps {
+					if reg.MatchString(group) {
+						break
+					}
+				}
+				client.topic2Consumer[topic] = append(client.topic2Consumer[topic], group)
+			}
+		}
+		client.log.Debugf("topic2Consumer %v", client.topic2Consumer)
+	})
+	client.partitionsAdded(added)
+	client.emitEvents(vanished)
+}
+
+// updateSeen marks the observed group and topic pairings as seen now, and forgets the ones expired
+func (client *KafkaClient) updateSeen(topic2Consumer map[string]map[string]bool) {
+	now := clockNow().UnixNano() / int64(time.Millisecond)
 	for topic, consumerMap := range topic2Consumer {
-		client.topic2Consumer[topic] = make([]string, 0, len(consumerMap))
 		for group := range consumerMap {
-			if group == "" {
-				continue
+			if _, ok := client.groupSeen[group]; !ok {
+				client.groupSeen[group] = make(map[string]*Seen)
 			}
-			for _, reg := range client.groupFilterRegexps {
-				if reg.MatchString(group) {
-					break
-				}
+			if seen, ok := client.groupSeen[group][topic]; ok {
+				seen.LastSeen = now
+			} else {
+				client.groupSeen[group][topic] = &Seen{FirstSeen: now, LastSeen: now}
 			}
-			client.topic2Consumer[topic] = append(client.topic2Consumer[topic], group)
 		}
 	}
-	log.Debugf("topic2Consumer %v \n", client.topic2Consumer)
+	expired := now - int64(SEEN_EXPIRE_SECOND)*1000
+	for group, topics := range client.groupSeen {
+		for topic, seen := range topics {
+			if seen.LastSeen < expired {
+				delete(topics, topic)
+			}
+		}
+		if len(topics) == 0 {
+			delete(client.groupSeen, group)
+		}
+	}
 }
 
 func withWriteLock(lock *sync.RWMutex, fn func()) {
@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	"github.com/sundy-li/burrowx/monitor/monitortest"
+)
+
+func TestSweep(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	c.AddTopic("orders", 2)
+	c.AddGroup("billing", "orders")
+	c.SetLogsize("orders", 0, 100)
+	c.SetLogsize("orders", 1, 80)
+	c.Commit("billing", "orders", 0, 60)
+	c.Commit("billing", "orders", 1, 80)
+
+	client, err := NewKafkaClient(c.Config(), monitortest.ClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	client.importer.log = logrus.NewEntry(logger)
+	client.importer.start()
+
+	client.RefreshMetaData()
+	if err := client.getOffsets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	statuses := client.Statuses()
+	if len(statuses) != 1 || statuses[0].Group != "billing" {
+		t.Fatalf("statuses %+v, want the one of billing", statuses)
+	}
+	if s := statuses[0]; s.Status != StatusOK || s.TotalLag != 40 || s.MaxLag != 40 {
+		t.Errorf("billing is %v with a lag of %d, max %d, want OK with 40", s.Status, s.TotalLag, s.MaxLag)
+	}
+
+	// the queued consumer_metrics points are written by the flush of the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if lost, err := client.importer.stop(ctx); err != nil || lost != 0 {
+		t.Fatalf("stop: %d lost, %v", lost, err)
+	}
+	for _, points := range []string{"consumer_status=1", "consumer_metrics=2"} {
+		if !strings.Contains(out.String(), points) {
+			t.Errorf("no dry run of %s in %q", points, out.String())
+		}
+	}
+}
+
+// blockingBackend is the sarama backend holding its metadata refreshes until released
+type blockingBackend struct {
+	Backend
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBackend) RefreshMetadata(topics ...string) error {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.Backend.RefreshMetadata(topics...)
+}
+
+var blocking *blockingBackend
+
+func init() {
+	RegisterBackend("blocking", func(cfg *config.Config, cluster string, client sarama.Client) (Backend, error) {
+		backend, err := newSaramaBackend(cfg, cluster, client)
+		if err != nil {
+			return nil, err
+		}
+		blocking = &blockingBackend{Backend: backend, entered: make(chan struct{}), release: make(chan struct{})}
+		return blocking, nil
+	})
+}
+
+func TestRefreshMetaDataUnlocked(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	c.AddTopic("invoices", 1)
+	c.AddGroup("reporting", "invoices")
+
+	cfg := c.Config()
+	cfg.Kafka[monitortest.ClusterName].Backend = "blocking"
+	client, err := NewKafkaClient(cfg, monitortest.ClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	refreshed := make(chan struct{})
+	go func() {
+		client.RefreshMetaData()
+		close(refreshed)
+	}()
+	<-blocking.entered
+
+	// the readers of the metadata don't wait for the brokers
+	read := make(chan struct{})
+	go func() {
+		client.Statuses()
+		client.IdleGroups()
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the statuses waited for the metadata requests of the refresh")
+	}
+	close(blocking.release)
+	<-refreshed
+	var snap *sweepSnapshot
+	withReadLock(client.schemaUpdateMtx, func() {
+		snap = client.snapshot()
+	})
+	if consumers := snap.topic2Consumer["invoices"]; len(consumers) != 1 || consumers[0] != "reporting" {
+		t.Errorf("consumers of invoices %v after the refresh, want reporting", consumers)
+	}
+}
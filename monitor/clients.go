@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// GroupClients are the members of a group running the same client, as far as their metadata tells: the assignment
+// strategy the group agreed on, the version of the subscription the members sent, newer clients send newer ones,
+// and the library guessed from the client id, with its version if the client id carries it
+type GroupClients struct {
+	Cluster      string `json:"cluster"`
+	Group        string `json:"group"`
+	ProtocolType string `json:"protocol_type"`
+	Strategy     string `json:"assignment_strategy"`
+	// of the member metadata, -1 if it can't be decoded
+	MetadataVersion int16  `json:"metadata_version"`
+	Library         string `json:"library,omitempty"`
+	LibraryVersion  string `json:"library_version,omitempty"`
+	Members         int    `json:"members"`
+}
+
+// the libraries recognized by their default client ids, the first submatch is the version
+var clientLibraries = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"kafka-python", regexp.MustCompile(`^kafka-python-(\d+(?:\.\d+)*)`)},
+	{"kafka-streams", regexp.MustCompile(`-StreamThread-\d+-(?:restore-)?consumer$`)},
+	{"java", regexp.MustCompile(`^consumer(?:-.+)?-\d+$`)},
+	{"librdkafka", regexp.MustCompile(`^rdkafka`)},
+	{"sarama", regexp.MustCompile(`^sarama`)},
+	{"franz-go", regexp.MustCompile(`^kgo$`)},
+	{"kafkajs", regexp.MustCompile(`^kafkajs`)},
+}
+
+// clientLibrary guesses the library and its version from a client id, empty if unknown
+func clientLibrary(clientId string) (string, string) {
+	for _, lib := range clientLibraries {
+		if m := lib.re.FindStringSubmatch(clientId); m != nil {
+			if len(m) > 1 {
+				return lib.name, m[1]
+			}
+			return lib.name, ""
+		}
+	}
+	return "", ""
+}
+
+// decodeMemberMetadata decodes the subscription of a member of a consumer group, the fields after the user data,
+// the owned partitions, the generation and the rack of the newer versions, are ignored
+func decodeMemberMetadata(b []byte) (*sarama.ConsumerGroupMemberMetadata, error) {
+	d := &commitDecoder{b: b}
+	metadata := &sarama.ConsumerGroupMemberMetadata{Version: d.int16()}
+	n := d.int32()
+	for i := int32(0); i < n && d.err == nil; i++ {
+		metadata.Topics = append(metadata.Topics, d.string())
+	}
+	if size := d.int32(); size >= 0 {
+		metadata.UserData = d.next(int(size))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return metadata, nil
+}
+
+// groupClients counts the members of the groups per client, it returns group => clients
+func groupClients(cluster string, descs []*sarama.GroupDescription) map[string][]*GroupClients {
+	res := make(map[string][]*GroupClients)
+	for _, desc := range descs {
+		byClient := make(map[GroupClients]int)
+		for _, gmd := range desc.Members {
+			key := GroupClients{Cluster: cluster, Group: desc.GroupId, ProtocolType: desc.ProtocolType, Strategy: desc.Protocol, MetadataVersion: -1}
+			if metadata, err := decodeMemberMetadata(gmd.MemberMetadata); err == nil {
+				key.MetadataVersion = metadata.Version
+			}
+			key.Library, key.LibraryVersion = clientLibrary(gmd.ClientId)
+			byClient[key]++
+		}
+		for key, members := range byClient {
+			gc := key
+			gc.Members = members
+			res[desc.GroupId] = append(res[desc.GroupId], &gc)
+		}
+	}
+	return res
+}
+
+// GroupClients returns the clients of the groups of a cluster, of all clusters if empty
+func (f *Fetcher) GroupClients(cluster string) []*GroupClients {
+	clients := []*GroupClients{}
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			clients = append(clients, cli.GroupClients()...)
+		}
+	}
+	return clients
+}
+
+// GroupClients returns the clients of the groups at the last metadata refresh, by group, the oldest metadata first
+func (client *KafkaClient) GroupClients() []*GroupClients {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+	res := []*GroupClients{}
+	for _, clients := range client.groupClients {
+		res = append(res, clients...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Group != res[j].Group {
+			return res[i].Group < res[j].Group
+		}
+		if res[i].MetadataVersion != res[j].MetadataVersion {
+			return res[i].MetadataVersion < res[j].MetadataVersion
+		}
+		return res[i].Library+res[i].LibraryVersion < res[j].Library+res[j].LibraryVersion
+	})
+	return res
+}
@@ -0,0 +1,230 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time of the monitor: the timestamps of the sweeps and evaluations, the expirations and
+// rate limits, and the tickers of the sweeps read it. The latencies of the requests are measured in
+// real time. SetClock swaps it for a FakeClock to test them deterministically, or a ScaledClock to run
+// faster than real time.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) *Ticker
+	Sleep(d time.Duration)
+}
+
+// Ticker delivers the ticks of a Clock on C, like a time.Ticker
+type Ticker struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+// Stop turns off the ticker, C isn't closed
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+var (
+	clockLock sync.RWMutex
+	clock     Clock = realClock{}
+)
+
+// SetClock replaces the clock of the monitor, it must be called before the clients are created
+func SetClock(c Clock) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	clock = c
+}
+
+func clockNow() time.Time {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return clock.Now()
+}
+
+func clockTicker(d time.Duration) *Ticker {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return clock.NewTicker(d)
+}
+
+func clockSleep(d time.Duration) {
+	clockLock.RLock()
+	c := clock
+	clockLock.RUnlock()
+	c.Sleep(d)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop}
+}
+
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// ScaledClock runs speed times faster than real time from its creation, e.g. to replay a recording
+// of a day in minutes with the tickers and expirations of the monitor keeping up
+type ScaledClock struct {
+	start time.Time
+	speed float64
+}
+
+func NewScaledClock(speed float64) *ScaledClock {
+	return &ScaledClock{start: time.Now(), speed: speed}
+}
+
+func (c *ScaledClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.speed))
+}
+
+// NewTicker ticks every d of the scaled time, the ticks carry the scaled time
+func (c *ScaledClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(c.real(d))
+	ch := make(chan time.Time, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				select {
+				case ch <- c.Now():
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return &Ticker{C: ch, stop: func() {
+		once.Do(func() {
+			t.Stop()
+			close(done)
+		})
+	}}
+}
+
+func (c *ScaledClock) Sleep(d time.Duration) { time.Sleep(c.real(d)) }
+
+func (c *ScaledClock) real(d time.Duration) time.Duration {
+	if r := time.Duration(float64(d) / c.speed); r > 0 {
+		return r
+	}
+	return 1
+}
+
+// FakeClock only moves when Advance is called, the tickers and sleeps due by then fire in order
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	sleeps  []*fakeSleep
+}
+
+type fakeTicker struct {
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+type fakeSleep struct {
+	until time.Time
+	done  chan struct{}
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// NewTicker ticks every d of the fake time, a tick is dropped if the previous one wasn't received, like a time.Ticker
+func (c *FakeClock) NewTicker(d time.Duration) *Ticker {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTicker{c: make(chan time.Time, 1), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return &Ticker{C: t.c, stop: func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		for i, other := range c.tickers {
+			if other == t {
+				c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+				break
+			}
+		}
+	}}
+}
+
+// Sleep blocks until the fake time is advanced by d
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.lock.Lock()
+	if d <= 0 {
+		c.lock.Unlock()
+		return
+	}
+	s := &fakeSleep{until: c.now.Add(d), done: make(chan struct{})}
+	c.sleeps = append(c.sleeps, s)
+	c.lock.Unlock()
+	<-s.done
+}
+
+// Advance moves the fake time by d, firing the ticks and waking the sleeps due on the way in time order
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	end := c.now.Add(d)
+	for {
+		next, ok := c.nextEvent(end)
+		if !ok {
+			break
+		}
+		c.now = next
+		for _, t := range c.tickers {
+			if !t.next.After(next) {
+				select {
+				case t.c <- next:
+				default:
+				}
+				t.next = t.next.Add(t.period)
+			}
+		}
+		sleeps := c.sleeps[:0]
+		for _, s := range c.sleeps {
+			if !s.until.After(next) {
+				close(s.done)
+			} else {
+				sleeps = append(sleeps, s)
+			}
+		}
+		c.sleeps = sleeps
+	}
+	c.now = end
+}
+
+// nextEvent is the time of the first tick or sleep due by end
+func (c *FakeClock) nextEvent(end time.Time) (time.Time, bool) {
+	var events []time.Time
+	for _, t := range c.tickers {
+		events = append(events, t.next)
+	}
+	for _, s := range c.sleeps {
+		events = append(events, s.until)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Before(events[j]) })
+	if len(events) == 0 || events[0].After(end) {
+		return time.Time{}, false
+	}
+	return events[0], true
+}
@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/sundy-li/burrowx/config"
+)
+
+var clockStart = time.Unix(1700000000, 0)
+
+// useFakeClock swaps the clock of the monitor for a fake one, the test sets the real clock back
+func useFakeClock() *FakeClock {
+	fake := NewFakeClock(clockStart)
+	SetClock(fake)
+	return fake
+}
+
+func clockClient() *KafkaClient {
+	cfg := &config.Config{}
+	cfg.General.OffsetsRetentionMinutes = 60
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return &KafkaClient{
+		cluster:         "local",
+		cfg:             cfg,
+		log:             logrus.NewEntry(logger),
+		schemaUpdateMtx: &sync.RWMutex{},
+		evaluator:       &Evaluator{mutes: make(map[string]map[string]*TopicMute)},
+		groupSeen:       make(map[string]map[string]*Seen),
+		emptySince:      make(map[string]int64),
+	}
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	ticker := clockTicker(10 * time.Second)
+	defer ticker.Stop()
+	woke := make(chan time.Time)
+	go func() {
+		clockSleep(25 * time.Second)
+		woke <- clockNow()
+	}()
+	// wait for the sleep to be registered
+	for {
+		fake.lock.Lock()
+		n := len(fake.sleeps)
+		fake.lock.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	fake.Advance(9 * time.Second)
+	select {
+	case tick := <-ticker.C:
+		t.Fatalf("ticked at %v before the period", tick)
+	default:
+	}
+	fake.Advance(21 * time.Second)
+	// the ticks of 20s and 30s are dropped while the one of 10s isn't received, like a time.Ticker
+	if tick := <-ticker.C; !tick.Equal(clockStart.Add(10 * time.Second)) {
+		t.Errorf("ticked at %v, want 10s after the start", tick.Sub(clockStart))
+	}
+	if now := <-woke; !now.Equal(clockStart.Add(30 * time.Second)) {
+		t.Errorf("woke up at %v, want after the advance", now.Sub(clockStart))
+	}
+	fake.Advance(10 * time.Second)
+	if tick := <-ticker.C; !tick.Equal(clockStart.Add(40 * time.Second)) {
+		t.Errorf("ticked at %v, want 40s after the start", tick.Sub(clockStart))
+	}
+}
+
+func TestSinkWindowExpiry(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	w := &sinkWindow{enable: clockStart.Add(time.Minute), disable: clockStart.Add(time.Hour)}
+	if w.active(clockNow()) {
+		t.Error("active before enable")
+	}
+	fake.Advance(time.Minute)
+	if !w.active(clockNow()) {
+		t.Error("inactive at enable")
+	}
+	fake.Advance(59*time.Minute - time.Millisecond)
+	if !w.active(clockNow()) {
+		t.Error("inactive before disable")
+	}
+	fake.Advance(time.Millisecond)
+	if w.active(clockNow()) {
+		t.Error("active at disable")
+	}
+}
+
+func TestMuteExpiry(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	client := clockClient()
+	until := clockStart.Add(time.Hour).UnixNano() / int64(time.Millisecond)
+	if _, err := client.Mute(&TopicMute{Group: "g", Topic: "t", Until: until}); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(59 * time.Minute)
+	if mutes := client.Mutes(); len(mutes) != 1 {
+		t.Fatalf("%d mutes before the end, want 1", len(mutes))
+	}
+	fake.Advance(time.Minute)
+	if mutes := client.Mutes(); len(mutes) != 0 {
+		t.Errorf("%d mutes after the end, want 0", len(mutes))
+	}
+	if client.evaluator.muted("g", "t", clockNow().UnixNano()/int64(time.Millisecond)) {
+		t.Error("the evaluator still mutes the topic")
+	}
+	// the next mute prunes the ended one
+	client.Mute(&TopicMute{Group: "other", Topic: "t", Until: until + 3600*1000})
+	if _, ok := client.evaluator.mutes["g"]; ok {
+		t.Error("the ended mute isn't pruned")
+	}
+}
+
+func TestPairingExpiry(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	client := clockClient()
+	client.updateSeen(map[string]map[string]bool{"orders": {"g": true}, "payments": {"g": true}})
+	fake.Advance(time.Duration(SEEN_EXPIRE_SECOND) * time.Second / 2)
+	client.updateSeen(map[string]map[string]bool{"orders": {"g": true}})
+	fake.Advance(time.Duration(SEEN_EXPIRE_SECOND)*time.Second/2 + time.Second)
+	client.updateSeen(nil)
+	if _, ok := client.groupSeen["g"]["payments"]; ok {
+		t.Error("the pairing not seen for SEEN_EXPIRE_SECOND didn't expire")
+	}
+	if _, ok := client.groupSeen["g"]["orders"]; !ok {
+		t.Fatal("the pairing seen since expired")
+	}
+	fake.Advance(time.Duration(SEEN_EXPIRE_SECOND) * time.Second)
+	client.updateSeen(nil)
+	if _, ok := client.groupSeen["g"]; ok {
+		t.Error("the group without pairings is kept")
+	}
+}
+
+func TestIdleExpiry(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	client := clockClient()
+	client.updateEmpty(map[string]string{"g": "Empty", "busy": "Stable"})
+	fake.Advance(20 * time.Minute)
+	client.updateEmpty(map[string]string{"g": "Empty", "busy": "Stable"})
+	idle := client.IdleGroups()
+	if len(idle) != 1 || idle[0].Group != "g" {
+		t.Fatalf("idle groups %+v, want g", idle)
+	}
+	// empty since the first refresh, the offsets expire offsetsRetentionMinutes later
+	if idle[0].ExpiresIn != 40*60 {
+		t.Errorf("expires in %vs, want 2400s", idle[0].ExpiresIn)
+	}
+	client.updateEmpty(map[string]string{"g": "Stable"})
+	if len(client.IdleGroups()) != 0 {
+		t.Error("the group back with members is still idle")
+	}
+}
+
+func TestWarnLimiter(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	log := logrus.NewEntry(logger)
+	l := newWarnLimiter(metrics.NewRegistry())
+
+	l.warnf(log, "k", "broker %d down", 1)
+	fake.Advance(30 * time.Second)
+	l.warnf(log, "k", "broker %d down", 1)
+	l.warnf(log, "other", "other warning")
+	if n := strings.Count(out.String(), "broker 1 down"); n != 1 {
+		t.Fatalf("logged %d times within the interval, want once", n)
+	}
+	fake.Advance(time.Duration(WARN_RATE_LIMIT_SECOND) * time.Second)
+	l.warnf(log, "k", "broker %d down", 1)
+	if !strings.Contains(out.String(), "1 similar messages suppressed") || !strings.Contains(out.String(), "other warning") {
+		t.Errorf("logged %q", out.String())
+	}
+	if n := l.suppressed.Count(); n != 1 {
+		t.Errorf("%d suppressed, want 1", n)
+	}
+}
+
+func TestWriteThrottle(t *testing.T) {
+	fake := useFakeClock()
+	defer SetClock(realClock{})
+	throttle := newWriteThrottle(10)
+	// one sweep's worth of points may burst
+	if !throttle.take(10 * METRIC_FETCH_INTERVAL_SECOND) {
+		t.Fatal("the burst of a sweep is throttled")
+	}
+	if throttle.take(1) {
+		t.Fatal("took a point from an empty bucket")
+	}
+	fake.Advance(time.Second)
+	if !throttle.take(10) || throttle.take(1) {
+		t.Error("the bucket didn't refill at the rate")
+	}
+	// the forced points are paid back before the next ones
+	throttle.force(20)
+	fake.Advance(time.Second)
+	if throttle.take(1) {
+		t.Error("took a point while the bucket is below zero")
+	}
+	fake.Advance(time.Hour)
+	if !throttle.take(10*METRIC_FETCH_INTERVAL_SECOND) || throttle.take(1) {
+		t.Error("the bucket grows past a sweep's worth of points")
+	}
+}
@@ -0,0 +1,39 @@
+package monitor
+
+import "sort"
+
+// ClusterInfo describes a monitored cluster to the humans
+type ClusterInfo struct {
+	Cluster     string   `json:"cluster"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Paused      bool     `json:"paused"`
+}
+
+// Clusters returns the monitored clusters, sorted by name
+func (f *Fetcher) Clusters() []*ClusterInfo {
+	clients := f.allClients()
+	res := make([]*ClusterInfo, 0, len(clients))
+	for _, cli := range clients {
+		k := cli.cfg.Kafka[cli.cluster]
+		res = append(res, &ClusterInfo{
+			Cluster:     cli.cluster,
+			DisplayName: k.DisplayName,
+			Description: k.Description,
+			Aliases:     k.Aliases,
+			Paused:      cli.Paused(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Cluster < res[j].Cluster })
+	return res
+}
+
+// named reports whether the cluster is called name or aliased so
+func (client *KafkaClient) named(name string) bool {
+	if name == client.cluster {
+		return true
+	}
+	k, ok := client.cfg.Kafka[client.cluster]
+	return ok && contains(k.Aliases, name)
+}
@@ -0,0 +1,255 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+func init() {
+	RegisterOffsetCodec("binary", newBinaryCodec)
+	RegisterOffsetCodec("json", newJSONCodec)
+	RegisterOffsetCodec("avro", newAvroCodec)
+}
+
+// ErrNotOffsetCommit is returned by the codecs for the records of an offsets topic which aren't offset commits,
+// e.g. the group metadata of __consumer_offsets, they're skipped without counting as decode errors
+var ErrNotOffsetCommit = errors.New("not an offset commit")
+
+// OffsetRecord is an offset commit decoded from a record of an offsets topic
+type OffsetRecord struct {
+	Group     string
+	Topic     string
+	Partition int32
+	Offset    int64
+	// commit timestamp(ms) set with the commit, 0 if the feed has none
+	CommitTimestamp int64
+	// the commit was deleted, Offset and CommitTimestamp are unset
+	Tombstone bool
+}
+
+// OffsetCodec decodes the records of an offsets topic, Decode may be called concurrently
+type OffsetCodec interface {
+	Decode(key, value []byte) (*OffsetRecord, error)
+}
+
+// OffsetCodecFactory creates the codec of an offsets topic from its options
+type OffsetCodecFactory func(options map[string]string) (OffsetCodec, error)
+
+var (
+	codecLock      sync.Mutex
+	codecFactories = make(map[string]OffsetCodecFactory)
+)
+
+// RegisterOffsetCodec makes a codec of the offsets topics available to the config, like RegisterSink,
+// and panics if the codec is registered twice
+func RegisterOffsetCodec(typ string, factory OffsetCodecFactory) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	if _, ok := codecFactories[typ]; ok {
+		panic("offset codec registered twice: " + typ)
+	}
+	codecFactories[typ] = factory
+}
+
+// offsetsTopic is a topic of offset commits with its codec
+type offsetsTopic struct {
+	name  string
+	codec OffsetCodec
+}
+
+func newOffsetsTopics(cfg *config.Config, cluster string) ([]*offsetsTopic, error) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	var topics []*offsetsTopic
+	for _, ot := range cfg.Kafka[cluster].OffsetsTopics {
+		factory, ok := codecFactories[ot.Codec]
+		if !ok {
+			return nil, fmt.Errorf("offsets topic %s: unknown codec %s, is its plugin loaded", ot.Name, ot.Codec)
+		}
+		codec, err := factory(ot.Options)
+		if err != nil {
+			return nil, fmt.Errorf("offsets topic %s: codec %s: %v", ot.Name, ot.Codec, err)
+		}
+		topics = append(topics, &offsetsTopic{name: ot.Name, codec: codec})
+	}
+	return topics, nil
+}
+
+// binaryCodec decodes the records of __consumer_offsets, the keys v0 and v1 are the offset commits,
+// v2 the group metadata
+type binaryCodec struct{}
+
+func newBinaryCodec(options map[string]string) (OffsetCodec, error) {
+	return binaryCodec{}, nil
+}
+
+func (binaryCodec) Decode(key, value []byte) (*OffsetRecord, error) {
+	d := &commitDecoder{b: key}
+	if version := d.int16(); version != 0 && version != 1 {
+		return nil, ErrNotOffsetCommit
+	}
+	r := &OffsetRecord{Group: d.string(), Topic: d.string(), Partition: d.int32()}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if value == nil {
+		r.Tombstone = true
+		return r, nil
+	}
+	d = &commitDecoder{b: value}
+	version := d.int16()
+	if version < 0 || version > 3 {
+		return nil, errors.New("unknown offset commit value version")
+	}
+	r.Offset = d.int64()
+	if version == 3 {
+		d.int32() // leader epoch
+	}
+	d.string() // metadata
+	r.CommitTimestamp = d.int64()
+	return r, d.err
+}
+
+// fieldMapping names the fields of the commits in the records decoded by the json and avro codecs, the fields
+// of the value override the ones of the key, a dot separates the names of nested fields
+type fieldMapping struct {
+	group, topic, partition, offset, timestamp string
+}
+
+// newFieldMapping takes the groupField option, group by default, topicField, topic, partitionField, partition,
+// offsetField, offset, and timestampField, commit_timestamp, in ms or RFC3339
+func newFieldMapping(options map[string]string) fieldMapping {
+	field := func(option, def string) string {
+		if name := options[option]; name != "" {
+			return name
+		}
+		return def
+	}
+	return fieldMapping{
+		group:     field("groupField", "group"),
+		topic:     field("topicField", "topic"),
+		partition: field("partitionField", "partition"),
+		offset:    field("offsetField", "offset"),
+		timestamp: field("timestampField", "commit_timestamp"),
+	}
+}
+
+// record returns the commit of the fields of the key and the value, a tombstone if value is nil
+func (m fieldMapping) record(key, value map[string]interface{}) (*OffsetRecord, error) {
+	lookup := func(name string) (interface{}, bool) {
+		if v, ok := lookupField(value, name); ok {
+			return v, true
+		}
+		return lookupField(key, name)
+	}
+	group, ok := lookup(m.group)
+	if !ok {
+		return nil, ErrNotOffsetCommit
+	}
+	r := &OffsetRecord{Group: fmt.Sprint(group), Tombstone: value == nil}
+	topic, ok := lookup(m.topic)
+	if !ok {
+		return nil, fmt.Errorf("no field %s", m.topic)
+	}
+	r.Topic = fmt.Sprint(topic)
+	partition, err := m.int(lookup, m.partition, true)
+	if err != nil {
+		return nil, err
+	}
+	r.Partition = int32(partition)
+	if r.Tombstone {
+		return r, nil
+	}
+	if r.Offset, err = m.int(lookup, m.offset, true); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup(m.timestamp); ok {
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				r.CommitTimestamp = t.UnixNano() / int64(time.Millisecond)
+				return r, nil
+			}
+		}
+		if r.CommitTimestamp, err = m.int(lookup, m.timestamp, false); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// int returns the integer of a field, a number or a numeric string
+func (m fieldMapping) int(lookup func(string) (interface{}, bool), name string, required bool) (int64, error) {
+	v, ok := lookup(name)
+	if !ok {
+		if required {
+			return 0, fmt.Errorf("no field %s", name)
+		}
+		return 0, nil
+	}
+	switch n := v.(type) {
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	case json.Number:
+		return n.Int64()
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+	return 0, fmt.Errorf("field %s is not an integer: %v", name, v)
+}
+
+// lookupField returns the field of a dotted name in nested objects
+func lookupField(fields map[string]interface{}, name string) (interface{}, bool) {
+	var v interface{} = fields
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok || v == nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonCodec decodes the commits of json records, the key a json object too or anything else, ignored then
+type jsonCodec struct {
+	fields fieldMapping
+}
+
+// newJSONCodec takes the field options of newFieldMapping
+func newJSONCodec(options map[string]string) (OffsetCodec, error) {
+	return &jsonCodec{fields: newFieldMapping(options)}, nil
+}
+
+func (c *jsonCodec) Decode(key, value []byte) (*OffsetRecord, error) {
+	decode := func(b []byte) (map[string]interface{}, error) {
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		var fields map[string]interface{}
+		err := d.Decode(&fields)
+		return fields, err
+	}
+	// a key which isn't a json object is only a partitioning key
+	keyFields, _ := decode(key)
+	if value == nil {
+		return c.fields.record(keyFields, nil)
+	}
+	valueFields, err := decode(value)
+	if err != nil {
+		return nil, err
+	}
+	return c.fields.record(keyFields, valueFields)
+}
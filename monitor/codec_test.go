@@ -0,0 +1,200 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// avroLong encodes a zigzag varint
+func avroLong(n int64) []byte {
+	u := uint64((n << 1) ^ (n >> 63))
+	var b []byte
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+func avroString(s string) []byte {
+	return append(avroLong(int64(len(s))), s...)
+}
+
+const commitSchema = `{"type": "record", "name": "Commit", "namespace": "offsets", "fields": [
+	{"name": "group", "type": "string"},
+	{"name": "topic", "type": "string"},
+	{"name": "partition", "type": "int"},
+	{"name": "offset", "type": "long"},
+	{"name": "commit_timestamp", "type": ["null", {"type": "long", "logicalType": "timestamp-millis"}]},
+	{"name": "tags", "type": {"type": "map", "values": "string"}},
+	{"name": "next", "type": ["null", "Commit"]}]}`
+
+// avroCommit encodes a commit of commitSchema in the wire format of the schema registry
+func avroCommit(schemaID uint32, group, topic string, partition int32, offset, ts int64) []byte {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint32(b[1:], schemaID)
+	b = append(b, avroString(group)...)
+	b = append(b, avroString(topic)...)
+	b = append(b, avroLong(int64(partition))...)
+	b = append(b, avroLong(offset)...)
+	b = append(b, avroLong(1)...)
+	b = append(b, avroLong(ts)...)
+	// a block of one entry with its size in bytes, then the end of the map
+	b = append(b, avroLong(-1)...)
+	b = append(b, avroLong(4)...)
+	b = append(b, avroString("a")...)
+	b = append(b, avroString("b")...)
+	b = append(b, avroLong(0)...)
+	return append(b, avroLong(0)...)
+}
+
+func TestBinaryCodec(t *testing.T) {
+	key := []byte{0, 1, 0, 1, 'g', 0, 1, 't', 0, 0, 0, 2}
+	// v1: the offset, an empty metadata, the commit and the expire timestamps
+	value := []byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 42, 0, 0, 0, 0, 0, 0, 0, 0, 0x03, 0xe8, 0, 0, 0, 0, 0, 0, 0x07, 0xd0}
+	r, err := binaryCodec{}.Decode(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *r != (OffsetRecord{Group: "g", Topic: "t", Partition: 2, Offset: 42, CommitTimestamp: 1000}) {
+		t.Errorf("decoded %+v", r)
+	}
+	if r, err := (binaryCodec{}).Decode(key, nil); err != nil || !r.Tombstone {
+		t.Errorf("tombstone decoded as %+v, %v", r, err)
+	}
+	if _, err := (binaryCodec{}).Decode([]byte{0, 2}, []byte{}); err != ErrNotOffsetCommit {
+		t.Errorf("group metadata decoded with %v", err)
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	codec, _ := newJSONCodec(map[string]string{"groupField": "consumer.group"})
+	r, err := codec.Decode([]byte(`"partitioning key"`),
+		[]byte(`{"consumer": {"group": "g"}, "topic": "t", "partition": 3, "offset": 42, "commit_timestamp": "2026-01-01T00:00:00Z"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OffsetRecord{Group: "g", Topic: "t", Partition: 3, Offset: 42, CommitTimestamp: 1767225600000}
+	if *r != want {
+		t.Errorf("decoded %+v, want %+v", r, want)
+	}
+	r, err = codec.Decode([]byte(`{"consumer": {"group": "g"}, "topic": "t", "partition": "3"}`), nil)
+	if err != nil || !r.Tombstone || r.Partition != 3 {
+		t.Errorf("tombstone decoded as %+v, %v", r, err)
+	}
+	if _, err := codec.Decode(nil, []byte(`{"heartbeat": 1}`)); err != ErrNotOffsetCommit {
+		t.Errorf("a record without group decoded with %v", err)
+	}
+	if _, err := codec.Decode(nil, []byte(`{"consumer": {"group": "g"}, "topic": "t", "partition": 1}`)); err == nil {
+		t.Error("a commit without offset decoded")
+	}
+}
+
+func TestAvroCodec(t *testing.T) {
+	var fetches int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if r.URL.Path != "/schemas/ids/7" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"schema": %q}`, commitSchema)
+	}))
+	defer registry.Close()
+	codec, err := newAvroCodec(map[string]string{"schemaRegistry": registry.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := avroCommit(7, "g", "t", 5, 123456789, 1700000000000)
+	for i := 0; i < 3; i++ {
+		r, err := codec.Decode([]byte("partitioning key"), value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *r != (OffsetRecord{Group: "g", Topic: "t", Partition: 5, Offset: 123456789, CommitTimestamp: 1700000000000}) {
+			t.Errorf("decoded %+v", r)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("the schema was fetched %d times, want once", fetches)
+	}
+	if _, err := codec.Decode(nil, value[:12]); err == nil {
+		t.Error("a truncated record decoded")
+	}
+	if _, err := codec.Decode(nil, []byte("not avro")); err == nil {
+		t.Error("a record out of the wire format decoded")
+	}
+}
+
+func TestAvroRegistryDown(t *testing.T) {
+	fake := NewFakeClock(time.Unix(1700000000, 0))
+	SetClock(fake)
+	defer SetClock(realClock{})
+
+	var fetches int32
+	var down atomic.Value
+	down.Store(true)
+	release := make(chan struct{})
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			<-release
+		}
+		if down.Load().(bool) {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"schema": %q}`, commitSchema)
+	}))
+	defer registry.Close()
+	codec, _ := newAvroCodec(map[string]string{"schemaRegistry": registry.URL})
+	value := avroCommit(7, "g", "t", 0, 1, 1700000000000)
+
+	// the records waiting for the first fetch share it
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := codec.Decode(nil, value); err == nil {
+				t.Error("decoded while the registry is down")
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if fetches != 1 {
+		t.Fatalf("%d fetches for the concurrent records, want 1", fetches)
+	}
+
+	// no fetch during the backoff, the records fail at once
+	if _, err := codec.Decode(nil, value); err == nil || fetches != 1 {
+		t.Fatalf("%d fetches during the backoff, err %v", fetches, err)
+	}
+	fake.Advance(time.Second)
+	codec.Decode(nil, value)
+	if fetches != 2 {
+		t.Fatalf("%d fetches after the backoff, want 2", fetches)
+	}
+	// the backoff doubled
+	fake.Advance(time.Second)
+	codec.Decode(nil, value)
+	if fetches != 2 {
+		t.Fatalf("%d fetches 1s after the second failure, want 2", fetches)
+	}
+	down.Store(false)
+	fake.Advance(time.Second)
+	if _, err := codec.Decode(nil, value); err != nil {
+		t.Fatalf("not decoded once the registry is back: %v", err)
+	}
+	codec.Decode(nil, value)
+	if fetches != 3 {
+		t.Errorf("%d fetches, want 3", fetches)
+	}
+}
@@ -0,0 +1,270 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// commitLatency consumes the offsets topics, __consumer_offsets by default, to measure, per group, how long
+// after the commit timestamp written in a commit the coordinator appended it, the timestamp of its record.
+// Large values reveal consumers with a broken clock, which set the commit timestamp themselves with
+// OffsetCommit v1, or lagging coordinators. The latencies are the max of the commits since the last sweep,
+// the commits of the feeds without commit timestamp are only counted. How far the consumption is behind
+// the end of the offsets topics is measured every sweep, the latencies are only as fresh as that.
+type commitLatency struct {
+	backend    Backend
+	topics     []*offsetsTopic
+	partitions []PartitionConsumer
+	rewrites   []*groupRewrite
+	log        *logrus.Entry
+	quarantine *quarantine
+	wg         sync.WaitGroup
+	// traces the decoding of batches of records, nil if tracing is disabled
+	tracer *tracer
+
+	// total and max over the partitions of the records not consumed yet
+	lag    metrics.Gauge
+	maxLag metrics.Gauge
+	// the errors-decode counter of the cluster
+	decodeErrors metrics.Counter
+
+	lock sync.Mutex
+	//group => commits and max latency(ms) since the last sweep
+	commits map[string]*commitStats
+	//topic => partition => next offset to consume, read atomically
+	positions map[string]map[int32]*int64
+}
+
+type commitStats struct {
+	count     int
+	latencyMs int64
+	// a commit had a commit timestamp
+	measured bool
+}
+
+func newCommitLatency(client *KafkaClient) *commitLatency {
+	return &commitLatency{
+		backend:      client.backend,
+		topics:       client.offsetsTopics,
+		rewrites:     client.groupRewrites,
+		quarantine:   client.quarantine,
+		log:          client.log,
+		tracer:       client.tracer,
+		lag:          metrics.GetOrRegisterGauge("consumer-offsets-lag", client.metrics),
+		maxLag:       metrics.GetOrRegisterGauge("consumer-offsets-max-lag", client.metrics),
+		decodeErrors: client.errors[ErrorDecode],
+		commits:      make(map[string]*commitStats),
+		positions:    make(map[string]map[int32]*int64),
+	}
+}
+
+// start consumes the new commits of all partitions of the offsets topics
+func (c *commitLatency) start() error {
+	for _, topic := range c.topics {
+		partitions, err := c.backend.Partitions(topic.name)
+		if err != nil {
+			c.stop()
+			return err
+		}
+		for _, partition := range partitions {
+			// the offset is resolved here rather than by the consumer, to know the position before the first record
+			offset, err := c.backend.GetOffset(topic.name, partition, sarama.OffsetNewest)
+			if err != nil {
+				c.stop()
+				return err
+			}
+			pc, err := c.backend.ConsumePartition(topic.name, partition, offset)
+			if err != nil {
+				c.stop()
+				return err
+			}
+			position := offset
+			c.lock.Lock()
+			if _, ok := c.positions[topic.name]; !ok {
+				c.positions[topic.name] = make(map[int32]*int64)
+			}
+			c.positions[topic.name][partition] = &position
+			c.lock.Unlock()
+			c.partitions = append(c.partitions, pc)
+			c.wg.Add(1)
+			go c.consume(topic, pc, &position)
+		}
+	}
+	return nil
+}
+
+// the records of the offsets topics decoded in one span at most
+const COMMIT_DECODE_SPAN_RECORDS = 1000
+
+// consume records the commits of a partition, the records read in a row, until the consumer has no more
+// buffered or COMMIT_DECODE_SPAN_RECORDS, are decoded in one span
+func (c *commitLatency) consume(topic *offsetsTopic, pc PartitionConsumer, position *int64) {
+	defer c.wg.Done()
+	log := c.log.WithField("topic", topic.name)
+	var sp *span
+	var records, failed int
+	for msg := range pc.Messages() {
+		if records == 0 {
+			_, sp = startSpan(context.Background(), c.tracer, "commits.decode")
+			sp.setAttr("topic", topic.name)
+			sp.setAttr("partition", msg.Partition)
+		}
+		records++
+		atomic.StoreInt64(position, msg.Offset+1)
+		if !c.record(topic, log, msg) {
+			failed++
+		}
+		if records >= COMMIT_DECODE_SPAN_RECORDS || len(pc.Messages()) == 0 {
+			sp.setAttr("records", records)
+			sp.setAttr("decode_errors", failed)
+			sp.finish(nil)
+			records, failed = 0, 0
+		}
+	}
+}
+
+// record counts the commit of a record of an offsets topic and its latency, false if it can't be decoded
+func (c *commitLatency) record(topic *offsetsTopic, log *logrus.Entry, msg *sarama.ConsumerMessage) bool {
+	r, err := topic.codec.Decode(msg.Key, msg.Value)
+	if err == ErrNotOffsetCommit {
+		return true
+	} else if err != nil {
+		c.decodeErrors.Inc(1)
+		log.WithFields(logrus.Fields{"partition": msg.Partition, "error_kind": ErrorDecode}).Debugf("Skip the record at offset %d: %v", msg.Offset, err)
+		return false
+	}
+	if r.Tombstone || r.Group == "" || msg.Timestamp.IsZero() {
+		return true
+	}
+	if r.CommitTimestamp != 0 {
+		if reason := plausibleTimestamp(r.CommitTimestamp); reason != "" {
+			c.quarantine.add(&QuarantinedRecord{Source: topic.name, Group: r.Group, Topic: topic.name, Partition: msg.Partition,
+				Offset: msg.Offset, Timestamp: r.CommitTimestamp, Reason: "commit " + reason, Dropped: true})
+			return true
+		}
+	}
+	group := rewriteGroup(c.rewrites, r.Group)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats, ok := c.commits[group]
+	if !ok {
+		stats = &commitStats{}
+		c.commits[group] = stats
+	}
+	stats.count++
+	if r.CommitTimestamp != 0 {
+		if latency := msg.Timestamp.UnixNano()/1e6 - r.CommitTimestamp; !stats.measured || latency > stats.latencyMs {
+			stats.latencyMs, stats.measured = latency, true
+		}
+	}
+	return true
+}
+
+// apply sets the commits and commit latency of the statuses, and starts the next period
+func (c *commitLatency) apply(statuses []*GroupStatus) {
+	c.lock.Lock()
+	commits := c.commits
+	c.commits = make(map[string]*commitStats)
+	c.lock.Unlock()
+	for _, status := range statuses {
+		if stats, ok := commits[status.Group]; ok {
+			status.Commits, status.CommitLatencyMs = stats.count, stats.latencyMs
+		}
+	}
+}
+
+// measureLag fetches the end offsets of the offsets topics, one request per leader, and sets the lag gauges
+func (c *commitLatency) measureLag(ctx context.Context) error {
+	c.lock.Lock()
+	positions := make(map[string]map[int32]*int64, len(c.positions))
+	for topic, partitions := range c.positions {
+		positions[topic] = make(map[int32]*int64, len(partitions))
+		for partition, position := range partitions {
+			positions[topic][partition] = position
+		}
+	}
+	c.lock.Unlock()
+	requests := make(leaderRequests)
+	for topic, partitions := range positions {
+		for partition := range partitions {
+			leader, _, err := c.backend.Leader(topic, partition)
+			if err != nil {
+				return err
+			}
+			requests.add(leader, topic, partition)
+		}
+	}
+	var total, max int64
+	for broker, request := range requests {
+		response, err := c.backend.ListOffsets(ctx, broker, request, sarama.OffsetNewest)
+		if err != nil {
+			return err
+		}
+		for topic, blocks := range response {
+			for partition, block := range blocks {
+				if block.Err != nil {
+					return block.Err
+				}
+				// as parseOffsetResponse, a partition without a valid offset is skipped
+				if block.Offset < 0 {
+					continue
+				}
+				lag := block.Offset - atomic.LoadInt64(positions[topic][partition])
+				if lag < 0 {
+					lag = 0
+				}
+				total += lag
+				if lag > max {
+					max = lag
+				}
+			}
+		}
+	}
+	c.lag.Update(total)
+	c.maxLag.Update(max)
+	return nil
+}
+
+func (c *commitLatency) stop() {
+	for _, pc := range c.partitions {
+		pc.AsyncClose()
+	}
+	c.wg.Wait()
+}
+
+// commitDecoder reads the big endian fields of the records of __consumer_offsets
+type commitDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *commitDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		if d.err == nil {
+			d.err = errors.New("truncated record")
+		}
+		return make([]byte, 8)
+	}
+	res := d.b[:n]
+	d.b = d.b[n:]
+	return res
+}
+
+func (d *commitDecoder) int16() int16 { return int16(binary.BigEndian.Uint16(d.next(2))) }
+func (d *commitDecoder) int32() int32 { return int32(binary.BigEndian.Uint32(d.next(4))) }
+func (d *commitDecoder) int64() int64 { return int64(binary.BigEndian.Uint64(d.next(8))) }
+
+func (d *commitDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
@@ -0,0 +1,36 @@
+package monitor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// updateCompacted marks the compacted topics for the evaluator, by their described cleanup.policy
+// or general.compactedTopics, the caller must hold schemaUpdateMtx
+func (client *KafkaClient) updateCompacted() {
+	compacted := make(map[string]bool)
+	for topic := range client.topicMap {
+		if config, ok := client.topicConfigs[topic]; ok && strings.Contains(config.CleanupPolicy, "compact") {
+			compacted[topic] = true
+			continue
+		}
+		for _, reg := range client.compactedRegexps {
+			if reg.MatchString(topic) {
+				compacted[topic] = true
+				break
+			}
+		}
+	}
+	client.evaluator.compacted = compacted
+}
+
+func newCompactedRegexps(patterns string) []*regexp.Regexp {
+	if patterns == "" {
+		return nil
+	}
+	var res []*regexp.Regexp
+	for _, p := range strings.Split(patterns, ",") {
+		res = append(res, regexp.MustCompile(p))
+	}
+	return res
+}
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"math"
+	"sort"
+)
+
+// CompareSide is a group in one cluster of a comparison
+type CompareSide struct {
+	Cluster     string  `json:"cluster"`
+	Group       string  `json:"group"`
+	Tenant      string  `json:"tenant,omitempty"`
+	Status      Status  `json:"status"`
+	TotalLag    int64   `json:"total_lag"`
+	TimeLag     float64 `json:"time_lag"`
+	ConsumeRate float64 `json:"consume_rate"`
+}
+
+// GroupComparison pairs the same group across clusters, e.g. a consumer of an active-active deployment,
+// by the name after groupRewrite. The divergences are between the most and the least lagging cluster,
+// RateRatio is the lowest consume rate over the highest, 1 when all clusters consume at the same rate.
+type GroupComparison struct {
+	Group             string         `json:"group"`
+	Sides             []*CompareSide `json:"sides"`
+	LagDivergence     int64          `json:"lag_divergence"`
+	TimeLagDivergence float64        `json:"time_lag_divergence"`
+	RateRatio         float64        `json:"rate_ratio"`
+}
+
+// CompareSides returns the sides of the statuses
+func CompareSides(statuses []*GroupStatus) []*CompareSide {
+	sides := make([]*CompareSide, 0, len(statuses))
+	for _, status := range statuses {
+		sides = append(sides, &CompareSide{
+			Cluster:     status.Cluster,
+			Group:       status.Group,
+			Tenant:      status.Tenant,
+			Status:      status.Status,
+			TotalLag:    status.TotalLag,
+			TimeLag:     status.TimeLag,
+			ConsumeRate: status.ConsumeRate,
+		})
+	}
+	return sides
+}
+
+// CompareGroups pairs the sides by group, the groups of a single cluster are left out, the most diverging first
+func CompareGroups(sides []*CompareSide) []*GroupComparison {
+	byGroup := make(map[string][]*CompareSide)
+	for _, side := range sides {
+		byGroup[side.Group] = append(byGroup[side.Group], side)
+	}
+	res := []*GroupComparison{}
+	for group, sides := range byGroup {
+		if len(sides) < 2 {
+			continue
+		}
+		sort.Slice(sides, func(i, j int) bool { return sides[i].Cluster < sides[j].Cluster })
+		c := &GroupComparison{Group: group, Sides: sides, RateRatio: 1}
+		minLag, maxLag := int64(math.MaxInt64), int64(math.MinInt64)
+		minTime, maxTime := math.Inf(1), math.Inf(-1)
+		minRate, maxRate := math.Inf(1), math.Inf(-1)
+		for _, side := range sides {
+			minLag, maxLag = minInt64(minLag, side.TotalLag), maxInt64(maxLag, side.TotalLag)
+			minTime, maxTime = math.Min(minTime, side.TimeLag), math.Max(maxTime, side.TimeLag)
+			minRate, maxRate = math.Min(minRate, side.ConsumeRate), math.Max(maxRate, side.ConsumeRate)
+		}
+		c.LagDivergence = maxLag - minLag
+		c.TimeLagDivergence = maxTime - minTime
+		if maxRate > 0 {
+			c.RateRatio = minRate / maxRate
+		}
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].TimeLagDivergence != res[j].TimeLagDivergence {
+			return res[i].TimeLagDivergence > res[j].TimeLagDivergence
+		}
+		return res[i].Group < res[j].Group
+	})
+	return res
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
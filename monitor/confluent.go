@@ -0,0 +1,38 @@
+package monitor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// confluentConfig applies what Confluent Cloud requires on top of the profile: SASL_SSL with PLAIN,
+// and longer timeouts and retries since the brokers are reached over the internet
+func confluentConfig(c *sarama.Config) {
+	c.Net.TLS.Enable = true
+	c.Net.SASL.Enable = true
+	c.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	c.Net.SASL.Handshake = true
+	c.Net.DialTimeout = 15 * time.Second
+	c.Net.ReadTimeout = 45 * time.Second
+	c.Net.WriteTimeout = 45 * time.Second
+	c.Metadata.Retry.Max = 5
+	c.Metadata.Retry.Backoff = time.Second
+}
+
+// clusterId asks the controller for the id of the cluster, e.g. lkc-xxxxx for Confluent Cloud
+func clusterId(client sarama.Client) (string, error) {
+	controller, err := client.Controller()
+	if err != nil {
+		return "", err
+	}
+	resp, err := controller.GetMetadata(&sarama.MetadataRequest{Version: 2})
+	if err != nil {
+		return "", err
+	}
+	if resp.ClusterID == nil || *resp.ClusterID == "" {
+		return "", errors.New("the cluster has no id")
+	}
+	return *resp.ClusterID, nil
+}
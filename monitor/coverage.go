@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"sort"
+)
+
+// Coverage is what the monitoring of a cluster misses: the topics produced to which no group consumes,
+// and the groups consuming topics which no longer exist
+type Coverage struct {
+	Cluster    string             `json:"cluster"`
+	Unconsumed []*UnconsumedTopic `json:"unconsumed"`
+	Orphaned   []*OrphanedGroup   `json:"orphaned"`
+}
+
+// UnconsumedTopic is a topic with messages produced since the previous sweep but no group consuming it
+type UnconsumedTopic struct {
+	Topic      string  `json:"topic"`
+	Partitions int     `json:"partitions"`
+	InRate     float64 `json:"in_rate"`
+}
+
+// OrphanedGroup is a group subscribed to, or seen consuming, topics missing from the metadata,
+// e.g. deleted or misspelled
+type OrphanedGroup struct {
+	Group  string   `json:"group"`
+	Topics []string `json:"topics"`
+}
+
+// Coverage returns the coverage of a cluster, of all clusters if empty
+func (f *Fetcher) Coverage(cluster string) []*Coverage {
+	coverage := []*Coverage{}
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			coverage = append(coverage, cli.Coverage())
+		}
+	}
+	return coverage
+}
+
+// Coverage returns the topics of the metadata produced to at the last sweep without any group, the busiest
+// first, and the groups with topics missing from the metadata, from their subscriptions and their pairings
+// seen until they expire
+func (client *KafkaClient) Coverage() *Coverage {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	c := &Coverage{Cluster: client.cluster, Unconsumed: []*UnconsumedTopic{}, Orphaned: []*OrphanedGroup{}}
+	for topic, rate := range client.inRates {
+		if _, ok := client.topicMap[topic]; !ok || rate <= 0 || len(client.topic2Consumer[topic]) > 0 {
+			continue
+		}
+		c.Unconsumed = append(c.Unconsumed, &UnconsumedTopic{Topic: topic, Partitions: client.topicMap[topic], InRate: rate})
+	}
+	sort.Slice(c.Unconsumed, func(i, j int) bool {
+		if c.Unconsumed[i].InRate != c.Unconsumed[j].InRate {
+			return c.Unconsumed[i].InRate > c.Unconsumed[j].InRate
+		}
+		return c.Unconsumed[i].Topic < c.Unconsumed[j].Topic
+	})
+
+	//group => missing topics
+	missing := make(map[string]map[string]bool)
+	add := func(group, topic string) {
+		if _, ok := missing[group]; !ok {
+			missing[group] = make(map[string]bool)
+		}
+		missing[group][topic] = true
+	}
+	for topic, groups := range client.missingTopics {
+		for group := range groups {
+			add(group, topic)
+		}
+	}
+	for group, topics := range client.groupSeen {
+		for topic := range topics {
+			if _, ok := client.topicMap[topic]; !ok && client.monitorsTopic(topic) {
+				add(group, topic)
+			}
+		}
+	}
+	for group, topics := range missing {
+		c.Orphaned = append(c.Orphaned, &OrphanedGroup{Group: group, Topics: groupNames(topics)})
+	}
+	sort.Slice(c.Orphaned, func(i, j int) bool { return c.Orphaned[i].Group < c.Orphaned[j].Group })
+	return c
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"sync"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/sundy-li/burrowx/config"
+)
+
+// emitFilter decides which consumer_metrics points are written, it's used by the importer loop
+// and by the purge of a group. The last written points are kept in two generations: a generation lasts
+// the longest of maxSilence and minInterval, and the groups not seen for a whole generation are forgotten
+// when the next one starts, without changing which points are written since theirs are too old to skip any.
+// Past maxGroups in the current generation it starts early, so a burst of ephemeral groups is forgotten
+// too, at the cost of writing the next point of the groups which were in the older generation.
+type emitFilter struct {
+	lock  sync.Mutex
+	dedup bool
+	// ms a partition may stay silent
+	maxSilence int64
+	// ms between two points of a partition
+	minInterval int64
+	// change of the lag since the last point below which the point is skipped
+	lagDelta int64
+	//group => topic => partition => last written point, of the current generation
+	last map[string]map[string]map[int32]*emitted
+	// of the previous generation
+	previous  map[string]map[string]map[int32]*emitted
+	genStart  int64
+	maxGroups int
+
+	// groups forgotten at the end of a generation, or early by maxGroups
+	expired metrics.Counter
+	evicted metrics.Counter
+}
+
+type emitted struct {
+	ts      int64
+	logsize int64
+	offset  int64
+	lag     int64
+}
+
+func newEmitFilter(cfg *config.Config, registry metrics.Registry) *emitFilter {
+	f := &emitFilter{
+		dedup:      cfg.General.Dedup,
+		maxSilence: int64(cfg.General.MaxSilenceSeconds) * 1000,
+
+		minInterval: int64(cfg.General.MinEmitIntervalSeconds) * 1000,
+		lagDelta:    cfg.General.MinLagDelta,
+		last:        make(map[string]map[string]map[int32]*emitted),
+		previous:    make(map[string]map[string]map[int32]*emitted),
+		maxGroups:   cfg.General.EmitStateMaxGroups,
+
+		expired: metrics.GetOrRegisterCounter("emit-state-expired", registry),
+		evicted: metrics.GetOrRegisterCounter("emit-state-evicted", registry),
+	}
+	registry.GetOrRegister("emit-state-groups", metrics.NewFunctionalGauge(func() int64 {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		return int64(len(f.last) + len(f.previous))
+	}))
+	return f
+}
+
+// generation returns the last written points of a group, starting a new generation when due, the caller
+// must hold the lock
+func (f *emitFilter) generation(group string, ts int64) map[string]map[int32]*emitted {
+	length := f.maxSilence
+	if f.minInterval > length {
+		length = f.minInterval
+	}
+	if ts-f.genStart >= length {
+		f.expired.Inc(int64(len(f.previous)))
+		f.previous, f.last, f.genStart = f.last, make(map[string]map[string]map[int32]*emitted), ts
+	}
+	if topics, ok := f.last[group]; ok {
+		return topics
+	}
+	topics, ok := f.previous[group]
+	if ok {
+		delete(f.previous, group)
+	} else {
+		topics = make(map[string]map[int32]*emitted)
+	}
+	if f.maxGroups > 0 && len(f.last) >= f.maxGroups {
+		f.evicted.Inc(int64(len(f.previous)))
+		f.previous, f.last = f.last, make(map[string]map[string]map[int32]*emitted)
+	}
+	f.last[group] = topics
+	return topics
+}
+
+// emit reports whether the point of the partition is written: at most one point every minInterval,
+// then with dedup it's skipped if neither the committed nor the log end offset moved since the last written point,
+// and with lagDelta if the lag didn't change by more than it, both unless the last point is older than maxSilence
+func (f *emitFilter) emit(msg *ConsumerFullOffset, partition int32, entry LogOffset) bool {
+	if !f.dedup && f.minInterval <= 0 && f.lagDelta <= 0 {
+		return true
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	topics := f.generation(msg.Group, msg.Timestamp)
+	partitions, ok := topics[msg.Topic]
+	if !ok {
+		partitions = make(map[int32]*emitted)
+		topics[msg.Topic] = partitions
+	}
+	if last, ok := partitions[partition]; ok {
+		elapsed := msg.Timestamp - last.ts
+		if elapsed < f.minInterval {
+			return false
+		}
+		if elapsed < f.maxSilence {
+			if f.dedup && last.offset == entry.Offset && last.logsize == entry.Logsize {
+				return false
+			}
+			if delta := entry.Lag - last.lag; f.lagDelta > 0 && delta <= f.lagDelta && delta >= -f.lagDelta {
+				return false
+			}
+		}
+	}
+	partitions[partition] = &emitted{ts: msg.Timestamp, logsize: entry.Logsize, offset: entry.Offset, lag: entry.Lag}
+	return true
+}
+
+// forget drops the last written points of a group
+func (f *emitFilter) forget(group string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.last, group)
+	delete(f.previous, group)
+}
+
+// forgetTopic drops the last written points of a group and topic, whose partition points weren't written after all
+func (f *emitFilter) forgetTopic(group, topic string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.last[group], topic)
+	delete(f.previous[group], topic)
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/sundy-li/burrowx/config"
+)
+
+type emitStep struct {
+	// seconds since the first point, partition, and its log end offset and committed offset
+	second    int64
+	partition int32
+	logsize   int64
+	offset    int64
+	want      bool
+}
+
+func testEmits(t *testing.T, f *emitFilter, steps []emitStep) {
+	for i, step := range steps {
+		msg := &ConsumerFullOffset{Group: "billing", Topic: "orders", Timestamp: 1700000000000 + step.second*1000}
+		entry := LogOffset{Logsize: step.logsize, Offset: step.offset, Lag: step.logsize - step.offset}
+		if emitted := f.emit(msg, step.partition, entry); emitted != step.want {
+			t.Errorf("step %d: point of partition %d at %ds written %v, want %v", i, step.partition, step.second, emitted, step.want)
+		}
+	}
+}
+
+func TestEmitDedup(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.General.Dedup = true
+	cfg.General.MaxSilenceSeconds = 60
+	f := newEmitFilter(cfg, metrics.NewRegistry())
+	testEmits(t, f, []emitStep{
+		{0, 0, 100, 90, true},
+		{10, 0, 100, 90, false},
+		{10, 1, 100, 90, true},
+		{20, 0, 110, 90, true},
+		{30, 0, 110, 100, true},
+		{40, 0, 110, 100, false},
+		// silent since the point at 30s
+		{90, 0, 110, 100, true},
+		{100, 0, 110, 100, false},
+	})
+	f.forget("billing")
+	testEmits(t, f, []emitStep{{110, 0, 110, 100, true}})
+
+	// every point is written without a filter
+	testEmits(t, newEmitFilter(&config.Config{}, metrics.NewRegistry()), []emitStep{
+		{0, 0, 100, 90, true},
+		{0, 0, 100, 90, true},
+	})
+}
+
+func TestEmitDownsampling(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.General.MaxSilenceSeconds = 120
+	cfg.General.MinEmitIntervalSeconds = 30
+	cfg.General.MinLagDelta = 5
+	f := newEmitFilter(cfg, metrics.NewRegistry())
+	testEmits(t, f, []emitStep{
+		{0, 0, 100, 90, true},
+		// within the interval
+		{10, 0, 150, 100, false},
+		{30, 0, 150, 100, true},
+		// the lag moved by 3, then by -3 since the last point
+		{60, 0, 153, 100, false},
+		{90, 0, 157, 110, false},
+		{120, 0, 160, 116, true},
+		{150, 0, 160, 116, false},
+		// silent since the point at 120s
+		{240, 0, 160, 116, true},
+	})
+}
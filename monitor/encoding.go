@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RECORD_VERSION is bumped on every incompatible change of the encoded records,
+// adding a field is compatible, renaming or removing one is not
+const RECORD_VERSION = 1
+
+// Record is the versioned envelope of an encoded record
+type Record struct {
+	Version int         `json:"version"`
+	Type    string      `json:"type"`
+	Data    interface{} `json:"data"`
+}
+
+// EncodeJSON encodes a ConsumerFullOffset, GroupStatus or Heartbeat in its versioned envelope
+func EncodeJSON(v interface{}) ([]byte, error) {
+	r := Record{Version: RECORD_VERSION, Data: v}
+	switch v.(type) {
+	case *ConsumerFullOffset:
+		r.Type = "consumer_offset"
+	case *GroupStatus:
+		r.Type = "group_status"
+	case *Heartbeat:
+		r.Type = "heartbeat"
+	default:
+		return nil, fmt.Errorf("unknown record type %T", v)
+	}
+	return json.Marshal(r)
+}
+
+func (msg *ConsumerFullOffset) MarshalJSON() ([]byte, error) {
+	type alias ConsumerFullOffset
+	return json.Marshal(&struct {
+		*alias
+		Partitions map[int32]LogOffset `json:"partitions"`
+	}{
+		alias:      (*alias)(msg),
+		Partitions: msg.partitionMap,
+	})
+}
+
+func (msg *ConsumerFullOffset) UnmarshalJSON(data []byte) error {
+	type alias ConsumerFullOffset
+	v := &struct {
+		*alias
+		Partitions map[int32]LogOffset `json:"partitions"`
+	}{
+		alias: (*alias)(msg),
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	msg.partitionMap = v.Partitions
+	return nil
+}
+
+// DecodeJSON decodes a record encoded by EncodeJSON, records of a newer version are rejected
+func DecodeJSON(data []byte) (interface{}, error) {
+	var r struct {
+		Version int             `json:"version"`
+		Type    string          `json:"type"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Version > RECORD_VERSION {
+		return nil, fmt.Errorf("unsupported record version %d", r.Version)
+	}
+	var v interface{}
+	switch r.Type {
+	case "consumer_offset":
+		v = &ConsumerFullOffset{}
+	case "group_status":
+		v = &GroupStatus{}
+	case "heartbeat":
+		v = &Heartbeat{}
+	default:
+		return nil, fmt.Errorf("unknown record type %s", r.Type)
+	}
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,73 @@
+package monitor
+
+// endOffsetCached reports whether the log end offset of an idle partition is reused this sweep instead of fetched,
+// the partitions are rechecked every general.idleRecheckSweeps sweeps, at different sweeps to spread the requests
+func (client *KafkaClient) endOffsetCached(topic string, partition int32) bool {
+	idle := client.cfg.General.IdleEndOffsetSweeps
+	if idle <= 0 || client.unmoved[topic][partition] < idle {
+		return false
+	}
+	return (client.sweeps+int(partition))%client.cfg.General.IdleRecheckSweeps != 0
+}
+
+// updateUnmoved reuses the last offsets of the cached partitions and counts the sweeps the fetched ones didn't move,
+// the partitions whose broker failed keep their count
+func (client *KafkaClient) updateUnmoved(snap *sweepSnapshot, cached map[string][]int32, previousStartOffset map[string]map[int32]int64) {
+	client.sweeps++
+	if client.cfg.General.IdleEndOffsetSweeps <= 0 {
+		return
+	}
+	withWriteLock(client.topicOffsetMapLock, func() {
+		for topic, partitions := range cached {
+			for _, partition := range partitions {
+				offset, ok := client.previousTopicOffset[topic][partition]
+				if !ok {
+					client.resetUnmoved(topic, partition)
+					continue
+				}
+				if _, ok := client.topicOffset[topic]; !ok {
+					client.topicOffset[topic] = make(map[int32]int64)
+				}
+				client.topicOffset[topic][partition] = offset
+				if stamp, ok := client.previousTopicOffsetStamp[topic][partition]; ok {
+					// still the log end offset of the sweep which fetched it
+					if _, ok := client.topicOffsetStamp[topic]; !ok {
+						client.topicOffsetStamp[topic] = make(map[int32]sweepStamp)
+					}
+					client.topicOffsetStamp[topic][partition] = stamp
+				}
+				if start, ok := previousStartOffset[topic][partition]; ok {
+					if _, ok := client.topicStartOffset[topic]; !ok {
+						client.topicStartOffset[topic] = make(map[int32]int64)
+					}
+					client.topicStartOffset[topic][partition] = start
+				}
+				client.cachedEndOffsets.Inc(1)
+			}
+		}
+		for topic, partitions := range client.topicOffset {
+			if _, ok := client.unmoved[topic]; !ok {
+				client.unmoved[topic] = make(map[int32]int)
+			}
+			for partition, offset := range partitions {
+				if previous, ok := client.previousTopicOffset[topic][partition]; ok && previous == offset {
+					client.unmoved[topic][partition]++
+				} else {
+					client.unmoved[topic][partition] = 0
+				}
+			}
+		}
+		for topic := range client.unmoved {
+			if _, ok := snap.topicMap[topic]; !ok {
+				delete(client.unmoved, topic)
+			}
+		}
+	})
+}
+
+// resetUnmoved fetches the log end offset of the partition at the next sweep
+func (client *KafkaClient) resetUnmoved(topic string, partition int32) {
+	if partitions, ok := client.unmoved[topic]; ok {
+		delete(partitions, partition)
+	}
+}
@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+func init() {
+	RegisterEngine("window", newWindowEngine)
+	RegisterEngine("threshold", newThresholdEngine)
+	config.EngineRegistered = engineRegistered
+}
+
+// Engine decides the statuses of the groups from what the evaluator measured of them, the evaluator keeps the
+// windows, the lag and rate measurements and the baselines. An engine is shared by the sweeps and the on demand
+// evaluations of a cluster, which may run concurrently, it must lock the state it keeps.
+type Engine interface {
+	Name() string
+	// PartitionStatus returns the status of a partition from its committed offsets in the window of the group,
+	// oldest first, the last one is the current one
+	PartitionStatus(group, topic string, partition int32, history []LogOffset) Status
+	// GroupStatus returns the status of a group, its Status is the one of its Worst partition so far, ERR
+	// if it's STALL or ERR, WARN if it's WARN or REWIND
+	GroupStatus(status *GroupStatus) Status
+}
+
+// EngineFactory creates the evaluation engine of a cluster from the options of its config
+type EngineFactory func(cfg *config.Config, cluster string, options map[string]string) (Engine, error)
+
+var (
+	engineLock      sync.Mutex
+	engineFactories = make(map[string]EngineFactory)
+)
+
+// RegisterEngine makes an evaluation engine type available to the config, like RegisterSink,
+// and panics if the type is registered twice
+func RegisterEngine(typ string, factory EngineFactory) {
+	engineLock.Lock()
+	defer engineLock.Unlock()
+	if _, ok := engineFactories[typ]; ok {
+		panic("evaluation engine type registered twice: " + typ)
+	}
+	engineFactories[typ] = factory
+}
+
+// engineRegistered reports whether an evaluation engine type is registered, for the validation of the config
+func engineRegistered(typ string) bool {
+	engineLock.Lock()
+	defer engineLock.Unlock()
+	_, ok := engineFactories[typ]
+	return ok
+}
+
+func newEngine(cfg *config.Config, cluster string) (Engine, error) {
+	engineLock.Lock()
+	defer engineLock.Unlock()
+	ec := cfg.EvaluationOf(cluster)
+	factory, ok := engineFactories[ec.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown evaluation engine type %s, is its plugin loaded", ec.Type)
+	}
+	engine, err := factory(cfg, cluster, ec.Options)
+	if err != nil {
+		return nil, fmt.Errorf("evaluation engine %s: %v", ec.Type, err)
+	}
+	return engine, nil
+}
+
+// windowEngine is the default engine, it evaluates the partitions over the window of the group and raises
+// the OK groups to WARN on their skew, retention pressure and anomaly score as configured
+type windowEngine struct {
+	windowSize int
+	// raise WARN on abnormal lag of OK groups
+	anomalyDetection bool
+	// raise WARN on OK groups with a topic more skewed than this, disabled if 0
+	skewThreshold float64
+	// raise WARN on OK groups whose retention pressure is above this, disabled if 0
+	retentionPressureThreshold float64
+}
+
+func newWindowEngine(cfg *config.Config, cluster string, options map[string]string) (Engine, error) {
+	return &windowEngine{
+		windowSize:                 EVALUATION_WINDOW,
+		anomalyDetection:           cfg.General.AnomalyDetection,
+		skewThreshold:              cfg.General.SkewThreshold,
+		retentionPressureThreshold: cfg.General.RetentionPressureThreshold,
+	}, nil
+}
+
+func (w *windowEngine) Name() string { return "window" }
+
+// PartitionStatus is REWIND if the committed offset went backwards, STALL if a full window of commits didn't
+// move while lagging, WARN if the lag grew in every evaluation of a full window, OK otherwise
+func (w *windowEngine) PartitionStatus(group, topic string, partition int32, history []LogOffset) Status {
+	if len(history) < 2 {
+		return StatusOK
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Offset < history[i-1].Offset {
+			return StatusRewind
+		}
+	}
+	if len(history) < w.windowSize {
+		return StatusOK
+	}
+
+	stalled, growing := true, true
+	for i := 1; i < len(history); i++ {
+		if history[i].Offset != history[i-1].Offset || history[i].Lag == 0 {
+			stalled = false
+		}
+		if history[i].Lag <= history[i-1].Lag {
+			growing = false
+		}
+	}
+	if stalled && history[0].Lag > 0 {
+		return StatusStall
+	}
+	if growing {
+		return StatusWarn
+	}
+	return StatusOK
+}
+
+func (w *windowEngine) GroupStatus(status *GroupStatus) Status {
+	if status.Status != StatusOK {
+		return status.Status
+	}
+	if w.skewThreshold > 0 {
+		for _, skew := range status.Skews {
+			if skew.Skew > w.skewThreshold {
+				return StatusWarn
+			}
+		}
+	}
+	if w.retentionPressureThreshold > 0 && status.RetentionPressure > w.retentionPressureThreshold {
+		return StatusWarn
+	}
+	if w.anomalyDetection && status.AnomalyScore > ANOMALY_THRESHOLD {
+		return StatusWarn
+	}
+	return StatusOK
+}
+
+// thresholdEngine flags the partitions on their current lag only, WARN above the warnLag option and ERR above
+// the errLag option, in messages, either disabled if 0
+type thresholdEngine struct {
+	warnLag int64
+	errLag  int64
+}
+
+func newThresholdEngine(cfg *config.Config, cluster string, options map[string]string) (Engine, error) {
+	e := &thresholdEngine{}
+	for name, v := range map[string]*int64{"warnLag": &e.warnLag, "errLag": &e.errLag} {
+		if options[name] == "" {
+			continue
+		}
+		var err error
+		if *v, err = strconv.ParseInt(options[name], 10, 64); err != nil || *v < 0 {
+			return nil, fmt.Errorf("invalid %s %s", name, options[name])
+		}
+	}
+	if e.warnLag == 0 && e.errLag == 0 {
+		return nil, fmt.Errorf("no warnLag nor errLag")
+	}
+	return e, nil
+}
+
+func (t *thresholdEngine) Name() string { return "threshold" }
+
+func (t *thresholdEngine) PartitionStatus(group, topic string, partition int32, history []LogOffset) Status {
+	if len(history) == 0 {
+		return StatusOK
+	}
+	lag := history[len(history)-1].Lag
+	if t.errLag > 0 && lag > t.errLag {
+		return StatusErr
+	}
+	if t.warnLag > 0 && lag > t.warnLag {
+		return StatusWarn
+	}
+	return StatusOK
+}
+
+func (t *thresholdEngine) GroupStatus(status *GroupStatus) Status {
+	return status.Status
+}
@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"regexp"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+type enrichRule struct {
+	tag   string
+	match *regexp.Regexp
+	drop  bool
+	set   map[string]string
+}
+
+func newEnrichRules(rules []*config.EnrichRule) ([]*enrichRule, error) {
+	res := make([]*enrichRule, 0, len(rules))
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &enrichRule{tag: rule.Tag, match: re, drop: rule.Drop, set: rule.Set})
+	}
+	return res, nil
+}
+
+// enrich applies the rules to the tags in order, it returns false if the point is dropped
+func enrich(rules []*enrichRule, tags map[string]string) bool {
+	for _, rule := range rules {
+		value, ok := tags[rule.tag]
+		if !ok {
+			continue
+		}
+		submatches := rule.match.FindStringSubmatchIndex(value)
+		if submatches == nil {
+			continue
+		}
+		if rule.drop {
+			return false
+		}
+		for k, v := range rule.set {
+			tags[k] = string(rule.match.ExpandString(nil, v, value, submatches))
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// ErrorKind classifies the failures of the monitor, each kind is counted by errors-<kind> in the internal metrics
+// of its cluster, and logged as error_kind
+type ErrorKind string
+
+const (
+	// a broker unreachable or failing a request
+	ErrorBroker ErrorKind = "broker"
+	// the credentials or the ACLs of the principal rejected
+	ErrorAuth ErrorKind = "auth"
+	// a response, a member metadata or a record which can't be decoded
+	ErrorDecode ErrorKind = "decode"
+	// a write to influxdb or to a sink failing
+	ErrorSink ErrorKind = "sink"
+)
+
+var errorKinds = []ErrorKind{ErrorBroker, ErrorAuth, ErrorDecode, ErrorSink}
+
+// MonitorError is a failure of the monitoring of a cluster with its kind
+type MonitorError struct {
+	Kind    ErrorKind
+	Cluster string
+	Err     error
+}
+
+func (e *MonitorError) Error() string {
+	return fmt.Sprintf("%s error on cluster %s: %v", e.Kind, e.Cluster, e.Err)
+}
+
+// kindOf classifies an error of a kafka request, the errors which are neither auth nor decode errors are broker errors
+func kindOf(err error) ErrorKind {
+	switch e := err.(type) {
+	case *MonitorError:
+		return e.Kind
+	case sarama.KError:
+		switch e {
+		case sarama.ErrSASLAuthenticationFailed, sarama.ErrUnsupportedSASLMechanism, sarama.ErrIllegalSASLState:
+			return ErrorAuth
+		}
+		if isAuthorizationError(e) {
+			return ErrorAuth
+		}
+		return ErrorBroker
+	case sarama.PacketDecodingError, *sarama.PacketDecodingError:
+		return ErrorDecode
+	}
+	if err == ErrNotOffsetCommit {
+		return ErrorDecode
+	}
+	return ErrorBroker
+}
+
+// errorCounters are the errors-<kind> counters of a cluster, shared by its client and its importer
+type errorCounters map[ErrorKind]metrics.Counter
+
+func newErrorCounters(registry metrics.Registry) errorCounters {
+	counters := make(errorCounters, len(errorKinds))
+	for _, kind := range errorKinds {
+		counters[kind] = metrics.GetOrRegisterCounter("errors-"+string(kind), registry)
+	}
+	return counters
+}
+
+// counts returns the errors per kind since the start
+func (c errorCounters) counts() map[ErrorKind]int64 {
+	res := make(map[ErrorKind]int64, len(c))
+	for kind, counter := range c {
+		res[kind] = counter.Count()
+	}
+	return res
+}
+
+// failed counts the error of the kind, or of the kind of err if empty, and returns the log entry of the error
+func (client *KafkaClient) failed(log *logrus.Entry, kind ErrorKind, err error) *logrus.Entry {
+	if kind == "" {
+		kind = kindOf(err)
+	}
+	client.errors[kind].Inc(1)
+	return log.WithField("error_kind", kind)
+}
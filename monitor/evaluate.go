@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"context"
+	"time"
+)
+
+// FreshStatus is the status of a group evaluated on demand, over its window and its offsets fetched now
+type FreshStatus struct {
+	Status *GroupStatus `json:"status"`
+	Lag    *GroupLag    `json:"lag"`
+}
+
+// EvaluateNow fetches the offsets of a group of a cluster now and evaluates it, e.g. after a consumer rollout
+func (f *Fetcher) EvaluateNow(ctx context.Context, cluster, group string) (*FreshStatus, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cli.EvaluateNow(ctx, group)
+}
+
+// EvaluateNow evaluates the group over its window with its offsets fetched now, the window isn't changed,
+// the sweeps evaluate the group at their interval as usual
+func (client *KafkaClient) EvaluateNow(ctx context.Context, group string) (*FreshStatus, error) {
+	lag, err := client.FreshLag(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+	ts := clockNow().UnixNano() / int64(time.Millisecond)
+	return &FreshStatus{Status: client.evaluator.evaluateOne(ts, lag.Group, lag.Offsets), Lag: lag}, nil
+}
+
+// evaluateOne evaluates a group on a copy of its state, without changing the evaluator
+func (e *Evaluator) evaluateOne(ts int64, group string, msgs []*ConsumerFullOffset) *GroupStatus {
+	one := *e
+	one.windows = map[string][]*Evaluation{group: append([]*Evaluation(nil), e.windows[group]...)}
+	one.baselines = make(map[string]*Baseline)
+	if baseline, ok := e.baselines[group]; ok {
+		b := *baseline
+		one.baselines[group] = &b
+	}
+	one.staleCounts = map[string]int64{group: e.staleCounts[group]}
+	return one.evaluate(ts, map[string][]*ConsumerFullOffset{group: msgs})[0]
+}
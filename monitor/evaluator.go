@@ -0,0 +1,419 @@
+package monitor
+
+import (
+	"math"
+	"sort"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+var (
+	// number of recent evaluations kept per group
+	EVALUATION_WINDOW = 10
+	// weight of the last evaluation in the lag baseline of a group
+	ANOMALY_ALPHA = 0.05
+	// evaluations a baseline needs before it's trusted
+	ANOMALY_WARMUP = 30
+	// standard deviations above its baseline at which the lag of a group is abnormal
+	ANOMALY_THRESHOLD = 4.0
+)
+
+// Evaluator keeps a window of the recent offsets of every group and evaluates the group status from it. It's
+// guarded by the schemaUpdateMtx of the client: the sweep evaluates and the mutes, the purge and the state
+// restore change it under the write lock, the api reads the windows under the read lock.
+type Evaluator struct {
+	cluster     string
+	clusterName string
+	windowSize  int
+	//group => recent evaluations, oldest first
+	windows map[string][]*Evaluation
+	//group => learned total lag
+	baselines map[string]*Baseline
+	//group => commits found ahead of the log end offset
+	staleCounts map[string]int64
+	// decides the statuses of the partitions and the groups
+	engine Engine
+	// rewinds of at most this many messages are out of order commits rather than deliberate
+	outOfOrderMaxRewind int64
+	//topic => retention.ms in seconds, of the topics with a time retention
+	retention map[string]float64
+	// the log start offsets are fetched
+	startOffsets bool
+	//compacted topics, whose lag counts records compaction may have removed
+	compacted map[string]bool
+	// the partitions of compacted topics are always OK
+	suppressCompacted bool
+	// the partitions being reassigned are always OK
+	suppressReassigning bool
+	tenants             *Tenants
+	//group => topic => mute, changed by the api under the lock of the owner of the evaluator
+	mutes map[string]map[string]*TopicMute
+	// set by the owner of the evaluator, nil if the groups have no owners
+	owners *owners
+}
+
+// Baseline is the exponentially weighted mean and variance of the total lag of a group
+type Baseline struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int     `json:"count"`
+}
+
+// NewEvaluator returns the evaluator of a cluster, with the evaluation engine of its config
+func NewEvaluator(cfg *config.Config, cluster string) (*Evaluator, error) {
+	engine, err := newEngine(cfg, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return &Evaluator{
+		cluster:     cluster,
+		clusterName: cfg.DisplayNameOf(cluster),
+		windowSize:  EVALUATION_WINDOW,
+		windows:     make(map[string][]*Evaluation),
+		baselines:   make(map[string]*Baseline),
+		staleCounts: make(map[string]int64),
+		mutes:       make(map[string]map[string]*TopicMute),
+		engine:      engine,
+
+		outOfOrderMaxRewind: cfg.General.OutOfOrderMaxRewind,
+		startOffsets:        cfg.General.FetchStartOffsets,
+		suppressCompacted:   cfg.General.SuppressCompactedLag,
+		suppressReassigning: cfg.General.SuppressReassigningLag,
+		tenants:             NewTenants(cfg),
+	}, nil
+}
+
+// evaluate appends the offsets of this sweep to the windows of the groups and returns their status,
+// groups absent from the sweep are forgotten
+func (e *Evaluator) evaluate(ts int64, groupOffsets map[string][]*ConsumerFullOffset) []*GroupStatus {
+	windows := make(map[string][]*Evaluation, len(groupOffsets))
+	baselines := make(map[string]*Baseline, len(groupOffsets))
+	staleCounts := make(map[string]int64, len(groupOffsets))
+	statuses := make([]*GroupStatus, 0, len(groupOffsets))
+	for group, msgs := range groupOffsets {
+		current := &Evaluation{
+			Timestamp: ts,
+			offsets:   make(map[string]map[int32]LogOffset),
+		}
+		for _, msg := range msgs {
+			current.offsets[msg.Topic] = msg.partitionMap
+		}
+		current.stamp()
+		window := e.windows[group]
+		replaced := false
+		if n := len(window); n > 0 && window[n-1].Timestamp == ts {
+			// a sweep asked out of the ticks within the same interval replaces the previous one
+			window = append([]*Evaluation{}, window[:n-1]...)
+			replaced = true
+		}
+		window = append(window, current)
+		if len(window) > e.windowSize {
+			window = window[len(window)-e.windowSize:]
+		}
+		windows[group] = window
+
+		status := &GroupStatus{
+			Cluster:     e.cluster,
+			ClusterName: e.clusterName,
+			Group:       group,
+			Tenant:      e.tenants.Of(e.cluster, group),
+			Timestamp:   ts,
+			Window:      window,
+		}
+		if owner := e.owners.of(e.cluster, group); owner != nil {
+			status.Team, status.Notifiers = owner.team, owner.notifiers
+		}
+		var previous *Evaluation
+		if len(window) > 1 {
+			previous = window[len(window)-2]
+		}
+		var retained, consumed, mutedLag int64
+		var lags []int64
+		staleCount := e.staleCounts[group]
+		for topic, partitions := range current.offsets {
+			muted := e.muted(group, topic, ts)
+			if muted {
+				status.MutedTopics = append(status.MutedTopics, topic)
+			}
+			skew := &TopicSkew{Topic: topic, MinLag: -1}
+			for partition, offset := range partitions {
+				if offset.StaleBrokerOffset {
+					staleCount++
+				}
+				if offset.Offset < 0 {
+					continue
+				}
+				skew.add(offset.Lag)
+				if previous != nil {
+					if rewind := e.rewind(topic, partition, previous.offsets[topic][partition], offset); rewind != nil {
+						status.Rewinds = append(status.Rewinds, rewind)
+					}
+				}
+				r, c := consumedRange(offset)
+				retained += r
+				consumed += c
+				ps := &PartitionStatus{
+					Topic:     topic,
+					Partition: partition,
+					Status:    e.partitionStatus(window, group, topic, partition),
+					Lag:       offset.Lag,
+					TimeLag:   timeLag(window, topic, partition),
+				}
+				if e.compacted[topic] {
+					ps.Compacted = true
+					if e.suppressCompacted {
+						ps.Status = StatusOK
+					}
+				}
+				if offset.Reassigning {
+					ps.Reassigning = true
+					if e.suppressReassigning {
+						ps.Status = StatusOK
+					}
+				}
+				ps.RetentionPressure = retentionPressure(offset, ps.TimeLag, e.retention[topic], e.startOffsets)
+				status.TotalLag += ps.Lag
+				lags = append(lags, ps.Lag)
+				if ps.Lag > status.MaxLag {
+					status.MaxLag = ps.Lag
+				}
+				if muted {
+					// recorded, but left out of the status
+					ps.Status, ps.Muted = StatusOK, true
+					mutedLag += ps.Lag
+					continue
+				}
+				if ps.RetentionPressure > status.RetentionPressure {
+					status.RetentionPressure = ps.RetentionPressure
+				}
+				if ps.TimeLag > status.TimeLag {
+					status.TimeLag = ps.TimeLag
+				}
+				if ps.Status != StatusOK {
+					status.partitions = append(status.partitions, ps)
+				}
+				if status.Worst == nil || ps.Status > status.Worst.Status ||
+					(ps.Status == status.Worst.Status && ps.Lag > status.Worst.Lag) {
+					status.Worst = ps
+				}
+			}
+			if skew.partitions > 1 && !muted {
+				skew.finish()
+				status.Skews = append(status.Skews, skew)
+			}
+		}
+		sort.Strings(status.MutedTopics)
+		status.StaleBrokerOffsets = staleCount
+		staleCounts[group] = staleCount
+		sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+		status.LagP50 = percentile(lags, 0.5)
+		status.LagP95 = percentile(lags, 0.95)
+		status.ConsumedPct = 100
+		if retained > 0 {
+			status.ConsumedPct = float64(consumed) * 100 / float64(retained)
+		}
+		if status.Worst != nil {
+			switch status.Worst.Status {
+			case StatusStall, StatusErr:
+				status.Status = StatusErr
+			case StatusWarn, StatusRewind:
+				status.Status = StatusWarn
+			}
+		}
+		baseline := e.baselines[group]
+		if baseline == nil {
+			baseline = &Baseline{}
+		}
+		// the lag of the muted topics, e.g. a replay, neither scores nor feeds the baseline it's scored against
+		unmutedLag := status.TotalLag - mutedLag
+		status.AnomalyScore = baseline.score(unmutedLag)
+		if !replaced {
+			// the replaced sweep already fed it, the baseline counts every interval once
+			baseline.update(unmutedLag)
+		}
+		baselines[group] = baseline
+		current.TotalLag = status.TotalLag
+		status.LagRate = lagRate(window)
+		status.Forecast15m = forecast(status.TotalLag, status.LagRate, 15*60)
+		status.Forecast60m = forecast(status.TotalLag, status.LagRate, 60*60)
+		status.ConsumeRate = consumeRate(window)
+		status.Status = e.engine.GroupStatus(status)
+		current.Status = status.Status
+		statuses = append(statuses, status)
+	}
+	e.windows = windows
+	e.baselines = baselines
+	e.staleCounts = staleCounts
+	return statuses
+}
+
+// rewind returns the rewind of a partition since the previous evaluation, nil if its committed offset didn't go back
+func (e *Evaluator) rewind(topic string, partition int32, previous, current LogOffset) *Rewind {
+	if previous.Offset < 0 || current.Offset >= previous.Offset {
+		return nil
+	}
+	r := &Rewind{
+		Topic:     topic,
+		Partition: partition,
+		From:      previous.Offset,
+		To:        current.Offset,
+		Kind:      RewindDeliberate,
+	}
+	if previous.Offset-current.Offset <= e.outOfOrderMaxRewind {
+		r.Kind = RewindOutOfOrder
+	}
+	return r
+}
+
+func (s *TopicSkew) add(lag int64) {
+	s.partitions++
+	s.MeanLag += float64(lag)
+	if lag > s.MaxLag {
+		s.MaxLag = lag
+	}
+	if s.MinLag < 0 || lag < s.MinLag {
+		s.MinLag = lag
+	}
+}
+
+func (s *TopicSkew) finish() {
+	s.MeanLag /= float64(s.partitions)
+	if s.MeanLag > 0 {
+		s.Skew = float64(s.MaxLag) / s.MeanLag
+	}
+}
+
+// percentile returns the nearest rank percentile p of the sorted values, 0 if there are none
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// timeLag estimates how many seconds ago the committed offset of the partition was the log end offset,
+// by interpolating between the log end offsets of the window, or extrapolating with their rate when
+// the committed offset is older than the window. The log end offsets are placed at the time their sweep
+// fetched them, a log end offset reused by several evaluations stays at the time of its sweep.
+func timeLag(window []*Evaluation, topic string, partition int32) float64 {
+	last := window[len(window)-1]
+	current, ok := last.offsets[topic][partition]
+	if !ok || current.Lag <= 0 {
+		return 0
+	}
+	now, currentAt := evaluationAt(last), offsetAt(last, current)
+	newer, newerAt := current, currentAt
+	for i := len(window) - 2; i >= 0; i-- {
+		offset, ok := window[i].offsets[topic][partition]
+		if !ok {
+			break
+		}
+		at := offsetAt(window[i], offset)
+		if offset.Logsize <= current.Offset {
+			if newer.Logsize > offset.Logsize && newerAt > at {
+				at += (newerAt - at) * float64(current.Offset-offset.Logsize) / float64(newer.Logsize-offset.Logsize)
+			}
+			return (now - at) / 1000
+		}
+		newer, newerAt = offset, at
+	}
+	// older than the window, newer is its oldest log end offset of the partition
+	seconds := (now - newerAt) / 1000
+	elapsed := (currentAt - newerAt) / 1000
+	if elapsed <= 0 || current.Logsize <= newer.Logsize {
+		return seconds
+	}
+	rate := float64(current.Logsize-newer.Logsize) / elapsed
+	return seconds + float64(newer.Logsize-current.Offset)/rate
+}
+
+// lagRate fits a least squares line through the total lags of the window, it returns its slope in messages per second
+func lagRate(window []*Evaluation) float64 {
+	if len(window) < 3 {
+		return 0
+	}
+	n := float64(len(window))
+	t0 := evaluationAt(window[0])
+	var sumX, sumY, sumXY, sumXX float64
+	for _, eval := range window {
+		x := (evaluationAt(eval) - t0) / 1000
+		y := float64(eval.TotalLag)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / d
+}
+
+// consumeRate is the messages per second the group committed over the window, the partitions
+// whose committed offset went back or is missing at either end don't count
+func consumeRate(window []*Evaluation) float64 {
+	if len(window) < 2 {
+		return 0
+	}
+	first, current := window[0], window[len(window)-1]
+	seconds := (evaluationAt(current) - evaluationAt(first)) / 1000
+	if seconds <= 0 {
+		return 0
+	}
+	var consumed int64
+	for topic, partitions := range current.offsets {
+		for partition, offset := range partitions {
+			if from, ok := first.offsets[topic][partition]; ok && from.Offset >= 0 && offset.Offset >= from.Offset {
+				consumed += offset.Offset - from.Offset
+			}
+		}
+	}
+	return float64(consumed) / seconds
+}
+
+// forecast is the lag after seconds if the rate holds, it can't go below 0
+func forecast(lag int64, rate float64, seconds int64) int64 {
+	f := float64(lag) + rate*float64(seconds)
+	if f < 0 {
+		return 0
+	}
+	return int64(f)
+}
+
+// score is how many standard deviations the lag is above the baseline, 0 until the baseline is warm
+func (b *Baseline) score(lag int64) float64 {
+	if b.Count < ANOMALY_WARMUP {
+		return 0
+	}
+	// a lag which never moved would make any change infinitely abnormal
+	std := math.Max(math.Sqrt(b.Variance), 1)
+	return (float64(lag) - b.Mean) / std
+}
+
+func (b *Baseline) update(lag int64) {
+	if b.Count == 0 {
+		b.Mean = float64(lag)
+	} else {
+		diff := float64(lag) - b.Mean
+		incr := ANOMALY_ALPHA * diff
+		b.Mean += incr
+		b.Variance = (1 - ANOMALY_ALPHA) * (b.Variance + diff*incr)
+	}
+	b.Count++
+}
+
+// partitionStatus evaluates a partition with the engine, from its committed offsets in the window
+func (e *Evaluator) partitionStatus(window []*Evaluation, group, topic string, partition int32) Status {
+	history := make([]LogOffset, 0, len(window))
+	for _, eval := range window {
+		if offset, ok := eval.offsets[topic][partition]; ok && offset.Offset >= 0 {
+			history = append(history, offset)
+		}
+	}
+	return e.engine.PartitionStatus(group, topic, partition, history)
+}
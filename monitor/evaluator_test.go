@@ -0,0 +1,234 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+func testEvaluator(t *testing.T) *Evaluator {
+	e, err := NewEvaluator(&config.Config{}, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// groupOffsets is the sweep of one group consuming one topic, a log end offset and committed offset pair per
+// partition
+func groupOffsets(group, topic string, offsets ...[2]int64) map[string][]*ConsumerFullOffset {
+	msg := &ConsumerFullOffset{Group: group, Topic: topic, partitionMap: make(map[int32]LogOffset, len(offsets))}
+	for partition, o := range offsets {
+		lag := int64(-1)
+		if o[1] >= 0 {
+			lag = o[0] - o[1]
+		}
+		msg.partitionMap[int32(partition)] = LogOffset{Logsize: o[0], Offset: o[1], Lag: lag}
+	}
+	return map[string][]*ConsumerFullOffset{group: {msg}}
+}
+
+func TestEvaluateReplacedSweepBaseline(t *testing.T) {
+	e := testEvaluator(t)
+	ts := int64(1700000000000)
+	for i := int64(0); i < 3; i++ {
+		e.evaluate(ts+i*10000, groupOffsets("billing", "orders", [2]int64{100 + i*10, 90 + i*10}))
+	}
+	// a sweep asked out of the ticks in the same interval as the last one
+	e.evaluate(ts+20000, groupOffsets("billing", "orders", [2]int64{130, 100}))
+	if n := len(e.windows["billing"]); n != 3 {
+		t.Errorf("%d evaluations in the window, want the replaced one counted once", n)
+	}
+	if b := e.baselines["billing"]; b.Count != 3 || b.Mean != 10 {
+		t.Errorf("baseline of %d evaluations with a mean of %v, want 3 of 10", b.Count, b.Mean)
+	}
+}
+
+func TestEvaluateWindowStatus(t *testing.T) {
+	full := int64(EVALUATION_WINDOW)
+	for _, c := range []struct {
+		name   string
+		sweeps int64
+		// log end offset and committed offset of the partition at the i-th sweep
+		sweep     func(i int64) [2]int64
+		partition Status
+		group     Status
+	}{
+		{"consumed", full, func(i int64) [2]int64 { return [2]int64{100 + i*10, 90 + i*10} }, StatusOK, StatusOK},
+		{"idle caught up", full, func(i int64) [2]int64 { return [2]int64{100, 100} }, StatusOK, StatusOK},
+		{"stalled", full, func(i int64) [2]int64 { return [2]int64{100 + i*10, 90} }, StatusStall, StatusErr},
+		{"stalled short of a window", full - 1, func(i int64) [2]int64 { return [2]int64{100 + i*10, 90} }, StatusOK, StatusOK},
+		{"lag growing", full, func(i int64) [2]int64 { return [2]int64{100 + i*10, 90 + i} }, StatusWarn, StatusWarn},
+		{"lag growing but once", full, func(i int64) [2]int64 {
+			if i == 4 {
+				// the lag of the previous sweep
+				return [2]int64{131, 94}
+			}
+			return [2]int64{100 + i*10, 90 + i}
+		}, StatusOK, StatusOK},
+		{"rewound", 2, func(i int64) [2]int64 { return [2]int64{100, 90 - i*20} }, StatusRewind, StatusWarn},
+	} {
+		e := testEvaluator(t)
+		var statuses []*GroupStatus
+		for i := int64(0); i < c.sweeps; i++ {
+			statuses = e.evaluate(1700000000000+i*10000, groupOffsets("billing", "orders", c.sweep(i)))
+		}
+		s := statuses[0]
+		if s.Worst == nil || s.Worst.Status != c.partition || s.Status != c.group {
+			t.Errorf("%s: partition %v and group %v, want %v and %v", c.name, s.Worst, s.Status, c.partition, c.group)
+		}
+	}
+}
+
+// sweepWindow is the window of a partition swept every 10s, with the same committed offset in every sweep
+func sweepWindow(offset int64, logsizes ...int64) []*Evaluation {
+	window := make([]*Evaluation, len(logsizes))
+	for i, logsize := range logsizes {
+		window[i] = &Evaluation{
+			Timestamp: int64(i) * 10000,
+			offsets:   map[string]map[int32]LogOffset{"orders": {0: {Logsize: logsize, Offset: offset, Lag: logsize - offset}}},
+		}
+	}
+	return window
+}
+
+func TestTimeLag(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		window  []*Evaluation
+		seconds float64
+	}{
+		{"caught up", sweepWindow(300, 100, 200, 300), 0},
+		{"at a log end offset", sweepWindow(200, 100, 200, 300), 10},
+		{"interpolated", sweepWindow(150, 100, 200, 300), 15},
+		{"older than the window", sweepWindow(50, 100, 200, 300), 25},
+		{"older than an idle window", sweepWindow(50, 100, 100, 100), 20},
+		{"single evaluation", sweepWindow(50, 100), 0},
+	} {
+		if seconds := timeLag(c.window, "orders", 0); seconds != c.seconds {
+			t.Errorf("%s: time lag of %vs, want %vs", c.name, seconds, c.seconds)
+		}
+	}
+}
+
+// lagWindow is the window of a group evaluated every 10s with these total lags
+func lagWindow(lags ...int64) []*Evaluation {
+	window := make([]*Evaluation, len(lags))
+	for i, lag := range lags {
+		window[i] = &Evaluation{Timestamp: int64(i) * 10000, TotalLag: lag}
+	}
+	return window
+}
+
+func TestLagRateForecast(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		window []*Evaluation
+		rate   float64
+		// the lag in 60s from the last one of the window
+		forecast int64
+	}{
+		{"growing", lagWindow(100, 200, 300), 10, 900},
+		{"draining", lagWindow(300, 200, 100), -10, 0},
+		{"draining slowly", lagWindow(130, 120, 110, 100), -1, 40},
+		{"flat", lagWindow(100, 100, 100), 0, 100},
+		{"noisy", lagWindow(100, 300, 200), 5, 500},
+		{"too short", lagWindow(100, 200), 0, 200},
+	} {
+		rate := lagRate(c.window)
+		if rate != c.rate {
+			t.Errorf("%s: lag rate of %v/s, want %v/s", c.name, rate, c.rate)
+		}
+		if f := forecast(c.window[len(c.window)-1].TotalLag, rate, 60); f != c.forecast {
+			t.Errorf("%s: forecast lag of %d, want %d", c.name, f, c.forecast)
+		}
+	}
+}
+
+func TestBaselineScore(t *testing.T) {
+	repeat := func(lag int64, n int) []int64 {
+		lags := make([]int64, n)
+		for i := range lags {
+			lags[i] = lag
+		}
+		return lags
+	}
+	for _, c := range []struct {
+		name string
+		// the lags the baseline learned, and the lag it scores
+		learned []int64
+		lag     int64
+		score   float64
+	}{
+		{"cold", repeat(100, ANOMALY_WARMUP-1), 500, 0},
+		// a lag which never moved has a standard deviation of 1
+		{"above a flat baseline", repeat(100, ANOMALY_WARMUP), 105, 5},
+		{"below a flat baseline", repeat(100, ANOMALY_WARMUP), 90, -10},
+		{"on a flat baseline", repeat(100, ANOMALY_WARMUP), 100, 0},
+	} {
+		b := &Baseline{}
+		for _, lag := range c.learned {
+			b.update(lag)
+		}
+		if score := b.score(c.lag); score != c.score {
+			t.Errorf("%s: score of %v, want %v", c.name, score, c.score)
+		}
+	}
+
+	b := &Baseline{}
+	b.update(100)
+	b.update(200)
+	if b.Count != 2 || b.Mean != 105 || b.Variance != 475 {
+		t.Errorf("baseline of %d lags with a mean of %v and a variance of %v, want 2 of 105 and 475", b.Count, b.Mean, b.Variance)
+	}
+}
+
+func TestWindowEngineAnomaly(t *testing.T) {
+	for _, c := range []struct {
+		detection bool
+		score     float64
+		status    Status
+	}{
+		{true, ANOMALY_THRESHOLD + 1, StatusWarn},
+		{true, ANOMALY_THRESHOLD, StatusOK},
+		{false, ANOMALY_THRESHOLD + 1, StatusOK},
+	} {
+		engine := &windowEngine{windowSize: EVALUATION_WINDOW, anomalyDetection: c.detection}
+		if status := engine.GroupStatus(&GroupStatus{AnomalyScore: c.score}); status != c.status {
+			t.Errorf("score of %v with the detection %v is %v, want %v", c.score, c.detection, status, c.status)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ranks := func(n int64) []int64 {
+		values := make([]int64, n)
+		for i := range values {
+			values[i] = int64(i) + 1
+		}
+		return values
+	}
+	for _, c := range []struct {
+		sorted   []int64
+		p50, p95 int64
+	}{
+		{nil, 0, 0},
+		{[]int64{7}, 7, 7},
+		{[]int64{1, 2}, 1, 2},
+		{ranks(10), 5, 10},
+		{ranks(20), 10, 19},
+		{ranks(100), 50, 95},
+	} {
+		if p50, p95 := percentile(c.sorted, 0.5), percentile(c.sorted, 0.95); p50 != c.p50 || p95 != c.p95 {
+			t.Errorf("percentiles of %d values are %d and %d, want %d and %d", len(c.sorted), p50, p95, c.p50, c.p95)
+		}
+	}
+
+	// the partitions without a commit don't count
+	e := testEvaluator(t)
+	s := e.evaluate(1700000000000, groupOffsets("billing", "orders", [2]int64{130, 100}, [2]int64{100, 100},
+		[2]int64{120, 100}, [2]int64{110, 100}, [2]int64{500, -1}))[0]
+	if s.LagP50 != 10 || s.LagP95 != 30 || s.MaxLag != 30 {
+		t.Errorf("lag p50 %d, p95 %d and max %d, want 10, 30 and 30", s.LagP50, s.LagP95, s.MaxLag)
+	}
+}
@@ -0,0 +1,25 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// eventHubsConfig applies what the kafka endpoint of Event Hubs requires: SASL_SSL with PLAIN,
+// a protocol version it supports, so committed offsets are fetched with OffsetFetch v1,
+// and a single in-flight request per connection with longer backoffs since the namespace throttles
+func eventHubsConfig(c *sarama.Config) {
+	c.Version = sarama.V1_0_0_0
+	c.Net.TLS.Enable = true
+	c.Net.SASL.Enable = true
+	c.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	c.Net.SASL.Handshake = true
+	c.Net.MaxOpenRequests = 1
+	c.Net.DialTimeout = 15 * time.Second
+	c.Net.ReadTimeout = 60 * time.Second
+	c.Metadata.Retry.Max = 5
+	c.Metadata.Retry.Backoff = 2 * time.Second
+	// Event Hubs closes idle connections after 240s
+	c.Metadata.RefreshFrequency = 3 * time.Minute
+}
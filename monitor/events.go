@@ -0,0 +1,262 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func init() {
+	RegisterSink("kafka-events", newEventTopicSink)
+}
+
+const (
+	// the group disappeared from the coordinators while it had members or before its offsets expired
+	EventGroupDeleted = "group_deleted"
+	// the group disappeared from the coordinators after staying empty for the offsets retention
+	EventOffsetsExpired = "offsets_expired"
+	// a committed offset went back, deliberately or out of order
+	EventRewind = "rewind"
+	// the group committed an offset of the topic for the first time
+	EventFirstCommit = "first_commit"
+	// the partition count of the topic grew
+	EventPartitionsAdded = "partitions_added"
+)
+
+// the events kept for the clients catching up
+var EVENTS_KEPT = 1000
+
+// Event is a discrete change of a group, as opposed to the lag measured every sweep
+type Event struct {
+	// increasing over the events of the instance, to resume a stream
+	ID      int64   `json:"id"`
+	Type    string  `json:"type"`
+	Cluster string  `json:"cluster"`
+	Group   string  `json:"group"`
+	Topic   string  `json:"topic,omitempty"`
+	Rewind  *Rewind `json:"rewind,omitempty"`
+	// the partitions added to the topic
+	Partitions []int32 `json:"partitions,omitempty"`
+	// timestamp(ms) the event was detected
+	Timestamp int64 `json:"timestamp"`
+}
+
+// EventSink is a sink which also receives the events, SaveEvents may be called while Save runs
+type EventSink interface {
+	Sink
+	SaveEvents(cluster string, events []*Event) error
+}
+
+// eventHub numbers the events of all clusters, keeps the last EVENTS_KEPT and fans them out to the subscribers
+type eventHub struct {
+	lock        sync.Mutex
+	next        int64
+	events      []*Event
+	subscribers map[chan *Event]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan *Event]bool)}
+}
+
+func (h *eventHub) publish(events []*Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, event := range events {
+		h.next++
+		event.ID = h.next
+		h.events = append(h.events, event)
+		for ch := range h.subscribers {
+			// a slow subscriber misses events rather than blocking the sweeps
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+	if n := len(h.events) - EVENTS_KEPT; n > 0 {
+		h.events = append([]*Event{}, h.events[n:]...)
+	}
+}
+
+func (h *eventHub) since(id int64) []*Event {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	res := []*Event{}
+	for _, event := range h.events {
+		if event.ID > id {
+			res = append(res, event)
+		}
+	}
+	return res
+}
+
+func (h *eventHub) subscribe() (<-chan *Event, func()) {
+	ch := make(chan *Event, 100)
+	h.lock.Lock()
+	h.subscribers[ch] = true
+	h.lock.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.lock.Lock()
+			delete(h.subscribers, ch)
+			h.lock.Unlock()
+		})
+	}
+}
+
+// Events returns the kept events after the id
+func (f *Fetcher) Events(since int64) []*Event {
+	return f.events.since(since)
+}
+
+// SubscribeEvents returns the channel of the new events, and the func to unsubscribe
+func (f *Fetcher) SubscribeEvents() (<-chan *Event, func()) {
+	return f.events.subscribe()
+}
+
+// emitEvents stamps the events of the cluster and hands them to the hub and the event sinks
+func (client *KafkaClient) emitEvents(events []*Event) {
+	if len(events) == 0 {
+		return
+	}
+	now := clockNow().UnixNano() / int64(time.Millisecond)
+	for _, event := range events {
+		event.Cluster, event.Timestamp = client.cluster, now
+	}
+	if client.events != nil {
+		client.events.publish(events)
+	}
+	for i, sink := range client.sinks {
+		if es, ok := sink.(EventSink); ok && client.sinkWindow(i).active(clockNow()) {
+			if err := es.SaveEvents(client.cluster, events); err != nil {
+				client.warnLimiter.warnf(client.log.WithField("sink", sink.Name()), "sink:"+sink.Name(), "Sink failed: %v", err)
+			}
+		}
+	}
+}
+
+// vanishedEvents returns the events of the groups of the previous refresh no broker lists anymore, the caller
+// must hold schemaUpdateMtx and only call it when all brokers answered ListGroups
+func (client *KafkaClient) vanishedEvents(listed map[string]bool) []*Event {
+	now := clockNow().UnixNano() / int64(time.Millisecond)
+	retention := int64(client.cfg.General.OffsetsRetentionMinutes) * 60 * 1000
+	var events []*Event
+	for group := range client.groupState {
+		if listed[group] {
+			continue
+		}
+		event := &Event{Type: EventGroupDeleted, Group: group}
+		if since, ok := client.emptySince[group]; ok && since+retention <= now {
+			event.Type = EventOffsetsExpired
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// commitEvents returns the rewinds of the statuses and the first commits of the groups per topic, the first
+// sweep only learns the commits. The groups which don't commit a topic for SEEN_EXPIRE_SECOND are forgotten.
+// It's only called by the sweep goroutine.
+func (client *KafkaClient) commitEvents(ts int64, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) []*Event {
+	var events []*Event
+	for _, status := range statuses {
+		for _, rewind := range status.Rewinds {
+			events = append(events, &Event{Type: EventRewind, Group: status.Group, Topic: rewind.Topic, Rewind: rewind})
+		}
+	}
+	first := client.committed == nil
+	if first {
+		client.committed = make(map[string]map[string]int64)
+	}
+	for group, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			committed := false
+			for _, offset := range msg.partitionMap {
+				if offset.Offset >= 0 {
+					committed = true
+					break
+				}
+			}
+			if !committed {
+				continue
+			}
+			if _, ok := client.committed[group]; !ok {
+				client.committed[group] = make(map[string]int64)
+			}
+			if _, ok := client.committed[group][msg.Topic]; !ok && !first {
+				events = append(events, &Event{Type: EventFirstCommit, Group: group, Topic: msg.Topic})
+			}
+			client.committed[group][msg.Topic] = ts
+		}
+	}
+	expired := ts - int64(SEEN_EXPIRE_SECOND)*1000
+	for group, topics := range client.committed {
+		for topic, last := range topics {
+			if last < expired {
+				delete(topics, topic)
+			}
+		}
+		if len(topics) == 0 {
+			delete(client.committed, group)
+		}
+	}
+	return events
+}
+
+// eventTopicSink produces the events to a topic as json, keyed by group, the statuses are ignored
+type eventTopicSink struct {
+	topic    string
+	client   sarama.Client
+	producer sarama.SyncProducer
+}
+
+// newEventTopicSink takes the brokers option, topic, burrowx-events by default, tls and saslUsername/saslPassword.
+// With create the topic is created if missing, with partitions (default 1) and replicationFactor (default 3)
+func newEventTopicSink(cluster string, options map[string]string) (Sink, error) {
+	if options["brokers"] == "" {
+		return nil, errors.New("no brokers")
+	}
+	s := &eventTopicSink{topic: options["topic"]}
+	if s.topic == "" {
+		s.topic = "burrowx-events"
+	}
+	var err error
+	if s.client, s.producer, err = newSinkProducer("burrowx-events", s.topic, "delete", options); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *eventTopicSink) Name() string { return "kafka-events" }
+
+func (s *eventTopicSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	return nil
+}
+
+func (s *eventTopicSink) SaveEvents(cluster string, events []*Event) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: s.topic,
+			Key:   sarama.StringEncoder(event.Cluster + "/" + event.Group),
+			Value: sarama.ByteEncoder(data),
+		})
+	}
+	return s.producer.SendMessages(msgs)
+}
+
+func (s *eventTopicSink) Close() error {
+	if err := s.producer.Close(); err != nil {
+		return err
+	}
+	return s.client.Close()
+}
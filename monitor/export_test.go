@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/sundy-li/burrowx/config"
+)
+
+// RealClock is the clock of the monitor out of the tests
+var RealClock Clock = realClock{}
+
+// NewSinkOf creates a sink of a registered type, as the config does
+func NewSinkOf(typ, cluster string, options map[string]string) (Sink, error) {
+	sinkLock.Lock()
+	factory, ok := sinkFactories[typ]
+	sinkLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink type %s", typ)
+	}
+	return factory(cluster, options)
+}
+
+// influxSink writes the offsets of the sweeps to influxdb through the queue of the importer, as a client does,
+// for the conformance suite. The statuses are written out of the queue and a failed write of them is dropped,
+// they aren't part of the check.
+type influxSink struct {
+	importer *Importer
+}
+
+// NewInfluxSink starts an importer writing to the influxdb of the cluster in cfg
+func NewInfluxSink(cfg *config.Config, cluster string) (Sink, error) {
+	importer, err := NewImporter(cfg, cluster, metrics.NewRegistry())
+	if err != nil {
+		return nil, err
+	}
+	importer.start()
+	return &influxSink{importer: importer}, nil
+}
+
+func (s *influxSink) Name() string { return "influxdb" }
+
+func (s *influxSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	for _, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			s.importer.saveMsg(msg)
+		}
+	}
+	return nil
+}
+
+func (s *influxSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lost, err := s.importer.stop(ctx)
+	if err == nil && lost > 0 {
+		err = fmt.Errorf("%d records lost", lost)
+	}
+	return err
+}
+
+// recordingProducer passes the messages it produced to produced
+type recordingProducer struct {
+	sarama.SyncProducer
+	produced func(msgs []*sarama.ProducerMessage)
+}
+
+func (p *recordingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	if err := p.SyncProducer.SendMessages(msgs); err != nil {
+		return err
+	}
+	p.produced(msgs)
+	return nil
+}
+
+// RecordProduced passes the messages a kafka sink produced to produced
+func RecordProduced(sink Sink, produced func(msgs []*sarama.ProducerMessage)) {
+	s := sink.(*statusTopicSink)
+	s.producer = &recordingProducer{SyncProducer: s.producer, produced: produced}
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// faults injected for chaos testing, to exercise the breakers, retries and staleness detection
+var faults struct {
+	// rates of the failed broker requests and of the offset responses which fail to parse
+	brokerRate float64
+	decodeRate float64
+	// added to every sink and influxdb write
+	sinkLatency time.Duration
+	// added to the clock of the sweep
+	clockSkew time.Duration
+}
+
+var errInjected = errors.New("injected fault")
+
+// InjectFaults enables the faults of a spec like "broker=0.1,decode=0.05,sink=2s,skew=-30s",
+// it's meant for developers and only read from the BURROWX_FAULTS env var
+func InjectFaults(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid fault %s", kv)
+		}
+		var err error
+		switch parts[0] {
+		case "broker":
+			faults.brokerRate, err = strconv.ParseFloat(parts[1], 64)
+		case "decode":
+			faults.decodeRate, err = strconv.ParseFloat(parts[1], 64)
+		case "sink":
+			faults.sinkLatency, err = time.ParseDuration(parts[1])
+		case "skew":
+			faults.clockSkew, err = time.ParseDuration(parts[1])
+		default:
+			return fmt.Errorf("unknown fault %s", parts[0])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid fault %s: %v", kv, err)
+		}
+	}
+	return nil
+}
+
+// injectFault reports whether to fail the current operation, at rate
+func injectFault(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// sweepNow is the clock of the sweep, skewed by the injected clock skew
+func sweepNow() time.Time {
+	return clockNow().Add(faults.clockSkew)
+}
+
+func injectSinkLatency() {
+	if faults.sinkLatency > 0 {
+		time.Sleep(faults.sinkLatency)
+	}
+}
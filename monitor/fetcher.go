@@ -1,37 +1,286 @@
 package monitor
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/sundy-li/burrowx/config"
 )
 
 type Fetcher struct {
-	cfg     *config.Config
-	clients []*KafkaClient
+	cfg      *config.Config
+	recorder *Recorder
+	events   *eventHub
+	started  time.Time
+	slots    chan struct{}
+	// reconciles the clusters of the KafkaMonitor resources, nil if kubernetes.watchKafkaMonitors is false
+	operator *Operator
+
+	// the operator adds and removes clients while the api reads them
+	clientsLock sync.RWMutex
+	clients     []*KafkaClient
+	// cfg with the clusters of the operator, and its tenants
+	current *config.Config
+	tenants *Tenants
+	// of Start, the clients added later are started with it, nil before
+	ctx context.Context
 }
 
 func NewFetcher(cfg *config.Config) (f *Fetcher, err error) {
 	f = &Fetcher{
 		clients: make([]*KafkaClient, 0, len(cfg.Kafka)),
 		cfg:     cfg,
+		events:  newEventHub(),
+		started: clockNow(),
+		slots:   newSweepSlots(cfg.General.MaxConcurrentSweeps),
+		current: cfg,
+		tenants: NewTenants(cfg),
+	}
+	if cfg.General.RecordFile != "" {
+		if f.recorder, err = NewRecorder(cfg.General.RecordFile); err != nil {
+			return
+		}
+	}
+	if err = LoadPlugins(cfg.General.Plugins); err != nil {
+		return
 	}
 	for k, _ := range cfg.Kafka {
-		client, e := NewKafkaClient(cfg, k)
-		if e != nil {
-			err = e
+		if _, err = f.addClient(cfg, k); err != nil {
+			return
+		}
+	}
+	if cfg.Kubernetes.WatchKafkaMonitors {
+		if f.operator, err = NewOperator(f); err != nil {
 			return
 		}
-		f.clients = append(f.clients, client)
 	}
 	return
 }
-func (f *Fetcher) Start() {
-	for _, cli := range f.clients {
-		cli.Start()
+
+// addClient adds the client of a cluster of cfg, started if the fetcher is
+func (f *Fetcher) addClient(cfg *config.Config, cluster string) (*KafkaClient, error) {
+	client, err := NewKafkaClient(cfg, cluster)
+	if err != nil {
+		return nil, err
+	}
+	client.recorder = f.recorder
+	client.events = f.events
+	client.sweepSlots = f.slots
+	if client.sinks, err = newSinks(cfg, cluster); err != nil {
+		client.Close()
+		return nil, err
+	}
+	client.sinkWindows = newSinkWindows(cfg, cluster, client.sinks)
+	client.sinkThrottles = newSinkThrottles(cfg, cluster, client.sinks)
+	var ctx context.Context
+	withWriteLock(&f.clientsLock, func() {
+		f.clients = append(f.clients, client)
+		ctx = f.ctx
+	})
+	// the first sweep of Start isn't run under the lock, the api would wait for it
+	if ctx != nil {
+		client.Start(ctx)
+	}
+	return client, nil
+}
+
+// removeClient stops the client of a cluster, flushing its points until ctx is done, and closes its connections
+func (f *Fetcher) removeClient(ctx context.Context, cluster string) error {
+	var client *KafkaClient
+	withWriteLock(&f.clientsLock, func() {
+		for i, cli := range f.clients {
+			if cli.cluster == cluster {
+				client = cli
+				f.clients = append(f.clients[:i:i], f.clients[i+1:]...)
+				break
+			}
+		}
+	})
+	if client == nil {
+		return fmt.Errorf("unknown cluster %s", cluster)
 	}
+	err := client.Stop(ctx)
+	client.backend.Close()
+	client.client.Close()
+	return err
 }
 
-func (f *Fetcher) Stop() {
-	for _, cli := range f.clients {
-		cli.Stop()
+// setConfig sets the config with the clusters of the operator
+func (f *Fetcher) setConfig(cfg *config.Config) {
+	tenants := NewTenants(cfg)
+	withWriteLock(&f.clientsLock, func() {
+		f.current, f.tenants = cfg, tenants
+	})
+}
+
+// Tenants returns the tenants of the clusters monitored now
+func (f *Fetcher) Tenants() *Tenants {
+	var tenants *Tenants
+	withReadLock(&f.clientsLock, func() {
+		tenants = f.tenants
+	})
+	return tenants
+}
+
+// ClusterID returns the cluster monitored now named or aliased name, name if none
+func (f *Fetcher) ClusterID(name string) string {
+	var cfg *config.Config
+	withReadLock(&f.clientsLock, func() {
+		cfg = f.current
+	})
+	return cfg.ClusterID(name)
+}
+
+// allClients returns the clients of the clusters monitored now
+func (f *Fetcher) allClients() []*KafkaClient {
+	var clients []*KafkaClient
+	withReadLock(&f.clientsLock, func() {
+		clients = f.clients
+	})
+	return clients
+}
+
+// Start monitors the clusters until Stop or until ctx is done
+func (f *Fetcher) Start(ctx context.Context) {
+	var clients []*KafkaClient
+	withWriteLock(&f.clientsLock, func() {
+		f.ctx = ctx
+		clients = f.clients
+	})
+	// like addClient, the first sweeps aren't run under the lock. The clients added from now on are started by
+	// addClient, and the operator, which removes clients, starts after.
+	for _, cli := range clients {
+		cli.Start(ctx)
+	}
+	if f.operator != nil {
+		f.operator.start(ctx)
+	}
+}
+
+// Stop stops the clusters in parallel, cancelling their sweeps in flight and flushing their points until ctx
+// is done, and closes their connections, it returns the first error
+func (f *Fetcher) Stop(ctx context.Context) error {
+	if f.operator != nil {
+		f.operator.stop()
+	}
+	clients := f.allClients()
+	errs := make(chan error, len(clients))
+	for _, cli := range clients {
+		go func(cli *KafkaClient) {
+			err := cli.Stop(ctx)
+			// like removeClient, Stop already stopped the canary and the commit consumers
+			cli.backend.Close()
+			cli.client.Close()
+			if err != nil {
+				errs <- fmt.Errorf("cluster %s: %v", cli.cluster, err)
+				return
+			}
+			errs <- nil
+		}(cli)
+	}
+	var err error
+	for range clients {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	if f.recorder != nil {
+		f.recorder.Close()
+	}
+	// the spans of the last sweeps
+	flushTracers(ctx)
+	return err
+}
+
+// Pause pauses the monitoring of a cluster
+func (f *Fetcher) Pause(cluster string) error {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return err
+	}
+	cli.Pause()
+	return nil
+}
+
+// Resume resumes the monitoring of a paused cluster
+func (f *Fetcher) Resume(cluster string) error {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return err
+	}
+	cli.Resume()
+	return nil
+}
+
+// PausedClusters returns the clusters whose monitoring is paused
+func (f *Fetcher) PausedClusters() []string {
+	paused := []string{}
+	for _, cli := range f.allClients() {
+		if cli.Paused() {
+			paused = append(paused, cli.cluster)
+		}
+	}
+	return paused
+}
+
+// TestNotifier sends a synthetic alert through the notifier of every cluster which has it
+func (f *Fetcher) TestNotifier(name string) (clusters []string, err error) {
+	for _, cli := range f.allClients() {
+		for _, sink := range cli.sinks {
+			if notifier, ok := sink.(Notifier); ok && sink.Name() == name {
+				if err := notifier.Test(); err != nil {
+					return clusters, fmt.Errorf("%s of cluster %s: %v", name, cli.cluster, err)
+				}
+				clusters = append(clusters, cli.cluster)
+			}
+		}
+	}
+	if len(clusters) == 0 {
+		return nil, ErrUnknownNotifier
+	}
+	return clusters, nil
+}
+
+func (f *Fetcher) client(cluster string) (*KafkaClient, error) {
+	for _, cli := range f.allClients() {
+		if cli.named(cluster) {
+			return cli, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown cluster %s", cluster)
+}
+
+// StaleClusters returns the clusters whose offsets are stale
+func (f *Fetcher) StaleClusters() []string {
+	var stale []string
+	for _, cli := range f.allClients() {
+		if cli.Stale() {
+			stale = append(stale, cli.cluster)
+		}
+	}
+	return stale
+}
+
+// Statuses returns the statuses of the groups of a cluster at its last evaluation, of all clusters if cluster is empty
+func (f *Fetcher) Statuses(cluster string) []*GroupStatus {
+	var statuses []*GroupStatus
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			statuses = append(statuses, cli.Statuses()...)
+		}
+	}
+	return statuses
+}
+
+// IdleGroups returns the groups without members which still have offsets, of all clusters if cluster is empty
+func (f *Fetcher) IdleGroups(cluster string) []*IdleGroup {
+	var idle []*IdleGroup
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			idle = append(idle, cli.IdleGroups()...)
+		}
 	}
+	return idle
 }
@@ -0,0 +1,26 @@
+package monitor
+
+import (
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// flavorConfig applies what the flavor of the brokers needs: kraft brokers are at least kafka 2.8 and redpanda
+// rejects the message formats before v2, e.g. the ones the canary produces at kafka 0.10.2, so both speak
+// kafka 2.1, with the record batches and OffsetFetch v5
+func flavorConfig(c *sarama.Config, flavor string) {
+	switch flavor {
+	case "kraft", "redpanda":
+		c.Version = sarama.V2_1_0_0
+	}
+}
+
+// internalTopic reports whether a topic is internal to the brokers and never monitored, besides
+// __consumer_offsets redpanda lists its own topics, e.g. _redpanda_e2e_probe or _redpanda.audit_log
+func internalTopic(flavor, topic string) bool {
+	if topic == "__consumer_offsets" {
+		return true
+	}
+	return flavor == "redpanda" && (strings.HasPrefix(topic, "_redpanda") || strings.HasPrefix(topic, "__redpanda"))
+}
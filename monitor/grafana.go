@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+// Annotator posts an annotation to the grafana http api every time the status of a group changes,
+// so the lag dashboards show when the incidents started and ended
+type Annotator struct {
+	cluster string
+	url     string
+	apiKey  string
+	tags    []string
+	http    *http.Client
+	log     *logrus.Entry
+}
+
+type annotation struct {
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+func NewAnnotator(cfg *config.Config, cluster string) (*Annotator, error) {
+	proxy, err := httpProxy(cfg.General.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &Annotator{
+		cluster: cluster,
+		url:     strings.TrimSuffix(cfg.Grafana.Url, "/") + "/api/annotations",
+		apiKey:  cfg.Grafana.ApiKey,
+		tags:    cfg.Grafana.Tags,
+		http:    &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: proxy}},
+		log:     mylog.Module("grafana").WithField("cluster", cluster),
+	}, nil
+}
+
+// annotate posts the status changes of this evaluation in the background, the sweep must not wait for grafana
+func (a *Annotator) annotate(statuses []*GroupStatus) {
+	var annotations []*annotation
+	for _, status := range statuses {
+		if len(status.Window) < 2 {
+			continue
+		}
+		previous := status.Window[len(status.Window)-2].Status
+		if previous == status.Status {
+			continue
+		}
+		text := fmt.Sprintf("%s %s -> %s", status.Group, previous, status.Status)
+		if status.Worst != nil && status.Worst.Status != StatusOK {
+			text += fmt.Sprintf(", %s on %s/%d", status.Worst.Status, status.Worst.Topic, status.Worst.Partition)
+		}
+		tags := append([]string{"burrowx", "cluster:" + a.cluster, "group:" + status.Group, "status:" + status.Status.String()}, a.tags...)
+		annotations = append(annotations, &annotation{Time: status.Timestamp, Tags: tags, Text: text})
+	}
+	if len(annotations) == 0 {
+		return
+	}
+	go func() {
+		for _, an := range annotations {
+			if err := a.post(an); err != nil {
+				a.log.Warnf("Cannot post annotation: %v", err)
+				return
+			}
+		}
+	}()
+}
+
+func (a *Annotator) post(an *annotation) error {
+	data, err := json.Marshal(an)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("grafana answered %s", resp.Status)
+	}
+	return nil
+}
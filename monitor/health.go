@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"time"
+)
+
+// ClusterHealth is the rollup of a cluster for the wallboards: the groups per status, their total lag,
+// and whether the sweeps, the offset fetches and the canary work
+type ClusterHealth struct {
+	Cluster string `json:"cluster"`
+	// display name of the cluster
+	ClusterName string `json:"cluster_name,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+	Groups      int    `json:"groups"`
+	OK          int    `json:"ok"`
+	Warn        int    `json:"warn"`
+	Err         int    `json:"err"`
+	TotalLag    int64  `json:"total_lag"`
+	Stale       bool   `json:"stale"`
+	Paused      bool   `json:"paused"`
+	// timestamps(ms) of the last successful sweep and offset fetch
+	LastSweep       int64 `json:"last_sweep"`
+	LastOffsetFetch int64 `json:"last_offset_fetch"`
+	// failures since the start
+	BrokerFailures int64 `json:"broker_failures"`
+	FetchFailures  int64 `json:"fetch_failures"`
+	// failures since the start per kind: broker, auth, decode and sink
+	Errors map[ErrorKind]int64 `json:"errors"`
+	// whether the canary messages are consumed back, absent without canary
+	CanaryOK *bool `json:"canary_ok,omitempty"`
+	// of the last metadata refresh, absent without general.brokerHealth
+	Brokers *BrokerHealth `json:"brokers,omitempty"`
+}
+
+// Health returns the health of the clusters, of all clusters if cluster is empty
+func (f *Fetcher) Health(cluster string) []*ClusterHealth {
+	res := []*ClusterHealth{}
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			res = append(res, cli.Health())
+		}
+	}
+	return res
+}
+
+// Health returns the health of the cluster at the last evaluation
+func (client *KafkaClient) Health() *ClusterHealth {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+	return client.health(clockNow(), client.statuses)
+}
+
+func (client *KafkaClient) health(now time.Time, statuses []*GroupStatus) *ClusterHealth {
+	h := &ClusterHealth{
+		Cluster:        client.cluster,
+		ClusterName:    client.cfg.DisplayNameOf(client.cluster),
+		Timestamp:      now.UnixNano() / int64(time.Millisecond),
+		Groups:         len(statuses),
+		Paused:         client.Paused(),
+		BrokerFailures: client.brokerFailures.Count(),
+		FetchFailures:  client.fetchFailures.Count(),
+		Errors:         client.errors.counts(),
+	}
+	for _, status := range statuses {
+		switch status.Status {
+		case StatusOK:
+			h.OK++
+		case StatusWarn:
+			h.Warn++
+		default:
+			h.Err++
+		}
+		h.TotalLag += status.TotalLag
+	}
+	var lastSweep, lastOffsetFetch time.Time
+	withReadLock(client.heartbeatLock, func() {
+		lastSweep, lastOffsetFetch = client.lastSweep, client.lastOffsetFetch
+		h.Brokers = client.brokerHealth
+	})
+	h.Stale = !h.Paused && client.stale(now, lastSweep, lastOffsetFetch)
+	if !lastSweep.IsZero() {
+		h.LastSweep = lastSweep.UnixNano() / int64(time.Millisecond)
+	}
+	if !lastOffsetFetch.IsZero() {
+		h.LastOffsetFetch = lastOffsetFetch.UnixNano() / int64(time.Millisecond)
+	}
+	if client.canary != nil {
+		ok := client.canary.consumeOK(now)
+		h.CanaryOK = &ok
+	}
+	return h
+}
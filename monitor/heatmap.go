@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Heatmap is the lag of the partitions of a topic consumed by a group over the evaluation window,
+// Lags[i][j] is the lag of Partitions[i] at Timestamps[j], -1 where the partition wasn't evaluated
+type Heatmap struct {
+	Cluster    string    `json:"cluster"`
+	Group      string    `json:"group"`
+	Topic      string    `json:"topic"`
+	Timestamps []int64   `json:"timestamps"`
+	Partitions []int32   `json:"partitions"`
+	Lags       [][]int64 `json:"lags"`
+}
+
+// Heatmap returns the lag matrix of a group and topic, downsampled to at most buckets columns
+// which keep the max lag of the evaluations they cover, and stamped with their last evaluation
+func (f *Fetcher) Heatmap(cluster, group, topic string, buckets int) (*Heatmap, error) {
+	for _, cli := range f.allClients() {
+		if cli.named(cluster) {
+			return cli.heatmap(group, topic, buckets)
+		}
+	}
+	return nil, fmt.Errorf("unknown cluster %s", cluster)
+}
+
+func (client *KafkaClient) heatmap(group, topic string, buckets int) (*Heatmap, error) {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	group = rewriteGroup(client.groupRewrites, group)
+	window := client.evaluator.windows[group]
+	if len(window) == 0 {
+		return nil, fmt.Errorf("unknown group %s", group)
+	}
+	hm := &Heatmap{Cluster: client.cluster, Group: group, Topic: topic}
+	seen := make(map[int32]bool)
+	for _, eval := range window {
+		for partition := range eval.offsets[topic] {
+			if !seen[partition] {
+				seen[partition] = true
+				hm.Partitions = append(hm.Partitions, partition)
+			}
+		}
+	}
+	if len(hm.Partitions) == 0 {
+		return nil, fmt.Errorf("group %s doesn't consume %s", group, topic)
+	}
+	sort.Slice(hm.Partitions, func(i, j int) bool { return hm.Partitions[i] < hm.Partitions[j] })
+
+	if buckets <= 0 || buckets > len(window) {
+		buckets = len(window)
+	}
+	hm.Lags = make([][]int64, len(hm.Partitions))
+	for i := range hm.Lags {
+		hm.Lags[i] = make([]int64, buckets)
+	}
+	for b := 0; b < buckets; b++ {
+		evals := window[b*len(window)/buckets : (b+1)*len(window)/buckets]
+		hm.Timestamps = append(hm.Timestamps, evals[len(evals)-1].Timestamp)
+		for i, partition := range hm.Partitions {
+			lag := int64(-1)
+			for _, eval := range evals {
+				if offset, ok := eval.offsets[topic][partition]; ok && offset.Offset >= 0 && offset.Lag > lag {
+					lag = offset.Lag
+				}
+			}
+			hm.Lags[i][b] = lag
+		}
+	}
+	return hm, nil
+}
@@ -0,0 +1,271 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterSink("history", newHistorySink)
+}
+
+// HistoryPoint is the lag of a group over one resolution period, the worst of the sweeps it covers
+type HistoryPoint struct {
+	// timestamp(ms) the period starts at
+	Timestamp int64   `json:"timestamp"`
+	Group     string  `json:"group"`
+	Status    Status  `json:"status"`
+	TotalLag  int64   `json:"total_lag"`
+	MaxLag    int64   `json:"max_lag"`
+	TimeLag   float64 `json:"time_lag"`
+}
+
+// History is the lag history of a group between two timestamps(ms)
+type History struct {
+	Cluster string          `json:"cluster"`
+	Group   string          `json:"group"`
+	From    int64           `json:"from"`
+	To      int64           `json:"to"`
+	Points  []*HistoryPoint `json:"points"`
+}
+
+// historySink keeps the lag history of the groups on the local disk, downsampled to the resolution, for the
+// installations without a tsdb: one json lines file per cluster and day, the days past the retention are
+// removed. The queries scan the files of the days they cover, it's meant for hundreds of groups, not more.
+type historySink struct {
+	dir        string
+	cluster    string
+	resolution int64
+	retention  int
+
+	lock sync.Mutex
+	//group => the period being downsampled
+	pending map[string]*HistoryPoint
+	day     string
+	f       *os.File
+	w       *bufio.Writer
+}
+
+// newHistorySink takes the dir option, resolutionSeconds, 60 by default, and retentionDays, 7 by default
+func newHistorySink(cluster string, options map[string]string) (Sink, error) {
+	s := &historySink{dir: options["dir"], cluster: cluster, resolution: 60000, retention: 7, pending: make(map[string]*HistoryPoint)}
+	if s.dir == "" {
+		return nil, errors.New("no dir")
+	}
+	if v := options["resolutionSeconds"]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid resolutionSeconds %s", v)
+		}
+		s.resolution = int64(seconds) * 1000
+	}
+	if v := options["retentionDays"]; v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid retentionDays %s", v)
+		}
+		s.retention = days
+	}
+	return s, os.MkdirAll(s.dir, 0755)
+}
+
+func (s *historySink) Name() string { return "history" }
+
+func (s *historySink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(statuses) == 0 {
+		return nil
+	}
+	// the periods before the one of this sweep are complete, the ones of the groups gone too
+	start := statuses[0].Timestamp - statuses[0].Timestamp%s.resolution
+	for group, point := range s.pending {
+		if point.Timestamp < start {
+			if err := s.write(point); err != nil {
+				return err
+			}
+			delete(s.pending, group)
+		}
+	}
+	for _, status := range statuses {
+		point := s.pending[status.Group]
+		if point == nil {
+			point = &HistoryPoint{Timestamp: start, Group: status.Group}
+			s.pending[status.Group] = point
+		}
+		point.merge(&HistoryPoint{Status: status.Status, TotalLag: status.TotalLag, MaxLag: status.MaxLag, TimeLag: status.TimeLag})
+	}
+	if s.w == nil {
+		return nil
+	}
+	return s.w.Flush()
+}
+
+// merge keeps the worst of two points of a period
+func (p *HistoryPoint) merge(o *HistoryPoint) {
+	if o.Status > p.Status {
+		p.Status = o.Status
+	}
+	if o.TotalLag > p.TotalLag {
+		p.TotalLag = o.TotalLag
+	}
+	if o.MaxLag > p.MaxLag {
+		p.MaxLag = o.MaxLag
+	}
+	if o.TimeLag > p.TimeLag {
+		p.TimeLag = o.TimeLag
+	}
+}
+
+// write appends a complete period to the file of its day
+func (s *historySink) write(point *HistoryPoint) error {
+	day := time.Unix(0, point.Timestamp*int64(time.Millisecond)).UTC().Format("20060102")
+	if day != s.day {
+		if err := s.closeFile(); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.fileName(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		s.day, s.f, s.w = day, f, bufio.NewWriter(f)
+		s.expire()
+	}
+	data, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *historySink) fileName(day string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("burrowx-history-%s-%s.jsonl", s.cluster, day))
+}
+
+// expire removes the files of the days past the retention
+func (s *historySink) expire() {
+	oldest := clockNow().UTC().AddDate(0, 0, -s.retention).Format("20060102")
+	prefix := fmt.Sprintf("burrowx-history-%s-", s.cluster)
+	names, _ := filepath.Glob(filepath.Join(s.dir, prefix+"*.jsonl"))
+	for _, name := range names {
+		if day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), prefix), ".jsonl"); day < oldest {
+			os.Remove(name)
+		}
+	}
+}
+
+// query returns the points of a group between two timestamps(ms), the period being downsampled included
+func (s *historySink) query(group string, from, to int64) ([]*HistoryPoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.w != nil {
+		if err := s.w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	// the group as encoded in the lines
+	needle, err := json.Marshal(group)
+	if err != nil {
+		return nil, err
+	}
+	points := []*HistoryPoint{}
+	day := time.Unix(0, from*int64(time.Millisecond)).UTC().Truncate(24 * time.Hour)
+	for ; day.UnixNano()/int64(time.Millisecond) <= to; day = day.AddDate(0, 0, 1) {
+		f, err := os.Open(s.fileName(day.Format("20060102")))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// skip the other groups without decoding them
+			if !bytes.Contains(scanner.Bytes(), needle) {
+				continue
+			}
+			point := &HistoryPoint{}
+			if err := json.Unmarshal(scanner.Bytes(), point); err != nil || point.Group != group {
+				continue
+			}
+			if point.Timestamp >= from && point.Timestamp <= to {
+				points = append(points, point)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if point := s.pending[group]; point != nil && point.Timestamp >= from && point.Timestamp <= to {
+		p := *point
+		points = append(points, &p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	// a restart within a period writes it twice
+	merged := points[:0]
+	for _, point := range points {
+		if n := len(merged); n > 0 && merged[n-1].Timestamp == point.Timestamp {
+			merged[n-1].merge(point)
+			continue
+		}
+		merged = append(merged, point)
+	}
+	return merged, nil
+}
+
+func (s *historySink) closeFile() error {
+	if s.f == nil {
+		return nil
+	}
+	defer func() { s.f, s.w, s.day = nil, nil, "" }()
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// Close writes the periods being downsampled
+func (s *historySink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for group, point := range s.pending {
+		if err := s.write(point); err != nil {
+			return err
+		}
+		delete(s.pending, group)
+	}
+	return s.closeFile()
+}
+
+// History returns the lag history of a group between two timestamps(ms), from the history sink of its cluster
+func (f *Fetcher) History(cluster, group string, from, to int64) (*History, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, sink := range cli.sinks {
+		if hs, ok := sink.(*historySink); ok {
+			points, err := hs.query(group, from, to)
+			if err != nil {
+				return nil, err
+			}
+			return &History{Cluster: cluster, Group: group, From: from, To: to, Points: points}, nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %s has no history sink", cluster)
+}
@@ -0,0 +1,36 @@
+package monitor
+
+import (
+	"os"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// Version of burrowx, set by main
+var Version = "dev"
+
+// Identity tells the data of this burrowx instance apart from the other instances
+type Identity struct {
+	Instance string `json:"instance"`
+	Host     string `json:"host"`
+	Version  string `json:"version"`
+}
+
+// NewIdentity returns the identity of this instance, the instance id is the hostname unless general.instanceId is set
+func NewIdentity(cfg *config.Config) Identity {
+	host, _ := os.Hostname()
+	id := Identity{Instance: cfg.General.InstanceId, Host: host, Version: Version}
+	if id.Instance == "" {
+		id.Instance = host
+	}
+	return id
+}
+
+// tags returns the identity as the tags added to every point
+func (id Identity) tags() map[string]string {
+	return map[string]string{
+		"burrowx_instance": id.Instance,
+		"burrowx_host":     id.Host,
+		"burrowx_version":  id.Version,
+	}
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+)
+
+// IdleGroup is a group without members whose committed offsets the brokers still retain,
+// since kafka 2.1 they expire offsets.retention.minutes after the group became empty
+type IdleGroup struct {
+	Cluster string   `json:"cluster"`
+	Group   string   `json:"group"`
+	Topics  []string `json:"topics"`
+	// timestamp(ms) the group was last seen with members, or first seen empty if it never was
+	EmptySince int64 `json:"empty_since"`
+	ExpiresAt  int64 `json:"expires_at"`
+	// seconds until the offsets expire
+	ExpiresIn float64 `json:"expires_in"`
+}
+
+// updateEmpty tracks since when the groups are empty, the caller must hold schemaUpdateMtx
+func (client *KafkaClient) updateEmpty(groupState map[string]string) {
+	now := clockNow().UnixNano() / int64(time.Millisecond)
+	for group, state := range groupState {
+		if state != "Empty" {
+			delete(client.emptySince, group)
+		} else if _, ok := client.emptySince[group]; !ok {
+			client.emptySince[group] = now
+		}
+	}
+	for group := range client.emptySince {
+		if _, ok := groupState[group]; !ok {
+			delete(client.emptySince, group)
+		}
+	}
+}
+
+// IdleGroups returns the empty groups, the ones closest to losing their offsets first
+func (client *KafkaClient) IdleGroups() []*IdleGroup {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	now := clockNow().UnixNano() / int64(time.Millisecond)
+	retention := int64(client.cfg.General.OffsetsRetentionMinutes) * 60 * 1000
+	idle := make([]*IdleGroup, 0, len(client.emptySince))
+	for group, since := range client.emptySince {
+		ig := &IdleGroup{Cluster: client.cluster, Group: group, EmptySince: since}
+		var lastSeen int64
+		for topic, seen := range client.groupSeen[group] {
+			ig.Topics = append(ig.Topics, topic)
+			if seen.LastSeen > lastSeen {
+				lastSeen = seen.LastSeen
+			}
+		}
+		sort.Strings(ig.Topics)
+		if lastSeen > 0 {
+			ig.EmptySince = lastSeen
+		}
+		ig.ExpiresAt = ig.EmptySince + retention
+		ig.ExpiresIn = float64(ig.ExpiresAt-now) / 1000
+		idle = append(idle, ig)
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].ExpiresAt < idle[j].ExpiresAt })
+	return idle
+}
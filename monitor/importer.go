@@ -1,43 +1,165 @@
 package monitor
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	client "github.com/influxdata/influxdb/client/v2"
 
-	log "github.com/cihub/seelog"
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
 )
 
 type Importer struct {
 	msgs chan *ConsumerFullOffset
-	cfg  *config.Config
+	// of the alerting groups, written before msgs
+	urgent chan *ConsumerFullOffset
+	cfg    *config.Config
+	// the influxdb of the cluster
+	influx config.InfluxdbConfig
+	dryRun bool
 
 	threshold  int
 	maxTimeGap int64
-	influxdb   client.Client
-	stopped    chan struct{}
+	// for the pings and the queries, the writes are posted with http to writeURL
+	influxdb client.Client
+	http     *http.Client
+	writeURL string
+	stopped  chan struct{}
+	// of the writes of the importer loop, cancelled once stop gives up flushing
+	ctx    context.Context
+	cancel context.CancelFunc
+	log    *logrus.Entry
+	// added to every point
+	tags map[string]string
+	// applied to the consumer_metrics points
+	enrichRules []*enrichRule
+	tenants     *Tenants
+	owners      *owners
+	filter      *emitFilter
+	// per group and topic points only
+	aggregateOnly bool
+	// of the partitions of the huge topics written, nil if all
+	sampler *partitionSampler
+	// of the timestamps written to influxdb, s, ms, u or ns
+	precision string
+	// the consumer_metrics points above its rate are downsampled to the aggregate points, nil if unlimited
+	throttle *writeThrottle
+	// traces the writes, nil if tracing is disabled
+	tracer *tracer
+
+	throttledPoints  metrics.Counter
+	backfilledPoints metrics.Counter
+	// records queued after the evaluation because the queue was full
+	deferredRecords metrics.Counter
+
+	// records in the batch not written yet, and lost by the shutdown, read atomically
+	batched int64
+	lost    int64
+	// set by stop before closing msgs, the records a sweep still running queues after are lost
+	closeLock sync.RWMutex
+	closed    bool
+	// closed by stop first, a sweep waiting for room in a full queue gives up and the record is lost
+	closing chan struct{}
+
+	writeTimer    metrics.Timer
+	writeFailures metrics.Counter
+	writtenPoints metrics.Counter
+	// the errors-sink counter of the cluster
+	sinkErrors metrics.Counter
 }
 
-func NewImporter(cfg *config.Config) (i *Importer, err error) {
+func NewImporter(cfg *config.Config, cluster string, registry metrics.Registry) (i *Importer, err error) {
 	i = &Importer{
 		msgs:       make(chan *ConsumerFullOffset, 1000),
+		urgent:     make(chan *ConsumerFullOffset, 1000),
 		cfg:        cfg,
+		influx:     cfg.InfluxdbOf(cluster),
+		dryRun:     cfg.General.DryRun,
 		threshold:  10,
 		maxTimeGap: 10,
 		stopped:    make(chan struct{}),
+		closing:    make(chan struct{}),
+		log:        mylog.Module("importer").WithField("cluster", cluster),
+		tags:       NewIdentity(cfg).tags(),
+		filter:     newEmitFilter(cfg, registry),
+		tenants:    NewTenants(cfg),
+
+		writeTimer:    metrics.GetOrRegisterTimer("importer-write", registry),
+		writeFailures: metrics.GetOrRegisterCounter("importer-write-failures", registry),
+		writtenPoints: metrics.GetOrRegisterCounter("importer-points", registry),
+		sinkErrors:    newErrorCounters(registry)[ErrorSink],
+
+		throttledPoints:  metrics.GetOrRegisterCounter("importer-throttled-points", registry),
+		backfilledPoints: metrics.GetOrRegisterCounter("importer-backfilled-points", registry),
+		deferredRecords:  metrics.GetOrRegisterCounter("importer-deferred-records", registry),
+	}
+	for k, v := range podTags() {
+		i.tags[k] = v
+	}
+	if kcfg, ok := cfg.Kafka[cluster]; ok {
+		if kcfg.DisplayName != "" {
+			i.tags["cluster_name"] = kcfg.DisplayName
+		}
+		i.aggregateOnly = kcfg.AggregateOnly
+		i.sampler = newPartitionSampler(kcfg.PartitionSampling)
+		i.precision = kcfg.Precision
+		i.dryRun = i.dryRun || kcfg.DryRun
+	}
+	i.throttle = sharedThrottle(i.influx.Hosts, i.influx.MaxPointsPerSecond)
+	i.tracer = sharedTracer(cfg)
+	if i.precision == "" {
+		i.precision = "s"
+	}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	if i.enrichRules, err = newEnrichRules(cfg.Enrich); err != nil {
+		return
+	}
+	if i.owners, err = sharedOwners(cfg); err != nil {
+		return
+	}
+	registry.GetOrRegister("importer-queue", metrics.NewFunctionalGauge(func() int64 {
+		return int64(i.queued())
+	}))
+	proxy, err := httpProxy(cfg.General.Proxy)
+	if err != nil {
+		return
 	}
 	// Create a new HTTPClient
 	c, err := client.NewHTTPClient(client.HTTPConfig{
-		Addr:     cfg.Influxdb.Hosts,
-		Username: cfg.Influxdb.Username,
-		Password: cfg.Influxdb.Pwd,
+		Addr:     i.influx.Hosts,
+		Username: i.influx.Username,
+		Password: i.influx.Pwd,
+		Proxy:    proxy,
 	})
 	if err != nil {
 		return
 	}
 	i.influxdb = c
+	u, err := url.Parse(i.influx.Hosts)
+	if err != nil {
+		return
+	}
+	u.Path = path.Join(u.Path, "write")
+	i.writeURL = u.String()
+	i.http = &http.Client{
+		Timeout:   time.Duration(i.influx.WriteTimeoutSeconds) * time.Second,
+		Transport: &http.Transport{Proxy: proxy},
+	}
 	return
 }
 
@@ -47,73 +169,791 @@ func (i *Importer) start() {
 	// 	panic(err)
 	// }
 	go func() {
-		bp, _ := client.NewBatchPoints(client.BatchPointsConfig{
-			Database:  i.cfg.Influxdb.Db,
-			Precision: "s",
-		})
+		bp, _ := i.newBatch()
 		lastCommit := time.Now().Unix()
-		for msg := range i.msgs {
-			tags := map[string]string{
-				"topic":          msg.Topic,
-				"consumer_group": msg.Group,
-				"cluster":        msg.Cluster,
+		urgent, msgs := i.urgent, i.msgs
+		for {
+			msg, ok := receive(&urgent, &msgs)
+			if !ok {
+				break
 			}
-
-			for partition, entry := range msg.partitionMap {
-				//offset is the sql keyword, so we use offsize
-				tags["partition"] = fmt.Sprintf("%d", partition)
-
-				fields := map[string]interface{}{
-					"logsize": entry.Logsize,
-					"offsize": entry.Offset,
-					"lag":     entry.Logsize - entry.Offset,
-				}
-				if entry.Offset < 0 {
-					fields["lag"] = -1
-					continue
-				}
-
-				tm := time.Unix(msg.Timestamp/1000, 0)
-				pt, err := client.NewPoint("consumer_metrics", tags, fields, tm)
-				if err != nil {
-					log.Error("error in add point ", err.Error())
-					continue
-				}
-				bp.AddPoint(pt)
+			if i.ctx.Err() != nil {
+				// past the shutdown deadline, the rest of the queue is lost
+				atomic.AddInt64(&i.lost, 1)
+				continue
 			}
+			bp.AddPoints(i.consumerPoints(msg))
+			atomic.AddInt64(&i.batched, 1)
 
 			if len(bp.Points()) > i.threshold || time.Now().Unix()-lastCommit >= i.maxTimeGap {
-				err := i.influxdb.Write(bp)
+				err := i.write(i.ctx, bp)
 				if err != nil {
-					log.Error("error in insert points ", err.Error())
+					// the batch is written again with the next record
+					i.log.Errorf("error in insert points %s", err.Error())
 					continue
 				}
-				bp, _ = client.NewBatchPoints(client.BatchPointsConfig{
-					Database:  i.cfg.Influxdb.Db,
-					Precision: "s",
-				})
+				bp, _ = i.newBatch()
+				atomic.StoreInt64(&i.batched, 0)
 				lastCommit = time.Now().Unix()
 			}
 		}
+		// flush what is left of the last batch
+		if len(bp.Points()) > 0 {
+			if err := i.write(i.ctx, bp); err != nil {
+				i.log.Errorf("error in insert points %s", err.Error())
+				atomic.AddInt64(&i.lost, atomic.LoadInt64(&i.batched))
+			}
+		}
 		i.stopped <- struct{}{}
 	}()
 
 }
 
+// consumerPoints returns the consumer_metrics points of a group and topic, per partition unless aggregateOnly
+// or the throttle is out of points, the aggregate point is written anyway. Of a sampled topic only the points
+// of the sampled partitions are written, and the aggregate point too.
+func (i *Importer) consumerPoints(msg *ConsumerFullOffset) []*client.Point {
+	if i.aggregateOnly {
+		return i.forcePoints(i.aggregatePoints(msg))
+	}
+	keep, sampled := i.sampler.sample(msg)
+	pts := i.partitionPoints(msg, keep)
+	if sampled {
+		pts = append(pts, i.aggregatePoints(msg)...)
+	}
+	if i.throttle == nil || i.throttle.take(len(pts)) {
+		return pts
+	}
+	// the aggregate of a single partition saves nothing
+	if len(pts) == 1 {
+		return i.forcePoints(pts)
+	}
+	i.throttledPoints.Inc(int64(len(pts)))
+	i.filter.forgetTopic(msg.Group, msg.Topic)
+	return i.forcePoints(i.aggregatePoints(msg))
+}
+
+func (i *Importer) forcePoints(pts []*client.Point) []*client.Point {
+	if i.throttle != nil {
+		i.throttle.force(len(pts))
+	}
+	return pts
+}
+
+// partitionPoints returns the consumer_metrics points of the partitions of a group and topic, the ones
+// kept only if not nil, tagged as sampled
+func (i *Importer) partitionPoints(msg *ConsumerFullOffset, keep map[int32]bool) []*client.Point {
+	pts := make([]*client.Point, 0, len(msg.partitionMap))
+	for partition, entry := range msg.partitionMap {
+		if keep != nil && !keep[partition] {
+			continue
+		}
+		tags := map[string]string{
+			"topic":          msg.Topic,
+			"consumer_group": msg.Group,
+			"cluster":        msg.Cluster,
+			"partition":      fmt.Sprintf("%d", partition),
+		}
+		if msg.CleanupPolicy != "" {
+			tags["cleanup_policy"] = msg.CleanupPolicy
+		}
+		if entry.Reassigning {
+			tags["reassigning"] = "true"
+		}
+		if keep != nil {
+			tags["sampled"] = "true"
+		}
+		if msg.backfill {
+			tags["backfill"] = "true"
+		}
+		if tenant := i.tenants.Of(msg.Cluster, msg.Group); tenant != "" {
+			tags["tenant"] = tenant
+		}
+		if team := i.owners.team(msg.Cluster, msg.Group); team != "" {
+			tags["team"] = team
+		}
+		if !enrich(i.enrichRules, tags) {
+			continue
+		}
+
+		//offset is the sql keyword, so we use offsize
+		fields := map[string]interface{}{
+			"logsize": entry.Logsize,
+			"offsize": entry.Offset,
+			"lag":     entry.Lag,
+			// share of the retained messages consumed
+			"consumed_pct": entry.ConsumedPct(),
+		}
+		if entry.StaleBrokerOffset && i.cfg.General.StaleBrokerOffset == "flag" {
+			fields["stale_broker_offset"] = true
+		}
+		if entry.Offset < 0 {
+			fields["lag"] = -1
+			continue
+		}
+		if !msg.backfill && !i.filter.emit(msg, partition, entry) {
+			continue
+		}
+
+		tm := msTime(msg.Timestamp)
+		pt, err := i.newPoint("consumer_metrics", tags, fields, tm)
+		if err != nil {
+			i.log.WithFields(logrus.Fields{"topic": msg.Topic, "group": msg.Group, "partition": partition}).Errorf("error in add point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	return pts
+}
+
+// aggregatePoints returns a single consumer_metrics point for a group and topic, without partition tag,
+// with the sums of the partitions and their max lag. It's tagged aggregate=true, so a sum over the points of
+// a sampled topic can leave it out instead of counting its partitions twice.
+func (i *Importer) aggregatePoints(msg *ConsumerFullOffset) []*client.Point {
+	tags := map[string]string{
+		"topic":          msg.Topic,
+		"consumer_group": msg.Group,
+		"cluster":        msg.Cluster,
+		"aggregate":      "true",
+	}
+	if msg.CleanupPolicy != "" {
+		tags["cleanup_policy"] = msg.CleanupPolicy
+	}
+	if msg.backfill {
+		tags["backfill"] = "true"
+	}
+	if tenant := i.tenants.Of(msg.Cluster, msg.Group); tenant != "" {
+		tags["tenant"] = tenant
+	}
+	if team := i.owners.team(msg.Cluster, msg.Group); team != "" {
+		tags["team"] = team
+	}
+	if !enrich(i.enrichRules, tags) {
+		return nil
+	}
+	var logsize, offset, lag, maxLag int64
+	var partitions int
+	for _, entry := range msg.partitionMap {
+		if entry.Offset < 0 {
+			continue
+		}
+		partitions++
+		logsize += entry.Logsize
+		offset += entry.Offset
+		lag += entry.Lag
+		if entry.Lag > maxLag {
+			maxLag = entry.Lag
+		}
+	}
+	if partitions == 0 {
+		return nil
+	}
+	fields := map[string]interface{}{
+		"logsize":    logsize,
+		"offsize":    offset,
+		"lag":        lag,
+		"max_lag":    maxLag,
+		"partitions": partitions,
+	}
+	pt, err := i.newPoint("consumer_metrics", tags, fields, msTime(msg.Timestamp))
+	if err != nil {
+		i.log.WithFields(logrus.Fields{"topic": msg.Topic, "group": msg.Group}).Errorf("error in add point %s", err.Error())
+		return nil
+	}
+	return []*client.Point{pt}
+}
+
 func (i *Importer) saveMsg(msg *ConsumerFullOffset) {
-	i.msgs <- msg
+	i.enqueue(i.msgs, msg)
+}
+
+// saveUrgentMsg queues the msg of an alerting group, the importer writes them before the others
+func (i *Importer) saveUrgentMsg(msg *ConsumerFullOffset) {
+	i.enqueue(i.urgent, msg)
+}
+
+// enqueue waits for room in the queue until the importer is stopping, then the msg is counted as lost
+func (i *Importer) enqueue(queue chan *ConsumerFullOffset, msg *ConsumerFullOffset) {
+	withReadLock(&i.closeLock, func() {
+		if i.closed {
+			atomic.AddInt64(&i.lost, 1)
+			return
+		}
+		select {
+		case queue <- msg:
+		case <-i.closing:
+			atomic.AddInt64(&i.lost, 1)
+		}
+	})
+}
+
+// queued returns the number of records in the queues
+func (i *Importer) queued() int {
+	return len(i.urgent) + len(i.msgs)
+}
+
+// receive returns the next record of the queues, of urgent first, false once both are closed and drained,
+// a closed queue is set to nil
+func receive(urgent, msgs *chan *ConsumerFullOffset) (*ConsumerFullOffset, bool) {
+	for *urgent != nil || *msgs != nil {
+		select {
+		case msg, ok := <-*urgent:
+			if ok {
+				return msg, true
+			}
+			*urgent = nil
+			continue
+		default:
+		}
+		select {
+		case msg, ok := <-*urgent:
+			if ok {
+				return msg, true
+			}
+			*urgent = nil
+		case msg, ok := <-*msgs:
+			if ok {
+				return msg, true
+			}
+			*msgs = nil
+		}
+	}
+	return nil, false
+}
+
+// trySaveMsg queues the msg unless the queue is full, once stopped the msg is counted as lost
+func (i *Importer) trySaveMsg(msg *ConsumerFullOffset) (ok bool) {
+	withReadLock(&i.closeLock, func() {
+		if i.closed {
+			atomic.AddInt64(&i.lost, 1)
+			ok = true
+			return
+		}
+		select {
+		case i.msgs <- msg:
+			ok = true
+		default:
+		}
+	})
+	return
+}
+
+// saveBackfill writes the offsets reconstructed for a step of a downtime as one batch, past the dedup and the
+// throttle, the topics of aggregateOnly or sampled by partitionSampling as their aggregate point only.
+// It returns the number of points.
+func (i *Importer) saveBackfill(ctx context.Context, groupOffsets map[string][]*ConsumerFullOffset) int {
+	var pts []*client.Point
+	for _, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			if i.aggregateOnly || (i.sampler != nil && len(msg.partitionMap) >= i.sampler.cfg.MinPartitions) {
+				pts = append(pts, i.aggregatePoints(msg)...)
+			} else {
+				pts = append(pts, i.partitionPoints(msg, nil)...)
+			}
+		}
+	}
+	i.backfilledPoints.Inc(int64(len(pts)))
+	i.writeBatch(ctx, pts)
+	return len(pts)
 }
 
-func (i *Importer) stop() {
-	close(i.msgs)
-	<-i.stopped
+// saveStatus writes the evaluated group statuses as one batch
+func (i *Importer) saveStatus(ctx context.Context, statuses []*GroupStatus) {
+	pts := make([]*client.Point, 0, len(statuses))
+	for _, status := range statuses {
+		tags := map[string]string{
+			"cluster":        status.Cluster,
+			"consumer_group": status.Group,
+			"status":         status.Status.String(),
+		}
+		if status.Tenant != "" {
+			tags["tenant"] = status.Tenant
+		}
+		if status.Team != "" {
+			tags["team"] = status.Team
+		}
+		fields := map[string]interface{}{
+			"status_code":   int(status.Status),
+			"total_lag":     status.TotalLag,
+			"max_lag":       status.MaxLag,
+			"lag_p50":       status.LagP50,
+			"lag_p95":       status.LagP95,
+			"anomaly_score": status.AnomalyScore,
+			"lag_rate":      status.LagRate,
+			"forecast_15m":  status.Forecast15m,
+			"forecast_60m":  status.Forecast60m,
+			"consume_rate":  status.ConsumeRate,
+			"rebalances":    status.Rebalances,
+
+			"stale_broker_offsets": status.StaleBrokerOffsets,
+
+			"retention_pressure": status.RetentionPressure,
+		}
+		if status.Commits > 0 {
+			fields["commits"] = status.Commits
+			fields["commit_latency_ms"] = status.CommitLatencyMs
+		}
+		if status.Worst != nil {
+			fields["worst_topic"] = status.Worst.Topic
+			fields["worst_partition"] = status.Worst.Partition
+		}
+		pt, err := i.newPoint("consumer_status", tags, fields, msTime(status.Timestamp))
+		if err != nil {
+			i.log.WithField("group", status.Group).Errorf("error in add status point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+		for _, skew := range status.Skews {
+			tags := map[string]string{
+				"cluster":        status.Cluster,
+				"consumer_group": status.Group,
+				"topic":          skew.Topic,
+			}
+			fields := map[string]interface{}{
+				"max_lag":  skew.MaxLag,
+				"min_lag":  skew.MinLag,
+				"mean_lag": skew.MeanLag,
+				"skew":     skew.Skew,
+			}
+			pt, err := i.newPoint("consumer_skew", tags, fields, msTime(status.Timestamp))
+			if err != nil {
+				i.log.WithFields(logrus.Fields{"topic": skew.Topic, "group": status.Group}).Errorf("error in add skew point %s", err.Error())
+				continue
+			}
+			pts = append(pts, pt)
+		}
+		for _, rewind := range status.Rewinds {
+			tags := map[string]string{
+				"cluster":        status.Cluster,
+				"consumer_group": status.Group,
+				"topic":          rewind.Topic,
+				"partition":      fmt.Sprintf("%d", rewind.Partition),
+				"kind":           rewind.Kind,
+			}
+			fields := map[string]interface{}{
+				"from":   rewind.From,
+				"to":     rewind.To,
+				"rewind": rewind.From - rewind.To,
+			}
+			pt, err := i.newPoint("consumer_rewind", tags, fields, msTime(status.Timestamp))
+			if err != nil {
+				i.log.WithFields(logrus.Fields{"topic": rewind.Topic, "group": status.Group}).Errorf("error in add rewind point %s", err.Error())
+				continue
+			}
+			pts = append(pts, pt)
+		}
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// saveTopics writes the throughput of the topics as one batch
+func (i *Importer) saveTopics(ctx context.Context, stats []*TopicStat) {
+	pts := make([]*client.Point, 0, len(stats))
+	for _, stat := range stats {
+		tags := map[string]string{
+			"cluster": stat.Cluster,
+			"topic":   stat.Topic,
+		}
+		fields := map[string]interface{}{
+			"partitions": stat.Partitions,
+			"logsize":    stat.Logsize,
+			"in_rate":    stat.InRate,
+		}
+		if stat.Config != nil {
+			tags["cleanup_policy"] = stat.Config.CleanupPolicy
+			fields["retention_ms"] = stat.Config.RetentionMs
+		}
+		if stat.Retained > 0 {
+			fields["retained"] = stat.Retained
+			fields["retained_seconds"] = stat.RetainedSeconds
+		}
+		pt, err := i.newPoint("topic_metrics", tags, fields, msTime(stat.Timestamp))
+		if err != nil {
+			i.log.WithField("topic", stat.Topic).Errorf("error in add topic point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// saveBrokerLatencies writes how long the brokers took to answer the offset requests of a sweep as one batch
+func (i *Importer) saveBrokerLatencies(ctx context.Context, cluster string, ts int64, latencies []*BrokerLatency) {
+	pts := make([]*client.Point, 0, len(latencies))
+	for _, latency := range latencies {
+		tags := map[string]string{
+			"cluster": cluster,
+			"broker":  fmt.Sprintf("%d", latency.Broker),
+			"host":    latency.Addr,
+		}
+		fields := map[string]interface{}{
+			"offsets_latency_ms": float64(latency.Latency) / float64(time.Millisecond),
+			"ok":                 latency.OK,
+		}
+		pt, err := i.newPoint("broker_metrics", tags, fields, msTime(ts))
+		if err != nil {
+			i.log.WithField("broker", latency.Broker).Errorf("error in add broker point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// saveIdle writes the groups without members which still have offsets as one batch
+func (i *Importer) saveIdle(ctx context.Context, idle []*IdleGroup) {
+	pts := make([]*client.Point, 0, len(idle))
+	for _, ig := range idle {
+		tags := map[string]string{
+			"cluster":        ig.Cluster,
+			"consumer_group": ig.Group,
+		}
+		fields := map[string]interface{}{
+			"empty_since": ig.EmptySince,
+			"expires_at":  ig.ExpiresAt,
+			"expires_in":  ig.ExpiresIn,
+			"topics":      strings.Join(ig.Topics, ","),
+		}
+		pt, err := i.newPoint("consumer_idle", tags, fields, clockNow())
+		if err != nil {
+			i.log.WithField("group", ig.Group).Errorf("error in add idle point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// saveClients writes the clients of the groups as one batch, an info point per group and client
+func (i *Importer) saveClients(ctx context.Context, clients []*GroupClients) {
+	pts := make([]*client.Point, 0, len(clients))
+	for _, gc := range clients {
+		tags := map[string]string{
+			"cluster":             gc.Cluster,
+			"consumer_group":      gc.Group,
+			"protocol_type":       gc.ProtocolType,
+			"assignment_strategy": gc.Strategy,
+			"metadata_version":    strconv.Itoa(int(gc.MetadataVersion)),
+		}
+		if gc.Library != "" {
+			tags["library"] = gc.Library
+		}
+		if gc.LibraryVersion != "" {
+			tags["library_version"] = gc.LibraryVersion
+		}
+		pt, err := i.newPoint("consumer_client", tags, map[string]interface{}{"members": gc.Members}, clockNow())
+		if err != nil {
+			i.log.WithField("group", gc.Group).Errorf("error in add client point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// saveHealth writes the rollup of the cluster
+func (i *Importer) saveHealth(ctx context.Context, h *ClusterHealth) {
+	fields := map[string]interface{}{
+		"groups":          h.Groups,
+		"ok":              h.OK,
+		"warn":            h.Warn,
+		"err":             h.Err,
+		"total_lag":       h.TotalLag,
+		"stale":           h.Stale,
+		"broker_failures": h.BrokerFailures,
+		"fetch_failures":  h.FetchFailures,
+	}
+	for kind, count := range h.Errors {
+		fields["errors_"+string(kind)] = count
+	}
+	if h.CanaryOK != nil {
+		fields["canary_ok"] = *h.CanaryOK
+	}
+	if h.Brokers != nil {
+		fields["brokers"] = h.Brokers.Brokers
+		fields["under_replicated_partitions"] = h.Brokers.UnderReplicated
+		fields["offline_partitions"] = h.Brokers.Offline
+		fields["controller_id"] = h.Brokers.ControllerID
+		fields["controller_changes"] = h.Brokers.ControllerChanges
+	}
+	pt, err := i.newPoint("cluster_health", map[string]string{"cluster": h.Cluster}, fields, msTime(h.Timestamp))
+	if err != nil {
+		i.log.Errorf("error in add health point %s", err.Error())
+		return
+	}
+	i.writeBatch(ctx, []*client.Point{pt})
+}
+
+// saveSLOs writes the compliance of the groups to their SLOs as one batch
+func (i *Importer) saveSLOs(ctx context.Context, slos []*SLOStatus) {
+	pts := make([]*client.Point, 0, len(slos))
+	for _, slo := range slos {
+		tags := map[string]string{
+			"cluster":        slo.Cluster,
+			"consumer_group": slo.Group,
+			"slo":            slo.SLO,
+		}
+		fields := map[string]interface{}{
+			"good":         slo.Good,
+			"total":        slo.Total,
+			"compliance":   slo.Compliance,
+			"burn_rate":    slo.BurnRate,
+			"burn_rate_1h": slo.BurnRate1h,
+		}
+		pt, err := i.newPoint("consumer_slo", tags, fields, msTime(slo.Timestamp))
+		if err != nil {
+			i.log.WithField("group", slo.Group).Errorf("error in add slo point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// saveSeen writes when every known group and topic pairing was first and last seen, including the ones gone quiet
+func (i *Importer) saveSeen(ctx context.Context, cluster string, ts int64, groupSeen map[string]map[string]*Seen) {
+	pts := make([]*client.Point, 0, len(groupSeen))
+	for group, topics := range groupSeen {
+		for topic, seen := range topics {
+			tags := map[string]string{
+				"cluster":        cluster,
+				"topic":          topic,
+				"consumer_group": group,
+			}
+			fields := map[string]interface{}{
+				"first_seen": seen.FirstSeen,
+				"last_seen":  seen.LastSeen,
+			}
+			pt, err := i.newPoint("consumer_seen", tags, fields, msTime(ts))
+			if err != nil {
+				i.log.WithFields(logrus.Fields{"topic": topic, "group": group}).Errorf("error in add seen point %s", err.Error())
+				continue
+			}
+			pts = append(pts, pt)
+		}
+	}
+	i.writeBatch(ctx, pts)
+}
+
+// writeBatch writes the points as one batch out of the importer loop
+func (i *Importer) writeBatch(ctx context.Context, pts []*client.Point) {
+	if len(pts) == 0 {
+		return
+	}
+	bp, _ := i.newBatch()
+	bp.AddPoints(pts)
+	if err := i.write(ctx, bp); err != nil {
+		i.log.Errorf("error in insert points %s", err.Error())
+	}
+}
+
+// write sends the batch to influxdb until ctx is done, and records its latency, in a span of the sweep
+// writing it, or of its own trace for the batches of the queue
+func (i *Importer) write(ctx context.Context, bp client.BatchPoints) (err error) {
+	ctx, sp := startSpan(ctx, i.tracer, "importer.write")
+	sp.setAttr("points", len(bp.Points()))
+	defer func() { sp.finish(err) }()
+	injectSinkLatency()
+	if i.dryRun {
+		i.logDryRun(bp)
+		return nil
+	}
+	start := time.Now()
+	err = i.post(ctx, bp)
+	i.writeTimer.UpdateSince(start)
+	if err != nil {
+		i.writeFailures.Inc(1)
+		i.sinkErrors.Inc(1)
+		return err
+	}
+	i.writtenPoints.Inc(int64(len(bp.Points())))
+	return nil
+}
+
+// the default User-Agent of the influxdb client
+const influxUserAgent = "InfluxDBClient"
+
+// post is the Write of the influxdb client with a context: Write takes none, so a write hanging on influxdb
+// would hold the shutdown until the http timeout. It builds the same request, the line protocol of the points,
+// the headers and the db, rp, precision and consistency parameters, and returns the same error, the body of
+// the response, so the writes behave and fail as they did through the client.
+func (i *Importer) post(ctx context.Context, bp client.BatchPoints) error {
+	var b bytes.Buffer
+	for _, pt := range bp.Points() {
+		if pt == nil {
+			continue
+		}
+		b.WriteString(pt.PrecisionString(bp.Precision()))
+		b.WriteByte('\n')
+	}
+	req, err := http.NewRequest("POST", i.writeURL, &b)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "")
+	req.Header.Set("User-Agent", influxUserAgent)
+	if i.influx.Username != "" {
+		req.SetBasicAuth(i.influx.Username, i.influx.Pwd)
+	}
+	params := req.URL.Query()
+	params.Set("db", bp.Database())
+	params.Set("rp", bp.RetentionPolicy())
+	params.Set("precision", bp.Precision())
+	params.Set("consistency", bp.WriteConsistency())
+	req.URL.RawQuery = params.Encode()
+	resp, err := i.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return errors.New(string(body))
+	}
+	return nil
+}
+
+// logDryRun logs the number of points per measurement instead of writing them
+func (i *Importer) logDryRun(bp client.BatchPoints) {
+	counts := make(map[string]int)
+	for _, pt := range bp.Points() {
+		counts[pt.Name()]++
+	}
+	names := make([]string, 0, len(counts))
+	for name, n := range counts {
+		names = append(names, fmt.Sprintf("%s=%d", name, n))
+	}
+	sort.Strings(names)
+	i.log.Infof("dry run, skip writing %d points: %s", len(bp.Points()), strings.Join(names, " "))
+}
+
+// saveInternalMetrics writes the metrics of burrowx itself, one point per metric
+func (i *Importer) saveInternalMetrics(ctx context.Context, cluster string, ts int64, registry metrics.Registry) {
+	pts := make([]*client.Point, 0, 16)
+	registry.Each(func(name string, metric interface{}) {
+		var fields map[string]interface{}
+		switch m := metric.(type) {
+		case metrics.Counter:
+			fields = map[string]interface{}{"count": m.Count()}
+		case metrics.Gauge:
+			fields = map[string]interface{}{"value": m.Value()}
+		case metrics.Histogram:
+			h := m.Snapshot()
+			fields = map[string]interface{}{
+				"count": h.Count(),
+				"max":   h.Max(),
+				"mean":  h.Mean(),
+				"p50":   h.Percentile(0.5),
+				"p99":   h.Percentile(0.99),
+			}
+		case metrics.Timer:
+			t := m.Snapshot()
+			ms := float64(time.Millisecond)
+			fields = map[string]interface{}{
+				"count":   t.Count(),
+				"max_ms":  float64(t.Max()) / ms,
+				"mean_ms": t.Mean() / ms,
+				"p50_ms":  t.Percentile(0.5) / ms,
+				"p99_ms":  t.Percentile(0.99) / ms,
+			}
+		default:
+			return
+		}
+		tags := map[string]string{
+			"cluster": cluster,
+			"metric":  name,
+		}
+		pt, err := i.newPoint("burrowx_internal", tags, fields, msTime(ts))
+		if err != nil {
+			i.log.Errorf("error in add internal metric point %s", err.Error())
+			return
+		}
+		pts = append(pts, pt)
+	})
+	i.writeBatch(ctx, pts)
+}
+
+// saveHeartbeat writes the heartbeat point immediately, it must not wait for a batch to fill up
+func (i *Importer) saveHeartbeat(ctx context.Context, hb *Heartbeat) {
+	tags := map[string]string{
+		"cluster": hb.Cluster,
+	}
+	fields := map[string]interface{}{
+		"last_sweep":        hb.LastSweep,
+		"last_offset_fetch": hb.LastOffsetFetch,
+		"stale":             hb.Stale,
+	}
+	i.writePoint(ctx, "monitor_heartbeat", tags, fields, msTime(hb.Timestamp))
+}
+
+// writePoint writes a single point out of the batch
+func (i *Importer) writePoint(ctx context.Context, name string, tags map[string]string, fields map[string]interface{}, tm time.Time) {
+	pt, err := i.newPoint(name, tags, fields, tm)
+	if err != nil {
+		i.log.Errorf("error in add %s point %s", name, err.Error())
+		return
+	}
+	i.writeBatch(ctx, []*client.Point{pt})
+}
+
+func (i *Importer) newBatch() (client.BatchPoints, error) {
+	return client.NewBatchPoints(client.BatchPointsConfig{
+		Database:  i.influx.Db,
+		Precision: i.precision,
+	})
+}
+
+// msTime converts the timestamps in ms used everywhere inside burrowx
+func msTime(ts int64) time.Time {
+	return time.Unix(0, ts*int64(time.Millisecond))
+}
+
+// newPoint creates a point with the tags of the importer added
+func (i *Importer) newPoint(name string, tags map[string]string, fields map[string]interface{}, tm time.Time) (*client.Point, error) {
+	if len(i.tags) > 0 {
+		all := make(map[string]string, len(tags)+len(i.tags))
+		for k, v := range i.tags {
+			all[k] = v
+		}
+		for k, v := range tags {
+			all[k] = v
+		}
+		tags = all
+	}
+	return client.NewPoint(name, tags, fields, tm)
+}
+
+// stop flushes the queued points until ctx is done, then cancels the writes and counts the records left as lost.
+// A sweep still running may call it, the records it queues after are counted as lost too.
+func (i *Importer) stop(ctx context.Context) (int64, error) {
+	// the sweeps blocked on a full queue release the lock, the queue is still flushed until ctx is done
+	close(i.closing)
+	withWriteLock(&i.closeLock, func() {
+		i.closed = true
+		close(i.urgent)
+		close(i.msgs)
+	})
+	defer i.cancel()
+	err := waitStopped(ctx, i.log, "the importer", i.stopped, func() string {
+		return fmt.Sprintf("%d records queued, %d in the batch being written", i.queued(), atomic.LoadInt64(&i.batched))
+	})
+	if err != nil {
+		// the write in flight is cancelled and the records left are counted as lost
+		i.cancel()
+		<-i.stopped
+	}
+	return atomic.LoadInt64(&i.lost), err
 }
 
 // runCmd method is for influxb querys
 func (i *Importer) runCmd(cmd string) (res []client.Result, err error) {
 	q := client.Query{
 		Command:  cmd,
-		Database: i.cfg.Influxdb.Db,
+		Database: i.influx.Db,
 	}
 	if response, err := i.influxdb.Query(q); err == nil {
 		if response.Error() != nil {
@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestImporterStopBoundedByFullQueue(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	i := &Importer{
+		msgs:    make(chan *ConsumerFullOffset, 1),
+		urgent:  make(chan *ConsumerFullOffset, 1),
+		stopped: make(chan struct{}),
+		closing: make(chan struct{}),
+		log:     logrus.NewEntry(logger),
+	}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	// a writer stuck on a slow influxdb until its write is cancelled
+	go func() {
+		<-i.ctx.Done()
+		i.stopped <- struct{}{}
+	}()
+	i.saveMsg(&ConsumerFullOffset{Group: "billing"})
+	enqueued := make(chan struct{})
+	go func() {
+		// blocks on the full queue
+		i.saveMsg(&ConsumerFullOffset{Group: "billing"})
+		close(enqueued)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result := make(chan int64, 1)
+	go func() {
+		lost, _ := i.stop(ctx)
+		result <- lost
+	}()
+	select {
+	case lost := <-result:
+		if lost != 1 {
+			t.Errorf("%d records lost, want the one waiting for room", lost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop waited for the sweep blocked on the full queue past its deadline")
+	}
+	<-enqueued
+}
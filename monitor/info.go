@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// GitCommit of the build, set by main
+var GitCommit = ""
+
+// the secrets of the config are replaced by this
+const redacted = "redacted"
+
+// Info describes the build and the configuration of the instance, for the support of many deployed instances
+type Info struct {
+	Identity
+	GitCommit string `json:"git_commit,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	// timestamp(ms) the fetcher was created
+	StartedAt int64    `json:"started_at"`
+	Clusters  []string `json:"clusters"`
+	// where the points are written, influxdb and the configured sinks
+	Importers []string `json:"importers"`
+	Notifiers []string `json:"notifiers"`
+	// the sink types registered by the build and the plugins
+	SinkTypes []string `json:"sink_types"`
+	Plugins   []string `json:"plugins"`
+	// the boolean switches of the general config
+	Features map[string]bool `json:"features"`
+	// the resolved config, without its secrets
+	Config *config.Config `json:"config"`
+}
+
+// Info returns the build info and the sanitized config of the instance
+func (f *Fetcher) Info() (*Info, error) {
+	cfg, err := sanitizeConfig(f.cfg)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Identity:  NewIdentity(f.cfg),
+		GitCommit: GitCommit,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		StartedAt: f.started.UnixNano() / int64(time.Millisecond),
+		Clusters:  []string{},
+		Importers: []string{"influxdb"},
+		Notifiers: []string{},
+		SinkTypes: []string{},
+		Plugins:   append([]string{}, f.cfg.General.Plugins...),
+		Features:  make(map[string]bool),
+		Config:    cfg,
+	}
+	if f.cfg.Grafana.Url != "" {
+		info.Notifiers = append(info.Notifiers, "grafana")
+	}
+	seen := make(map[string]bool)
+	var dryRun []string
+	for _, cli := range f.allClients() {
+		info.Clusters = append(info.Clusters, cli.cluster)
+		if cli.importer.dryRun {
+			dryRun = append(dryRun, cli.cluster)
+		}
+		for _, sink := range cli.sinks {
+			if seen[sink.Name()] {
+				continue
+			}
+			seen[sink.Name()] = true
+			if _, ok := sink.(Notifier); ok {
+				info.Notifiers = append(info.Notifiers, sink.Name())
+			} else {
+				info.Importers = append(info.Importers, sink.Name())
+			}
+		}
+	}
+	sort.Strings(info.Clusters)
+	// general.dryRun or the dryRun of the clusters
+	sort.Strings(dryRun)
+	switch {
+	case len(dryRun) == 0:
+	case len(dryRun) == len(info.Clusters):
+		info.Importers[0] = "influxdb (dry run)"
+	default:
+		info.Importers[0] = "influxdb (dry run: " + strings.Join(dryRun, ", ") + ")"
+	}
+	sinkLock.Lock()
+	for typ := range sinkFactories {
+		info.SinkTypes = append(info.SinkTypes, typ)
+	}
+	sinkLock.Unlock()
+	sort.Strings(info.SinkTypes)
+
+	general := reflect.ValueOf(f.cfg.General)
+	for i := 0; i < general.NumField(); i++ {
+		if field := general.Type().Field(i); field.Type.Kind() == reflect.Bool {
+			info.Features[strings.Split(field.Tag.Get("json"), ",")[0]] = general.Field(i).Bool()
+		}
+	}
+	info.Features["api_tokens"] = len(f.cfg.Api.Tokens) > 0
+	info.Features["federation"] = len(f.cfg.Api.Peers) > 0
+	return info, nil
+}
+
+// sanitizeConfig returns a copy of the config without the passwords, api keys, tokens and connection strings,
+// the options of the sinks, the offsets topic codecs and the evaluation engine whose name suggests a secret,
+// the webhook urls and the usernames included, are redacted too
+func sanitizeConfig(cfg *config.Config) (*config.Config, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var res config.Config
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	redact := func(s *string) {
+		if *s != "" {
+			*s = redacted
+		}
+	}
+	redact(&res.Influxdb.Pwd)
+	redact(&res.Grafana.ApiKey)
+	res.General.Proxy = redactURL(res.General.Proxy)
+	for _, token := range res.Api.Tokens {
+		redact(&token.Token)
+	}
+	var options []map[string]string
+	if res.Evaluation != nil {
+		options = append(options, res.Evaluation.Options)
+	}
+	for _, sink := range res.Sinks {
+		options = append(options, sink.Options)
+	}
+	for _, k := range res.Kafka {
+		redact(&k.Sasl.Password)
+		redact(&k.Confluent.ApiSecret)
+		redact(&k.EventHubs.ConnectionString)
+		if k.Influxdb != nil {
+			redact(&k.Influxdb.Pwd)
+		}
+		for _, sink := range k.Sinks {
+			options = append(options, sink.Options)
+		}
+		if k.Evaluation != nil {
+			options = append(options, k.Evaluation.Options)
+		}
+		for _, ot := range k.OffsetsTopics {
+			options = append(options, ot.Options)
+		}
+	}
+	for _, opts := range options {
+		redactOptions(opts)
+	}
+	return &res, nil
+}
+
+// redactOptions redacts the options whose name suggests a secret, and the passwords of the urls of the others,
+// e.g. the schemaRegistry of an avro codec
+func redactOptions(options map[string]string) {
+	for name, value := range options {
+		lower := strings.ToLower(name)
+		options[name] = redactURL(value)
+		for _, secret := range []string{"password", "secret", "token", "key", "url", "user"} {
+			if strings.Contains(lower, secret) {
+				options[name] = redacted
+				break
+			}
+		}
+	}
+}
+
+// redactURL hides the password of an url
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
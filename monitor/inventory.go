@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	client "github.com/influxdata/influxdb/client/v2"
+)
+
+var (
+	ErrInventoryDisabled = errors.New("the inventory isn't refreshed, set general.inventoryMinutes")
+	ErrInventoryPending  = errors.New("the inventory isn't refreshed yet")
+)
+
+// Inventory is a snapshot of the metadata of a cluster, for the CMDB and capacity tooling
+type Inventory struct {
+	Cluster     string `json:"cluster"`
+	ClusterName string `json:"cluster_name,omitempty"`
+	Flavor      string `json:"flavor"`
+	// timestamp(ms) of the snapshot
+	Timestamp int64 `json:"timestamp"`
+	// -1 if unknown, or on a kraft cluster
+	ControllerID int32              `json:"controller_id"`
+	Brokers      []*BrokerInventory `json:"brokers"`
+	// all topics of the metadata, internal ones included, not only the monitored ones
+	Topics     int `json:"topics"`
+	Partitions int `json:"partitions"`
+	//topic => partition count
+	TopicPartitions map[string]int `json:"topic_partitions"`
+}
+
+// BrokerInventory is a broker of the metadata
+type BrokerInventory struct {
+	ID   int32  `json:"id"`
+	Addr string `json:"addr"`
+	// empty if broker.rack isn't set
+	Rack string `json:"rack,omitempty"`
+	// the first release supporting the Fetch version the broker answers in ApiVersions, a lower bound,
+	// empty if it didn't answer, e.g. before 0.10
+	KafkaVersion string `json:"kafka_version,omitempty"`
+	// partitions led by the broker and replicas it hosts
+	Leaders  int `json:"leaders"`
+	Replicas int `json:"replicas"`
+}
+
+// fetchReleases maps the max Fetch versions to the first release supporting them
+var fetchReleases = []struct {
+	version int16
+	release string
+}{
+	{2, "0.10.0"}, {3, "0.10.1"}, {4, "0.11.0"}, {5, "1.0"}, {7, "1.1"}, {8, "2.0"}, {9, "2.1"},
+	{11, "2.3"}, {12, "2.7"}, {13, "3.1"}, {15, "3.5"}, {16, "3.7"},
+}
+
+// kafkaRelease returns the release of a broker answering maxFetch as the max Fetch version
+func kafkaRelease(maxFetch int16) string {
+	release := ""
+	for _, r := range fetchReleases {
+		if maxFetch >= r.version {
+			release = r.release
+		}
+	}
+	return release
+}
+
+// Inventory returns the inventory of a cluster at its last refresh
+func (f *Fetcher) Inventory(cluster string) (*Inventory, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Inventory()
+}
+
+// Inventory returns the inventory of the last refresh
+func (client *KafkaClient) Inventory() (*Inventory, error) {
+	if client.cfg.General.InventoryMinutes <= 0 {
+		return nil, ErrInventoryDisabled
+	}
+	var inv *Inventory
+	withReadLock(client.heartbeatLock, func() {
+		inv = client.inventory
+	})
+	if inv == nil {
+		return nil, ErrInventoryPending
+	}
+	return inv, nil
+}
+
+// refreshInventory refreshes the metadata, asks every broker its api versions, keeps the inventory for the api
+// and writes it
+func (client *KafkaClient) refreshInventory(ctx context.Context) {
+	if err := client.client.RefreshMetadata(); err != nil {
+		client.warnLimiter.warnf(client.log, "inventory", "Cannot refresh the metadata of the inventory: %v", err)
+		return
+	}
+	topics, err := client.client.Topics()
+	if err != nil {
+		client.warnLimiter.warnf(client.log, "inventory", "Cannot list the topics of the inventory: %v", err)
+		return
+	}
+	flavor := client.cfg.Kafka[client.cluster].Flavor
+	inv := &Inventory{
+		Cluster:         client.cluster,
+		ClusterName:     client.cfg.DisplayNameOf(client.cluster),
+		Flavor:          flavor,
+		Timestamp:       clockNow().UnixNano() / int64(time.Millisecond),
+		ControllerID:    -1,
+		Topics:          len(topics),
+		TopicPartitions: make(map[string]int, len(topics)),
+	}
+	if flavor == "" {
+		inv.Flavor = "kafka"
+	}
+	brokers := make(map[int32]*BrokerInventory)
+	for _, broker := range client.client.Brokers() {
+		b := &BrokerInventory{ID: broker.ID(), Addr: broker.Addr(), Rack: broker.Rack()}
+		if ok, _ := broker.Connected(); !ok {
+			broker.Open(client.client.Config())
+		}
+		if resp, err := broker.ApiVersions(&sarama.ApiVersionsRequest{}); err != nil {
+			client.failed(client.log.WithField("broker", broker.ID()), "", err).Debugf("ApiVersions error : %v", err)
+		} else if resp.Err == sarama.ErrNoError {
+			for _, block := range resp.ApiVersions {
+				// the api key of Fetch
+				if block.ApiKey == 1 {
+					b.KafkaVersion = kafkaRelease(block.MaxVersion)
+				}
+			}
+		}
+		brokers[b.ID] = b
+		inv.Brokers = append(inv.Brokers, b)
+	}
+	sort.Slice(inv.Brokers, func(i, j int) bool { return inv.Brokers[i].ID < inv.Brokers[j].ID })
+	for _, topic := range topics {
+		partitions, err := client.client.Partitions(topic)
+		if err != nil {
+			continue
+		}
+		inv.TopicPartitions[topic] = len(partitions)
+		inv.Partitions += len(partitions)
+		for _, partition := range partitions {
+			if leader, err := client.client.Leader(topic, partition); err == nil {
+				if b, ok := brokers[leader.ID()]; ok {
+					b.Leaders++
+				}
+			}
+			replicas, _ := client.client.Replicas(topic, partition)
+			for _, replica := range replicas {
+				if b, ok := brokers[replica]; ok {
+					b.Replicas++
+				}
+			}
+		}
+	}
+	if controller, err := client.client.Controller(); err == nil && flavor != "kraft" {
+		inv.ControllerID = controller.ID()
+	}
+	withWriteLock(client.heartbeatLock, func() {
+		client.inventory = inv
+	})
+	client.importer.saveInventory(ctx, inv)
+}
+
+// saveInventory writes the inventory as info points, one cluster_inventory point and one broker_inventory
+// point per broker, tagged with its id, address, rack and release
+func (i *Importer) saveInventory(ctx context.Context, inv *Inventory) {
+	tm := msTime(inv.Timestamp)
+	pts := make([]*client.Point, 0, len(inv.Brokers)+1)
+	pt, err := i.newPoint("cluster_inventory", map[string]string{"cluster": inv.Cluster, "flavor": inv.Flavor}, map[string]interface{}{
+		"brokers":       len(inv.Brokers),
+		"topics":        inv.Topics,
+		"partitions":    inv.Partitions,
+		"controller_id": inv.ControllerID,
+	}, tm)
+	if err != nil {
+		i.log.Errorf("error in add inventory point %s", err.Error())
+		return
+	}
+	pts = append(pts, pt)
+	for _, b := range inv.Brokers {
+		tags := map[string]string{"cluster": inv.Cluster, "broker_id": strconv.Itoa(int(b.ID)), "addr": b.Addr}
+		if b.Rack != "" {
+			tags["rack"] = b.Rack
+		}
+		if b.KafkaVersion != "" {
+			tags["kafka_version"] = b.KafkaVersion
+		}
+		pt, err := i.newPoint("broker_inventory", tags, map[string]interface{}{
+			"leaders":    b.Leaders,
+			"replicas":   b.Replicas,
+			"controller": b.ID == inv.ControllerID,
+		}, tm)
+		if err != nil {
+			i.log.WithField("broker", b.ID).Errorf("error in add inventory point %s", err.Error())
+			continue
+		}
+		pts = append(pts, pt)
+	}
+	i.writeBatch(ctx, pts)
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefix of a broker entry resolved through DNS, e.g. dns://kafka-headless.kafka.svc.cluster.local:9092,
+// which expands to every address of a headless service so the brokers don't have to be listed
+const dnsBrokerPrefix = "dns://"
+
+// podTags returns the pod and namespace tags added to every point, from the POD_NAME and POD_NAMESPACE
+// env vars which the kubernetes downward API sets
+func podTags() map[string]string {
+	tags := make(map[string]string)
+	if pod := os.Getenv("POD_NAME"); pod != "" {
+		tags["pod"] = pod
+	}
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		tags["namespace"] = ns
+	}
+	return tags
+}
+
+// resolveBrokers splits the broker list and expands the dns:// entries to the addresses they resolve to
+func resolveBrokers(brokers string) ([]string, error) {
+	var addrs []string
+	for _, broker := range strings.Split(brokers, ",") {
+		broker = strings.TrimSpace(broker)
+		if !strings.HasPrefix(broker, dnsBrokerPrefix) {
+			addrs = append(addrs, broker)
+			continue
+		}
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(broker, dnsBrokerPrefix))
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("%s resolves to no address", host)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, port))
+		}
+	}
+	return addrs, nil
+}
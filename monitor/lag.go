@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// GroupLag is the lag of a group per topic, Fresh if it was fetched now instead of at the last sweep
+type GroupLag struct {
+	Cluster  string                `json:"cluster"`
+	Group    string                `json:"group"`
+	Fresh    bool                  `json:"fresh"`
+	TotalLag int64                 `json:"total_lag"`
+	Offsets  []*ConsumerFullOffset `json:"offsets"`
+}
+
+// Lag returns the lag of a group of a cluster at the last sweep, or fetched now until ctx is done if fresh
+func (f *Fetcher) Lag(ctx context.Context, cluster, group string, fresh bool) (*GroupLag, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if fresh {
+		return cli.FreshLag(ctx, group)
+	}
+	return cli.Lag(group)
+}
+
+// Lag returns the lag of the group at the last sweep, of its logical group after groupRewrite
+func (client *KafkaClient) Lag(group string) (*GroupLag, error) {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	group = rewriteGroup(client.groupRewrites, group)
+	window := client.evaluator.windows[group]
+	if len(window) == 0 {
+		return nil, fmt.Errorf("unknown group %s", group)
+	}
+	last := window[len(window)-1]
+	gl := &GroupLag{Cluster: client.cluster, Group: group}
+	for topic, partitions := range last.offsets {
+		gl.add(&ConsumerFullOffset{
+			Cluster:      client.cluster,
+			Topic:        topic,
+			Group:        group,
+			Timestamp:    last.Timestamp,
+			partitionMap: partitions,
+		})
+	}
+	return gl, nil
+}
+
+// FreshLag fetches the committed offsets of the group and the log end offsets of its partitions now,
+// bypassing the sweep, to check the lag during an incident. With groupRewrite, group is resolved to its logical
+// group and the offsets of its instances are merged as the sweeps do.
+func (client *KafkaClient) FreshLag(ctx context.Context, group string) (*GroupLag, error) {
+	group = rewriteGroup(client.groupRewrites, group)
+	//group => topic => partitions, the groups of kafka named group after groupRewrite
+	instances := make(map[string]map[string]int)
+	topics := make(map[string]int)
+	client.schemaUpdateMtx.RLock()
+	for name, seen := range client.groupSeen {
+		if rewriteGroup(client.groupRewrites, name) != group {
+			continue
+		}
+		for topic := range seen {
+			partitions, ok := client.topicMap[topic]
+			if !ok {
+				continue
+			}
+			if _, ok := instances[name]; !ok {
+				instances[name] = make(map[string]int)
+			}
+			instances[name][topic] = partitions
+			topics[topic] = partitions
+		}
+	}
+	client.schemaUpdateMtx.RUnlock()
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("unknown group %s", group)
+	}
+
+	logsizes, err := client.fetchLogsizes(ctx, topics)
+	if err != nil {
+		return nil, err
+	}
+	ts := clockNow().UnixNano() / int64(time.Millisecond)
+	groupOffsets := make(map[string][]*ConsumerFullOffset, len(instances))
+	for name, consumed := range instances {
+		for topic, partitions := range consumed {
+			blocks, err := client.fetchCommittedOffsets(ctx, name, topic, partitions)
+			if err != nil {
+				return nil, err
+			}
+			msg := &ConsumerFullOffset{
+				Cluster:      client.cluster,
+				Topic:        topic,
+				Group:        name,
+				Timestamp:    ts,
+				partitionMap: make(map[int32]LogOffset, partitions),
+			}
+			for partition := int32(0); partition < int32(partitions); partition++ {
+				logsize := logsizes[topic][partition]
+				offset := LogOffset{Logsize: logsize, Offset: -1, Lag: -1, LeaderEpoch: -1}
+				if block, ok := blocks[partition]; ok && block.Err == sarama.ErrNoError && block.Offset >= 0 {
+					offset.Offset = block.Offset
+					offset.LeaderEpoch = block.LeaderEpoch
+					offset.Metadata = block.Metadata
+					if offset.Offset > logsize {
+						offset.Offset = logsize
+					}
+					offset.Lag = logsize - offset.Offset
+				}
+				msg.partitionMap[partition] = offset
+			}
+			groupOffsets[name] = append(groupOffsets[name], msg)
+		}
+	}
+	gl := &GroupLag{Cluster: client.cluster, Group: group, Fresh: true}
+	for _, msg := range rewriteGroups(client.groupRewrites, groupOffsets)[group] {
+		gl.add(msg)
+	}
+	return gl, nil
+}
+
+// fetchLogsizes asks the leaders of the partitions of the topics for their log end offsets, one request per leader
+func (client *KafkaClient) fetchLogsizes(ctx context.Context, topics map[string]int) (map[string]map[int32]int64, error) {
+	requests := make(leaderRequests)
+	for topic, partitions := range topics {
+		for partition := int32(0); partition < int32(partitions); partition++ {
+			broker, _, err := client.backend.Leader(topic, partition)
+			if err != nil {
+				return nil, err
+			}
+			requests.add(broker, topic, partition)
+		}
+	}
+	logsizes := make(map[string]map[int32]int64, len(topics))
+	for broker, request := range requests {
+		response, err := client.backend.ListOffsets(ctx, broker, request, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		offsets, ok := client.parseOffsetResponse(broker, response)
+		if !ok {
+			return nil, fmt.Errorf("error in the offset response of broker %d", broker)
+		}
+		for topic, partitions := range offsets {
+			if _, ok := logsizes[topic]; !ok {
+				logsizes[topic] = make(map[int32]int64, len(partitions))
+			}
+			for partition, logsize := range partitions {
+				logsizes[topic][partition] = logsize
+			}
+		}
+	}
+	return logsizes, nil
+}
+
+func (gl *GroupLag) add(msg *ConsumerFullOffset) {
+	for _, offset := range msg.partitionMap {
+		if offset.Lag > 0 {
+			gl.TotalLag += offset.Lag
+		}
+	}
+	gl.Offsets = append(gl.Offsets, msg)
+}
@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sundy-li/burrowx/config"
+	"github.com/sundy-li/burrowx/monitor/monitortest"
+)
+
+func TestFreshLagGroupRewrite(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	c.AddTopic("payments", 2)
+	c.SetLogsize("payments", 0, 500)
+	c.SetLogsize("payments", 1, 300)
+	// the instances of an ephemeral group, the merged offsets are the furthest of each partition
+	c.AddGroup("ledger-1a2b", "payments")
+	c.AddGroup("ledger-3c4d", "payments")
+	c.Commit("ledger-1a2b", "payments", 0, 450)
+	c.Commit("ledger-1a2b", "payments", 1, 100)
+	c.Commit("ledger-3c4d", "payments", 0, 200)
+	c.Commit("ledger-3c4d", "payments", 1, 280)
+
+	cfg := c.Config()
+	cfg.GroupRewrite = []*config.GroupRewrite{{Match: "^(ledger)-[0-9a-f]+$", Replace: "$1"}}
+	client, err := NewKafkaClient(cfg, monitortest.ClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.RefreshMetaData()
+	ctx := context.Background()
+	if err := client.getOffsets(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, group := range []string{"ledger", "ledger-3c4d"} {
+		lag, err := client.FreshLag(ctx, group)
+		if err != nil {
+			t.Fatalf("fresh lag of %s: %v", group, err)
+		}
+		if lag.Group != "ledger" || lag.TotalLag != 70 || len(lag.Offsets) != 1 {
+			t.Errorf("fresh lag of %s is %d for %s over %d topics, want 70 for ledger over 1", group, lag.TotalLag, lag.Group, len(lag.Offsets))
+		}
+	}
+
+	fresh, err := client.EvaluateNow(ctx, "ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the evaluation of the sweep and the fresh one
+	if s := fresh.Status; s.Group != "ledger" || s.TotalLag != 70 || len(s.Window) != 2 {
+		t.Errorf("evaluated %s with a lag of %d over %d evaluations, want ledger with 70 over 2", s.Group, s.TotalLag, len(s.Window))
+	}
+}
@@ -0,0 +1,309 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// the real groups were observed in this share of the sweeps of the learning period at least
+	learnMinPresence = 0.5
+	// and committed, or had caught up, in this share of the sweeps they were observed in at least
+	learnMinRegularity = 0.5
+)
+
+var (
+	ErrLearningDisabled = errors.New("the groups aren't learned, set general.learnGroupsHours")
+	ErrLearning         = errors.New("the groups are still being learned")
+)
+
+// GroupProposal is the allowlist the learning mode proposes for a cluster once its period is over
+type GroupProposal struct {
+	Cluster string `json:"cluster"`
+	// timestamps(ms) of the learning period
+	Since int64 `json:"since"`
+	Until int64 `json:"until"`
+	Ready bool  `json:"ready"`
+	// the cluster only monitors the Accepted groups
+	Accepted  []string        `json:"accepted,omitempty"`
+	Real      []*LearnedGroup `json:"real"`
+	Ephemeral []*LearnedGroup `json:"ephemeral"`
+}
+
+// LearnedGroup is what the learning mode observed of a group
+type LearnedGroup struct {
+	Group     string `json:"group"`
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+	// share of the sweeps of the period the group was observed in
+	Presence float64 `json:"presence"`
+	// share of the sweeps the group was observed in, after its first, it committed or had caught up in
+	Regularity float64 `json:"regularity"`
+}
+
+type groupObservation struct {
+	firstSeen, lastSeen int64
+	sweeps, active      int
+	//topic => partition => committed offset
+	offsets map[string]map[int32]int64
+}
+
+// groupLearner observes the groups of a cluster over the learning period and proposes the real ones,
+// the groups observed in most of the sweeps which commit regularly, as the allowlist of the cluster
+type groupLearner struct {
+	cluster string
+	period  int64
+	file    string
+	log     *logrus.Entry
+
+	lock sync.Mutex
+	// timestamp(ms) of the first sweep of the period
+	since  int64
+	sweeps int
+	groups map[string]*groupObservation
+	// of the period once over, then no more observations
+	proposal *GroupProposal
+	// the groups monitored once a proposal is accepted
+	allowed map[string]bool
+}
+
+// newGroupLearner learns from the first sweep on, or resumes the proposal and the allowlist kept in dir
+func newGroupLearner(cluster string, hours int, dir string, log *logrus.Entry) (*groupLearner, error) {
+	l := &groupLearner{
+		cluster: cluster,
+		period:  int64(hours) * 3600 * 1000,
+		log:     log,
+		groups:  make(map[string]*groupObservation),
+	}
+	if dir == "" {
+		return l, nil
+	}
+	l.file = filepath.Join(dir, "burrowx-groups-"+cluster+".json")
+	f, err := os.Open(l.file)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var proposal GroupProposal
+	if err := json.NewDecoder(f).Decode(&proposal); err != nil {
+		return nil, err
+	}
+	if proposal.Ready {
+		l.proposal = &proposal
+		l.allow(proposal.Accepted)
+	}
+	return l, nil
+}
+
+func (l *groupLearner) allow(groups []string) {
+	if len(groups) == 0 {
+		l.allowed = nil
+		return
+	}
+	l.allowed = make(map[string]bool, len(groups))
+	for _, group := range groups {
+		l.allowed[group] = true
+	}
+}
+
+// allows reports whether the group is monitored, all are until a proposal is accepted
+func (l *groupLearner) allows(group string) bool {
+	if l == nil {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.allowed == nil || l.allowed[group]
+}
+
+// observe counts the groups of a sweep, by their names before the rewrites, and makes the proposal once
+// the learning period is over
+func (l *groupLearner) observe(ts int64, groupOffsets map[string][]*ConsumerFullOffset) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.proposal != nil {
+		return
+	}
+	if l.sweeps == 0 {
+		l.since = ts
+	}
+	l.sweeps++
+	for group, msgs := range groupOffsets {
+		obs, ok := l.groups[group]
+		if !ok {
+			obs = &groupObservation{firstSeen: ts, offsets: make(map[string]map[int32]int64)}
+			l.groups[group] = obs
+		}
+		moved, caughtUp := false, true
+		for _, msg := range msgs {
+			if _, ok := obs.offsets[msg.Topic]; !ok {
+				obs.offsets[msg.Topic] = make(map[int32]int64)
+			}
+			for partition, offset := range msg.partitionMap {
+				if offset.Offset < 0 {
+					continue
+				}
+				if last, ok := obs.offsets[msg.Topic][partition]; ok && last != offset.Offset {
+					moved = true
+				}
+				if offset.Lag > 0 {
+					caughtUp = false
+				}
+				obs.offsets[msg.Topic][partition] = offset.Offset
+			}
+		}
+		if obs.sweeps > 0 && (moved || caughtUp) {
+			obs.active++
+		}
+		obs.sweeps++
+		obs.lastSeen = ts
+	}
+	if ts-l.since < l.period {
+		return
+	}
+	l.proposal = l.propose(ts)
+	l.groups = nil
+	l.log.Infof("Learned %d real and %d ephemeral groups, accept the allowlist with POST /v1/clusters/%s/allowlist",
+		len(l.proposal.Real), len(l.proposal.Ephemeral), l.cluster)
+	if err := l.save(); err != nil {
+		l.log.Warnf("Cannot keep the proposed allowlist: %v", err)
+	}
+}
+
+// propose classifies the observed groups, the caller must hold the lock
+func (l *groupLearner) propose(until int64) *GroupProposal {
+	p := &GroupProposal{Cluster: l.cluster, Since: l.since, Until: until, Ready: true, Real: []*LearnedGroup{}, Ephemeral: []*LearnedGroup{}}
+	for group, obs := range l.groups {
+		lg := &LearnedGroup{
+			Group:     group,
+			FirstSeen: obs.firstSeen,
+			LastSeen:  obs.lastSeen,
+			Presence:  float64(obs.sweeps) / float64(l.sweeps),
+		}
+		if obs.sweeps > 1 {
+			lg.Regularity = float64(obs.active) / float64(obs.sweeps-1)
+		}
+		if lg.Presence >= learnMinPresence && lg.Regularity >= learnMinRegularity {
+			p.Real = append(p.Real, lg)
+		} else {
+			p.Ephemeral = append(p.Ephemeral, lg)
+		}
+	}
+	for _, groups := range [][]*LearnedGroup{p.Real, p.Ephemeral} {
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+	}
+	return p
+}
+
+// current returns the proposal, not Ready during the learning period
+func (l *groupLearner) current() *GroupProposal {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.proposal != nil {
+		p := *l.proposal
+		return &p
+	}
+	p := &GroupProposal{Cluster: l.cluster}
+	if l.sweeps > 0 {
+		p.Since, p.Until = l.since, l.since+l.period
+	}
+	return p
+}
+
+// accept monitors only the groups, the real ones of the proposal if empty, from the next metadata refresh
+func (l *groupLearner) accept(groups []string) ([]string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.proposal == nil {
+		return nil, ErrLearning
+	}
+	if len(groups) == 0 {
+		for _, lg := range l.proposal.Real {
+			groups = append(groups, lg.Group)
+		}
+		if len(groups) == 0 {
+			return nil, errors.New("the proposal has no real group")
+		}
+	}
+	groups = append([]string(nil), groups...)
+	sort.Strings(groups)
+	l.proposal.Accepted = groups
+	l.allow(groups)
+	return groups, l.save()
+}
+
+// reject monitors all the groups again, the proposal stays
+func (l *groupLearner) reject() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.proposal == nil {
+		return ErrLearning
+	}
+	l.proposal.Accepted = nil
+	l.allow(nil)
+	return l.save()
+}
+
+// save writes the proposal to the file if set, the caller must hold the lock
+func (l *groupLearner) save() error {
+	if l.file == "" {
+		return nil
+	}
+	return writeFileAtomic(l.file, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(l.proposal)
+	})
+}
+
+// allowsGroup reports whether the group is in kafka.<cluster>.groups and in the accepted allowlist, if any
+func (client *KafkaClient) allowsGroup(group string) bool {
+	if client.groupAllowlist != nil {
+		return client.groupAllowlist[group]
+	}
+	return client.learner.allows(group)
+}
+
+// GroupProposal returns the allowlist proposed for a cluster
+func (f *Fetcher) GroupProposal(cluster string) (*GroupProposal, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if cli.learner == nil {
+		return nil, ErrLearningDisabled
+	}
+	return cli.learner.current(), nil
+}
+
+// AcceptGroups locks the monitoring of a cluster down to the groups, the real groups of its proposal if empty,
+// it returns the accepted groups
+func (f *Fetcher) AcceptGroups(cluster string, groups []string) ([]string, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if cli.learner == nil {
+		return nil, ErrLearningDisabled
+	}
+	return cli.learner.accept(groups)
+}
+
+// RejectGroups monitors all the groups of a cluster again
+func (f *Fetcher) RejectGroups(cluster string) error {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return err
+	}
+	if cli.learner == nil {
+		return ErrLearningDisabled
+	}
+	return cli.learner.reject()
+}
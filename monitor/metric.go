@@ -1,8 +1,67 @@
 package monitor
 
+import (
+	"fmt"
+	"time"
+)
+
 type LogOffset struct {
-	Logsize int64
-	Offset  int64
+	Logsize int64 `json:"logsize"`
+	Offset  int64 `json:"offset"`
+	Lag     int64 `json:"lag"`
+	// log start offset, 0 unless general.fetchStartOffsets
+	LogStart int64 `json:"log_start,omitempty"`
+
+	// member owning the partition and the state of its group
+	Owner      string `json:"owner"`
+	ClientID   string `json:"client_id"`
+	ClientHost string `json:"client_host"`
+	GroupState string `json:"group_state"`
+
+	// as returned by the OffsetFetch of the committed offset
+	LeaderEpoch int32  `json:"leader_epoch"`
+	Metadata    string `json:"metadata"`
+	// the committed offset was ahead of the log end offset, fetched before it
+	StaleBrokerOffset bool `json:"stale_broker_offset,omitempty"`
+	// the partition is being reassigned, with general.detectReassignments
+	Reassigning bool `json:"reassigning,omitempty"`
+	// sequence number of the sweep whose log end offset the commit was matched to, and when it was fetched
+	Sweep   int `json:"sweep,omitempty"`
+	sweptAt int64
+}
+
+// ConsumedPct is the share of the retained messages of the partition the group has consumed, in percent
+func (o LogOffset) ConsumedPct() float64 {
+	retained, consumed := consumedRange(o)
+	if retained <= 0 {
+		return 100
+	}
+	return float64(consumed) * 100 / float64(retained)
+}
+
+// consumedRange returns the retained messages of the partition and how many of them the group has consumed
+func consumedRange(o LogOffset) (retained, consumed int64) {
+	offset := o.Offset
+	if offset < o.LogStart {
+		offset = o.LogStart
+	}
+	return o.Logsize - o.LogStart, offset - o.LogStart
+}
+
+// GroupMember is the consumer a partition is assigned to
+type GroupMember struct {
+	MemberId   string
+	ClientId   string
+	ClientHost string
+}
+
+// BrokerLatency is how long a broker took to answer the offset request of a sweep
+type BrokerLatency struct {
+	Broker  int32
+	Addr    string
+	Latency time.Duration
+	// false if the request failed
+	OK bool
 }
 
 type ConsumerOffset struct {
@@ -20,10 +79,195 @@ type TopicPartitionOffset struct {
 }
 
 type ConsumerFullOffset struct {
-	Cluster   string
-	Topic     string
-	Group     string
-	Timestamp int64
+	Cluster   string `json:"cluster"`
+	Topic     string `json:"topic"`
+	Group     string `json:"group"`
+	Timestamp int64  `json:"timestamp"`
+
+	// when the group was first and last observed consuming the topic
+	FirstSeen int64 `json:"first_seen"`
+	LastSeen  int64 `json:"last_seen"`
+	// of the topic, if its config is described
+	CleanupPolicy string `json:"cleanup_policy,omitempty"`
 
 	partitionMap map[int32]LogOffset
+	// reconstructed after a downtime of the monitor
+	backfill bool
+}
+
+// NewConsumerFullOffset returns the offsets of a group on a topic at ts(ms), e.g. to feed a sink in a test
+func NewConsumerFullOffset(cluster, group, topic string, ts int64, partitions map[int32]LogOffset) *ConsumerFullOffset {
+	return &ConsumerFullOffset{Cluster: cluster, Group: group, Topic: topic, Timestamp: ts, partitionMap: partitions}
+}
+
+// Partitions returns partition => offset of the group on the topic
+func (msg *ConsumerFullOffset) Partitions() map[int32]LogOffset {
+	return msg.partitionMap
+}
+
+// Seen is when a group was first and last observed consuming a topic, in ms
+type Seen struct {
+	FirstSeen int64 `json:"first_seen"`
+	LastSeen  int64 `json:"last_seen"`
+}
+
+// Heartbeat is the self monitoring record of a cluster's monitor
+type Heartbeat struct {
+	Cluster   string `json:"cluster"`
+	Timestamp int64  `json:"timestamp"`
+
+	// timestamps in ms of the last successful broker offset sweep and the last consumer offset fetch
+	LastSweep       int64 `json:"last_sweep"`
+	LastOffsetFetch int64 `json:"last_offset_fetch"`
+	Stale           bool  `json:"stale"`
+}
+
+// Status of a consumer group or one of its partitions, ordered by severity
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarn
+	StatusRewind
+	StatusStall
+	StatusErr
+)
+
+var statusNames = []string{"OK", "WARN", "REWIND", "STALL", "ERR"}
+
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return "UNKNOWN"
+	}
+	return statusNames[s]
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(text []byte) error {
+	for i, name := range statusNames {
+		if name == string(text) {
+			*s = Status(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %s", text)
+}
+
+// GroupStatus is the evaluated status of a consumer group over all its topics
+type GroupStatus struct {
+	Cluster string `json:"cluster"`
+	// display name of the cluster
+	ClusterName string `json:"cluster_name,omitempty"`
+	Group       string `json:"group"`
+	Tenant      string `json:"tenant,omitempty"`
+	// team owning the group, and the notifiers its alerts are routed to, all if empty
+	Team      string   `json:"team,omitempty"`
+	Notifiers []string `json:"notifiers,omitempty"`
+	Timestamp int64    `json:"timestamp"`
+
+	Status   Status `json:"status"`
+	TotalLag int64  `json:"total_lag"`
+	MaxLag   int64  `json:"max_lag"`
+	// median and 95th percentile of the partition lags, a stuck partition shows in the gap between them
+	LagP50 int64 `json:"lag_p50"`
+	LagP95 int64 `json:"lag_p95"`
+	// share of the retained messages of all partitions consumed, in percent
+	ConsumedPct float64 `json:"consumed_pct"`
+	// estimated seconds the most lagging partition is behind
+	TimeLag float64          `json:"time_lag"`
+	Worst   *PartitionStatus `json:"worst,omitempty"`
+	// highest retention pressure of the partitions, 1 when the group is about to lose data
+	RetentionPressure float64 `json:"retention_pressure"`
+	// standard deviations of the total lag above the baseline of the group
+	AnomalyScore float64 `json:"anomaly_score"`
+	// growth of the total lag over the window in messages per second, and the lag it leads to
+	LagRate     float64 `json:"lag_rate"`
+	Forecast15m int64   `json:"forecast_15m"`
+	Forecast60m int64   `json:"forecast_60m"`
+	// messages per second the group committed over the window
+	ConsumeRate float64 `json:"consume_rate"`
+	// rebalances observed within general.rebalanceStormMinutes
+	Rebalances int `json:"rebalances"`
+	// commits found ahead of the log end offset since the group is evaluated
+	StaleBrokerOffsets int64 `json:"stale_broker_offsets"`
+	// commits read from __consumer_offsets since the previous evaluation, and the max time(ms) between
+	// their commit timestamp and their append, with general.commitLatency
+	Commits         int   `json:"commits,omitempty"`
+	CommitLatencyMs int64 `json:"commit_latency_ms,omitempty"`
+
+	// lag imbalance of the topics with more than one partition
+	Skews []*TopicSkew `json:"skews,omitempty"`
+	// partitions whose committed offset went back since the previous evaluation
+	Rewinds []*Rewind `json:"rewinds,omitempty"`
+	// topics muted now, their lag counts in the lags but not in the status
+	MutedTopics []string `json:"muted_topics,omitempty"`
+
+	// recent evaluations, oldest first, the last one is the current evaluation
+	Window []*Evaluation `json:"window"`
+
+	// with alerting routes, the notifiers they send the status change to
+	routing bool
+	routed  []string
+	// the partitions not OK, for the burrow payloads
+	partitions []*PartitionStatus
+}
+
+// TopicSkew is the imbalance of the partition lags of a topic in a group, Skew is the max lag over the mean lag,
+// 1 when the lag is uniform, the number of partitions when a single partition lags
+type TopicSkew struct {
+	Topic   string  `json:"topic"`
+	MaxLag  int64   `json:"max_lag"`
+	MinLag  int64   `json:"min_lag"`
+	MeanLag float64 `json:"mean_lag"`
+	Skew    float64 `json:"skew"`
+
+	partitions int
+}
+
+const (
+	// a small step back, a stale commit of a zombie or split brain consumer after a failed rebalance
+	RewindOutOfOrder = "out_of_order"
+	// a reset of the offsets
+	RewindDeliberate = "rewind"
+)
+
+// Rewind is a committed offset going back from From to To
+type Rewind struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	From      int64  `json:"from"`
+	To        int64  `json:"to"`
+	Kind      string `json:"kind"`
+}
+
+type PartitionStatus struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Status    Status `json:"status"`
+	Lag       int64  `json:"lag"`
+	// estimated seconds behind
+	TimeLag float64 `json:"time_lag"`
+	// share of what the topic retains the lag represents
+	RetentionPressure float64 `json:"retention_pressure"`
+	// the topic is compacted, the lag counts records compaction may have removed
+	Compacted bool `json:"compacted,omitempty"`
+	// the partition is being reassigned, its log end offset and consumer may lag behind meanwhile
+	Reassigning bool `json:"reassigning,omitempty"`
+	// its topic is muted, it's always OK
+	Muted bool `json:"muted,omitempty"`
+}
+
+type Evaluation struct {
+	Timestamp int64  `json:"timestamp"`
+	Status    Status `json:"status"`
+	TotalLag  int64  `json:"total_lag"`
+	// sequence number of the latest sweep of the offsets, and when it was made
+	Sweep   int `json:"sweep,omitempty"`
+	sweptAt int64
+
+	//topic => partition => offset
+	offsets map[string]map[int32]LogOffset
 }
@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// PointCounter is implemented by the sinks which count the points they wrote since the start,
+// the migration reports compare them with the points written to influxdb
+type PointCounter interface {
+	Points() int64
+}
+
+// SinkReport compares what a verified sink received and wrote with the points written to influxdb during its window
+type SinkReport struct {
+	Cluster string `json:"cluster"`
+	Sink    string `json:"sink"`
+	// timestamps(ms) of the window, 0 if unbounded
+	Enable  int64 `json:"enable,omitempty"`
+	Disable int64 `json:"disable,omitempty"`
+	Active  bool  `json:"active"`
+	// timestamp(ms) of the first sweep of the window the sink received
+	Since        int64 `json:"since,omitempty"`
+	Sweeps       int   `json:"sweeps"`
+	FailedSweeps int   `json:"failed_sweeps"`
+	// partition offsets and statuses of the sweeps the sink saved
+	Records int64 `json:"records"`
+	// written by the sink since Since, -1 if it doesn't count them
+	Points int64 `json:"points"`
+	// written to influxdb since Since
+	InfluxdbPoints int64 `json:"influxdb_points"`
+}
+
+// sinkWindow is the migration window of a sink, it only receives the sweeps from enable until disable
+type sinkWindow struct {
+	enable, disable time.Time
+	verify          bool
+
+	lock   sync.Mutex
+	report SinkReport
+	// of the sink and of influxdb at the first sweep of the window
+	sinkBase, influxBase int64
+}
+
+// newSinkWindows returns the windows of the sinks of a cluster, in the order of the sinks, nil for the sinks
+// without window nor verify
+func newSinkWindows(cfg *config.Config, cluster string, sinks []Sink) []*sinkWindow {
+	configs := cfg.SinksOf(cluster)
+	windows := make([]*sinkWindow, len(sinks))
+	for i, sc := range configs {
+		if i >= len(sinks) || (sc.Enable == "" && sc.Disable == "" && !sc.Verify) {
+			continue
+		}
+		// validated with the config
+		enable, disable, _ := sc.Window()
+		w := &sinkWindow{enable: enable, disable: disable, verify: sc.Verify}
+		w.report = SinkReport{Cluster: cluster, Sink: sinks[i].Name(), Points: -1}
+		if !enable.IsZero() {
+			w.report.Enable = enable.UnixNano() / int64(time.Millisecond)
+		}
+		if !disable.IsZero() {
+			w.report.Disable = disable.UnixNano() / int64(time.Millisecond)
+		}
+		windows[i] = w
+	}
+	return windows
+}
+
+// active reports whether the sink receives the sweep at now
+func (w *sinkWindow) active(now time.Time) bool {
+	if w == nil {
+		return true
+	}
+	return (w.enable.IsZero() || !now.Before(w.enable)) && (w.disable.IsZero() || now.Before(w.disable))
+}
+
+// record counts a sweep the sink received, with the points written to influxdb so far
+func (w *sinkWindow) record(sink Sink, now time.Time, records int, influxPoints int64, err error) {
+	if w == nil || !w.verify {
+		return
+	}
+	counter, counts := sink.(PointCounter)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.report.Sweeps == 0 && w.report.FailedSweeps == 0 {
+		w.report.Since = now.UnixNano() / int64(time.Millisecond)
+		w.influxBase = influxPoints
+		if counts {
+			w.sinkBase = counter.Points()
+		}
+	}
+	if err != nil {
+		w.report.FailedSweeps++
+	} else {
+		w.report.Sweeps++
+		w.report.Records += int64(records)
+	}
+	if counts {
+		w.report.Points = counter.Points() - w.sinkBase
+	}
+	w.report.InfluxdbPoints = influxPoints - w.influxBase
+}
+
+func (w *sinkWindow) snapshot(now time.Time) *SinkReport {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	r := w.report
+	r.Active = w.active(now)
+	return &r
+}
+
+// sinkWindow returns the window of the i-th sink, nil if it has none
+func (client *KafkaClient) sinkWindow(i int) *sinkWindow {
+	if i < len(client.sinkWindows) {
+		return client.sinkWindows[i]
+	}
+	return nil
+}
+
+// sinkRecords counts the partition offsets and the statuses of a sweep
+func sinkRecords(groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) int {
+	records := len(statuses)
+	for _, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			records += len(msg.partitionMap)
+		}
+	}
+	return records
+}
+
+// MigrationReports returns the reports of the verified sinks of a cluster, of all clusters if empty
+func (f *Fetcher) MigrationReports(cluster string) []*SinkReport {
+	now := clockNow()
+	reports := []*SinkReport{}
+	for _, cli := range f.allClients() {
+		if cluster != "" && !cli.named(cluster) {
+			continue
+		}
+		for _, w := range cli.sinkWindows {
+			if w != nil && w.verify {
+				reports = append(reports, w.snapshot(now))
+			}
+		}
+	}
+	return reports
+}
@@ -0,0 +1,230 @@
+// Package monitortest runs a fake kafka cluster on a sarama mock broker, to feed synthetic broker offsets,
+// groups and commits through the whole monitor pipeline without a real cluster. A test of package monitor
+// declares the topics with AddTopic, their log end offsets with SetLogsize, the groups with AddGroup and their
+// commits with Commit, then creates a client of the cluster:
+//
+//	client, err := NewKafkaClient(c.Config(), monitortest.ClusterName)
+//
+// client.RefreshMetaData() and client.getOffsets(ctx) run a sweep, and the setters change what the next one sees.
+package monitortest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/sundy-li/burrowx/config"
+)
+
+// ClusterName is the name of the fake cluster in Config
+const ClusterName = "mock"
+
+// Cluster is a single broker cluster whose every group has one member consuming all the partitions of its topics
+type Cluster struct {
+	t      sarama.TestReporter
+	broker *sarama.MockBroker
+
+	lock sync.Mutex
+	//topic => partition => log end offset
+	logsize map[string][]int64
+	//topic => partition => log start offset
+	logStart map[string][]int64
+	//group => topics
+	groups map[string][]string
+	//group => topic => partition => committed offset
+	commits map[string]map[string]map[int32]int64
+}
+
+func NewCluster(t sarama.TestReporter) *Cluster {
+	c := &Cluster{
+		t:        t,
+		broker:   sarama.NewMockBroker(t, 1),
+		logsize:  make(map[string][]int64),
+		logStart: make(map[string][]int64),
+		groups:   make(map[string][]string),
+		commits:  make(map[string]map[string]map[int32]int64),
+	}
+	c.update()
+	return c
+}
+
+// Addr is the address of the broker
+func (c *Cluster) Addr() string {
+	return c.broker.Addr()
+}
+
+// Config returns a config monitoring every topic and group of the cluster, in dry run so nothing is written to influxdb
+func (c *Cluster) Config() *config.Config {
+	doc := map[string]interface{}{
+		"general": map[string]interface{}{
+			"clientId":    "burrowx-test",
+			"topicFilter": ".*",
+			"groupFilter": ".*",
+			"dryRun":      true,
+		},
+		"kafka": map[string]interface{}{
+			ClusterName: map[string]interface{}{"brokers": c.Addr()},
+		},
+		"influxdb": map[string]interface{}{"hosts": "http://127.0.0.1:8086", "db": "burrowx"},
+	}
+	data, _ := json.Marshal(doc)
+	var cfg config.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		c.t.Fatal(err)
+	}
+	cfg.Init()
+	return &cfg
+}
+
+// AddTopic creates a topic whose partitions are empty
+func (c *Cluster) AddTopic(topic string, partitions int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.logsize[topic] = make([]int64, partitions)
+	c.logStart[topic] = make([]int64, partitions)
+	c.update()
+}
+
+// SetLogsize sets the log end offset of a partition
+func (c *Cluster) SetLogsize(topic string, partition int32, logsize int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.logsize[topic][partition] = logsize
+	c.update()
+}
+
+// SetLogStart sets the log start offset of a partition, e.g. after retention deleted its oldest segments
+func (c *Cluster) SetLogStart(topic string, partition int32, logStart int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.logStart[topic][partition] = logStart
+	c.update()
+}
+
+// AddGroup creates a stable group with one member consuming the topics
+func (c *Cluster) AddGroup(group string, topics ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.groups[group] = topics
+	if _, ok := c.commits[group]; !ok {
+		c.commits[group] = make(map[string]map[int32]int64)
+	}
+	c.update()
+}
+
+// RemoveGroup makes a group disappear, as if its last member left and its offsets expired
+func (c *Cluster) RemoveGroup(group string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.groups, group)
+	delete(c.commits, group)
+	c.update()
+}
+
+// Commit sets the committed offset of a group on a partition
+func (c *Cluster) Commit(group, topic string, partition int32, offset int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.commits[group][topic]; !ok {
+		c.commits[group][topic] = make(map[int32]int64)
+	}
+	c.commits[group][topic][partition] = offset
+	c.update()
+}
+
+func (c *Cluster) Close() {
+	c.broker.Close()
+}
+
+// update rebuilds the responses of the broker from the state, the broker serves them under its own lock
+func (c *Cluster) update() {
+	metadata := sarama.NewMockMetadataResponse(c.t).
+		SetBroker(c.broker.Addr(), c.broker.BrokerID()).
+		SetController(c.broker.BrokerID())
+	offsets := sarama.NewMockOffsetResponse(c.t)
+	for topic, partitions := range c.logsize {
+		for partition, logsize := range partitions {
+			metadata.SetLeader(topic, int32(partition), c.broker.BrokerID())
+			offsets.SetOffset(topic, int32(partition), sarama.OffsetNewest, logsize)
+			offsets.SetOffset(topic, int32(partition), sarama.OffsetOldest, c.logStart[topic][partition])
+		}
+	}
+
+	listGroups := sarama.NewMockListGroupsResponse(c.t)
+	describeGroups := sarama.NewMockDescribeGroupsResponse(c.t)
+	coordinator := sarama.NewMockFindCoordinatorResponse(c.t)
+	consumerMetadata := sarama.NewMockConsumerMetadataResponse(c.t)
+	offsetFetch := sarama.NewMockOffsetFetchResponse(c.t)
+	for group, topics := range c.groups {
+		listGroups.AddGroup(group, "consumer")
+		coordinator.SetCoordinator(sarama.CoordinatorGroup, group, c.broker)
+		consumerMetadata.SetCoordinator(group, c.broker)
+		describeGroups.AddGroupDescription(group, &sarama.GroupDescription{
+			GroupId:      group,
+			State:        "Stable",
+			ProtocolType: "consumer",
+			Protocol:     "range",
+			Members: map[string]*sarama.GroupMemberDescription{
+				group + "-member": {
+					ClientId:         group + "-client",
+					ClientHost:       "/127.0.0.1",
+					MemberMetadata:   memberMetadata(topics),
+					MemberAssignment: c.memberAssignment(topics),
+				},
+			},
+		})
+		for topic, partitions := range c.commits[group] {
+			for partition, offset := range partitions {
+				offsetFetch.SetOffset(group, topic, partition, offset, "", sarama.ErrNoError)
+			}
+		}
+	}
+	c.broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest":         metadata,
+		"OffsetRequest":           offsets,
+		"ListGroupsRequest":       listGroups,
+		"DescribeGroupsRequest":   describeGroups,
+		"FindCoordinatorRequest":  coordinator,
+		"ConsumerMetadataRequest": consumerMetadata,
+		"OffsetFetchRequest":      offsetFetch,
+	})
+}
+
+// memberMetadata encodes the ConsumerGroupMemberMetadata of a member subscribed to the topics
+func memberMetadata(topics []string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int16(0))
+	binary.Write(&buf, binary.BigEndian, int32(len(topics)))
+	for _, topic := range topics {
+		putString(&buf, topic)
+	}
+	binary.Write(&buf, binary.BigEndian, int32(-1))
+	return buf.Bytes()
+}
+
+// memberAssignment encodes the ConsumerGroupMemberAssignment of a member owning all the partitions of the topics
+func (c *Cluster) memberAssignment(topics []string) []byte {
+	sorted := append([]string(nil), topics...)
+	sort.Strings(sorted)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int16(0))
+	binary.Write(&buf, binary.BigEndian, int32(len(sorted)))
+	for _, topic := range sorted {
+		putString(&buf, topic)
+		partitions := len(c.logsize[topic])
+		binary.Write(&buf, binary.BigEndian, int32(partitions))
+		for partition := 0; partition < partitions; partition++ {
+			binary.Write(&buf, binary.BigEndian, int32(partition))
+		}
+	}
+	binary.Write(&buf, binary.BigEndian, int32(-1))
+	return buf.Bytes()
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, int16(len(s)))
+	buf.WriteString(s)
+}
@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// a mute can't last longer, so a forgotten one doesn't hide a group for good
+const maxMuteDuration = 7 * 24 * time.Hour
+
+// TopicMute excludes a topic of a group from the status of the group until Until, e.g. while the group
+// reprocesses it on purpose, its lag is still written but doesn't raise the status nor alert
+type TopicMute struct {
+	Cluster string `json:"cluster"`
+	Group   string `json:"group"`
+	Topic   string `json:"topic"`
+	// timestamp(ms) the mute ends
+	Until  int64  `json:"until"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// muted reports whether the topic of the group is muted at ts
+func (e *Evaluator) muted(group, topic string, ts int64) bool {
+	mute, ok := e.mutes[group][topic]
+	return ok && ts < mute.Until
+}
+
+// Mute mutes a topic of a group of a cluster until the timestamp(ms), at most 7 days from now
+func (f *Fetcher) Mute(cluster string, mute *TopicMute) (*TopicMute, error) {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Mute(mute)
+}
+
+// Unmute ends the mute of a topic of a group of a cluster
+func (f *Fetcher) Unmute(cluster, group, topic string) error {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return err
+	}
+	return cli.Unmute(group, topic)
+}
+
+// Mutes returns the mutes in effect of a cluster, of all clusters if empty
+func (f *Fetcher) Mutes(cluster string) []*TopicMute {
+	mutes := []*TopicMute{}
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			mutes = append(mutes, cli.Mutes()...)
+		}
+	}
+	return mutes
+}
+
+// Mute mutes the topic of the group from the next evaluation on, replacing its previous mute
+func (client *KafkaClient) Mute(mute *TopicMute) (*TopicMute, error) {
+	now := clockNow()
+	if mute.Group == "" || mute.Topic == "" {
+		return nil, errors.New("group and topic are required")
+	}
+	if mute.Until <= now.UnixNano()/int64(time.Millisecond) {
+		return nil, errors.New("the mute ends in the past")
+	}
+	if end := now.Add(maxMuteDuration).UnixNano() / int64(time.Millisecond); mute.Until > end {
+		return nil, fmt.Errorf("a mute ends within %v", maxMuteDuration)
+	}
+	m := *mute
+	m.Cluster = client.cluster
+	client.schemaUpdateMtx.Lock()
+	defer client.schemaUpdateMtx.Unlock()
+	client.pruneMutes(now)
+	if _, ok := client.evaluator.mutes[m.Group]; !ok {
+		client.evaluator.mutes[m.Group] = make(map[string]*TopicMute)
+	}
+	client.evaluator.mutes[m.Group][m.Topic] = &m
+	client.log.WithFields(logrus.Fields{"group": m.Group, "topic": m.Topic}).Warnf("Topic muted until %v: %s", msTime(m.Until), m.Reason)
+	return &m, nil
+}
+
+// Unmute ends the mute of the topic of the group from the next evaluation on
+func (client *KafkaClient) Unmute(group, topic string) error {
+	client.schemaUpdateMtx.Lock()
+	defer client.schemaUpdateMtx.Unlock()
+	client.pruneMutes(clockNow())
+	if _, ok := client.evaluator.mutes[group][topic]; !ok {
+		return fmt.Errorf("topic %s of group %s isn't muted", topic, group)
+	}
+	delete(client.evaluator.mutes[group], topic)
+	if len(client.evaluator.mutes[group]) == 0 {
+		delete(client.evaluator.mutes, group)
+	}
+	client.log.WithFields(logrus.Fields{"group": group, "topic": topic}).Warnf("Topic unmuted")
+	return nil
+}
+
+// Mutes returns the mutes in effect, the ones ending first first
+func (client *KafkaClient) Mutes() []*TopicMute {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+	now := clockNow().UnixNano() / int64(time.Millisecond)
+	var mutes []*TopicMute
+	for _, topics := range client.evaluator.mutes {
+		for _, mute := range topics {
+			if now < mute.Until {
+				m := *mute
+				mutes = append(mutes, &m)
+			}
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool { return mutes[i].Until < mutes[j].Until })
+	return mutes
+}
+
+// pruneMutes forgets the mutes ended, the caller must hold schemaUpdateMtx
+func (client *KafkaClient) pruneMutes(now time.Time) {
+	ts := now.UnixNano() / int64(time.Millisecond)
+	for group, topics := range client.evaluator.mutes {
+		for topic, mute := range topics {
+			if mute.Until <= ts {
+				delete(topics, topic)
+			}
+		}
+		if len(topics) == 0 {
+			delete(client.evaluator.mutes, group)
+		}
+	}
+}
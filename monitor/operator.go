@@ -0,0 +1,307 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+const (
+	// the token, CA and namespace of the service account of the pod
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// the KafkaMonitor resources, see deploy/kafkamonitor-crd.yaml
+	kafkaMonitorPath = "/apis/burrowx.io/v1alpha1/namespaces/%s/kafkamonitors"
+	// the operator lists the resources again after a failed watch this much later
+	OPERATOR_RETRY_SECOND = 5
+	// the reconcile gives up stopping a removed cluster after this
+	OPERATOR_STOP_TIMEOUT_SECOND = 30
+)
+
+// kubeClient is a minimal client of the kubernetes api from a pod, with the token and CA of its service account,
+// no kubernetes client is vendored
+type kubeClient struct {
+	base      string
+	tokenFile string
+	http      *http.Client
+}
+
+func newKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in kubernetes, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are unset")
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate in the CA of the service account")
+	}
+	return &kubeClient{
+		base:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		// no timeout, the watches stream
+		http: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+			Proxy:           http.ProxyFromEnvironment,
+		}},
+	}, nil
+}
+
+// get requests the path of the api, the token is read at every request since the kubelet rotates it
+func (k *kubeClient) get(ctx context.Context, path string) (*http.Response, error) {
+	token, err := ioutil.ReadFile(k.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", k.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", path, resp.Status, body)
+	}
+	return resp, nil
+}
+
+// KafkaMonitor is a resource of the KafkaMonitor CRD, a cluster whose name is the name of the resource
+type KafkaMonitor struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec *config.ClusterSpec `json:"spec"`
+}
+
+type kafkaMonitorList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []*KafkaMonitor `json:"items"`
+}
+
+type kafkaMonitorEvent struct {
+	// ADDED, MODIFIED, DELETED, BOOKMARK or ERROR
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Operator monitors the clusters of the KafkaMonitor resources of a namespace next to the ones of the config
+// file: it lists and watches the resources, and adds, restarts and removes their clients as they change. The
+// clusters of the config file are never changed, a resource with the name of one of them is rejected, so are
+// the invalid resources, the others are still reconciled.
+type Operator struct {
+	fetcher   *Fetcher
+	kube      *kubeClient
+	namespace string
+	log       *logrus.Entry
+
+	//name => spec of the resources, only changed by the watch goroutine
+	resources map[string]*config.ClusterSpec
+	//name => the json of the spec its running client was created from
+	applied map[string]string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewOperator(f *Fetcher) (*Operator, error) {
+	kube, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace := f.cfg.Kubernetes.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("no kubernetes.namespace and %v", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	return &Operator{
+		fetcher:   f,
+		kube:      kube,
+		namespace: namespace,
+		log:       mylog.Module("operator").WithField("namespace", namespace),
+		resources: make(map[string]*config.ClusterSpec),
+		applied:   make(map[string]string),
+	}, nil
+}
+
+// start reconciles the clusters until stop or until ctx is done
+func (o *Operator) start(ctx context.Context) {
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		for {
+			version, err := o.list(ctx)
+			if err == nil {
+				err = o.watch(ctx, version)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				o.log.Warnf("Cannot watch the KafkaMonitor resources: %v", err)
+			}
+			select {
+			case <-time.After(OPERATOR_RETRY_SECOND * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the reconciliation, the clusters it added are stopped by the fetcher
+func (o *Operator) stop() {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	o.wg.Wait()
+}
+
+// list replaces the resources with the ones listed and reconciles them, it returns the version to watch from
+func (o *Operator) list(ctx context.Context) (string, error) {
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	resp, err := o.kube.get(listCtx, fmt.Sprintf(kafkaMonitorPath, o.namespace))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var list kafkaMonitorList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	o.resources = make(map[string]*config.ClusterSpec, len(list.Items))
+	for _, item := range list.Items {
+		o.resources[item.Metadata.Name] = item.Spec
+	}
+	o.reconcile(ctx)
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes of the resources after version until the watch ends, the api server ends them
+// after a few minutes, or fails
+func (o *Operator) watch(ctx context.Context, version string) error {
+	resp, err := o.kube.get(ctx, fmt.Sprintf(kafkaMonitorPath, o.namespace)+"?watch=true&allowWatchBookmarks=true&resourceVersion="+version)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	// a resource may be large, the secrets of its profile included
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var event kafkaMonitorEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		if event.Type == "ERROR" {
+			// e.g. 410 Gone, the version is too old, listed again
+			return fmt.Errorf("watch error: %s", event.Object)
+		}
+		var resource KafkaMonitor
+		if err := json.Unmarshal(event.Object, &resource); err != nil {
+			return err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			o.resources[resource.Metadata.Name] = resource.Spec
+		case "DELETED":
+			delete(o.resources, resource.Metadata.Name)
+		default:
+			continue
+		}
+		o.reconcile(ctx)
+	}
+	return scanner.Err()
+}
+
+// reconcile adds the clients of the new resources, restarts the ones of the changed resources and removes
+// the ones of the deleted or invalid resources. A client which can't be created, e.g. its brokers are down, is
+// retried at the next change or list, the watches end after a few minutes.
+func (o *Operator) reconcile(ctx context.Context) {
+	base := o.fetcher.cfg
+	valid := make(map[string]*config.ClusterSpec, len(o.resources))
+	for name, spec := range o.resources {
+		if spec == nil {
+			o.log.Errorf("KafkaMonitor %s has no spec", name)
+			continue
+		}
+		if _, err := base.WithClusters(map[string]*config.ClusterSpec{name: spec}); err != nil {
+			o.log.Errorf("KafkaMonitor %s is invalid: %v", name, err)
+			continue
+		}
+		valid[name] = spec
+	}
+	cfg, err := base.WithClusters(valid)
+	if err != nil {
+		// e.g. two resources with the same alias
+		o.log.Errorf("Cannot monitor the KafkaMonitor resources together, keeping the clusters unchanged: %v", err)
+		return
+	}
+	o.fetcher.setConfig(cfg)
+	for name, applied := range o.applied {
+		spec, ok := valid[name]
+		if ok {
+			if data, _ := json.Marshal(spec); string(data) == applied {
+				continue
+			}
+		}
+		o.remove(ctx, name)
+	}
+	for name, spec := range valid {
+		if _, ok := o.applied[name]; ok {
+			continue
+		}
+		data, _ := json.Marshal(spec)
+		if _, err := o.fetcher.addClient(cfg, name); err != nil {
+			o.log.WithField("cluster", name).Errorf("Cannot monitor the cluster of KafkaMonitor %s: %v", name, err)
+			continue
+		}
+		o.applied[name] = string(data)
+		o.log.WithField("cluster", name).Infof("Monitoring the cluster of KafkaMonitor %s", name)
+	}
+}
+
+// remove stops the client of a resource
+func (o *Operator) remove(ctx context.Context, name string) {
+	stopCtx, cancel := context.WithTimeout(ctx, OPERATOR_STOP_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+	if err := o.fetcher.removeClient(stopCtx, name); err != nil {
+		o.log.WithField("cluster", name).Warnf("Cannot stop the cluster cleanly: %v", err)
+	}
+	delete(o.applied, name)
+	o.log.WithField("cluster", name).Infof("Stopped monitoring the cluster of KafkaMonitor %s", name)
+}
@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	"github.com/sundy-li/burrowx/monitor/monitortest"
+)
+
+// the watch events the fake api server streams, one list per watch
+var operatorWatches = []string{
+	`{"type":"MODIFIED","object":{"metadata":{"name":"crd","resourceVersion":"2"},"spec":{"kafka":{"brokers":"%[1]s","displayName":"CRD"}}}}`,
+	`{"type":"DELETED","object":{"metadata":{"name":"crd","resourceVersion":"3"},"spec":{"kafka":{"brokers":"%[1]s","displayName":"CRD"}}}}`,
+}
+
+func TestOperatorReconcile(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	c.AddTopic("orders", 1)
+
+	var lock sync.Mutex
+	var watches int
+	var auth string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path != "/apis/burrowx.io/v1alpha1/namespaces/monitoring/kafkamonitors" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("watch") != "true" {
+			// the resource named as the cluster of the config file is rejected
+			fmt.Fprintf(w, `{"metadata":{"resourceVersion":"1"},"items":[
+				{"metadata":{"name":"crd"},"spec":{"kafka":{"brokers":"%[1]s"},"alertRoutes":[{"notifiers":["slack"]}]}},
+				{"metadata":{"name":"%[2]s"},"spec":{"kafka":{"brokers":"%[1]s"}}}]}`, c.Addr(), monitortest.ClusterName)
+			return
+		}
+		fmt.Fprintf(w, operatorWatches[watches]+"\n", c.Addr())
+		watches++
+	}))
+	defer api.Close()
+	dir, err := ioutil.TempDir("", "operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := c.Config()
+	cfg.Kubernetes.WatchKafkaMonitors = true
+	ctx := context.Background()
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	f := &Fetcher{cfg: cfg, events: newEventHub(), current: cfg, tenants: NewTenants(cfg), ctx: ctx}
+	o := &Operator{
+		fetcher:   f,
+		kube:      &kubeClient{base: api.URL, tokenFile: token, http: api.Client()},
+		namespace: "monitoring",
+		log:       logrus.NewEntry(logger),
+		resources: make(map[string]*config.ClusterSpec),
+		applied:   make(map[string]string),
+	}
+	clusters := f.Clusters
+
+	version, err := o.list(ctx)
+	if err != nil || version != "1" {
+		t.Fatalf("listed version %q: %v", version, err)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("requested with the authorization %q", auth)
+	}
+	if infos := clusters(); len(infos) != 1 || infos[0].Cluster != "crd" || infos[0].DisplayName != "" {
+		t.Fatalf("clusters %+v after the list, want crd", infos)
+	}
+	if routes := f.current.Alerting.Routes; len(routes) != 1 || routes[0].Cluster != "crd" {
+		t.Errorf("alert routes %+v, want the one of crd", routes)
+	}
+	if err := o.watch(ctx, version); err != nil {
+		t.Fatal(err)
+	}
+	if infos := clusters(); len(infos) != 1 || infos[0].DisplayName != "CRD" {
+		t.Fatalf("clusters %+v after the change, want crd restarted with its display name", infos)
+	}
+	if err := o.watch(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if infos := clusters(); len(infos) != 0 {
+		t.Fatalf("clusters %+v after the deletion, want none", infos)
+	}
+}
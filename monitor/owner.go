@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+var (
+	// seconds between two reloads of general.ownersSource
+	OWNERS_REFRESH_SECOND = 60
+)
+
+type ownerRule struct {
+	team      string
+	cluster   string
+	group     *regexp.Regexp
+	notifiers []string
+}
+
+// owners maps the groups to their teams, from the config or from general.ownersSource which is reloaded
+// at the metadata refreshes, it's shared by the clusters
+type owners struct {
+	source string
+	log    *logrus.Entry
+
+	lock   sync.RWMutex
+	rules  []*ownerRule
+	loaded time.Time
+}
+
+var (
+	ownersLock sync.Mutex
+	//source => owners
+	sharedOwnersBySource = make(map[string]*owners)
+)
+
+// sharedOwners returns the owners of the config, the ones of a source are loaded once for all clusters
+func sharedOwners(cfg *config.Config) (*owners, error) {
+	if cfg.General.OwnersSource == "" {
+		o := &owners{}
+		return o, o.set(cfg.Owners)
+	}
+	ownersLock.Lock()
+	defer ownersLock.Unlock()
+	if o, ok := sharedOwnersBySource[cfg.General.OwnersSource]; ok {
+		return o, nil
+	}
+	o := &owners{source: cfg.General.OwnersSource, log: mylog.Module("owners")}
+	rules, err := loadOwnerRules(o.source)
+	if err == nil {
+		err = o.set(rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("owners %s: %v", o.source, err)
+	}
+	sharedOwnersBySource[o.source] = o
+	return o, nil
+}
+
+func (o *owners) set(rules []*config.OwnerRule) error {
+	if err := config.ValidateOwners(rules); err != nil {
+		return err
+	}
+	compiled := make([]*ownerRule, 0, len(rules))
+	for _, rule := range rules {
+		compiled = append(compiled, &ownerRule{team: rule.Team, cluster: rule.Cluster, group: regexp.MustCompile(rule.Group), notifiers: rule.Notifiers})
+	}
+	withWriteLock(&o.lock, func() {
+		o.rules = compiled
+		o.loaded = clockNow()
+	})
+	return nil
+}
+
+// refresh reloads the source if it's older than OWNERS_REFRESH_SECOND, the rules are kept if it fails
+func (o *owners) refresh() {
+	if o == nil || o.source == "" {
+		return
+	}
+	var loaded time.Time
+	withReadLock(&o.lock, func() { loaded = o.loaded })
+	if clockNow().Sub(loaded) < time.Duration(OWNERS_REFRESH_SECOND)*time.Second {
+		return
+	}
+	rules, err := loadOwnerRules(o.source)
+	if err == nil {
+		err = o.set(rules)
+	}
+	if err != nil {
+		o.log.Warnf("Cannot reload the owners from %s, keeping the previous ones: %v", o.source, err)
+		// don't retry every cluster at once
+		withWriteLock(&o.lock, func() { o.loaded = clockNow() })
+	}
+}
+
+// of returns the owner rule of a group, nil if no rule matches
+func (o *owners) of(cluster, group string) *ownerRule {
+	if o == nil {
+		return nil
+	}
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	for _, rule := range o.rules {
+		if (rule.cluster == "" || rule.cluster == cluster) && rule.group.MatchString(group) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// team returns the team owning a group, empty if it has none
+func (o *owners) team(cluster, group string) string {
+	if rule := o.of(cluster, group); rule != nil {
+		return rule.team
+	}
+	return ""
+}
+
+var ownersClient = &http.Client{Timeout: 10 * time.Second}
+
+// loadOwnerRules reads the json list of owner rules of a file or of an http(s) url
+func loadOwnerRules(source string) ([]*config.OwnerRule, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		var resp *http.Response
+		if resp, err = ownersClient.Get(source); err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s answered %s", source, resp.Status)
+		}
+		data, err = ioutil.ReadAll(resp.Body)
+	} else {
+		data, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rules []*config.OwnerRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,35 @@
+package monitor
+
+// addedPartitions returns topic => partitions of the topics whose partition count grew since the previous
+// refresh, the caller must hold schemaUpdateMtx
+func (client *KafkaClient) addedPartitions(previous map[string]int) map[string][]int32 {
+	added := make(map[string][]int32)
+	for topic, partitions := range client.topicMap {
+		count, ok := previous[topic]
+		if !ok || partitions <= count {
+			continue
+		}
+		for i := count; i < partitions; i++ {
+			added[topic] = append(added[topic], int32(i))
+		}
+	}
+	return added
+}
+
+// partitionsAdded emits the events of the added partitions and asks for a sweep without waiting for the
+// ticker, so their offsets are fetched and the commits of their consumers counted at once
+func (client *KafkaClient) partitionsAdded(added map[string][]int32) {
+	if len(added) == 0 {
+		return
+	}
+	events := make([]*Event, 0, len(added))
+	for topic, partitions := range added {
+		client.log.WithField("topic", topic).Infof("Partitions added: %v", partitions)
+		events = append(events, &Event{Type: EventPartitionsAdded, Topic: topic, Partitions: partitions})
+	}
+	client.emitEvents(events)
+	select {
+	case client.sweepRequests <- struct{}{}:
+	default:
+	}
+}
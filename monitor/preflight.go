@@ -0,0 +1,213 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sundy-li/burrowx/config"
+)
+
+// PreflightCheck is the result of one check of the preflight
+type PreflightCheck struct {
+	Cluster string `json:"cluster"`
+	Check   string `json:"check"`
+	OK      bool   `json:"ok"`
+	// a failed optional check only matters to a feature which isn't enabled
+	Optional bool   `json:"optional,omitempty"`
+	Detail   string `json:"detail"`
+	// round trip of the check, for the brokers
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+}
+
+// Ready reports whether no required check failed
+func Ready(checks []*PreflightCheck) bool {
+	for _, check := range checks {
+		if !check.OK && !check.Optional {
+			return false
+		}
+	}
+	return true
+}
+
+// Preflight connects to the clusters and their sinks as the daemon would, and checks the brokers answer and
+// the principal may list the topics and the groups, fetch the offsets of a group and read the offsets topics,
+// __consumer_offsets by default, so the missing ACLs show before the daemon runs blind
+func Preflight(cfg *config.Config, clusters []string) []*PreflightCheck {
+	var checks []*PreflightCheck
+	for _, cluster := range clusters {
+		checks = append(checks, preflightCluster(cfg, cluster)...)
+	}
+	return checks
+}
+
+func preflightCluster(cfg *config.Config, cluster string) []*PreflightCheck {
+	var checks []*PreflightCheck
+	add := func(check string, err error, detail string) *PreflightCheck {
+		c := &PreflightCheck{Cluster: cluster, Check: check, OK: err == nil, Detail: detail}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		checks = append(checks, c)
+		return c
+	}
+	client, err := NewKafkaClient(cfg, cluster)
+	if err != nil {
+		add("connect", err, "")
+		return checks
+	}
+	defer client.Close()
+	brokers := client.client.Brokers()
+	add("connect", nil, fmt.Sprintf("%d brokers", len(brokers)))
+
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i].ID() < brokers[j].ID() })
+	for _, broker := range brokers {
+		if ok, _ := broker.Connected(); !ok {
+			broker.Open(client.client.Config())
+		}
+		start := time.Now()
+		_, err := broker.GetMetadata(&sarama.MetadataRequest{})
+		latency := time.Since(start)
+		c := add(fmt.Sprintf("broker %d", broker.ID()), err, broker.Addr())
+		c.LatencyMs = float64(latency) / float64(time.Millisecond)
+	}
+
+	if err := client.client.RefreshMetadata(); err != nil {
+		add("list topics", err, "")
+	} else if topics, err := client.client.Topics(); err != nil {
+		add("list topics", err, "")
+	} else {
+		monitored := 0
+		for _, topic := range topics {
+			if client.monitorsTopic(topic) {
+				monitored++
+			}
+		}
+		if monitored == 0 {
+			add("list topics", fmt.Errorf("%d topics, none monitored, check the topicFilter and the Describe ACLs of the topics", len(topics)), "")
+		} else {
+			add("list topics", nil, fmt.Sprintf("%d topics, %d monitored", len(topics), monitored))
+		}
+	}
+
+	groups := 0
+	var listErr error
+	for _, broker := range brokers {
+		resp, err := broker.ListGroups(&sarama.ListGroupsRequest{})
+		if err == nil && resp.Err != sarama.ErrNoError {
+			err = resp.Err
+		}
+		if err != nil {
+			listErr = fmt.Errorf("broker %d: %v", broker.ID(), err)
+			if isAuthorizationError(err) {
+				listErr = fmt.Errorf("%v, check the Describe ACL of the cluster", listErr)
+			}
+			break
+		}
+		groups += len(resp.Groups)
+	}
+	add("list groups", listErr, fmt.Sprintf("%d groups", groups))
+
+	client.RefreshMetaData()
+	detail, err := client.preflightOffsetFetch()
+	add("fetch offsets", err, detail)
+
+	// the offsets topics are only read by the commit latency and the backfill, unless they're configured
+	required := cfg.General.CommitLatency || cfg.General.BackfillMaxHours > 0 || customOffsetsTopics(cfg, cluster)
+	for _, ot := range client.offsetsTopics {
+		c := add("read "+ot.name, client.preflightOffsetsTopic(ot.name), "")
+		c.Optional = !required
+		if c.OK {
+			c.Detail = "for general.commitLatency and general.backfillMaxHours"
+		}
+	}
+
+	if !client.importer.dryRun {
+		_, _, err := client.importer.influxdb.Ping(5 * time.Second)
+		add("influxdb", err, client.importer.influx.Hosts)
+	}
+	sinks, err := newSinks(cfg, cluster)
+	names := make([]string, 0, len(sinks))
+	for _, sink := range sinks {
+		names = append(names, sink.Name())
+		sink.Close()
+	}
+	if err == nil && len(names) == 0 {
+		names = append(names, "none")
+	}
+	add("sinks", err, strings.Join(names, ", "))
+	return checks
+}
+
+// preflightOffsetFetch fetches the committed offsets of the first group consuming a monitored topic, which
+// needs the Describe ACL of the group
+func (client *KafkaClient) preflightOffsetFetch() (string, error) {
+	var snap *sweepSnapshot
+	withReadLock(client.schemaUpdateMtx, func() {
+		snap = client.snapshot()
+	})
+	topics := make([]string, 0, len(snap.topic2Consumer))
+	for topic, consumers := range snap.topic2Consumer {
+		if len(consumers) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return "no group consumes a monitored topic", nil
+	}
+	sort.Strings(topics)
+	topic, group := topics[0], snap.topic2Consumer[topics[0]][0]
+	blocks, err := client.fetchCommittedOffsets(context.Background(), group, topic, snap.topicMap[topic])
+	if err != nil {
+		return "", fmt.Errorf("group %s: %v", group, err)
+	}
+	for _, block := range blocks {
+		if isAuthorizationError(block.Err) {
+			return "", fmt.Errorf("group %s: %v, check the Describe ACLs of the group and topic", group, block.Err)
+		}
+	}
+	return fmt.Sprintf("group %s, topic %s", group, topic), nil
+}
+
+// customOffsetsTopics tells whether the offsets topics of a cluster are configured, other than __consumer_offsets
+// in the binary format
+func customOffsetsTopics(cfg *config.Config, cluster string) bool {
+	topics := cfg.Kafka[cluster].OffsetsTopics
+	return len(topics) != 1 || topics[0].Name != "__consumer_offsets" || topics[0].Codec != "binary"
+}
+
+// preflightOffsetsTopic fetches from the first partition of an offsets topic, which needs its Read ACL
+func (client *KafkaClient) preflightOffsetsTopic(topic string) error {
+	partitions, err := client.client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("the topic %s has no partition", topic)
+	}
+	partition := partitions[0]
+	leader, err := client.client.Leader(topic, partition)
+	if err != nil {
+		return err
+	}
+	offset, err := client.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	request := &sarama.FetchRequest{}
+	request.AddBlock(topic, partition, offset, 1024)
+	response, err := leader.Fetch(request)
+	if err != nil {
+		return err
+	}
+	if block := response.GetBlock(topic, partition); block != nil && block.Err != sarama.ErrNoError {
+		if isAuthorizationError(block.Err) {
+			return fmt.Errorf("%v, check the Read ACL of the topic", block.Err)
+		}
+		return block.Err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+)
+
+// Rule is a proposed alert condition, it fires for the groups matching Group (all if empty) whose total lag is above
+// MaxTotalLag, time lag above MaxTimeLag, or status at least MinStatus, in each of their last For evaluations
+type Rule struct {
+	Group       string  `json:"group"`
+	MaxTotalLag int64   `json:"max_total_lag"`
+	MaxTimeLag  float64 `json:"max_time_lag"`
+	MinStatus   *Status `json:"min_status"`
+	For         int     `json:"for"`
+}
+
+// RuleMatch is a group a rule would fire for, with its values at the last evaluation
+type RuleMatch struct {
+	Cluster  string  `json:"cluster"`
+	Group    string  `json:"group"`
+	Status   Status  `json:"status"`
+	TotalLag int64   `json:"total_lag"`
+	TimeLag  float64 `json:"time_lag"`
+	// timestamp(ms) of the oldest evaluation of the window the rule held since
+	Since int64 `json:"since"`
+}
+
+// Preview returns the groups a rule would fire for now, from the evaluation windows of the groups
+func (f *Fetcher) Preview(rule *Rule) ([]*RuleMatch, error) {
+	if rule.MaxTotalLag <= 0 && rule.MaxTimeLag <= 0 && rule.MinStatus == nil {
+		return nil, errors.New("the rule has no condition")
+	}
+	if rule.For <= 0 {
+		rule.For = 1
+	}
+	if rule.For > EVALUATION_WINDOW {
+		return nil, errors.New("for is longer than the evaluation window")
+	}
+	group, err := regexp.Compile(rule.Group)
+	if err != nil {
+		return nil, err
+	}
+	matches := []*RuleMatch{}
+	for _, cli := range f.allClients() {
+		matches = append(matches, cli.preview(rule, group)...)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Since < matches[j].Since })
+	return matches, nil
+}
+
+func (client *KafkaClient) preview(rule *Rule, group *regexp.Regexp) []*RuleMatch {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	var matches []*RuleMatch
+	for name, window := range client.evaluator.windows {
+		if !group.MatchString(name) || len(window) < rule.For {
+			continue
+		}
+		var match *RuleMatch
+		firing := true
+		for i := len(window) - 1; i >= len(window)-rule.For; i-- {
+			eval := window[i]
+			lag := windowTimeLag(window[:i+1])
+			if !(rule.MaxTotalLag > 0 && eval.TotalLag > rule.MaxTotalLag) &&
+				!(rule.MaxTimeLag > 0 && lag > rule.MaxTimeLag) &&
+				!(rule.MinStatus != nil && eval.Status >= *rule.MinStatus) {
+				firing = false
+				break
+			}
+			if match == nil {
+				match = &RuleMatch{Cluster: client.cluster, Group: name, Status: eval.Status, TotalLag: eval.TotalLag, TimeLag: lag}
+			}
+			match.Since = eval.Timestamp
+		}
+		if firing {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// windowTimeLag is the time lag of the most lagging partition at the last evaluation of the window
+func windowTimeLag(window []*Evaluation) float64 {
+	var max float64
+	for topic, partitions := range window[len(window)-1].offsets {
+		for partition := range partitions {
+			if lag := timeLag(window, topic, partition); lag > max {
+				max = lag
+			}
+		}
+	}
+	return max
+}
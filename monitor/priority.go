@@ -0,0 +1,41 @@
+package monitor
+
+// alertingGroups returns the groups whose points the importer writes first: the groups not OK at the last
+// evaluation and the groups with an owner, whose status changes are alerted
+func (client *KafkaClient) alertingGroups() map[string]bool {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+	groups := make(map[string]bool)
+	for _, status := range client.statuses {
+		if status.Status != StatusOK || status.Team != "" || len(status.Notifiers) > 0 {
+			groups[status.Group] = true
+		}
+	}
+	return groups
+}
+
+// queueOffsets queues the offsets of the alerting groups to the urgent queue of the importer, drained first,
+// waiting for room if it's full, and the others to its queue if there is room left. It returns the offsets
+// deferred until after the evaluation, so a slow influxdb doesn't hold back the alerts.
+func (client *KafkaClient) queueOffsets(groupOffsets map[string][]*ConsumerFullOffset) []*ConsumerFullOffset {
+	alerting := client.alertingGroups()
+	var others, deferred []*ConsumerFullOffset
+	for group, msgs := range groupOffsets {
+		if !alerting[group] {
+			others = append(others, msgs...)
+			continue
+		}
+		for _, msg := range msgs {
+			client.importer.saveUrgentMsg(msg)
+		}
+	}
+	for _, msg := range others {
+		if !client.importer.trySaveMsg(msg) {
+			deferred = append(deferred, msg)
+		}
+	}
+	if len(deferred) > 0 {
+		client.importer.deferredRecords.Inc(int64(len(deferred)))
+	}
+	return deferred
+}
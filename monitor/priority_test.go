@@ -0,0 +1,28 @@
+package monitor
+
+import "testing"
+
+func TestReceiveUrgentFirst(t *testing.T) {
+	urgent := make(chan *ConsumerFullOffset, 4)
+	msgs := make(chan *ConsumerFullOffset, 4)
+	msgs <- &ConsumerFullOffset{Group: "ephemeral"}
+	urgent <- &ConsumerFullOffset{Group: "alerting"}
+	msgs <- &ConsumerFullOffset{Group: "other"}
+	close(urgent)
+	close(msgs)
+
+	var groups []string
+	for {
+		msg, ok := receive(&urgent, &msgs)
+		if !ok {
+			break
+		}
+		groups = append(groups, msg.Group)
+	}
+	if len(groups) != 3 || groups[0] != "alerting" || groups[1] != "ephemeral" || groups[2] != "other" {
+		t.Errorf("received %v, want the alerting group first then the others in order", groups)
+	}
+	if urgent != nil || msgs != nil {
+		t.Error("the drained queues aren't reset")
+	}
+}
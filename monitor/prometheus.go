@@ -0,0 +1,250 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// the upper bounds, in seconds, of the buckets of the canary end to end latency
+var CANARY_LATENCY_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// latencyHistogram counts the observations of a latency in fixed buckets, and keeps the last traced observation
+// of every bucket as its exemplar
+type latencyHistogram struct {
+	bounds  []float64
+	created time.Time
+
+	lock sync.Mutex
+	// the last is +Inf
+	counts    []uint64
+	sum       float64
+	exemplars []*exemplar
+}
+
+// exemplar is an observation of a traced operation, e.g. the canary message of a slow end to end latency
+type exemplar struct {
+	traceID string
+	value   float64
+	ts      time.Time
+}
+
+func newLatencyHistogram(bounds []float64) *latencyHistogram {
+	return &latencyHistogram{
+		bounds:    bounds,
+		created:   time.Now(),
+		counts:    make([]uint64, len(bounds)+1),
+		exemplars: make([]*exemplar, len(bounds)+1),
+	}
+}
+
+// observe counts a latency(s), traceID is the trace of the observed operation, empty if it isn't traced
+func (h *latencyHistogram) observe(value float64, traceID string) {
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[i]++
+	h.sum += value
+	if traceID != "" {
+		h.exemplars[i] = &exemplar{traceID: traceID, value: value, ts: time.Now()}
+	}
+}
+
+// metricFamily is a metric of the exposition, with the samples of all clusters
+type metricFamily struct {
+	name string
+	// counter, gauge, summary or histogram
+	typ     string
+	unit    string
+	help    string
+	samples []string
+}
+
+// metricsWriter writes the metrics in the Prometheus text format or in OpenMetrics, which adds the created
+// timestamps of the counters, summaries and histograms, the exemplars of the histogram buckets and the units
+type metricsWriter struct {
+	openMetrics bool
+	families    map[string]*metricFamily
+}
+
+func (mw *metricsWriter) family(name, typ, unit, help string) *metricFamily {
+	if f, ok := mw.families[name]; ok {
+		return f
+	}
+	f := &metricFamily{name: name, typ: typ, unit: unit, help: help}
+	mw.families[name] = f
+	return f
+}
+
+func (mw *metricsWriter) sample(f *metricFamily, suffix string, labels []string, value string) {
+	f.samples = append(f.samples, f.name+suffix+formatLabels(labels)+" "+value)
+}
+
+// created adds the created timestamp of a counter, a summary or a histogram, OpenMetrics only
+func (mw *metricsWriter) created(f *metricFamily, labels []string, created time.Time) {
+	if mw.openMetrics {
+		mw.sample(f, "_created", labels, formatTimestamp(created))
+	}
+}
+
+func (mw *metricsWriter) gauge(name, help string, labels []string, value float64) {
+	mw.sample(mw.family(name, "gauge", "", help), "", labels, formatFloat(value))
+}
+
+func (mw *metricsWriter) counter(name, help string, labels []string, value float64, created time.Time) {
+	f := mw.family(name, "counter", "", help)
+	mw.sample(f, "_total", labels, formatFloat(value))
+	mw.created(f, labels, created)
+}
+
+func (mw *metricsWriter) summary(name, help string, labels []string, t metrics.Timer, created time.Time) {
+	f := mw.family(name, "summary", "seconds", help)
+	s := t.Snapshot()
+	for _, q := range []float64{0.5, 0.99} {
+		mw.sample(f, "", append(labels, "quantile", formatFloat(q)), formatFloat(s.Percentile(q)/1e9))
+	}
+	mw.sample(f, "_sum", labels, formatFloat(float64(s.Sum())/1e9))
+	mw.sample(f, "_count", labels, strconv.FormatInt(s.Count(), 10))
+	mw.created(f, labels, created)
+}
+
+func (mw *metricsWriter) histogram(name, help string, labels []string, h *latencyHistogram) {
+	f := mw.family(name, "histogram", "seconds", help)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var count uint64
+	for i, n := range h.counts {
+		count += n
+		le := math.Inf(1)
+		if i < len(h.bounds) {
+			le = h.bounds[i]
+		}
+		value := strconv.FormatUint(count, 10)
+		if e := h.exemplars[i]; e != nil && mw.openMetrics {
+			value += " # " + formatLabels([]string{"trace_id", e.traceID}) + " " + formatFloat(e.value) + " " + formatTimestamp(e.ts)
+		}
+		mw.sample(f, "_bucket", append(labels, "le", formatFloat(le)), value)
+	}
+	mw.sample(f, "_sum", labels, formatFloat(h.sum))
+	mw.sample(f, "_count", labels, strconv.FormatUint(count, 10))
+	mw.created(f, labels, h.created)
+}
+
+func (mw *metricsWriter) write(w io.Writer) error {
+	names := make([]string, 0, len(mw.families))
+	for name := range mw.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := mw.families[name]
+		// in the Prometheus text format the family of a counter is named as its samples
+		typeName := f.name
+		if f.typ == "counter" && !mw.openMetrics {
+			typeName += "_total"
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", typeName, f.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", typeName, f.typ)
+		if f.unit != "" && mw.openMetrics {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", f.name, f.unit)
+		}
+		for _, s := range f.samples {
+			bw.WriteString(s)
+			bw.WriteByte('\n')
+		}
+	}
+	if mw.openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats the name, value pairs of labels
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatTimestamp formats a time as the seconds since the epoch, to the millisecond
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano()/int64(time.Millisecond))/1000, 'f', 3, 64)
+}
+
+// metricName turns the name of an internal metric into a Prometheus one, offset-sweep => burrowx_offset_sweep
+func metricName(name string) string {
+	return "burrowx_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// WriteMetrics writes the metrics of the clusters for Prometheus, in OpenMetrics if openMetrics: the lag and
+// the status of the groups of the tenants allows, and the internal metrics and the end to end latency of the
+// canary of the clusters of the tenants allows, whose buckets link to the trace of their last traced message
+func (f *Fetcher) WriteMetrics(w io.Writer, openMetrics bool, allows func(tenant string) bool) error {
+	mw := &metricsWriter{openMetrics: openMetrics, families: make(map[string]*metricFamily)}
+	tenants := f.Tenants()
+	for _, cli := range f.allClients() {
+		for _, s := range cli.Statuses() {
+			if !allows(s.Tenant) {
+				continue
+			}
+			labels := []string{"cluster", s.Cluster, "group", s.Group}
+			mw.gauge("burrowx_group_lag", "Total lag of the group over its partitions", labels, float64(s.TotalLag))
+			mw.gauge("burrowx_group_max_lag", "Lag of the most lagging partition of the group", labels, float64(s.MaxLag))
+			mw.gauge("burrowx_group_time_lag_seconds", "Estimated seconds the most lagging partition of the group is behind", labels, s.TimeLag)
+			mw.gauge("burrowx_group_status", "Status of the group, 0 OK, 1 WARN, 2 REWIND, 3 STALL, 4 ERR", labels, float64(s.Status))
+		}
+		if !allows(tenants.Cluster(cli.cluster)) {
+			continue
+		}
+		labels := []string{"cluster", cli.cluster}
+		cli.metrics.Each(func(name string, metric interface{}) {
+			help := "Internal metric " + name + " of burrowx"
+			switch m := metric.(type) {
+			case metrics.Counter:
+				mw.counter(metricName(name), help, labels, float64(m.Count()), cli.started)
+			case metrics.Gauge:
+				mw.gauge(metricName(name), help, labels, float64(m.Value()))
+			case metrics.Timer:
+				mw.summary(metricName(name)+"_seconds", help, labels, m, cli.started)
+			}
+		})
+		if cli.canary != nil {
+			mw.histogram("burrowx_canary_e2e_latency_seconds", "End to end latency of the canary messages, produced to consumed",
+				labels, cli.canary.latency)
+		}
+	}
+	return mw.write(w)
+}
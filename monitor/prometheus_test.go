@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sundy-li/burrowx/monitor/monitortest"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	c := monitortest.NewCluster(t)
+	defer c.Close()
+	c.AddTopic("payments", 2)
+	c.SetLogsize("payments", 0, 50)
+	c.SetLogsize("payments", 1, 50)
+	// caught up, and without the commit of a partition
+	c.AddGroup("ledger", "payments")
+	c.Commit("ledger", "payments", 0, 50)
+	c.Commit("ledger", "payments", 1, 50)
+	c.AddGroup("audit", "payments")
+	c.Commit("audit", "payments", 0, 20)
+
+	cfg := c.Config()
+	client, err := NewKafkaClient(cfg, monitortest.ClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.RefreshMetaData()
+	if err := client.getOffsets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	latency := newLatencyHistogram([]float64{0.1, 1})
+	latency.observe(0.05, "")
+	latency.observe(0.5, "4bf92f3577b34da6a3ce929d0e0e4736")
+	client.canary = &Canary{latency: latency}
+	// the canary is never started
+	defer func() { client.canary = nil }()
+	f := &Fetcher{cfg: cfg, clients: []*KafkaClient{client}, current: cfg, tenants: NewTenants(cfg)}
+	all := func(string) bool { return true }
+
+	var text bytes.Buffer
+	if err := f.WriteMetrics(&text, false, all); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`burrowx_group_lag{cluster="mock",group="ledger"} 0`,
+		`burrowx_group_lag{cluster="mock",group="audit"} 30`,
+		`burrowx_group_status{cluster="mock",group="ledger"} 0`,
+		`# TYPE burrowx_broker_request_failures_total counter`,
+		`burrowx_canary_e2e_latency_seconds_bucket{cluster="mock",le="1"} 2`,
+		`burrowx_canary_e2e_latency_seconds_count{cluster="mock"} 2`,
+	} {
+		if !strings.Contains(text.String(), line+"\n") {
+			t.Errorf("no %q in the Prometheus text format:\n%s", line, text.String())
+		}
+	}
+	if strings.Contains(text.String(), "_created") || strings.Contains(text.String(), "trace_id") {
+		t.Errorf("created timestamps or exemplars in the Prometheus text format:\n%s", text.String())
+	}
+
+	var om bytes.Buffer
+	if err := f.WriteMetrics(&om, true, all); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`# TYPE burrowx_broker_request_failures counter`,
+		`burrowx_broker_request_failures_created{cluster="mock"} `,
+		`# UNIT burrowx_canary_e2e_latency_seconds seconds`,
+		`burrowx_canary_e2e_latency_seconds_bucket{cluster="mock",le="0.1"} 1` + "\n",
+		`burrowx_canary_e2e_latency_seconds_bucket{cluster="mock",le="1"} 2 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.5 `,
+		`burrowx_canary_e2e_latency_seconds_created{cluster="mock"} `,
+	} {
+		if !strings.Contains(om.String(), line) {
+			t.Errorf("no %q in OpenMetrics:\n%s", line, om.String())
+		}
+	}
+	if !strings.HasSuffix(om.String(), "# EOF\n") {
+		t.Errorf("OpenMetrics without # EOF:\n%s", om.String())
+	}
+
+	var scoped bytes.Buffer
+	if err := f.WriteMetrics(&scoped, true, func(tenant string) bool { return tenant == "payments" }); err != nil {
+		t.Fatal(err)
+	}
+	if scoped.String() != "# EOF\n" {
+		t.Errorf("metrics of other tenants:\n%s", scoped.String())
+	}
+}
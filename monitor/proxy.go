@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+func init() {
+	proxy.RegisterDialerType("http", newHTTPConnectDialer)
+}
+
+// proxyDialer returns the dialer to the brokers through the proxy, socks5:// or http:// for a CONNECT proxy
+func proxyDialer(rawurl string, forward proxy.Dialer) (proxy.Dialer, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return proxy.FromURL(u, forward)
+}
+
+// httpProxy returns the proxy function of the http clients, net/http handles both http:// and socks5:// proxies
+func httpProxy(rawurl string) (func(*http.Request) (*url.URL, error), error) {
+	if rawurl == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(u), nil
+}
+
+// httpConnectDialer tunnels the broker connections through an http proxy with CONNECT
+type httpConnectDialer struct {
+	addr    string
+	auth    string
+	forward proxy.Dialer
+}
+
+func newHTTPConnectDialer(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	d := &httpConnectDialer{addr: u.Host, forward: forward}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		d.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+	}
+	return d, nil
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial(network, d.addr)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.auth != "" {
+		req.Header.Set("Proxy-Authorization", d.auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// kafka brokers never speak first, so nothing is buffered past the response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", d.addr, addr, resp.Status)
+	}
+	return conn, nil
+}
@@ -0,0 +1,177 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSink("pulsar", newPulsarSink)
+}
+
+// the schema of the keys and values of the messages, the json records as strings
+const pulsarStringSchema = `{"type":"STRING","schema":"","properties":{}}`
+
+// pulsarSink publishes the lag records of every sweep, the offsets of the groups per topic and their statuses,
+// to a Pulsar topic, like the kafka sink. No pulsar client is vendored, it posts the batches of messages to
+// the REST producer of the brokers (Pulsar 2.8+)
+type pulsarSink struct {
+	// the REST url of the topic
+	url       string
+	token     string
+	batchSize int
+	http      *http.Client
+}
+
+type pulsarMessage struct {
+	Key       string `json:"key"`
+	Payload   string `json:"payload"`
+	EventTime int64  `json:"eventTime"`
+}
+
+type pulsarMessages struct {
+	KeySchema    string           `json:"keySchema"`
+	ValueSchema  string           `json:"valueSchema"`
+	ProducerName string           `json:"producerName"`
+	Messages     []*pulsarMessage `json:"messages"`
+}
+
+type pulsarResults struct {
+	MessagePublishResults []struct {
+		ErrorCode int    `json:"errorCode"`
+		Error     string `json:"error"`
+	} `json:"messagePublishResults"`
+}
+
+// newPulsarSink takes the serviceUrl option of the brokers, e.g. https://pulsar:8443, the topic, e.g.
+// persistent://public/default/burrowx-lag, the token of the token authentication, tlsCaFile for a private CA,
+// and batchSize, the messages per request, 500 by default
+func newPulsarSink(cluster string, options map[string]string) (Sink, error) {
+	serviceUrl := strings.TrimSuffix(options["serviceUrl"], "/")
+	if serviceUrl == "" {
+		return nil, errors.New("no serviceUrl")
+	}
+	topic := options["topic"]
+	if topic == "" {
+		return nil, errors.New("no topic")
+	}
+	// persistent://tenant/namespace/topic => persistent/tenant/namespace/topic
+	path := strings.Replace(topic, "://", "/", 1)
+	if !strings.HasPrefix(topic, "persistent://") && !strings.HasPrefix(topic, "non-persistent://") {
+		path = "persistent/" + topic
+	}
+	s := &pulsarSink{url: serviceUrl + "/topics/" + path, token: options["token"], batchSize: 500}
+	if v := options["batchSize"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid batchSize %s", v)
+		}
+		s.batchSize = n
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if file := options["tlsCaFile"]; file != "" {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", file)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	s.http = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return s, nil
+}
+
+func (s *pulsarSink) Name() string { return "pulsar" }
+
+func (s *pulsarSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	var batch []*pulsarMessage
+	add := func(key string, ts int64, v interface{}) error {
+		data, err := EncodeJSON(v)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, &pulsarMessage{Key: key, Payload: string(data), EventTime: ts})
+		if len(batch) >= s.batchSize {
+			err = s.publish(batch)
+			batch = nil
+		}
+		return err
+	}
+	for group, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			if err := add(cluster+"/"+group+"/"+msg.Topic, msg.Timestamp, msg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, status := range statuses {
+		if err := add(cluster+"/"+status.Group, status.Timestamp, status); err != nil {
+			return err
+		}
+	}
+	if len(batch) > 0 {
+		return s.publish(batch)
+	}
+	return nil
+}
+
+// publish posts a batch of messages to the REST producer
+func (s *pulsarSink) publish(batch []*pulsarMessage) error {
+	data, err := json.Marshal(&pulsarMessages{
+		KeySchema:    pulsarStringSchema,
+		ValueSchema:  pulsarStringSchema,
+		ProducerName: "burrowx",
+		Messages:     batch,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("pulsar answered %s: %s", resp.Status, body)
+	}
+	var results pulsarResults
+	if err := json.Unmarshal(body, &results); err != nil {
+		// accepted, without the results of the messages
+		return nil
+	}
+	failed := 0
+	var last string
+	for _, r := range results.MessagePublishResults {
+		if r.ErrorCode != 0 {
+			failed++
+			last = r.Error
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d messages not published: %s", failed, len(batch), last)
+	}
+	return nil
+}
+
+func (s *pulsarSink) Close() error { return nil }
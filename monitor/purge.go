@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"fmt"
+)
+
+// Purge drops everything known about a group of a cluster, so a decommissioned group disappears now instead of
+// when its pairings expire, a group which still has members comes back at the next metadata refresh
+func (f *Fetcher) Purge(cluster, group string) error {
+	cli, err := f.client(cluster)
+	if err != nil {
+		return err
+	}
+	return cli.Purge(group)
+}
+
+// Purge drops the group from the metadata, the evaluation windows, the baselines, the SLO buckets and the statuses
+func (client *KafkaClient) Purge(group string) error {
+	client.schemaUpdateMtx.Lock()
+	defer client.schemaUpdateMtx.Unlock()
+
+	_, found := client.groupSeen[group]
+	if _, ok := client.evaluator.windows[group]; ok {
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("unknown group %s", group)
+	}
+
+	for topic, consumers := range client.topic2Consumer {
+		kept := consumers[:0]
+		for _, consumer := range consumers {
+			if consumer != group {
+				kept = append(kept, consumer)
+			}
+		}
+		client.topic2Consumer[topic] = kept
+	}
+	delete(client.groupSeen, group)
+	delete(client.groupState, group)
+	delete(client.partitionOwner, group)
+	delete(client.members, group)
+	delete(client.groupClients, group)
+	delete(client.emptySince, group)
+	client.rebalances.forget(group)
+	delete(client.evaluator.windows, group)
+	delete(client.evaluator.baselines, group)
+	delete(client.evaluator.staleCounts, group)
+	for _, slo := range client.slos.slos {
+		delete(slo.buckets, group)
+	}
+	statuses := make([]*GroupStatus, 0, len(client.statuses))
+	for _, status := range client.statuses {
+		if status.Group != group {
+			statuses = append(statuses, status)
+		}
+	}
+	client.statuses = statuses
+	client.importer.filter.forget(group)
+	client.importer.sampler.forget(group)
+	client.log.WithField("group", group).Warnf("Group purged")
+	return nil
+}
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+var (
+	// identical warnings are logged at most once per interval
+	WARN_RATE_LIMIT_SECOND = 60
+)
+
+// warnLimiter rate limits repeated warnings by key, the suppressed ones are summarized in the next logged line
+type warnLimiter struct {
+	lock       sync.Mutex
+	interval   time.Duration
+	lastPurge  time.Time
+	entries    map[string]*limitedWarn
+	suppressed metrics.Counter
+}
+
+type limitedWarn struct {
+	last       time.Time
+	suppressed int
+}
+
+func newWarnLimiter(registry metrics.Registry) *warnLimiter {
+	return &warnLimiter{
+		interval:   time.Duration(WARN_RATE_LIMIT_SECOND) * time.Second,
+		lastPurge:  clockNow(),
+		entries:    make(map[string]*limitedWarn),
+		suppressed: metrics.GetOrRegisterCounter("suppressed-warnings", registry),
+	}
+}
+
+// warnf logs the warning unless one with the same key was logged in the interval
+func (l *warnLimiter) warnf(log *logrus.Entry, key string, format string, args ...interface{}) {
+	now := clockNow()
+	l.lock.Lock()
+	if now.Sub(l.lastPurge) > l.interval {
+		for k, e := range l.entries {
+			if now.Sub(e.last) > l.interval && e.suppressed == 0 {
+				delete(l.entries, k)
+			}
+		}
+		l.lastPurge = now
+	}
+	e, ok := l.entries[key]
+	if ok && now.Sub(e.last) < l.interval {
+		e.suppressed++
+		l.lock.Unlock()
+		l.suppressed.Inc(1)
+		return
+	}
+	suppressed := 0
+	if ok {
+		suppressed = e.suppressed
+	}
+	l.entries[key] = &limitedWarn{last: now}
+	l.lock.Unlock()
+
+	msg := fmt.Sprintf(format, args...)
+	if suppressed > 0 {
+		msg = fmt.Sprintf("%s (%d similar messages suppressed)", msg, suppressed)
+	}
+	log.Warn(msg)
+}
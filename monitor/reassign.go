@@ -0,0 +1,46 @@
+package monitor
+
+// updateReassigning marks the partitions being reassigned, the caller must hold schemaUpdateMtx.
+// The vendored sarama has no ListPartitionReassignments, but while a partition moves its metadata lists
+// the union of its old and new replicas, so a partition with more replicas than most partitions of its
+// topic is being reassigned, which misses the topics whose partitions all move at once
+func (client *KafkaClient) updateReassigning() {
+	reassigning := make(map[string]map[int32]bool)
+	count := 0
+	for topic, partitions := range client.topicMap {
+		replicas := make([]int, partitions)
+		// replicas => partitions
+		factors := make(map[int]int)
+		for i := 0; i < partitions; i++ {
+			ids, err := client.client.Replicas(topic, int32(i))
+			if err != nil {
+				continue
+			}
+			replicas[i] = len(ids)
+			factors[len(ids)]++
+		}
+		factor := 0
+		for f, n := range factors {
+			if n > factors[factor] || (n == factors[factor] && f < factor) {
+				factor = f
+			}
+		}
+		for i, n := range replicas {
+			if n > factor {
+				if _, ok := reassigning[topic]; !ok {
+					reassigning[topic] = make(map[int32]bool)
+				}
+				reassigning[topic][int32(i)] = true
+				count++
+			}
+		}
+	}
+	previous := 0
+	for _, partitions := range client.reassigning {
+		previous += len(partitions)
+	}
+	if count != previous {
+		client.log.Infof("%d partitions of %d topics are being reassigned", count, len(reassigning))
+	}
+	client.reassigning = reassigning
+}
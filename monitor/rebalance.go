@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// rebalanceTracker counts the rebalances of the groups, DescribeGroups doesn't return the generation of a group
+// so a rebalance is observed as a change of its members, or the group caught rebalancing, at a metadata refresh
+type rebalanceTracker struct {
+	// rebalances within window above which an OK group becomes WARN, disabled if 0
+	threshold int
+	window    int64
+	//group => sorted member ids at the last refresh
+	members map[string]string
+	//group => timestamps(ms) of the rebalances within the window, oldest first
+	rebalances map[string][]int64
+}
+
+func newRebalanceTracker(threshold, minutes int) *rebalanceTracker {
+	return &rebalanceTracker{
+		threshold:  threshold,
+		window:     int64(minutes) * 60 * 1000,
+		members:    make(map[string]string),
+		rebalances: make(map[string][]int64),
+	}
+}
+
+// observe records the members and state of the described groups, the caller must hold schemaUpdateMtx
+func (t *rebalanceTracker) observe(groupState map[string]string, groupMembers map[string][]string) {
+	now := clockNow().UnixNano() / int64(time.Millisecond)
+	members := make(map[string]string, len(groupState))
+	for group, state := range groupState {
+		ids := groupMembers[group]
+		sort.Strings(ids)
+		members[group] = strings.Join(ids, ",")
+		last, known := t.members[group]
+		rebalancing := state == "PreparingRebalance" || state == "CompletingRebalance" || state == "AwaitingSync"
+		if rebalancing || (known && last != members[group]) {
+			t.rebalances[group] = append(t.rebalances[group], now)
+		}
+	}
+	t.members = members
+	for group, ts := range t.rebalances {
+		for len(ts) > 0 && ts[0] <= now-t.window {
+			ts = ts[1:]
+		}
+		if len(ts) == 0 {
+			delete(t.rebalances, group)
+		} else {
+			t.rebalances[group] = ts
+		}
+	}
+}
+
+// apply sets the rebalances of the statuses, and makes WARN the OK groups in a rebalance storm,
+// the rebalances of the groups merged by the rewrites add up
+func (t *rebalanceTracker) apply(rules []*groupRewrite, statuses []*GroupStatus) {
+	counts := make(map[string]int, len(t.rebalances))
+	for group, ts := range t.rebalances {
+		counts[rewriteGroup(rules, group)] += len(ts)
+	}
+	for _, status := range statuses {
+		status.Rebalances = counts[status.Group]
+		if t.threshold > 0 && status.Rebalances > t.threshold && status.Status == StatusOK {
+			status.Status = StatusWarn
+			status.Window[len(status.Window)-1].Status = StatusWarn
+		}
+	}
+}
+
+func (t *rebalanceTracker) forget(group string) {
+	delete(t.members, group)
+	delete(t.rebalances, group)
+}
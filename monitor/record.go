@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+// Recorder appends the offsets of every sweep of all clusters to a file, one json record per line
+type Recorder struct {
+	lock sync.Mutex
+	f    *os.File
+}
+
+func NewRecorder(file string) (*Recorder, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+func (r *Recorder) record(groupOffsets map[string][]*ConsumerFullOffset) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	w := bufio.NewWriter(r.f)
+	for _, msgs := range groupOffsets {
+		for _, msg := range msgs {
+			data, err := EncodeJSON(msg)
+			if err != nil {
+				return err
+			}
+			w.Write(data)
+			w.WriteByte('\n')
+		}
+	}
+	return w.Flush()
+}
+
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// Replay feeds recorded offsets through the evaluator and the importer as if they were swept again,
+// speed scales the time between the recorded sweeps, 0 replays as fast as possible
+func Replay(cfg *config.Config, r io.Reader, speed float64) error {
+	log := mylog.Module("replay")
+	type cluster struct {
+		importer     *Importer
+		evaluator    *Evaluator
+		ts           int64
+		groupOffsets map[string][]*ConsumerFullOffset
+	}
+	clusters := make(map[string]*cluster)
+	// evaluate the sweep collected so far, once the records of the next one show up
+	flush := func(c *cluster) {
+		if len(c.groupOffsets) > 0 {
+			c.importer.saveStatus(context.Background(), c.evaluator.evaluate(c.ts, c.groupOffsets))
+		}
+		c.groupOffsets = make(map[string][]*ConsumerFullOffset)
+	}
+
+	var lastTs int64
+	var replayed int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		v, err := DecodeJSON(scanner.Bytes())
+		if err != nil {
+			return err
+		}
+		msg, ok := v.(*ConsumerFullOffset)
+		if !ok {
+			continue
+		}
+		c, ok := clusters[msg.Cluster]
+		if !ok {
+			importer, err := NewImporter(cfg, msg.Cluster, metrics.NewRegistry())
+			if err != nil {
+				return err
+			}
+			importer.start()
+			evaluator, err := NewEvaluator(cfg, msg.Cluster)
+			if err != nil {
+				return err
+			}
+			evaluator.owners = importer.owners
+			c = &cluster{
+				importer:     importer,
+				evaluator:    evaluator,
+				ts:           msg.Timestamp,
+				groupOffsets: make(map[string][]*ConsumerFullOffset),
+			}
+			clusters[msg.Cluster] = c
+		}
+		if msg.Timestamp != c.ts {
+			flush(c)
+			c.ts = msg.Timestamp
+		}
+		if speed > 0 && lastTs > 0 && msg.Timestamp > lastTs {
+			clockSleep(time.Duration(float64(msg.Timestamp-lastTs)/speed) * time.Millisecond)
+		}
+		if msg.Timestamp > lastTs {
+			lastTs = msg.Timestamp
+		}
+		c.importer.saveMsg(msg)
+		c.groupOffsets[msg.Group] = append(c.groupOffsets[msg.Group], msg)
+		replayed++
+	}
+	for _, c := range clusters {
+		flush(c)
+		c.importer.stop(context.Background())
+	}
+	log.Infof("replayed %d records of %d clusters", replayed, len(clusters))
+	return scanner.Err()
+}
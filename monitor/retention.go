@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"strconv"
+
+	"github.com/Shopify/sarama"
+)
+
+// TopicConfig is the part of the config of a topic which changes the meaning of the lag
+type TopicConfig struct {
+	// -1 retains forever
+	RetentionMs   int64  `json:"retention_ms"`
+	CleanupPolicy string `json:"cleanup_policy"`
+}
+
+// describeTopicConfigs describes the retention.ms and cleanup.policy of the topics, it returns topic => config
+// and topic => retention(s), nil if the topics couldn't be described
+func (client *KafkaClient) describeTopicConfigs(topics map[string]int) (map[string]*TopicConfig, map[string]float64) {
+	request := &sarama.DescribeConfigsRequest{}
+	for topic := range topics {
+		request.Resources = append(request.Resources, &sarama.ConfigResource{
+			Type:        sarama.TopicResource,
+			Name:        topic,
+			ConfigNames: []string{"retention.ms", "cleanup.policy"},
+		})
+	}
+	if len(request.Resources) == 0 {
+		return nil, nil
+	}
+	controller, err := client.client.Controller()
+	if err != nil {
+		client.warnLimiter.warnf(client.log, "describe-configs", "Cannot describe the topics: %v", err)
+		return nil, nil
+	}
+	response, err := controller.DescribeConfigs(request)
+	if err != nil {
+		client.warnLimiter.warnf(client.log, "describe-configs", "Cannot describe the topics: %v", err)
+		return nil, nil
+	}
+	configs := make(map[string]*TopicConfig, len(response.Resources))
+	retention := make(map[string]float64, len(response.Resources))
+	for _, resource := range response.Resources {
+		if resource.ErrorCode != 0 {
+			client.warnLimiter.warnf(client.log.WithField("topic", resource.Name), "describe-configs:"+resource.Name,
+				"Cannot describe the topic: %v", sarama.KError(resource.ErrorCode))
+			continue
+		}
+		config := &TopicConfig{RetentionMs: -1}
+		for _, entry := range resource.Configs {
+			switch entry.Name {
+			case "retention.ms":
+				if ms, err := strconv.ParseInt(entry.Value, 10, 64); err == nil {
+					config.RetentionMs = ms
+				}
+			case "cleanup.policy":
+				config.CleanupPolicy = entry.Value
+			}
+		}
+		configs[resource.Name] = config
+		if config.RetentionMs > 0 {
+			retention[resource.Name] = float64(config.RetentionMs) / 1000
+		}
+	}
+	return configs, retention
+}
+
+// retentionPressure is how close the group is to losing the data of the partition, 1 when its committed offset
+// reaches what the topic retains: the share of the retention time the partition is behind, or with the
+// log start offsets the share of the retained messages it still has to consume, whichever is higher
+func retentionPressure(offset LogOffset, timeLag, retention float64, startOffsets bool) float64 {
+	var pressure float64
+	if retention > 0 {
+		pressure = timeLag / retention
+	}
+	if startOffsets {
+		if retained, consumed := consumedRange(offset); retained > 0 {
+			if p := float64(retained-consumed) / float64(retained); p > pressure {
+				pressure = p
+			}
+		}
+	}
+	return pressure
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"regexp"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+type groupRewrite struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+func newGroupRewrites(rules []*config.GroupRewrite) ([]*groupRewrite, error) {
+	res := make([]*groupRewrite, 0, len(rules))
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &groupRewrite{match: re, replace: rule.Replace})
+	}
+	return res, nil
+}
+
+// rewriteGroup returns the logical name of a group
+func rewriteGroup(rules []*groupRewrite, group string) string {
+	for _, rule := range rules {
+		if rule.match.MatchString(group) {
+			return rule.match.ReplaceAllString(group, rule.replace)
+		}
+	}
+	return group
+}
+
+// rewriteGroups renames the groups and merges the ones sharing a logical name, per partition the offset
+// of the group which progressed the most wins, the abandoned instances of an ephemeral group don't count
+func rewriteGroups(rules []*groupRewrite, groupOffsets map[string][]*ConsumerFullOffset) map[string][]*ConsumerFullOffset {
+	if len(rules) == 0 {
+		return groupOffsets
+	}
+	res := make(map[string][]*ConsumerFullOffset, len(groupOffsets))
+	//logical group => topic => merged offsets
+	merged := make(map[string]map[string]*ConsumerFullOffset)
+	for group, msgs := range groupOffsets {
+		name := rewriteGroup(rules, group)
+		if _, ok := merged[name]; !ok {
+			merged[name] = make(map[string]*ConsumerFullOffset)
+		}
+		for _, msg := range msgs {
+			msg.Group = name
+			into, ok := merged[name][msg.Topic]
+			if !ok {
+				merged[name][msg.Topic] = msg
+				res[name] = append(res[name], msg)
+				continue
+			}
+			for partition, offset := range msg.partitionMap {
+				if current, ok := into.partitionMap[partition]; !ok || offset.Offset > current.Offset {
+					into.partitionMap[partition] = offset
+				}
+			}
+			if msg.FirstSeen != 0 && (into.FirstSeen == 0 || msg.FirstSeen < into.FirstSeen) {
+				into.FirstSeen = msg.FirstSeen
+			}
+			if msg.LastSeen > into.LastSeen {
+				into.LastSeen = msg.LastSeen
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// alertRouter applies the alerting routes of the config to the status changes of the groups
+type alertRouter struct {
+	routes   []*alertRoute
+	location *time.Location
+}
+
+type alertRoute struct {
+	*config.AlertRoute
+	min, max Status
+}
+
+// newAlertRouter returns nil without routes, every notifier then gets the alerts the owners route to it
+func newAlertRouter(cfg *config.Config) (*alertRouter, error) {
+	if len(cfg.Alerting.Routes) == 0 {
+		return nil, nil
+	}
+	r := &alertRouter{location: time.Local}
+	if cfg.Alerting.Timezone != "" {
+		var err error
+		if r.location, err = time.LoadLocation(cfg.Alerting.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	for _, route := range cfg.Alerting.Routes {
+		compiled := &alertRoute{AlertRoute: route}
+		if err := compiled.min.UnmarshalText([]byte(route.MinStatus)); err != nil {
+			return nil, err
+		}
+		if err := compiled.max.UnmarshalText([]byte(route.MaxStatus)); err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, compiled)
+	}
+	return r, nil
+}
+
+// route sets the notifiers the routes send the status changes to at now
+func (r *alertRouter) route(statuses []*GroupStatus, now time.Time) {
+	if r == nil {
+		return
+	}
+	now = now.In(r.location)
+	for _, status := range statuses {
+		status.routing = true
+		status.routed = nil
+		if len(status.Window) < 2 {
+			continue
+		}
+		severity := status.Status
+		if previous := status.Window[len(status.Window)-2].Status; previous > severity {
+			severity = previous
+		}
+		for _, route := range r.routes {
+			if route.matches(status, severity, now) {
+				status.routed = append(status.routed, route.Notifiers...)
+			}
+		}
+	}
+}
+
+func (route *alertRoute) matches(status *GroupStatus, severity Status, now time.Time) bool {
+	if (route.Cluster != "" && route.Cluster != status.Cluster) || (route.Team != "" && route.Team != status.Team) {
+		return false
+	}
+	if severity < route.min || severity > route.max {
+		return false
+	}
+	if len(route.OnCall) > 0 && !inWindows(route.OnCall, now) {
+		return false
+	}
+	return !inWindows(route.QuietHours, now)
+}
+
+func inWindows(windows []*config.TimeWindow, t time.Time) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutedTo reports whether the alert of the status change goes to the notifier, for the notifiers of the plugins too:
+// the alerts of a team with notifiers only go to these, and with alerting routes only to the notifiers of the
+// routes matching the change
+func (status *GroupStatus) RoutedTo(notifier string) bool {
+	if len(status.Notifiers) > 0 && !contains(status.Notifiers, notifier) {
+		return false
+	}
+	return !status.routing || contains(status.routed, notifier)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// weight of the last sweep in the recent lag of a partition
+const sampleDecay = 0.1
+
+// partitionSampler picks the partitions of the huge topics whose consumer_metrics points are written,
+// by their number and by their recent lag, a moving average over the sweeps
+type partitionSampler struct {
+	cfg  config.PartitionSampling
+	lock sync.Mutex
+	//group => topic => partition => recent lag
+	scores map[string]map[string]map[int32]float64
+	//group => timestamp(ms) of its last sampled point, to forget the groups gone
+	seen   map[string]int64
+	pruned int64
+}
+
+func newPartitionSampler(cfg *config.PartitionSampling) *partitionSampler {
+	if cfg == nil {
+		return nil
+	}
+	return &partitionSampler{
+		cfg:    *cfg,
+		scores: make(map[string]map[string]map[int32]float64),
+		seen:   make(map[string]int64),
+	}
+}
+
+// sample returns the partitions of the group and topic to write, false if the topic isn't sampled
+func (s *partitionSampler) sample(msg *ConsumerFullOffset) (map[int32]bool, bool) {
+	if s == nil || len(msg.partitionMap) < s.cfg.MinPartitions {
+		return nil, false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prune(msg.Timestamp)
+	s.seen[msg.Group] = msg.Timestamp
+	topics, ok := s.scores[msg.Group]
+	if !ok {
+		topics = make(map[string]map[int32]float64)
+		s.scores[msg.Group] = topics
+	}
+	scores, ok := topics[msg.Topic]
+	if !ok {
+		scores = make(map[int32]float64)
+		topics[msg.Topic] = scores
+	}
+	keep := make(map[int32]bool)
+	partitions := make([]int32, 0, len(msg.partitionMap))
+	for partition, entry := range msg.partitionMap {
+		if entry.Lag >= 0 {
+			if score, ok := scores[partition]; ok {
+				scores[partition] = score + sampleDecay*(float64(entry.Lag)-score)
+			} else {
+				scores[partition] = float64(entry.Lag)
+			}
+		}
+		if s.cfg.Every > 0 && int(partition)%s.cfg.Every == 0 {
+			keep[partition] = true
+		}
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		if scores[partitions[i]] != scores[partitions[j]] {
+			return scores[partitions[i]] > scores[partitions[j]]
+		}
+		return partitions[i] < partitions[j]
+	})
+	for i := 0; i < s.cfg.Worst && i < len(partitions); i++ {
+		keep[partitions[i]] = true
+	}
+	return keep, true
+}
+
+// prune forgets, once an hour, the groups without sampled point for an hour, the caller must hold the lock
+func (s *partitionSampler) prune(ts int64) {
+	const hour = 3600 * 1000
+	if ts-s.pruned < hour {
+		return
+	}
+	s.pruned = ts
+	for group, last := range s.seen {
+		if last < ts-hour {
+			delete(s.seen, group)
+			delete(s.scores, group)
+		}
+	}
+}
+
+// forget drops the recent lags of a group
+func (s *partitionSampler) forget(group string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.seen, group)
+	delete(s.scores, group)
+}
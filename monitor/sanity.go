@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	// timestamp(ms) of 2010-01-01, the records stamped before are misparsed
+	minPlausibleTimestamp = 1262304000000
+	// the records stamped this long after now are misparsed
+	maxPlausibleAhead = 24 * time.Hour
+	// the quarantined records kept per cluster
+	quarantineSize = 100
+)
+
+// QuarantinedRecord is a decoded offset which failed the sanity checks, the implausible ones are dropped instead
+// of imported, the suspicious ones are kept and only flagged
+type QuarantinedRecord struct {
+	Cluster string `json:"cluster"`
+	// offset-response, offset-fetch or the offsets topic, e.g. __consumer_offsets
+	Source    string `json:"source"`
+	Group     string `json:"group,omitempty"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Reason    string `json:"reason"`
+	Dropped   bool   `json:"dropped"`
+	// timestamp(ms) it was quarantined
+	At int64 `json:"at"`
+}
+
+// quarantine keeps the last quarantined records of a cluster
+type quarantine struct {
+	cluster string
+	log     *logrus.Entry
+	limiter *warnLimiter
+	dropped metrics.Counter
+	flagged metrics.Counter
+
+	lock    sync.Mutex
+	records []*QuarantinedRecord
+	next    int
+}
+
+func newQuarantine(cluster string, log *logrus.Entry, limiter *warnLimiter, registry metrics.Registry) *quarantine {
+	return &quarantine{
+		cluster: cluster,
+		log:     log,
+		limiter: limiter,
+		dropped: metrics.GetOrRegisterCounter("quarantined-records", registry),
+		flagged: metrics.GetOrRegisterCounter("flagged-records", registry),
+	}
+}
+
+func (q *quarantine) add(r *QuarantinedRecord) {
+	r.Cluster, r.At = q.cluster, clockNow().UnixNano()/int64(time.Millisecond)
+	if r.Dropped {
+		q.dropped.Inc(1)
+	} else {
+		q.flagged.Inc(1)
+	}
+	q.lock.Lock()
+	if len(q.records) < quarantineSize {
+		q.records = append(q.records, r)
+	} else {
+		q.records[q.next] = r
+	}
+	q.next = (q.next + 1) % quarantineSize
+	q.lock.Unlock()
+	log := q.log.WithFields(logrus.Fields{"topic": r.Topic, "partition": r.Partition, "group": r.Group, "error_kind": ErrorDecode})
+	if r.Dropped {
+		q.limiter.warnf(log, "quarantine:"+r.Source+":"+r.Topic, "Dropped the implausible offset %d of the %s: %s", r.Offset, r.Source, r.Reason)
+	} else {
+		q.limiter.warnf(log, "flagged:"+r.Source+":"+r.Topic, "Suspicious offset %d of the %s: %s", r.Offset, r.Source, r.Reason)
+	}
+}
+
+// list returns the quarantined records, the latest first
+func (q *quarantine) list() []*QuarantinedRecord {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	res := append([]*QuarantinedRecord{}, q.records...)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].At > res[j].At })
+	return res
+}
+
+// plausibleTimestamp returns why a timestamp(ms) can't be the one of a record, empty if it can
+func plausibleTimestamp(ts int64) string {
+	if ts < minPlausibleTimestamp {
+		return fmt.Sprintf("timestamp %d before 2010", ts)
+	}
+	if ahead := ts - clockNow().UnixNano()/int64(time.Millisecond); ahead > int64(maxPlausibleAhead/time.Millisecond) {
+		return fmt.Sprintf("timestamp %d more than %v in the future", ts, maxPlausibleAhead)
+	}
+	return ""
+}
+
+// checkCommitRecord returns why a commit read from __consumer_offsets is implausible, empty if it's not: a negative
+// offset, a partition beyond the partition count of its known topic or a record timestamp out of range
+func checkCommitRecord(partition int32, offset, ts int64, partitions int, known bool) string {
+	switch {
+	case offset < 0:
+		return "negative offset"
+	case partition < 0 || (known && int(partition) >= partitions):
+		return fmt.Sprintf("partition beyond the %d partitions of the topic", partitions)
+	}
+	return plausibleTimestamp(ts)
+}
+
+// flagRewoundLogs flags the log end offsets lower than at the previous sweep, they're kept since a recreated
+// topic starts over, the caller must not hold topicOffsetMapLock
+func (client *KafkaClient) flagRewoundLogs(topicOffsetMap map[string]map[int32]int64) {
+	var rewound []*QuarantinedRecord
+	withReadLock(client.topicOffsetMapLock, func() {
+		for topic, partitions := range topicOffsetMap {
+			for partition, offset := range partitions {
+				if previous, ok := client.previousTopicOffset[topic][partition]; ok && offset < previous {
+					rewound = append(rewound, &QuarantinedRecord{Source: "offset-response", Topic: topic, Partition: partition, Offset: offset,
+						Reason: fmt.Sprintf("log end offset went back from %d", previous)})
+				}
+			}
+		}
+	})
+	for _, record := range rewound {
+		client.quarantine.add(record)
+	}
+}
+
+// Quarantine returns the records which failed the sanity checks of a cluster, of all clusters if empty
+func (f *Fetcher) Quarantine(cluster string) []*QuarantinedRecord {
+	records := []*QuarantinedRecord{}
+	for _, cli := range f.allClients() {
+		if cluster == "" || cli.named(cluster) {
+			records = append(records, cli.quarantine.list()...)
+		}
+	}
+	return records
+}
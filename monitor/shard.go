@@ -0,0 +1,17 @@
+package monitor
+
+import (
+	"hash/fnv"
+)
+
+// ownsGroup reports whether the group belongs to the shard of this instance, the groups are spread
+// by the hash of their name so the instances agree on the split without talking to each other
+func (client *KafkaClient) ownsGroup(group string) bool {
+	shards := client.cfg.General.Shards
+	if shards <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(group))
+	return int(h.Sum32()%uint32(shards)) == client.cfg.General.ShardIndex
+}
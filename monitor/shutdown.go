@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// how often the shutdown logs what it's still waiting for
+const shutdownProgressInterval = 5 * time.Second
+
+// waitStopped waits for done until ctx is done, logging what is still draining every shutdownProgressInterval
+func waitStopped(ctx context.Context, log *logrus.Entry, what string, done <-chan struct{}, progress func() string) error {
+	ticker := time.NewTicker(shutdownProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			log.Infof("Still waiting for %s to stop: %s", what, progress())
+		}
+	}
+}
+
+// closeSinks closes the sinks all at once and waits for them until ctx is done, the ones which don't close by
+// then are left behind. Every sink is closed even if ctx is already done.
+func (client *KafkaClient) closeSinks(ctx context.Context) {
+	closed := make([]chan struct{}, len(client.sinks))
+	for n, sink := range client.sinks {
+		closed[n] = make(chan struct{})
+		go func(sink Sink, closed chan struct{}) {
+			sink.Close()
+			close(closed)
+		}(sink, closed[n])
+	}
+	for n, sink := range client.sinks {
+		log := client.log.WithField("sink", sink.Name())
+		if err := waitStopped(ctx, log, "the sink", closed[n], func() string { return "closing" }); err != nil {
+			log.Warnf("The sink didn't close in time, leaving it behind")
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"fmt"
+	"plugin"
+	"sync"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// Sink receives the offsets and the evaluated statuses of every sweep, next to influxdb,
+// for the sinks and notifiers which are kept out of the tree
+type Sink interface {
+	Name() string
+	Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error
+	Close() error
+}
+
+// SinkFactory creates the sink of a cluster from the options of its config
+type SinkFactory func(cluster string, options map[string]string) (Sink, error)
+
+var (
+	sinkLock      sync.Mutex
+	sinkFactories = make(map[string]SinkFactory)
+)
+
+// RegisterSink makes a sink type available to the config, it's meant to be called from the init
+// of a plugin or of a package linked into a custom build, and panics if the type is registered twice
+func RegisterSink(typ string, factory SinkFactory) {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	if _, ok := sinkFactories[typ]; ok {
+		panic("sink type registered twice: " + typ)
+	}
+	sinkFactories[typ] = factory
+}
+
+// LoadPlugins opens the go plugins, their init functions register their sink types
+func LoadPlugins(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("plugin %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func newSinks(cfg *config.Config, cluster string) ([]Sink, error) {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	configs := cfg.SinksOf(cluster)
+	sinks := make([]Sink, 0, len(configs))
+	for _, sc := range configs {
+		factory, ok := sinkFactories[sc.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown sink type %s, is its plugin loaded", sc.Type)
+		}
+		sink, err := factory(cluster, sc.Options)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %v", sc.Type, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
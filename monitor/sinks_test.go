@@ -0,0 +1,465 @@
+package monitor_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/influxdata/influxdb/models"
+	"github.com/sundy-li/burrowx/config"
+	"github.com/sundy-li/burrowx/monitor"
+	"github.com/sundy-li/burrowx/monitor/sinktest"
+)
+
+// deliveries are the records a destination received, in their order
+type deliveries struct {
+	lock     sync.Mutex
+	offsets  []*monitor.ConsumerFullOffset
+	statuses []*monitor.GroupStatus
+}
+
+func (d *deliveries) add(v interface{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	switch v := v.(type) {
+	case *monitor.ConsumerFullOffset:
+		d.offsets = append(d.offsets, v)
+	case *monitor.GroupStatus:
+		d.statuses = append(d.statuses, v)
+	}
+}
+
+// decode adds a record encoded by EncodeJSON
+func (d *deliveries) decode(data []byte) error {
+	v, err := monitor.DecodeJSON(data)
+	if err != nil {
+		return err
+	}
+	d.add(v)
+	return nil
+}
+
+func (d *deliveries) Offsets() ([]*monitor.ConsumerFullOffset, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.offsets, nil
+}
+
+func (d *deliveries) Statuses() ([]*monitor.GroupStatus, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.statuses, nil
+}
+
+// fakeServer answers 500 to every request while failing, and passes the others to its handler
+type fakeServer struct {
+	*httptest.Server
+	failing int32
+}
+
+func newFakeServer(t *testing.T, handle func(r *http.Request, body []byte) error) *fakeServer {
+	s := &fakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || atomic.LoadInt32(&s.failing) == 1 {
+			http.Error(w, "failing", http.StatusInternalServerError)
+			return
+		}
+		if err := handle(r, body); err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return s
+}
+
+func (s *fakeServer) SetFailing(on bool) {
+	if on {
+		atomic.StoreInt32(&s.failing, 1)
+	} else {
+		atomic.StoreInt32(&s.failing, 0)
+	}
+}
+
+// closingSink closes the destination once the sink is closed, what it received stays readable
+type closingSink struct {
+	monitor.Sink
+	close func()
+}
+
+func (s *closingSink) Close() error {
+	err := s.Sink.Close()
+	s.close()
+	return err
+}
+
+func newSink(t *testing.T, typ, cluster string, options map[string]string) monitor.Sink {
+	sink, err := monitor.NewSinkOf(typ, cluster, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+// tempDir returns a new dir in root
+func tempDir(t *testing.T, root string) string {
+	dir, err := ioutil.TempDir(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestArchiveConformance(t *testing.T) {
+	root, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(root)
+	sinktest.Run(t, sinktest.Harness{
+		New: func(t *testing.T, cluster string) *sinktest.Destination {
+			dir := tempDir(t, root)
+			// the files of a sink are named by the time they start at, in their order
+			read := func() (*deliveries, error) {
+				names, _ := filepath.Glob(filepath.Join(dir, "*.jsonl.gz"))
+				sort.Strings(names)
+				d := &deliveries{}
+				for _, name := range names {
+					if err := readArchive(name, d); err != nil {
+						return nil, err
+					}
+				}
+				return d, nil
+			}
+			return &sinktest.Destination{
+				Sink: newSink(t, "archive", cluster, map[string]string{"dir": dir}),
+				Delivered: func() ([]*monitor.ConsumerFullOffset, error) {
+					d, err := read()
+					if err != nil {
+						return nil, err
+					}
+					return d.Offsets()
+				},
+				DeliveredStatuses: func() ([]*monitor.GroupStatus, error) {
+					d, err := read()
+					if err != nil {
+						return nil, err
+					}
+					return d.Statuses()
+				},
+			}
+		},
+	})
+}
+
+func readArchive(name string, d *deliveries) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if err := d.decode(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func TestBackupConformance(t *testing.T) {
+	// a second between the backups, the sweeps of the suite are saved far more than one second apart
+	monitor.SetClock(monitor.NewScaledClock(1e6))
+	defer monitor.SetClock(monitor.RealClock)
+	root, _ := ioutil.TempDir("", "backup")
+	defer os.RemoveAll(root)
+	for _, format := range []string{"csv", "json"} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			sinktest.Run(t, sinktest.Harness{
+				New: func(t *testing.T, cluster string) *sinktest.Destination {
+					dir := tempDir(t, root)
+					return &sinktest.Destination{
+						Sink: newSink(t, "backup", cluster, map[string]string{"dir": dir, "format": format, "intervalSeconds": "1"}),
+						Delivered: func() ([]*monitor.ConsumerFullOffset, error) {
+							if format == "json" {
+								return readJSONBackup(filepath.Join(dir, "burrowx-offsets-"+cluster+".json"))
+							}
+							return readCSVBackups(filepath.Join(dir, cluster))
+						},
+					}
+				},
+				// a backup replaces the previous one
+				LatestOnly: true,
+			})
+		})
+	}
+}
+
+func readCSVBackups(dir string) ([]*monitor.ConsumerFullOffset, error) {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.csv"))
+	var msgs []*monitor.ConsumerFullOffset
+	for _, name := range names {
+		group, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(name), ".csv"))
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			// TOPIC,PARTITION,OFFSET
+			fields := strings.Split(line, ",")
+			partition, _ := strconv.Atoi(fields[1])
+			offset, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, monitor.NewConsumerFullOffset(sinktest.Cluster, group, fields[0], 0,
+				map[int32]monitor.LogOffset{int32(partition): {Offset: offset}}))
+		}
+	}
+	return msgs, nil
+}
+
+func readJSONBackup(name string) ([]*monitor.ConsumerFullOffset, error) {
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backup struct {
+		Cluster string                                `json:"cluster"`
+		Groups  map[string]map[string]map[int32]int64 `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+	var msgs []*monitor.ConsumerFullOffset
+	for group, topics := range backup.Groups {
+		for topic, partitions := range topics {
+			offsets := make(map[int32]monitor.LogOffset, len(partitions))
+			for partition, offset := range partitions {
+				offsets[partition] = monitor.LogOffset{Offset: offset}
+			}
+			msgs = append(msgs, monitor.NewConsumerFullOffset(backup.Cluster, group, topic, 0, offsets))
+		}
+	}
+	return msgs, nil
+}
+
+func TestHistoryConformance(t *testing.T) {
+	root, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(root)
+	sinktest.Run(t, sinktest.Harness{
+		New: func(t *testing.T, cluster string) *sinktest.Destination {
+			dir := tempDir(t, root)
+			// the sweeps of the suite are of 2020
+			sink := newSink(t, "history", cluster, map[string]string{"dir": dir, "retentionDays": "36500"})
+			return &sinktest.Destination{
+				Sink: sink,
+				DeliveredStatuses: func() ([]*monitor.GroupStatus, error) {
+					names, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+					sort.Strings(names)
+					var statuses []*monitor.GroupStatus
+					for _, name := range names {
+						data, err := ioutil.ReadFile(name)
+						if err != nil {
+							return nil, err
+						}
+						for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+							var point monitor.HistoryPoint
+							if err := json.Unmarshal([]byte(line), &point); err != nil {
+								return nil, err
+							}
+							statuses = append(statuses, &monitor.GroupStatus{Group: point.Group, Timestamp: point.Timestamp, Status: point.Status})
+						}
+					}
+					return statuses, nil
+				},
+			}
+		},
+	})
+}
+
+func TestPulsarConformance(t *testing.T) {
+	sinktest.Run(t, sinktest.Harness{
+		New: func(t *testing.T, cluster string) *sinktest.Destination {
+			d := &deliveries{}
+			server := newFakeServer(t, func(r *http.Request, body []byte) error {
+				var batch struct {
+					Messages []struct {
+						Payload string `json:"payload"`
+					} `json:"messages"`
+				}
+				if err := json.Unmarshal(body, &batch); err != nil {
+					return err
+				}
+				for _, msg := range batch.Messages {
+					if err := d.decode([]byte(msg.Payload)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			sink := newSink(t, "pulsar", cluster, map[string]string{
+				"serviceUrl": server.URL,
+				"topic":      "persistent://public/default/burrowx-lag",
+				"batchSize":  "7",
+			})
+			return &sinktest.Destination{
+				Sink:              &closingSink{Sink: sink, close: server.Close},
+				Delivered:         d.Offsets,
+				DeliveredStatuses: d.Statuses,
+				SetFailing:        server.SetFailing,
+			}
+		},
+	})
+}
+
+func TestWebhookConformance(t *testing.T) {
+	sinktest.Run(t, sinktest.Harness{
+		New: func(t *testing.T, cluster string) *sinktest.Destination {
+			d := &deliveries{}
+			server := newFakeServer(t, func(r *http.Request, body []byte) error {
+				var alert struct {
+					Cluster   string `json:"cluster"`
+					Group     string `json:"group"`
+					Timestamp int64  `json:"timestamp"`
+				}
+				if err := json.Unmarshal(body, &alert); err != nil {
+					return err
+				}
+				d.add(&monitor.GroupStatus{Cluster: alert.Cluster, Group: alert.Group, Timestamp: alert.Timestamp})
+				return nil
+			})
+			sink := newSink(t, "webhook", cluster, map[string]string{"url": server.URL})
+			// no SetFailing, the alerts are best effort, a failed one is logged and dropped
+			return &sinktest.Destination{
+				Sink:              &closingSink{Sink: sink, close: server.Close},
+				DeliveredStatuses: d.Statuses,
+			}
+		},
+	})
+}
+
+// the kafka-events sink isn't checked, it ignores the sweeps and produces the events given to SaveEvents
+func TestStatusTopicConformance(t *testing.T) {
+	const topic = "burrowx-status"
+	sinktest.Run(t, sinktest.Harness{
+		New: func(t *testing.T, cluster string) *sinktest.Destination {
+			broker := sarama.NewMockBroker(t, 1)
+			metadata := sarama.NewMockMetadataResponse(t).
+				SetBroker(broker.Addr(), broker.BrokerID()).
+				SetLeader(topic, 0, broker.BrokerID())
+			handlers := func(produce sarama.MockResponse) map[string]sarama.MockResponse {
+				return map[string]sarama.MockResponse{"MetadataRequest": metadata, "ProduceRequest": produce}
+			}
+			// the sink produces with the version 2 of a 0.10.2 broker
+			produce := func() *sarama.MockProduceResponse { return sarama.NewMockProduceResponse(t).SetVersion(2) }
+			broker.SetHandlerByMap(handlers(produce()))
+			sink := newSink(t, "kafka", cluster, map[string]string{"brokers": broker.Addr(), "topic": topic})
+			d := &deliveries{}
+			monitor.RecordProduced(sink, func(msgs []*sarama.ProducerMessage) {
+				for _, msg := range msgs {
+					// the tombstones of the groups gone
+					if msg.Value == nil {
+						continue
+					}
+					data, _ := msg.Value.Encode()
+					if err := d.decode(data); err != nil {
+						t.Error(err)
+					}
+				}
+			})
+			return &sinktest.Destination{
+				Sink:              &closingSink{Sink: sink, close: broker.Close},
+				DeliveredStatuses: d.Statuses,
+				SetFailing: func(on bool) {
+					response := produce()
+					if on {
+						response.SetError(topic, 0, sarama.ErrNotEnoughReplicas)
+					}
+					broker.SetHandlerByMap(handlers(response))
+				},
+			}
+		},
+	})
+}
+
+func TestInfluxdbConformance(t *testing.T) {
+	sinktest.Run(t, sinktest.Harness{
+		New: func(t *testing.T, cluster string) *sinktest.Destination {
+			d := &deliveries{}
+			server := newFakeServer(t, func(r *http.Request, body []byte) error {
+				if r.URL.Path != "/write" {
+					return nil
+				}
+				points, err := models.ParsePointsWithPrecision(body, time.Now(), r.URL.Query().Get("precision"))
+				if err != nil {
+					return err
+				}
+				for _, pt := range points {
+					if string(pt.Name()) != "consumer_metrics" {
+						continue
+					}
+					tags := pt.Tags()
+					fields, err := pt.Fields()
+					if err != nil {
+						return err
+					}
+					partition, _ := strconv.Atoi(string(tags.Get([]byte("partition"))))
+					offset, _ := fields["offsize"].(int64)
+					d.add(monitor.NewConsumerFullOffset(string(tags.Get([]byte("cluster"))), string(tags.Get([]byte("consumer_group"))),
+						string(tags.Get([]byte("topic"))), pt.Time().UnixNano()/int64(time.Millisecond),
+						map[int32]monitor.LogOffset{int32(partition): {Offset: offset}}))
+				}
+				return nil
+			})
+			sink, err := monitor.NewInfluxSink(influxConfig(t, server.URL, cluster), cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &sinktest.Destination{
+				Sink:       &closingSink{Sink: sink, close: server.Close},
+				Delivered:  d.Offsets,
+				SetFailing: server.SetFailing,
+			}
+		},
+	})
+}
+
+func influxConfig(t *testing.T, hosts, cluster string) *config.Config {
+	data, _ := json.Marshal(map[string]interface{}{
+		"general":  map[string]interface{}{"clientId": "burrowx-test", "topicFilter": ".*", "groupFilter": ".*"},
+		"kafka":    map[string]interface{}{cluster: map[string]interface{}{"brokers": "127.0.0.1:9092"}},
+		"influxdb": map[string]interface{}{"hosts": hosts, "db": "burrowx"},
+	})
+	var cfg config.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Init()
+	return &cfg
+}
@@ -0,0 +1,364 @@
+// Package sinktest is the conformance suite of the sinks: every sink type, built in or registered by a plugin,
+// should pass it, so the sinks agree on what a Save or a Close which returned nil guarantees. In a test of the
+// package of the sink:
+//
+//	func TestConformance(t *testing.T) {
+//		sinktest.Run(t, sinktest.Harness{
+//			New: func(t *testing.T, cluster string) *sinktest.Destination {
+//				dir, _ := ioutil.TempDir("", "sink")
+//				sink, err := newMySink(cluster, map[string]string{"dir": dir})
+//				if err != nil {
+//					t.Fatal(err)
+//				}
+//				return &sinktest.Destination{Sink: sink, Delivered: func() ([]*monitor.ConsumerFullOffset, error) {
+//					return readMyFiles(dir)
+//				}}
+//			},
+//		})
+//	}
+//
+// A sink delivering the statuses, e.g. a notifier, reads them back with DeliveredStatuses instead, or too. The
+// status of every group changes at every sweep, so the notifiers alert on each. The suite checks that:
+//   - an empty sweep is accepted
+//   - every offset and status of a large sweep is delivered once, whatever the batches the sink splits it in
+//   - the offsets of a partition and the statuses of a group are delivered in the order of the sweeps
+//   - the records of a Save which returned nil are delivered, even if the destination failed meanwhile, and
+//     the sink recovers once it's back
+//   - Close delivers what is buffered and returns within Harness.CloseTimeout
+package sinktest
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// the cluster of the sweeps the suite saves
+const Cluster = "conformance"
+
+// Destination is a sink under test with what it delivered
+type Destination struct {
+	Sink monitor.Sink
+	// Delivered reads back the offsets the sink delivered to the destination, in the order they were delivered,
+	// nil if it delivers none
+	Delivered func() ([]*monitor.ConsumerFullOffset, error)
+	// DeliveredStatuses reads back the statuses the same way, nil if it delivers none
+	DeliveredStatuses func() ([]*monitor.GroupStatus, error)
+	// SetFailing makes the destination fail the deliveries while on, e.g. a fake server answering 500s,
+	// nil if it can't fail, which skips the retry checks
+	SetFailing func(on bool)
+}
+
+// Harness creates the sinks under test
+type Harness struct {
+	// New returns a sink of cluster delivering to a new empty destination, every check creates its own
+	New func(t *testing.T, cluster string) *Destination
+	// set for the sinks keeping only the last offset of a partition or status of a group, e.g. a backup,
+	// the records of the earlier sweeps may be missing then
+	LatestOnly bool
+	// a Close taking longer fails the suite, 10s by default
+	CloseTimeout time.Duration
+}
+
+// Run runs the conformance checks of a sink as subtests of t
+func Run(t *testing.T, h Harness) {
+	if h.CloseTimeout <= 0 {
+		h.CloseTimeout = 10 * time.Second
+	}
+	t.Run("Name", func(t *testing.T) { h.testName(t) })
+	t.Run("EmptySweep", func(t *testing.T) { h.testEmptySweep(t) })
+	t.Run("Batching", func(t *testing.T) { h.testBatching(t) })
+	t.Run("Ordering", func(t *testing.T) { h.testOrdering(t) })
+	t.Run("Retry", func(t *testing.T) { h.testRetry(t) })
+	t.Run("ShutdownFlush", func(t *testing.T) { h.testShutdownFlush(t) })
+}
+
+func (h Harness) testName(t *testing.T) {
+	d := h.New(t, Cluster)
+	defer h.close(t, d)
+	name := d.Sink.Name()
+	if name == "" {
+		t.Fatal("the sink has no name")
+	}
+	if d.Sink.Name() != name {
+		t.Fatalf("the name of the sink changed from %s to %s", name, d.Sink.Name())
+	}
+}
+
+func (h Harness) testEmptySweep(t *testing.T) {
+	d := h.New(t, Cluster)
+	if err := d.Sink.Save(Cluster, map[string][]*monitor.ConsumerFullOffset{}, nil); err != nil {
+		t.Fatalf("Save of an empty sweep: %v", err)
+	}
+	h.close(t, d)
+}
+
+func (h Harness) testBatching(t *testing.T) {
+	d := h.New(t, Cluster)
+	s := newSweep(3, 4, 500, 0)
+	if err := s.save(d.Sink); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	h.close(t, d)
+	want := s.expected(d)
+	seen := make(map[partitionKey]int)
+	for _, r := range delivered(t, d) {
+		seen[r.partitionKey]++
+		if r.value != want[r.partitionKey] {
+			t.Errorf("%v delivered at %d, saved at %d", r.partitionKey, r.value, want[r.partitionKey])
+		}
+	}
+	for key := range want {
+		switch seen[key] {
+		case 0:
+			t.Errorf("%v not delivered", key)
+		case 1:
+		default:
+			t.Errorf("%v delivered %d times", key, seen[key])
+		}
+	}
+	if len(seen) != len(want) {
+		t.Errorf("%d partitions and groups delivered, %d saved", len(seen), len(want))
+	}
+}
+
+func (h Harness) testOrdering(t *testing.T) {
+	d := h.New(t, Cluster)
+	var sweeps []*sweep
+	for i := 0; i < 5; i++ {
+		s := newSweep(2, 2, 8, i)
+		if err := s.save(d.Sink); err != nil {
+			t.Fatalf("Save of sweep %d: %v", i, err)
+		}
+		sweeps = append(sweeps, s)
+	}
+	h.close(t, d)
+	last := sweeps[len(sweeps)-1]
+	h.checkSweeps(t, d, sweeps, last)
+}
+
+func (h Harness) testRetry(t *testing.T) {
+	d := h.New(t, Cluster)
+	if d.SetFailing == nil {
+		h.close(t, d)
+		t.Skip("the destination can't fail")
+	}
+	first := newSweep(2, 2, 8, 0)
+	if err := first.save(d.Sink); err != nil {
+		t.Fatalf("Save before the failure: %v", err)
+	}
+	d.SetFailing(true)
+	failed := newSweep(2, 2, 8, 1)
+	failedErr := failed.save(d.Sink)
+	d.SetFailing(false)
+	recovered := newSweep(2, 2, 8, 2)
+	if err := recovered.save(d.Sink); err != nil {
+		t.Fatalf("Save once the destination is back: %v", err)
+	}
+	h.close(t, d)
+
+	sweeps := []*sweep{first, recovered}
+	if failedErr == nil {
+		// the sink took the sweep, it must deliver it once the destination is back
+		sweeps = []*sweep{first, failed, recovered}
+	}
+	h.checkSweeps(t, d, sweeps, recovered)
+}
+
+func (h Harness) testShutdownFlush(t *testing.T) {
+	d := h.New(t, Cluster)
+	s := newSweep(1, 3, 16, 0)
+	if err := s.save(d.Sink); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	h.close(t, d)
+	seen := make(map[partitionKey]bool)
+	for _, r := range delivered(t, d) {
+		seen[r.partitionKey] = true
+	}
+	for key := range s.expected(d) {
+		if !seen[key] {
+			t.Errorf("%v not delivered by Close", key)
+		}
+	}
+}
+
+// checkSweeps checks the offsets of every partition and the statuses of every group are delivered in the order
+// of the sweeps, the ones of every sweep unless LatestOnly, and that the last delivered are the ones of last
+func (h Harness) checkSweeps(t *testing.T, d *Destination, sweeps []*sweep, last *sweep) {
+	byPartition := make(map[partitionKey][]int64)
+	for _, r := range delivered(t, d) {
+		byPartition[r.partitionKey] = append(byPartition[r.partitionKey], r.value)
+	}
+	for key := range last.expected(d) {
+		offsets := byPartition[key]
+		if len(offsets) == 0 {
+			t.Errorf("%v not delivered", key)
+			continue
+		}
+		for i := 1; i < len(offsets); i++ {
+			// a retried batch may be delivered twice, never out of order
+			if offsets[i] < offsets[i-1] {
+				t.Errorf("%v delivered out of order: %v", key, offsets)
+				break
+			}
+		}
+		if got, want := offsets[len(offsets)-1], last.values[key]; got != want {
+			t.Errorf("%v last delivered at %d, saved last at %d", key, got, want)
+		}
+		if h.LatestOnly {
+			continue
+		}
+		got := make(map[int64]bool, len(offsets))
+		for _, offset := range offsets {
+			got[offset] = true
+		}
+		for i, s := range sweeps {
+			if !got[s.values[key]] {
+				t.Errorf("%v at %d of sweep %d not delivered", key, s.values[key], i)
+			}
+		}
+	}
+}
+
+// close closes the sink, failing the test if it returns an error or doesn't return within CloseTimeout
+func (h Harness) close(t *testing.T, d *Destination) {
+	done := make(chan error, 1)
+	go func() { done <- d.Sink.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	case <-time.After(h.CloseTimeout):
+		t.Fatalf("Close didn't return within %v", h.CloseTimeout)
+	}
+}
+
+// the partition of the key of a group status
+const statusPartition = -1
+
+// partitionKey is a partition of a topic consumed by a group, or the status of the group
+type partitionKey struct {
+	group     string
+	topic     string
+	partition int32
+}
+
+func statusKey(group string) partitionKey {
+	return partitionKey{group: group, partition: statusPartition}
+}
+
+func (k partitionKey) String() string {
+	if k.partition == statusPartition {
+		return fmt.Sprintf("status of %s", k.group)
+	}
+	return fmt.Sprintf("%s/%s/%d", k.group, k.topic, k.partition)
+}
+
+// record is a delivered offset of a partition, or the timestamp of a delivered status
+type record struct {
+	partitionKey
+	value int64
+}
+
+func delivered(t *testing.T, d *Destination) []*record {
+	var records []*record
+	if d.DeliveredStatuses != nil {
+		statuses, err := d.DeliveredStatuses()
+		if err != nil {
+			t.Fatalf("reading the statuses the sink delivered: %v", err)
+		}
+		for _, status := range statuses {
+			records = append(records, &record{partitionKey: statusKey(status.Group), value: status.Timestamp})
+		}
+	}
+	if d.Delivered == nil {
+		return records
+	}
+	msgs, err := d.Delivered()
+	if err != nil {
+		t.Fatalf("reading what the sink delivered: %v", err)
+	}
+	for _, msg := range msgs {
+		partitions := make([]int32, 0, len(msg.Partitions()))
+		for partition := range msg.Partitions() {
+			partitions = append(partitions, partition)
+		}
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		for _, partition := range partitions {
+			records = append(records, &record{
+				partitionKey: partitionKey{group: msg.Group, topic: msg.Topic, partition: partition},
+				value:        msg.Partitions()[partition].Offset,
+			})
+		}
+	}
+	return records
+}
+
+// sweep is a synthetic sweep whose offsets grow with its index, the status of its groups alternates between
+// OK and WARN
+type sweep struct {
+	ts           int64
+	groupOffsets map[string][]*monitor.ConsumerFullOffset
+	statuses     []*monitor.GroupStatus
+	// the offsets of the partitions and the timestamps of the statuses
+	values map[partitionKey]int64
+}
+
+func newSweep(groups, topics, partitions, index int) *sweep {
+	// a minute apart, from 2020-01-01
+	ts := int64(1577836800000 + index*60000)
+	s := &sweep{ts: ts, groupOffsets: make(map[string][]*monitor.ConsumerFullOffset), values: make(map[partitionKey]int64)}
+	status, previous := monitor.StatusOK, monitor.StatusWarn
+	if index%2 == 1 {
+		status, previous = previous, status
+	}
+	for g := 0; g < groups; g++ {
+		group := fmt.Sprintf("group-%d", g)
+		var totalLag int64
+		for tp := 0; tp < topics; tp++ {
+			topic := fmt.Sprintf("topic-%d", tp)
+			offsets := make(map[int32]monitor.LogOffset, partitions)
+			for p := 0; p < partitions; p++ {
+				offset := int64(index*1000 + g*100 + p)
+				logsize := offset + int64(p)
+				offsets[int32(p)] = monitor.LogOffset{Logsize: logsize, Offset: offset, Lag: logsize - offset}
+				s.values[partitionKey{group: group, topic: topic, partition: int32(p)}] = offset
+				totalLag += logsize - offset
+			}
+			s.groupOffsets[group] = append(s.groupOffsets[group], monitor.NewConsumerFullOffset(Cluster, group, topic, ts, offsets))
+		}
+		s.statuses = append(s.statuses, &monitor.GroupStatus{
+			Cluster:   Cluster,
+			Group:     group,
+			Timestamp: ts,
+			Status:    status,
+			TotalLag:  totalLag,
+			Window: []*monitor.Evaluation{
+				{Timestamp: ts - 60000, Status: previous},
+				{Timestamp: ts, Status: status, TotalLag: totalLag},
+			},
+		})
+		s.values[statusKey(group)] = ts
+	}
+	return s
+}
+
+func (s *sweep) save(sink monitor.Sink) error {
+	return sink.Save(Cluster, s.groupOffsets, s.statuses)
+}
+
+// expected returns the values of the sweep of the records the destination delivers
+func (s *sweep) expected(d *Destination) map[partitionKey]int64 {
+	want := make(map[partitionKey]int64, len(s.values))
+	for key, value := range s.values {
+		if key.partition == statusPartition && d.DeliveredStatuses != nil || key.partition != statusPartition && d.Delivered != nil {
+			want[key] = value
+		}
+	}
+	return want
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// SLOTracker counts the evaluations of every group meeting its SLOs, in hourly buckets covering the SLO window.
+// The sweep tracks and the purge of a group forgets it under the write lock of the schemaUpdateMtx of the client.
+type SLOTracker struct {
+	slos []*trackedSLO
+}
+
+type trackedSLO struct {
+	cfg   *config.SLO
+	group *regexp.Regexp
+	//group => hourly buckets, oldest first
+	buckets map[string][]*sloBucket
+}
+
+type sloBucket struct {
+	hour        int64
+	good, total int64
+}
+
+// SLOStatus is the compliance of a group to an SLO over its window, the burn rate is how fast the error budget
+// is spent, 1 spends exactly the budget of the window, BurnRate1h is the burn rate of the current hour
+type SLOStatus struct {
+	SLO        string  `json:"slo"`
+	Cluster    string  `json:"cluster"`
+	Group      string  `json:"group"`
+	Timestamp  int64   `json:"timestamp"`
+	Good       int64   `json:"good"`
+	Total      int64   `json:"total"`
+	Compliance float64 `json:"compliance"`
+	BurnRate   float64 `json:"burn_rate"`
+	BurnRate1h float64 `json:"burn_rate_1h"`
+}
+
+func NewSLOTracker(slos []*config.SLO) *SLOTracker {
+	t := &SLOTracker{}
+	for _, slo := range slos {
+		t.slos = append(t.slos, &trackedSLO{
+			cfg:     slo,
+			group:   regexp.MustCompile(slo.Group),
+			buckets: make(map[string][]*sloBucket),
+		})
+	}
+	return t
+}
+
+// track counts the evaluation of the groups and returns their compliance to the SLOs which apply to them,
+// groups absent from the sweep keep their buckets until they expire
+func (t *SLOTracker) track(statuses []*GroupStatus) []*SLOStatus {
+	if len(statuses) == 0 {
+		return nil
+	}
+	now := statuses[0].Timestamp / int64(time.Hour/time.Millisecond)
+	var res []*SLOStatus
+	for _, slo := range t.slos {
+		for _, status := range statuses {
+			if !slo.group.MatchString(status.Group) {
+				continue
+			}
+			buckets := slo.buckets[status.Group]
+			if len(buckets) == 0 || buckets[len(buckets)-1].hour != now {
+				buckets = append(buckets, &sloBucket{hour: now})
+			}
+			for len(buckets) > 0 && buckets[0].hour <= now-int64(slo.cfg.WindowHours) {
+				buckets = buckets[1:]
+			}
+			current := buckets[len(buckets)-1]
+			current.total++
+			if status.TimeLag < slo.cfg.MaxTimeLag {
+				current.good++
+			}
+			slo.buckets[status.Group] = buckets
+
+			ss := &SLOStatus{
+				SLO:       slo.cfg.Name,
+				Cluster:   status.Cluster,
+				Group:     status.Group,
+				Timestamp: status.Timestamp,
+			}
+			for _, b := range buckets {
+				ss.Good += b.good
+				ss.Total += b.total
+			}
+			ss.Compliance = float64(ss.Good) / float64(ss.Total)
+			budget := 1 - slo.cfg.Objective
+			ss.BurnRate = (1 - ss.Compliance) / budget
+			ss.BurnRate1h = (1 - float64(current.good)/float64(current.total)) / budget
+			res = append(res, ss)
+		}
+	}
+	for _, slo := range t.slos {
+		for group, buckets := range slo.buckets {
+			if len(buckets) > 0 && buckets[len(buckets)-1].hour <= now-int64(slo.cfg.WindowHours) {
+				delete(slo.buckets, group)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+func TestSLOBurnRate(t *testing.T) {
+	tracker := NewSLOTracker([]*config.SLO{{Name: "fresh", Group: "^billing", MaxTimeLag: 60, Objective: 0.75, WindowHours: 2}})
+	hour := int64(3600 * 1000)
+	start := 1700000000000 / hour * hour
+	for i, step := range []struct {
+		hour    int64
+		timeLag float64
+		// evaluations meeting the SLO and evaluated over the window, and the burn rates
+		good, total          int64
+		burnRate, burnRate1h float64
+	}{
+		{0, 10, 1, 1, 0, 0},
+		{0, 120, 1, 2, 2, 2},
+		{1, 10, 2, 3, 4.0 / 3, 0},
+		// the first hour left the window
+		{2, 30, 2, 2, 0, 0},
+		{2, 60, 2, 3, 4.0 / 3, 2},
+	} {
+		ts := start + step.hour*hour
+		statuses := []*GroupStatus{
+			{Cluster: "local", Group: "billing", Timestamp: ts, TimeLag: step.timeLag},
+			{Cluster: "local", Group: "audit", Timestamp: ts, TimeLag: step.timeLag},
+		}
+		res := tracker.track(statuses)
+		if len(res) != 1 || res[0].Group != "billing" {
+			t.Fatalf("step %d: %d statuses, want the one of billing", i, len(res))
+		}
+		s := res[0]
+		if s.Good != step.good || s.Total != step.total ||
+			math.Abs(s.BurnRate-step.burnRate) > 1e-9 || math.Abs(s.BurnRate1h-step.burnRate1h) > 1e-9 {
+			t.Errorf("step %d: %d/%d burning %v, %v in the hour, want %d/%d burning %v, %v",
+				i, s.Good, s.Total, s.BurnRate, s.BurnRate1h, step.good, step.total, step.burnRate, step.burnRate1h)
+		}
+	}
+	// billing is gone once its last hour left the window
+	tracker.track([]*GroupStatus{{Group: "billing-eu", Timestamp: start + 4*hour}})
+	if _, ok := tracker.slos[0].buckets["billing"]; ok {
+		t.Error("the buckets of billing outlived the window")
+	}
+}
@@ -0,0 +1,53 @@
+package monitor
+
+// sweepSnapshot is a copy of the metadata a sweep reads, taken under schemaUpdateMtx so the offset requests
+// of the sweep run without it and don't block the metadata refreshes and the api for seconds on large clusters
+type sweepSnapshot struct {
+	topicMap       map[string]int
+	topic2Consumer map[string][]string
+	topicConfigs   map[string]*TopicConfig
+	groupSeen      map[string]map[string]*Seen
+	groupState     map[string]string
+	partitionOwner map[string]map[string]map[int32]*GroupMember
+	reassigning    map[string]map[int32]bool
+}
+
+// snapshot copies the metadata of the sweep, the caller must hold schemaUpdateMtx
+func (client *KafkaClient) snapshot() *sweepSnapshot {
+	snap := &sweepSnapshot{
+		topicMap:       make(map[string]int, len(client.topicMap)),
+		topic2Consumer: make(map[string][]string, len(client.topic2Consumer)),
+		topicConfigs:   make(map[string]*TopicConfig, len(client.topicConfigs)),
+		groupSeen:      make(map[string]map[string]*Seen, len(client.groupSeen)),
+		groupState:     make(map[string]string, len(client.groupState)),
+		partitionOwner: make(map[string]map[string]map[int32]*GroupMember, len(client.partitionOwner)),
+		// replaced, not updated, by the refreshes
+		reassigning: client.reassigning,
+	}
+	for topic, partitions := range client.topicMap {
+		snap.topicMap[topic] = partitions
+	}
+	// Purge filters the consumers in place
+	for topic, consumers := range client.topic2Consumer {
+		snap.topic2Consumer[topic] = append([]string(nil), consumers...)
+	}
+	for topic, config := range client.topicConfigs {
+		snap.topicConfigs[topic] = config
+	}
+	// the refreshes update the seen pairings in place
+	for group, topics := range client.groupSeen {
+		snap.groupSeen[group] = make(map[string]*Seen, len(topics))
+		for topic, seen := range topics {
+			s := *seen
+			snap.groupSeen[group][topic] = &s
+		}
+	}
+	for group, state := range client.groupState {
+		snap.groupState[group] = state
+	}
+	// the owners of a group are replaced, not updated, by the refreshes
+	for group, topics := range client.partitionOwner {
+		snap.partitionOwner[group] = topics
+	}
+	return snap
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// sweepSchedule spreads the sweeps of the clusters over the fetch interval, so tens of clusters don't
+// hit the cpu and the network at the same instant: each cluster sweeps at a random phase after the ticks
+// of its ticker, plus a random jitter at every tick
+type sweepSchedule struct {
+	phase  time.Duration
+	jitter time.Duration
+}
+
+func newSweepSchedule(cfg *config.Config) sweepSchedule {
+	interval := time.Duration(METRIC_FETCH_INTERVAL_SECOND) * time.Second
+	s := sweepSchedule{jitter: interval * time.Duration(cfg.General.SweepJitterPercent) / 100}
+	if cfg.General.SweepPhaseSpread {
+		// the phase and the jitter stay within the interval
+		s.phase = time.Duration(rand.Int63n(int64(interval - s.jitter)))
+	}
+	return s
+}
+
+// delay returns how long to wait after a tick before sweeping
+func (s sweepSchedule) delay() time.Duration {
+	d := s.phase
+	if s.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	return d
+}
+
+// wait sleeps the delay of a tick
+func (s sweepSchedule) wait() {
+	if d := s.delay(); d > 0 {
+		clockSleep(d)
+	}
+}
+
+// sweepSlots caps the sweeps running at once over all clusters, nil if unlimited
+func newSweepSlots(max int) chan struct{} {
+	if max <= 0 {
+		return nil
+	}
+	return make(chan struct{}, max)
+}
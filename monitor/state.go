@@ -0,0 +1,146 @@
+package monitor
+
+import (
+	"fmt"
+)
+
+// State is the snapshot of the in-memory state of all clusters, to move it to another instance
+type State struct {
+	Version  int                      `json:"version"`
+	Clusters map[string]*ClusterState `json:"clusters"`
+}
+
+type ClusterState struct {
+	//topic => partition => newest offset of the last sweep
+	TopicOffsets map[string]map[int32]int64 `json:"topic_offsets"`
+	//group => topic => when the pairing was first and last observed
+	Seen map[string]map[string]*Seen `json:"seen"`
+	//group => recent evaluations, oldest first
+	Windows map[string][]*EvaluationState `json:"windows"`
+	//group => learned lag baseline
+	Baselines map[string]*Baseline `json:"baselines"`
+	Mutes     []*TopicMute         `json:"mutes,omitempty"`
+}
+
+// EvaluationState is an Evaluation with the offsets it was evaluated from
+type EvaluationState struct {
+	Evaluation
+	Offsets map[string]map[int32]LogOffset `json:"offsets"`
+}
+
+// ExportState snapshots the state of all clusters
+func (f *Fetcher) ExportState() *State {
+	all := f.allClients()
+	state := &State{
+		Version:  RECORD_VERSION,
+		Clusters: make(map[string]*ClusterState, len(all)),
+	}
+	for _, client := range all {
+		state.Clusters[client.cluster] = client.exportState()
+	}
+	return state
+}
+
+// ImportState replaces the state of the clusters in the snapshot, it fails before changing anything
+// if the snapshot is of a newer version or has a cluster which isn't configured
+func (f *Fetcher) ImportState(state *State) error {
+	if state.Version > RECORD_VERSION {
+		return fmt.Errorf("unsupported state version %d", state.Version)
+	}
+	all := f.allClients()
+	clients := make(map[string]*KafkaClient, len(all))
+	for _, client := range all {
+		clients[client.cluster] = client
+	}
+	for cluster := range state.Clusters {
+		if _, ok := clients[cluster]; !ok {
+			return fmt.Errorf("unknown cluster %s", cluster)
+		}
+	}
+	for cluster, cs := range state.Clusters {
+		clients[cluster].importState(cs)
+	}
+	return nil
+}
+
+func (client *KafkaClient) exportState() *ClusterState {
+	client.schemaUpdateMtx.RLock()
+	defer client.schemaUpdateMtx.RUnlock()
+
+	cs := &ClusterState{
+		TopicOffsets: make(map[string]map[int32]int64, len(client.topicOffset)),
+		Seen:         make(map[string]map[string]*Seen, len(client.groupSeen)),
+		Windows:      make(map[string][]*EvaluationState, len(client.evaluator.windows)),
+		Baselines:    make(map[string]*Baseline, len(client.evaluator.baselines)),
+	}
+	withReadLock(client.topicOffsetMapLock, func() {
+		for topic, partitions := range client.topicOffset {
+			cs.TopicOffsets[topic] = make(map[int32]int64, len(partitions))
+			for partition, offset := range partitions {
+				cs.TopicOffsets[topic][partition] = offset
+			}
+		}
+	})
+	for group, topics := range client.groupSeen {
+		cs.Seen[group] = make(map[string]*Seen, len(topics))
+		for topic, seen := range topics {
+			s := *seen
+			cs.Seen[group][topic] = &s
+		}
+	}
+	for group, window := range client.evaluator.windows {
+		for _, eval := range window {
+			cs.Windows[group] = append(cs.Windows[group], &EvaluationState{Evaluation: *eval, Offsets: eval.offsets})
+		}
+	}
+	for group, baseline := range client.evaluator.baselines {
+		b := *baseline
+		cs.Baselines[group] = &b
+	}
+	for _, topics := range client.evaluator.mutes {
+		for _, mute := range topics {
+			m := *mute
+			cs.Mutes = append(cs.Mutes, &m)
+		}
+	}
+	return cs
+}
+
+func (client *KafkaClient) importState(cs *ClusterState) {
+	client.schemaUpdateMtx.Lock()
+	defer client.schemaUpdateMtx.Unlock()
+
+	if cs.TopicOffsets != nil {
+		withWriteLock(client.topicOffsetMapLock, func() {
+			client.topicOffset = cs.TopicOffsets
+		})
+	}
+	if cs.Seen != nil {
+		client.groupSeen = cs.Seen
+	}
+	if cs.Windows != nil {
+		windows := make(map[string][]*Evaluation, len(cs.Windows))
+		for group, window := range cs.Windows {
+			for _, es := range window {
+				eval := es.Evaluation
+				eval.offsets = es.Offsets
+				windows[group] = append(windows[group], &eval)
+			}
+		}
+		client.evaluator.windows = windows
+	}
+	if cs.Baselines != nil {
+		client.evaluator.baselines = cs.Baselines
+	}
+	if cs.Mutes != nil {
+		client.evaluator.mutes = make(map[string]map[string]*TopicMute)
+		for _, mute := range cs.Mutes {
+			if _, ok := client.evaluator.mutes[mute.Group]; !ok {
+				client.evaluator.mutes[mute.Group] = make(map[string]*TopicMute)
+			}
+			m := *mute
+			m.Cluster = client.cluster
+			client.evaluator.mutes[mute.Group][mute.Topic] = &m
+		}
+	}
+}
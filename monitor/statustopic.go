@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func init() {
+	RegisterSink("kafka", newStatusTopicSink)
+}
+
+// statusTopicSink publishes the evaluated status of every group to a compacted topic, keyed by cluster and
+// group, so other services get the health of the consumers with the kafka tooling: a consumer reading the
+// topic from the start gets the last status of every group, and the groups gone are deleted by tombstones
+type statusTopicSink struct {
+	topic    string
+	client   sarama.Client
+	producer sarama.SyncProducer
+	interval time.Duration
+	last     time.Time
+	// keys published, to send the tombstones of the groups gone
+	published map[string]bool
+}
+
+// newStatusTopicSink takes the brokers option, topic, burrowx-status by default, intervalSeconds, every sweep
+// by default, tls and saslUsername/saslPassword. With create the topic is created compacted if missing,
+// with partitions (default 1) and replicationFactor (default 3)
+func newStatusTopicSink(cluster string, options map[string]string) (Sink, error) {
+	if options["brokers"] == "" {
+		return nil, errors.New("no brokers")
+	}
+	s := &statusTopicSink{topic: options["topic"], published: make(map[string]bool)}
+	if s.topic == "" {
+		s.topic = "burrowx-status"
+	}
+	if v := options["intervalSeconds"]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid intervalSeconds %s", v)
+		}
+		s.interval = time.Duration(seconds) * time.Second
+	}
+	var err error
+	if s.client, s.producer, err = newSinkProducer("burrowx-status", s.topic, "compact", options); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newSinkProducer connects to the brokers option with tls and saslUsername/saslPassword, with create the topic is
+// created with the cleanup policy if missing, with partitions (default 1) and replicationFactor (default 3)
+func newSinkProducer(clientID, topic, cleanupPolicy string, options map[string]string) (sarama.Client, sarama.SyncProducer, error) {
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V0_10_2_0
+	cfg.ClientID = clientID
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	if options["tls"] == "true" {
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = &tls.Config{}
+	}
+	if options["saslUsername"] != "" {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.User = options["saslUsername"]
+		cfg.Net.SASL.Password = options["saslPassword"]
+	}
+	brokers := strings.Split(options["brokers"], ",")
+	client, err := sarama.NewClient(brokers, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if options["create"] == "true" {
+		if err := createSinkTopic(client, brokers, cfg, topic, cleanupPolicy, options); err != nil {
+			client.Close()
+			return nil, nil, err
+		}
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, producer, nil
+}
+
+func createSinkTopic(client sarama.Client, brokers []string, cfg *sarama.Config, name, cleanupPolicy string, options map[string]string) error {
+	partitions, replicationFactor := 1, 3
+	var err error
+	if v := options["partitions"]; v != "" {
+		if partitions, err = strconv.Atoi(v); err != nil || partitions <= 0 {
+			return fmt.Errorf("invalid partitions %s", v)
+		}
+	}
+	if v := options["replicationFactor"]; v != "" {
+		if replicationFactor, err = strconv.Atoi(v); err != nil || replicationFactor <= 0 {
+			return fmt.Errorf("invalid replicationFactor %s", v)
+		}
+	}
+	topics, err := client.Topics()
+	if err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if topic == name {
+			return nil
+		}
+	}
+	admin, err := sarama.NewClusterAdmin(brokers, cfg)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	err = admin.CreateTopic(name, &sarama.TopicDetail{
+		NumPartitions:     int32(partitions),
+		ReplicationFactor: int16(replicationFactor),
+		ConfigEntries:     map[string]*string{"cleanup.policy": &cleanupPolicy},
+	}, false)
+	if terr, ok := err.(*sarama.TopicError); ok && terr.Err == sarama.ErrTopicAlreadyExists {
+		return nil
+	}
+	return err
+}
+
+func (s *statusTopicSink) Name() string { return "kafka" }
+
+func (s *statusTopicSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	now := clockNow()
+	if s.interval > 0 && now.Sub(s.last) < s.interval {
+		return nil
+	}
+	msgs := make([]*sarama.ProducerMessage, 0, len(statuses))
+	keys := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		data, err := EncodeJSON(status)
+		if err != nil {
+			return err
+		}
+		key := cluster + "/" + status.Group
+		keys[key] = true
+		msgs = append(msgs, &sarama.ProducerMessage{Topic: s.topic, Key: sarama.StringEncoder(key), Value: sarama.ByteEncoder(data)})
+	}
+	for key := range s.published {
+		if !keys[key] {
+			msgs = append(msgs, &sarama.ProducerMessage{Topic: s.topic, Key: sarama.StringEncoder(key)})
+		}
+	}
+	if len(msgs) > 0 {
+		if err := s.producer.SendMessages(msgs); err != nil {
+			return err
+		}
+	}
+	s.published = keys
+	s.last = now
+	return nil
+}
+
+func (s *statusTopicSink) Close() error {
+	if err := s.producer.Close(); err != nil {
+		return err
+	}
+	return s.client.Close()
+}
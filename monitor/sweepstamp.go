@@ -0,0 +1,62 @@
+package monitor
+
+import "time"
+
+// sweepStamp is the sweep a log end offset was fetched in: its sequence number, counted from 1 since the start of
+// the client, and when the response of its broker arrived in ms, on the monotonic clock of the process, so the time
+// lag doesn't jump with the wall clock of the host nor depend on the clocks of the brokers and consumers
+type sweepStamp struct {
+	seq int
+	at  int64
+}
+
+// monotonicMs returns t in ms on the timeline of the client, its wall clock at start plus the monotonic time since
+func (client *KafkaClient) monotonicMs(t time.Time) int64 {
+	return (client.started.UnixNano() + int64(t.Sub(client.started))) / int64(time.Millisecond)
+}
+
+// stampOffsets stamps the log end offsets of a broker response with the sweep in progress
+func (client *KafkaClient) stampOffsets(topicOffsetMap map[string]map[int32]int64, seq int) {
+	stamp := sweepStamp{seq: seq, at: client.monotonicMs(clockNow())}
+	withWriteLock(client.topicOffsetMapLock, func() {
+		for topic, partitions := range topicOffsetMap {
+			if _, ok := client.topicOffsetStamp[topic]; !ok {
+				client.topicOffsetStamp[topic] = make(map[int32]sweepStamp, len(partitions))
+			}
+			for partition := range partitions {
+				client.topicOffsetStamp[topic][partition] = stamp
+			}
+		}
+	})
+}
+
+// offsetAt returns when the log end offset of a partition of an evaluation was fetched, the timestamp of the
+// evaluation if it isn't stamped, e.g. restored from a state export or replayed
+func offsetAt(e *Evaluation, offset LogOffset) float64 {
+	if offset.sweptAt > 0 {
+		return float64(offset.sweptAt)
+	}
+	return float64(e.Timestamp)
+}
+
+// evaluationAt returns when the sweep of an evaluation was made, the timestamp of the evaluation if it isn't stamped
+func evaluationAt(e *Evaluation) float64 {
+	if e.sweptAt > 0 {
+		return float64(e.sweptAt)
+	}
+	return float64(e.Timestamp)
+}
+
+// stamp sets the sweep of an evaluation and when it was made from the latest offsets it holds
+func (e *Evaluation) stamp() {
+	for _, partitions := range e.offsets {
+		for _, offset := range partitions {
+			if offset.Sweep > e.Sweep {
+				e.Sweep = offset.Sweep
+			}
+			if offset.sweptAt > e.sweptAt {
+				e.sweptAt = offset.sweptAt
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"regexp"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+type tenantRule struct {
+	name    string
+	cluster string
+	group   *regexp.Regexp
+}
+
+// Tenants resolves the tenant of the groups from the tenant rules and the tenant of their cluster
+type Tenants struct {
+	rules []*tenantRule
+	//cluster => tenant of its unmatched groups
+	clusters map[string]string
+}
+
+// NewTenants compiles the tenant rules of the config, which Validate checked
+func NewTenants(cfg *config.Config) *Tenants {
+	t := &Tenants{clusters: make(map[string]string, len(cfg.Kafka))}
+	for _, rule := range cfg.Tenants {
+		t.rules = append(t.rules, &tenantRule{name: rule.Name, cluster: rule.Cluster, group: regexp.MustCompile(rule.Group)})
+	}
+	for name, k := range cfg.Kafka {
+		t.clusters[name] = k.Tenant
+	}
+	return t
+}
+
+// Of returns the tenant of a group, empty if it has none
+func (t *Tenants) Of(cluster, group string) string {
+	for _, rule := range t.rules {
+		if (rule.cluster == "" || rule.cluster == cluster) && rule.group.MatchString(group) {
+			return rule.name
+		}
+	}
+	return t.clusters[cluster]
+}
+
+// Cluster returns the tenant of a cluster itself
+func (t *Tenants) Cluster(cluster string) string {
+	return t.clusters[cluster]
+}
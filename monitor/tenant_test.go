@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+func TestTenantsOf(t *testing.T) {
+	cfg := &config.Config{}
+	if err := json.Unmarshal([]byte(`{
+		"kafka": {"local": {"tenant": "platform"}, "eu": {}},
+		"tenants": [
+			{"name": "payments", "cluster": "eu", "group": "^billing"},
+			{"name": "payments-eu", "group": "^billing-eu"},
+			{"name": "search", "group": "^(indexer|crawler)$"}
+		]
+	}`), cfg); err != nil {
+		t.Fatal(err)
+	}
+	tenants := NewTenants(cfg)
+	for _, c := range []struct {
+		cluster, group, tenant string
+	}{
+		{"eu", "billing-eu", "payments"},
+		// the rule of the eu cluster doesn't apply to the others
+		{"local", "billing-eu", "payments-eu"},
+		{"local", "billing", "platform"},
+		{"eu", "indexer", "search"},
+		{"eu", "indexer-v2", ""},
+		{"local", "indexer-v2", "platform"},
+		{"unknown", "audit", ""},
+	} {
+		if tenant := tenants.Of(c.cluster, c.group); tenant != c.tenant {
+			t.Errorf("tenant of %s on %s is %q, want %q", c.group, c.cluster, tenant, c.tenant)
+		}
+	}
+	if tenant := tenants.Cluster("local"); tenant != "platform" {
+		t.Errorf("tenant of the local cluster is %q, want platform", tenant)
+	}
+}
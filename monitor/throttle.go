@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+// writeThrottle is a token bucket of consumer_metrics points shared by the importers of all clusters,
+// which write to the same influxdb, it holds one sweep's worth of points so the bursts of a sweep pass
+// as long as the average rate holds
+type writeThrottle struct {
+	lock     sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+var (
+	throttleLock sync.Mutex
+	//influxdb hosts => throttle
+	throttles = make(map[string]*writeThrottle)
+)
+
+// sharedThrottle returns the throttle of the influxdb hosts, nil if the rate is unlimited
+func sharedThrottle(hosts string, rate float64) *writeThrottle {
+	if rate <= 0 {
+		return nil
+	}
+	throttleLock.Lock()
+	defer throttleLock.Unlock()
+	t, ok := throttles[hosts]
+	if !ok {
+		t = newWriteThrottle(rate)
+		throttles[hosts] = t
+	}
+	return t
+}
+
+func newWriteThrottle(rate float64) *writeThrottle {
+	capacity := rate * float64(METRIC_FETCH_INTERVAL_SECOND)
+	return &writeThrottle{rate: rate, capacity: capacity, tokens: capacity, last: clockNow()}
+}
+
+// newSinkThrottles returns the throttles of the sinks of a cluster, in the order of the sinks, nil for the sinks
+// without maxPointsPerSecond. Unlike the one of influxdb, the throttle of a sink isn't shared by the clusters.
+func newSinkThrottles(cfg *config.Config, cluster string, sinks []Sink) []*writeThrottle {
+	throttles := make([]*writeThrottle, len(sinks))
+	for i, sc := range cfg.SinksOf(cluster) {
+		if i < len(sinks) && sc.MaxPointsPerSecond > 0 {
+			throttles[i] = newWriteThrottle(sc.MaxPointsPerSecond)
+		}
+	}
+	return throttles
+}
+
+// take reports whether n points may be written now, and takes them if so
+func (t *writeThrottle) take(n int) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.refill()
+	if t.tokens < float64(n) {
+		return false
+	}
+	t.tokens -= float64(n)
+	return true
+}
+
+// force takes n points which are written anyway, the bucket may go below zero
+func (t *writeThrottle) force(n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.refill()
+	t.tokens -= float64(n)
+}
+
+func (t *writeThrottle) refill() {
+	now := clockNow()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.capacity {
+		t.tokens = t.capacity
+	}
+	t.last = now
+}
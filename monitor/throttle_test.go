@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/sundy-li/burrowx/config"
+)
+
+func TestSharedThrottle(t *testing.T) {
+	if sharedThrottle("influx-a:8086", 0) != nil {
+		t.Error("a throttle for an unlimited rate")
+	}
+	a := sharedThrottle("influx-a:8086", 100)
+	if a == nil || sharedThrottle("influx-a:8086", 100) != a {
+		t.Error("the clusters writing to the same influxdb don't share its throttle")
+	}
+	if sharedThrottle("influx-b:8086", 100) == a {
+		t.Error("two influxdb share a throttle")
+	}
+}
+
+func TestConsumerPointsThrottled(t *testing.T) {
+	useFakeClock()
+	defer SetClock(realClock{})
+	cfg := &config.Config{}
+	// nothing is written
+	cfg.Influxdb.Hosts = "http://127.0.0.1:8086"
+	i, err := NewImporter(cfg, "local", metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.throttle = newWriteThrottle(1)
+	i.throttle.tokens = 4
+	for n, c := range []struct {
+		partitions int
+		// points written, of the partitions or their aggregate, and the tokens left
+		points    int
+		aggregate bool
+		tokens    float64
+	}{
+		{3, 3, false, 1},
+		{3, 1, true, 0},
+		// the aggregate of a single partition saves nothing
+		{1, 1, false, -1},
+	} {
+		msg := &ConsumerFullOffset{Cluster: "local", Group: "billing", Topic: "orders", Timestamp: clockStart.Unix() * 1000,
+			partitionMap: make(map[int32]LogOffset, c.partitions)}
+		for p := 0; p < c.partitions; p++ {
+			msg.partitionMap[int32(p)] = LogOffset{Logsize: 100, Offset: 90, Lag: 10}
+		}
+		pts := i.consumerPoints(msg)
+		if len(pts) != c.points || (pts[0].Tags()["aggregate"] == "true") != c.aggregate || i.throttle.tokens != c.tokens {
+			t.Errorf("sweep %d: %d points, aggregate %v, %v tokens left, want %d, %v, %v",
+				n, len(pts), pts[0].Tags()["aggregate"] == "true", i.throttle.tokens, c.points, c.aggregate, c.tokens)
+		}
+	}
+	if n := i.throttledPoints.Count(); n != 3 {
+		t.Errorf("%d throttled points, want the 3 partitions replaced by their aggregate", n)
+	}
+}
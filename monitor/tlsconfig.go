@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+)
+
+// profileTLS checks the tls fields of a profile and builds the tls config of its clients, which is returned
+// even if tls is disabled since the managed clusters enable it
+func profileTLS(p *config.Profile, log *logrus.Entry) (bool, *tls.Config, error) {
+	if err := p.CheckTLS(); err != nil {
+		return false, nil, err
+	}
+	if !p.TLSEnabled() {
+		if p.HasTLSFields() {
+			log.Warnf("The tls fields of the client profile are ignored, tls is disabled")
+		}
+		return false, &tls.Config{}, nil
+	}
+	c := &tls.Config{InsecureSkipVerify: p.TLSNoVerify}
+	if p.TLSCAFilePath != "" || p.TLSSystemCA {
+		pool := x509.NewCertPool()
+		if p.TLSSystemCA {
+			var err error
+			if pool, err = x509.SystemCertPool(); err != nil {
+				return false, nil, fmt.Errorf("cannot load the system CAs: %v", err)
+			}
+		}
+		if p.TLSCAFilePath != "" {
+			caCert, err := ioutil.ReadFile(p.TLSCAFilePath)
+			if err != nil {
+				return false, nil, err
+			}
+			if !pool.AppendCertsFromPEM(caCert) {
+				return false, nil, fmt.Errorf("no certificate in %s", p.TLSCAFilePath)
+			}
+		}
+		c.RootCAs = pool
+	}
+	if p.TLSCertFilePath != "" {
+		cert, err := tls.LoadX509KeyPair(p.TLSCertFilePath, p.TLSKeyFilePath)
+		if err != nil {
+			return false, nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return true, c, nil
+}
@@ -0,0 +1,73 @@
+package monitor
+
+// TopicStats derives the message-in rate of the topics from the log end offsets of consecutive sweeps. Only
+// the sweeps use it, and the loop of the client runs them one at a time, so it has no lock.
+type TopicStats struct {
+	cluster string
+	//topic => sum of the log end offsets at the last sweep
+	last   map[string]int64
+	lastTs int64
+	// of the last sweep
+	stats []*TopicStat
+}
+
+// TopicStat is the throughput of a topic, the retention fields are only set when the log start offsets are fetched
+type TopicStat struct {
+	Cluster    string  `json:"cluster"`
+	Topic      string  `json:"topic"`
+	Timestamp  int64   `json:"timestamp"`
+	Partitions int     `json:"partitions"`
+	Logsize    int64   `json:"logsize"`
+	InRate     float64 `json:"in_rate"`
+	// messages retained on the brokers, and how long they last at the current rate
+	Retained        int64   `json:"retained,omitempty"`
+	RetainedSeconds float64 `json:"retained_seconds,omitempty"`
+	// if the topic configs are described
+	Config *TopicConfig `json:"config,omitempty"`
+}
+
+func NewTopicStats(cluster string) *TopicStats {
+	return &TopicStats{
+		cluster: cluster,
+		last:    make(map[string]int64),
+	}
+}
+
+// update computes the stats of the topics of this sweep, the rate of a topic is 0 on its first sweep
+// or if its offsets went backwards, e.g. after it was recreated. A sweep at the timestamp of the previous
+// one, e.g. the extra sweep asked when partitions are added within an interval, has no elapsed time to
+// derive a rate from: it returns the stats of the previous sweep and fresh is false, they're already written
+func (t *TopicStats) update(ts int64, topicOffset, topicStartOffset map[string]map[int32]int64) (stats []*TopicStat, fresh bool) {
+	if t.stats != nil && ts == t.lastTs {
+		return t.stats, false
+	}
+	stats = make([]*TopicStat, 0, len(topicOffset))
+	last := make(map[string]int64, len(topicOffset))
+	seconds := float64(ts-t.lastTs) / 1000
+	for topic, partitions := range topicOffset {
+		stat := &TopicStat{
+			Cluster:    t.cluster,
+			Topic:      topic,
+			Timestamp:  ts,
+			Partitions: len(partitions),
+		}
+		for _, offset := range partitions {
+			stat.Logsize += offset
+		}
+		if previous, ok := t.last[topic]; ok && seconds > 0 && stat.Logsize >= previous {
+			stat.InRate = float64(stat.Logsize-previous) / seconds
+		}
+		if starts, ok := topicStartOffset[topic]; ok && len(starts) == len(partitions) {
+			for partition, offset := range partitions {
+				stat.Retained += offset - starts[partition]
+			}
+			if stat.InRate > 0 {
+				stat.RetainedSeconds = float64(stat.Retained) / stat.InRate
+			}
+		}
+		last[topic] = stat.Logsize
+		stats = append(stats, stat)
+	}
+	t.last, t.lastTs, t.stats = last, ts, stats
+	return stats, true
+}
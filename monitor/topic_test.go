@@ -0,0 +1,21 @@
+package monitor
+
+import "testing"
+
+func TestTopicStatsSameTimestamp(t *testing.T) {
+	stats := NewTopicStats("local")
+	stats.update(60000, map[string]map[int32]int64{"orders": {0: 100}}, nil)
+	first, fresh := stats.update(120000, map[string]map[int32]int64{"orders": {0: 700}}, nil)
+	if !fresh || first[0].InRate != 10 {
+		t.Fatalf("in rate %v, fresh %v, want 10 messages/s", first[0].InRate, fresh)
+	}
+	// the extra sweep of an added partition within the same interval
+	again, fresh := stats.update(120000, map[string]map[int32]int64{"orders": {0: 720, 1: 0}}, nil)
+	if fresh || again[0].InRate != 10 {
+		t.Errorf("the sweep at the same timestamp returned the in rate %v, fresh %v", again[0].InRate, fresh)
+	}
+	next, _ := stats.update(180000, map[string]map[int32]int64{"orders": {0: 1300, 1: 0}}, nil)
+	if next[0].InRate != 10 {
+		t.Errorf("in rate %v after the repeated sweep, want 10", next[0].InRate)
+	}
+}
@@ -0,0 +1,359 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+const (
+	// the spans are exported once this many are finished, or every TRACE_EXPORT_INTERVAL_SECOND
+	TRACE_EXPORT_BATCH           = 256
+	TRACE_EXPORT_INTERVAL_SECOND = 5
+	// finished spans waiting for the export, the spans past it are dropped
+	TRACE_QUEUE_SIZE = 4096
+)
+
+// tracer exports the spans of the sweeps, of the decoding of the commits, of the writes of the importer and
+// the sinks and of the canary to an OTLP/HTTP collector, in the json encoding of OTLP. No OpenTelemetry SDK
+// is vendored, it builds the export requests itself. The spans measure real time, not the clock of the monitor.
+type tracer struct {
+	url      string
+	headers  map[string]string
+	ratio    float64
+	resource []otlpAttribute
+	http     *http.Client
+	log      *logrus.Entry
+
+	queue   chan *span
+	flushes chan chan struct{}
+	dropped int64
+}
+
+var (
+	tracerLock sync.Mutex
+	//endpoint => tracer
+	tracers = make(map[string]*tracer)
+)
+
+// sharedTracer returns the tracer of the config, nil if tracing is disabled, one tracer exports the spans of
+// all clusters
+func sharedTracer(cfg *config.Config) *tracer {
+	if cfg.Tracing.Endpoint == "" {
+		return nil
+	}
+	tracerLock.Lock()
+	defer tracerLock.Unlock()
+	if t, ok := tracers[cfg.Tracing.Endpoint]; ok {
+		return t
+	}
+	id := NewIdentity(cfg)
+	t := &tracer{
+		url:     strings.TrimSuffix(cfg.Tracing.Endpoint, "/") + "/v1/traces",
+		headers: cfg.Tracing.Headers,
+		ratio:   cfg.Tracing.SampleRatio,
+		resource: []otlpAttribute{
+			newOTLPAttribute("service.name", "burrowx"),
+			newOTLPAttribute("service.version", id.Version),
+			newOTLPAttribute("service.instance.id", id.Instance),
+			newOTLPAttribute("host.name", id.Host),
+		},
+		http:    &http.Client{Timeout: 10 * time.Second},
+		log:     mylog.Module("tracing"),
+		queue:   make(chan *span, TRACE_QUEUE_SIZE),
+		flushes: make(chan chan struct{}),
+	}
+	go t.run()
+	tracers[cfg.Tracing.Endpoint] = t
+	return t
+}
+
+// flushTracers exports the finished spans of the tracers, until ctx is done
+func flushTracers(ctx context.Context) {
+	tracerLock.Lock()
+	all := make([]*tracer, 0, len(tracers))
+	for _, t := range tracers {
+		all = append(all, t)
+	}
+	tracerLock.Unlock()
+	for _, t := range all {
+		done := make(chan struct{})
+		select {
+		case t.flushes <- done:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run exports the spans in batches until the process exits
+func (t *tracer) run() {
+	ticker := time.NewTicker(TRACE_EXPORT_INTERVAL_SECOND * time.Second)
+	defer ticker.Stop()
+	batch := make([]*span, 0, TRACE_EXPORT_BATCH)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			t.log.Warnf("Cannot export %d spans to %s: %v", len(batch), t.url, err)
+		}
+		if dropped := atomic.SwapInt64(&t.dropped, 0); dropped > 0 {
+			t.log.Warnf("Dropped %d spans, the export is too slow", dropped)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= TRACE_EXPORT_BATCH {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-t.flushes:
+			for n := len(t.queue); n > 0; n-- {
+				batch = append(batch, <-t.queue)
+			}
+			export()
+			close(done)
+		}
+	}
+}
+
+// span is an operation of a trace, nil if it isn't traced, its methods do nothing then
+type span struct {
+	tracer  *tracer
+	traceID [16]byte
+	id      [8]byte
+	parent  [8]byte
+	name    string
+	start   time.Time
+	end     time.Time
+
+	lock  sync.Mutex
+	attrs map[string]interface{}
+	err   error
+}
+
+type spanKey struct{}
+
+// startSpan starts a span, the child of the span of ctx if it has one, else the root of a new trace if the
+// tracer samples it, and returns ctx with the span
+func startSpan(ctx context.Context, t *tracer, name string) (context.Context, *span) {
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok && parent != nil {
+		s := &span{tracer: parent.tracer, traceID: parent.traceID, parent: parent.id, name: name, start: time.Now()}
+		rand.Read(s.id[:])
+		return context.WithValue(ctx, spanKey{}, s), s
+	}
+	if t == nil || mathrand.Float64() >= t.ratio {
+		return ctx, nil
+	}
+	s := &span{tracer: t, name: name, start: time.Now()}
+	rand.Read(s.traceID[:])
+	rand.Read(s.id[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// startRemoteSpan starts a span child of a span of another process, from its W3C traceparent,
+// nil if the traceparent is invalid or not sampled
+func startRemoteSpan(t *tracer, traceparent, name string, start time.Time) *span {
+	// version-traceid-spanid-flags
+	parts := strings.Split(traceparent, "-")
+	if t == nil || len(parts) != 4 || parts[3] != "01" {
+		return nil
+	}
+	s := &span{tracer: t, name: name, start: start}
+	if n, err := hex.Decode(s.traceID[:], []byte(parts[1])); err != nil || n != 16 {
+		return nil
+	}
+	if n, err := hex.Decode(s.parent[:], []byte(parts[2])); err != nil || n != 8 {
+		return nil
+	}
+	rand.Read(s.id[:])
+	return s
+}
+
+// setAttr sets an attribute of the span, a string, bool, int, int32, int64 or float64
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// finish ends the span, failed if err isn't nil, and queues it for the export
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.end, s.err = time.Now(), err
+	s.lock.Unlock()
+	select {
+	case s.tracer.queue <- s:
+	default:
+		atomic.AddInt64(&s.tracer.dropped, 1)
+	}
+}
+
+// TraceID is the hex id of the trace of the span, empty if it isn't traced
+func (s *span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// traceparent is the W3C traceparent of the span, to carry the trace to another process, empty if it isn't traced
+func (s *span) traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.id[:]) + "-01"
+}
+
+// the json encoding of the ExportTraceServiceRequest of OTLP
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	// 2 is error
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// the 64 bits integers are strings in the json encoding of OTLP
+func newOTLPAttribute(key string, value interface{}) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value = map[string]interface{}{"stringValue": v}
+	case bool:
+		a.Value = map[string]interface{}{"boolValue": v}
+	case int:
+		a.Value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int32:
+		a.Value = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		a.Value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		a.Value = map[string]interface{}{"doubleValue": v}
+	default:
+		a.Value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return a
+}
+
+// export posts a batch of spans to the collector
+func (t *tracer) export(batch []*span) error {
+	scope := otlpScopeSpans{Spans: make([]*otlpSpan, 0, len(batch))}
+	scope.Scope.Name, scope.Scope.Version = "burrowx", Version
+	var empty [8]byte
+	for _, s := range batch {
+		s.lock.Lock()
+		os := &otlpSpan{
+			TraceID: hex.EncodeToString(s.traceID[:]),
+			SpanID:  hex.EncodeToString(s.id[:]),
+			Name:    s.name,
+			// internal
+			Kind:  1,
+			Start: strconv.FormatInt(s.start.UnixNano(), 10),
+			End:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != empty {
+			os.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for key, value := range s.attrs {
+			os.Attributes = append(os.Attributes, newOTLPAttribute(key, value))
+		}
+		if s.err != nil {
+			os.Status = &otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		s.lock.Unlock()
+		scope.Spans = append(scope.Spans, os)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = t.resource
+	data, err := json.Marshal(&otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return nil
+}
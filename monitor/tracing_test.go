@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sundy-li/burrowx/config"
+)
+
+func TestTracingExport(t *testing.T) {
+	var lock sync.Mutex
+	var exported []*otlpSpan
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		auth = r.Header.Get("Authorization")
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				exported = append(exported, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	cfg := &config.Config{}
+	cfg.Tracing.Endpoint = collector.URL
+	cfg.Tracing.SampleRatio = 1
+	cfg.Tracing.Headers = map[string]string{"Authorization": "Bearer secret"}
+	tracer := sharedTracer(cfg)
+	if sharedTracer(cfg) != tracer {
+		t.Fatal("the tracer of an endpoint isn't shared")
+	}
+
+	ctx, sweep := startSpan(context.Background(), tracer, "sweep")
+	sweep.setAttr("cluster", "local")
+	_, broker := startSpan(ctx, nil, "broker.list_offsets")
+	broker.setAttr("broker", int32(1))
+	broker.finish(errors.New("broker down"))
+	sweep.finish(nil)
+	// the canary consumption joins the trace of its probe from the traceparent of the message
+	consume := startRemoteSpan(tracer, sweep.traceparent(), "canary.consume", time.Now())
+	consume.finish(nil)
+	if _, untraced := startSpan(context.Background(), nil, "importer.write"); untraced != nil {
+		t.Error("a span without parent nor tracer is traced")
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	flushTracers(flushCtx)
+	lock.Lock()
+	defer lock.Unlock()
+	if len(exported) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(exported))
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("exported with the authorization %q", auth)
+	}
+	spans := make(map[string]*otlpSpan)
+	for _, s := range exported {
+		spans[s.Name] = s
+	}
+	root, child, remote := spans["sweep"], spans["broker.list_offsets"], spans["canary.consume"]
+	if root == nil || child == nil || remote == nil {
+		t.Fatalf("exported %+v", exported)
+	}
+	if root.ParentSpanID != "" || child.ParentSpanID != root.SpanID || remote.ParentSpanID != root.SpanID {
+		t.Errorf("parents %q, %q and %q, want none and %q", root.ParentSpanID, child.ParentSpanID, remote.ParentSpanID, root.SpanID)
+	}
+	if child.TraceID != root.TraceID || remote.TraceID != root.TraceID || len(root.TraceID) != 32 {
+		t.Errorf("traces %q, %q and %q, want the one of the sweep", root.TraceID, child.TraceID, remote.TraceID)
+	}
+	if child.Status == nil || child.Status.Code != 2 || child.Status.Message != "broker down" {
+		t.Errorf("status of the failed request %+v", child.Status)
+	}
+	if len(child.Attributes) != 1 || child.Attributes[0].Value["intValue"] != "1" {
+		t.Errorf("attributes of the request %+v", child.Attributes)
+	}
+}
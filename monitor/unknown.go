@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"sort"
+	"strings"
+)
+
+// monitorsTopic reports whether the topic would be monitored once the metadata knows it
+func (client *KafkaClient) monitorsTopic(topic string) bool {
+	if topics := client.cfg.Kafka[client.cluster].Topics; len(topics) > 0 {
+		for _, t := range topics {
+			if t == topic {
+				return true
+			}
+		}
+		return false
+	}
+	if internalTopic(client.cfg.Kafka[client.cluster].Flavor, topic) {
+		return false
+	}
+	for _, reg := range client.topicFilterRegexps {
+		if reg.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveUnknownTopics handles the groups consuming topics missing from the cached metadata, e.g. created since
+// its last refresh, according to general.unknownTopics. pending is topic => groups consuming it, the resolved
+// topics are added to topicMap and their pairings to topic2Consumer
+func (client *KafkaClient) resolveUnknownTopics(pending, topic2Consumer map[string]map[string]bool, topicMap map[string]int) {
+	if len(pending) == 0 {
+		return
+	}
+	topics := make([]string, 0, len(pending))
+	for topic := range pending {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	switch client.cfg.General.UnknownTopics {
+	case "warn":
+		for _, topic := range topics {
+			client.warnLimiter.warnf(client.log.WithField("topic", topic), "unknown-topic:"+topic,
+				"Groups %s consume a topic the metadata doesn't know yet, skipped until it does", strings.Join(groupNames(pending[topic]), ","))
+		}
+	case "refresh":
+		// all the metadata, the metadata of the topics would create the deleted ones on brokers auto creating topics
+		if err := client.backend.RefreshMetadata(); err != nil {
+			client.warnLimiter.warnf(client.log, "unknown-topics", "Cannot refresh the metadata of the unknown topics: %v", err)
+			break
+		}
+		for _, topic := range topics {
+			partitions, err := client.backend.Partitions(topic)
+			if err != nil || len(partitions) == 0 {
+				continue
+			}
+			topicMap[topic] = len(partitions)
+			if _, ok := topic2Consumer[topic]; !ok {
+				topic2Consumer[topic] = make(map[string]bool)
+			}
+			for group := range pending[topic] {
+				topic2Consumer[topic][group] = true
+			}
+			client.log.WithField("topic", topic).Infof("Monitoring the new topic of %d partitions", len(partitions))
+			delete(pending, topic)
+		}
+	}
+	for _, groups := range pending {
+		client.unknownTopics.Inc(int64(len(groups)))
+	}
+}
+
+func groupNames(groups map[string]bool) []string {
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,294 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+func init() {
+	RegisterSink("webhook", newWebhookSink)
+}
+
+var ErrUnknownNotifier = errors.New("unknown notifier")
+
+// Notifier is a sink sending alerts, it can send a synthetic one to check the integration without waiting for lag
+type Notifier interface {
+	Sink
+	Test() error
+}
+
+// Alert is the data of the notifier templates, the change of the status of a group
+type Alert struct {
+	Cluster   string
+	Group     string
+	Team      string
+	Previous  Status
+	Status    Status
+	Timestamp int64
+	TotalLag  int64
+	TimeLag   float64
+	Worst     *PartitionStatus
+	// sent by the test endpoint
+	Test bool
+}
+
+// Text is a one line summary of the alert
+func (a *Alert) Text() string {
+	text := fmt.Sprintf("[%s] %s %s -> %s, lag %d", a.Cluster, a.Group, a.Previous, a.Status, a.TotalLag)
+	if a.Worst != nil && a.Worst.Status != StatusOK {
+		text += fmt.Sprintf(", %s on %s/%d", a.Worst.Status, a.Worst.Topic, a.Worst.Partition)
+	}
+	if a.Test {
+		text = "test alert from burrowx: " + text
+	}
+	return text
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// notifierTemplates are the built in payloads of the webhook notifier
+var notifierTemplates = map[string]string{
+	"generic": `{"cluster":{{json .Cluster}},"group":{{json .Group}},"team":{{json .Team}},"previous":"{{.Previous}}","status":"{{.Status}}",` +
+		`"total_lag":{{.TotalLag}},"time_lag":{{.TimeLag}},"timestamp":{{.Timestamp}},"worst":{{json .Worst}},"test":{{.Test}},"text":{{json .Text}}}`,
+	"slack": `{"text":{{json .Text}}}`,
+	"teams": `{"@type":"MessageCard","@context":"http://schema.org/extensions","summary":{{json .Text}},` +
+		`"themeColor":"{{if eq .Status.String "OK"}}2DC72D{{else}}D7000C{{end}}","text":{{json .Text}}}`,
+}
+
+// webhookSink posts the rendered template for every status change of a group, in the background like the grafana annotations
+type webhookSink struct {
+	name     string
+	cluster  string
+	url      string
+	template *template.Template
+	// the templates are rendered with a BurrowEvent instead of an Alert
+	burrow bool
+	extras map[string]string
+	lock   sync.Mutex
+	//group => its incident, for the burrow format
+	incidents map[string]*burrowIncident
+	// only the alerts routed to this notifier by the owner of their group
+	ownedOnly bool
+	http      *http.Client
+	log       *logrus.Entry
+	// the alerts of a sweep are sent once the ones of the previous sweep are, Close waits for them
+	sending  sync.WaitGroup
+	lastSent chan struct{}
+}
+
+// newWebhookSink takes the url option, the name of the notifier, webhook by default, and the template,
+// generic, slack, teams or burrow, or templateFile, a text/template rendered with an Alert, or with a BurrowEvent
+// and the extras.<name> options if format is burrow, with ownedOnly=true it only sends the alerts the owners route to it
+func newWebhookSink(cluster string, options map[string]string) (Sink, error) {
+	s := &webhookSink{
+		name:      options["name"],
+		cluster:   cluster,
+		url:       options["url"],
+		ownedOnly: options["ownedOnly"] == "true",
+		burrow:    options["format"] == "burrow" || options["template"] == "burrow",
+		extras:    make(map[string]string),
+		incidents: make(map[string]*burrowIncident),
+		http:      &http.Client{Timeout: 10 * time.Second},
+		log:       mylog.Module("webhook").WithField("cluster", cluster),
+	}
+	if s.url == "" {
+		return nil, errors.New("no url")
+	}
+	if s.name == "" {
+		s.name = "webhook"
+	}
+	s.log = s.log.WithField("notifier", s.name)
+	if format := options["format"]; format != "" && format != "burrowx" && format != "burrow" {
+		return nil, fmt.Errorf("unknown format %s, burrowx or burrow", format)
+	}
+	for name, value := range options {
+		if strings.HasPrefix(name, "extras.") {
+			s.extras[strings.TrimPrefix(name, "extras.")] = value
+		}
+	}
+	funcs := templateFuncs
+	text, ok := notifierTemplates["generic"]
+	if s.burrow {
+		funcs, text = burrowTemplateFuncs, burrowTemplate
+	}
+	if file := options["templateFile"]; file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	} else if name := options["template"]; name != "" && name != "burrow" {
+		if s.burrow {
+			return nil, fmt.Errorf("template %s isn't of the burrow format", name)
+		}
+		if text, ok = notifierTemplates[name]; !ok {
+			return nil, fmt.Errorf("unknown template %s, generic, slack, teams or burrow", name)
+		}
+	}
+	var err error
+	s.template, err = template.New(s.name).Funcs(funcs).Parse(text)
+	return s, err
+}
+
+func (s *webhookSink) Name() string { return s.name }
+
+func (s *webhookSink) Save(cluster string, groupOffsets map[string][]*ConsumerFullOffset, statuses []*GroupStatus) error {
+	if s.burrow {
+		s.pruneIncidents(statuses)
+	}
+	var alerts []interface{}
+	for _, status := range statuses {
+		if len(status.Window) < 2 {
+			continue
+		}
+		previous := status.Window[len(status.Window)-2].Status
+		if previous == status.Status || !s.routed(status) {
+			continue
+		}
+		if s.burrow {
+			alerts = append(alerts, s.burrowEvent(status))
+			continue
+		}
+		alerts = append(alerts, &Alert{
+			Cluster:   status.Cluster,
+			Group:     status.Group,
+			Team:      status.Team,
+			Previous:  previous,
+			Status:    status.Status,
+			Timestamp: status.Timestamp,
+			TotalLag:  status.TotalLag,
+			TimeLag:   status.TimeLag,
+			Worst:     status.Worst,
+		})
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	previous, sent := s.lastSent, make(chan struct{})
+	s.lastSent = sent
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		defer close(sent)
+		if previous != nil {
+			<-previous
+		}
+		for _, alert := range alerts {
+			if err := s.send(alert); err != nil {
+				s.log.Warnf("Cannot send alert: %v", err)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// routed reports whether the alerts of a group go to this notifier: the ones of a team with notifiers go to these only,
+// the others to the notifiers which aren't ownedOnly, and with alerting routes to the ones of the matching routes
+func (s *webhookSink) routed(status *GroupStatus) bool {
+	if len(status.Notifiers) == 0 && s.ownedOnly {
+		return false
+	}
+	return status.RoutedTo(s.name)
+}
+
+// pruneIncidents forgets the incidents of the groups the sweep didn't evaluate, purged or expired, which won't
+// get back to OK
+func (s *webhookSink) pruneIncidents(statuses []*GroupStatus) {
+	evaluated := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		evaluated[status.Group] = true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for group := range s.incidents {
+		if !evaluated[group] {
+			delete(s.incidents, group)
+		}
+	}
+}
+
+// burrowEvent returns the event of a status change in the incident of its group, which ends back to OK
+func (s *webhookSink) burrowEvent(status *GroupStatus) *BurrowEvent {
+	s.lock.Lock()
+	incident, ok := s.incidents[status.Group]
+	if !ok {
+		incident = newBurrowIncident(status.Timestamp)
+		s.incidents[status.Group] = incident
+	}
+	if status.Status == StatusOK {
+		delete(s.incidents, status.Group)
+	}
+	s.lock.Unlock()
+	return &BurrowEvent{
+		Id:      incident.id,
+		Cluster: status.Cluster,
+		Group:   status.Group,
+		Start:   incident.start,
+		Extras:  s.extras,
+		Result:  newBurrowGroupStatus(status),
+	}
+}
+
+// Test sends a synthetic alert and waits for the answer
+func (s *webhookSink) Test() error {
+	ts := clockNow().UnixNano() / int64(time.Millisecond)
+	if s.burrow {
+		incident := newBurrowIncident(ts)
+		return s.send(&BurrowEvent{
+			Id:      incident.id,
+			Cluster: s.cluster,
+			Group:   "burrowx-test",
+			Start:   incident.start,
+			Extras:  s.extras,
+			Result:  &BurrowGroupStatus{Cluster: s.cluster, Group: "burrowx-test", Status: BurrowWarn},
+		})
+	}
+	return s.send(&Alert{
+		Cluster:   s.cluster,
+		Group:     "burrowx-test",
+		Previous:  StatusOK,
+		Status:    StatusWarn,
+		Timestamp: ts,
+		Test:      true,
+	})
+}
+
+// send posts the template rendered with an Alert or a BurrowEvent
+func (s *webhookSink) send(alert interface{}) error {
+	var buf bytes.Buffer
+	if err := s.template.Execute(&buf, alert); err != nil {
+		return err
+	}
+	resp, err := s.http.Post(s.url, "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Close waits for the alerts being sent
+func (s *webhookSink) Close() error {
+	s.sending.Wait()
+	return nil
+}
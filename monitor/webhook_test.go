@@ -0,0 +1,26 @@
+package monitor
+
+import "testing"
+
+func TestWebhookIncidentsPruned(t *testing.T) {
+	sink, err := newWebhookSink("local", map[string]string{"url": "http://127.0.0.1:1/", "format": "burrow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sink.(*webhookSink)
+	warn := &GroupStatus{Group: "g", Status: StatusWarn}
+	first := s.burrowEvent(warn)
+	if again := s.burrowEvent(warn); again.Id != first.Id {
+		t.Errorf("incident %s, want %s", again.Id, first.Id)
+	}
+	// the group is still evaluated, its incident is kept
+	s.Save("local", nil, []*GroupStatus{warn})
+	if len(s.incidents) != 1 {
+		t.Fatalf("%d incidents, want 1", len(s.incidents))
+	}
+	// purged or expired, it's no longer evaluated
+	s.Save("local", nil, nil)
+	if len(s.incidents) != 0 {
+		t.Errorf("%d incidents left of the groups gone", len(s.incidents))
+	}
+}
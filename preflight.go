@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	. "github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// preflightCmd checks the clusters and sinks of the config are reachable and allowed, and fails if not ready
+func preflightCmd(args []string) error {
+	var cfgFile, cluster, format string
+	fs := newFlagSet("preflight", &cfgFile)
+	fs.StringVar(&cluster, "cluster", "", "cluster to check, all clusters if empty")
+	fs.StringVar(&format, "format", "table", "output format, table or json")
+	fs.Parse(args)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	cfg := ReadConfig(cfgFile)
+	if err := mylog.InitLogger(cfg.General.Log); err != nil {
+		return err
+	}
+	clusters := make([]string, 0, len(cfg.Kafka))
+	for name := range cfg.Kafka {
+		if cluster == "" || cluster == name {
+			clusters = append(clusters, name)
+		}
+	}
+	if len(clusters) == 0 {
+		return fmt.Errorf("unknown cluster %s", cluster)
+	}
+	sort.Strings(clusters)
+	if err := monitor.LoadPlugins(cfg.General.Plugins); err != nil {
+		return err
+	}
+
+	checks := monitor.Preflight(cfg, clusters)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CLUSTER\tCHECK\tRESULT\tLATENCY\tDETAIL")
+		for _, check := range checks {
+			result := "ok"
+			if !check.OK && check.Optional {
+				result = "warn"
+			} else if !check.OK {
+				result = "FAIL"
+			}
+			latency := ""
+			if check.LatencyMs > 0 {
+				latency = fmt.Sprintf("%.1fms", check.LatencyMs)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", check.Cluster, check.Check, result, latency, check.Detail)
+		}
+		w.Flush()
+	}
+	if !monitor.Ready(checks) {
+		return fmt.Errorf("not ready")
+	}
+	fmt.Fprintln(os.Stderr, "ready")
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+// service is the lifecycle of the daemon as seen by the service manager of the platform
+type service interface {
+	// ready reports the daemon started, stale returns the clusters whose offsets are stale
+	ready(stale func() []string)
+	// wait blocks until the daemon must stop
+	wait()
+	// stopping reports the daemon is shutting down
+	stopping()
+}
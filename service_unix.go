@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	mylog "github.com/sundy-li/burrowx/log"
+)
+
+// serve runs the daemon, it notifies systemd of its lifecycle when started by a Type=notify unit
+func serve(run func(svc service) error) error {
+	return run(&systemd{socket: os.Getenv("NOTIFY_SOCKET")})
+}
+
+// systemd implements sd_notify, without libsystemd: the states are datagrams sent to the NOTIFY_SOCKET
+type systemd struct {
+	socket   string
+	watchdog *time.Ticker
+}
+
+// ready sends READY=1, and with WatchdogSec set pings the watchdog at half its interval as long as
+// no cluster is stale, so systemd restarts a burrowx whose sweeps hang
+func (s *systemd) ready(stale func() []string) {
+	s.notify("READY=1")
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	s.watchdog = time.NewTicker(interval / 2)
+	go func() {
+		for _ = range s.watchdog.C {
+			if clusters := stale(); len(clusters) > 0 {
+				s.notify("STATUS=stale clusters: " + strings.Join(clusters, ","))
+				continue
+			}
+			s.notify("WATCHDOG=1\nSTATUS=ok")
+		}
+	}()
+}
+
+func (s *systemd) wait() {
+	WaitForExitSign()
+}
+
+func (s *systemd) stopping() {
+	if s.watchdog != nil {
+		s.watchdog.Stop()
+	}
+	s.notify("STOPPING=1")
+}
+
+func (s *systemd) notify(state string) {
+	if s.socket == "" {
+		return
+	}
+	name := s.socket
+	// an abstract socket
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		mylog.Module("main").Warnf("sd_notify %q failed: %v", state, err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		mylog.Module("main").Warnf("sd_notify %q failed: %v", state, err)
+	}
+}
+
+// watchdogInterval returns the WatchdogSec of the unit if it applies to this process, 0 otherwise
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// ToggleDebugOnSignal switches all log levels to debug and back on every SIGUSR1
+func ToggleDebugOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	log := mylog.Module("main")
+	for _ = range c {
+		log.Warnf("SIGUSR1 received, debug logging: %v", mylog.ToggleDebug())
+	}
+}
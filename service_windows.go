@@ -0,0 +1,133 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// name of the service as registered with sc.exe create
+const serviceName = "burrowx"
+
+// ERROR_FAILED_SERVICE_CONTROLLER_CONNECT, the process wasn't started by the service control manager
+const errNotAService = syscall.Errno(1063)
+
+var procRegisterServiceCtrlHandlerEx = windows.NewLazySystemDLL("advapi32.dll").NewProc("RegisterServiceCtrlHandlerExW")
+
+// the service control manager calls back on its own threads, so the running service is global
+var (
+	winSvc *windowsService
+	// run of serve, called by serviceMain
+	winRun func(svc service) error
+	winErr error
+)
+
+// serve runs the daemon as a windows service when started by the service control manager,
+// as a console program otherwise
+func serve(run func(svc service) error) error {
+	winRun = run
+	name, err := windows.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return err
+	}
+	table := []windows.SERVICE_TABLE_ENTRY{
+		{ServiceName: name, ServiceProc: windows.NewCallback(serviceMain)},
+		{ServiceName: nil, ServiceProc: 0},
+	}
+	// blocks until the service stopped
+	err = windows.StartServiceCtrlDispatcher(&table[0])
+	if err == errNotAService {
+		return run(console{})
+	}
+	if err != nil {
+		return err
+	}
+	return winErr
+}
+
+// windowsService reports the state of the daemon to the service control manager
+type windowsService struct {
+	handle   windows.Handle
+	lock     sync.Mutex
+	status   windows.SERVICE_STATUS
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	winSvc = &windowsService{stop: make(chan struct{})}
+	winSvc.status.ServiceType = windows.SERVICE_WIN32_OWN_PROCESS
+	name, _ := windows.UTF16PtrFromString(serviceName)
+	h, _, err := procRegisterServiceCtrlHandlerEx.Call(uintptr(unsafe.Pointer(name)), windows.NewCallback(serviceCtrlHandler), 0)
+	if h == 0 {
+		winErr = err
+		return 0
+	}
+	winSvc.handle = windows.Handle(h)
+	winSvc.set(windows.SERVICE_START_PENDING, 0)
+
+	winErr = winRun(winSvc)
+	var exitCode uint32
+	if winErr != nil {
+		exitCode = 1
+	}
+	winSvc.set(windows.SERVICE_STOPPED, exitCode)
+	return 0
+}
+
+func serviceCtrlHandler(ctrl, eventType uint32, eventData, context uintptr) uintptr {
+	switch ctrl {
+	case windows.SERVICE_CONTROL_STOP, windows.SERVICE_CONTROL_SHUTDOWN:
+		winSvc.stopOnce.Do(func() { close(winSvc.stop) })
+	case windows.SERVICE_CONTROL_INTERROGATE:
+		winSvc.lock.Lock()
+		windows.SetServiceStatus(winSvc.handle, &winSvc.status)
+		winSvc.lock.Unlock()
+	}
+	return windows.NO_ERROR
+}
+
+func (s *windowsService) set(state, exitCode uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status.CurrentState = state
+	s.status.Win32ExitCode = exitCode
+	s.status.ControlsAccepted = 0
+	s.status.WaitHint = 0
+	switch state {
+	case windows.SERVICE_RUNNING:
+		s.status.ControlsAccepted = windows.SERVICE_ACCEPT_STOP | windows.SERVICE_ACCEPT_SHUTDOWN
+	case windows.SERVICE_START_PENDING, windows.SERVICE_STOP_PENDING:
+		s.status.CheckPoint++
+		s.status.WaitHint = 30000
+	}
+	windows.SetServiceStatus(s.handle, &s.status)
+}
+
+// ready reports the service running, windows has no watchdog so the stale clusters are only in the api
+func (s *windowsService) ready(stale func() []string) {
+	s.set(windows.SERVICE_RUNNING, 0)
+}
+
+func (s *windowsService) wait() {
+	<-s.stop
+}
+
+func (s *windowsService) stopping() {
+	s.set(windows.SERVICE_STOP_PENDING, 0)
+}
+
+// console runs burrowx in the foreground until ctrl+c
+type console struct{}
+
+func (console) ready(stale func() []string) {}
+func (console) wait()                       { WaitForExitSign() }
+func (console) stopping()                   {}
+
+// ToggleDebugOnSignal does nothing, windows has no SIGUSR1, the /v1/admin/loglevel api changes the levels
+func ToggleDebugOnSignal() {}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	. "github.com/sundy-li/burrowx/config"
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// stateCmd exports the state of a running burrowx to a file, or imports it, through its api
+func stateCmd(args []string) error {
+	if len(args) > 0 && args[0] == "diff" {
+		return stateDiffCmd(args[1:])
+	}
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		return fmt.Errorf("usage: burrowx state export|import|diff [flags]")
+	}
+	action := args[0]
+	var cfgFile, addr, file string
+	fs := newFlagSet("state "+action, &cfgFile)
+	fs.StringVar(&addr, "api", "", "api address of the running burrowx, api.adminListen or api.listen of the config if empty")
+	fs.StringVar(&file, "file", "", "state file, stdout or stdin if empty")
+	fs.Parse(args[1:])
+
+	if addr == "" {
+		cfg, err := LoadConfig(cfgFile)
+		if err != nil {
+			return err
+		}
+		if addr = cfg.Api.AdminListen; addr == "" {
+			addr = cfg.Api.Listen
+		}
+		if addr == "" {
+			return fmt.Errorf("no api address, set --api or api.listen")
+		}
+	}
+	url := "http://" + addr + "/v1/admin/state"
+
+	var resp *http.Response
+	var err error
+	if action == "export" {
+		resp, err = http.Get(url)
+	} else {
+		var data []byte
+		if file == "" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		resp, err = http.Post(url, "application/json", bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	var out io.Writer = os.Stdout
+	if action == "export" && file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+type lagChange struct {
+	cluster, group string
+	before, after  int64
+}
+
+// stateDiffCmd compares the lag of the groups in two exported states, e.g. before and after a deploy
+func stateDiffCmd(args []string) error {
+	var before, after string
+	var minChange int64
+	fs := flag.NewFlagSet("burrowx state diff", flag.ExitOnError)
+	fs.StringVar(&before, "before", "", "state exported before")
+	fs.StringVar(&after, "after", "", "state exported after")
+	fs.Int64Var(&minChange, "min-change", 0, "only print groups whose lag changed by more than this")
+	fs.Parse(args)
+	if before == "" || after == "" {
+		return fmt.Errorf("both --before and --after are needed")
+	}
+	lagsBefore, err := readStateLags(before)
+	if err != nil {
+		return err
+	}
+	lagsAfter, err := readStateLags(after)
+	if err != nil {
+		return err
+	}
+
+	var changes []*lagChange
+	for key, lag := range lagsAfter {
+		changes = append(changes, &lagChange{cluster: key[0], group: key[1], before: -1, after: lag})
+	}
+	for _, c := range changes {
+		if lag, ok := lagsBefore[[2]string{c.cluster, c.group}]; ok {
+			c.before = lag
+		}
+	}
+	for key, lag := range lagsBefore {
+		if _, ok := lagsAfter[key]; !ok {
+			changes = append(changes, &lagChange{cluster: key[0], group: key[1], before: lag, after: -1})
+		}
+	}
+	// biggest regressions first
+	sort.Slice(changes, func(i, j int) bool {
+		if d1, d2 := changes[i].after-changes[i].before, changes[j].after-changes[j].before; d1 != d2 {
+			return d1 > d2
+		}
+		if changes[i].cluster != changes[j].cluster {
+			return changes[i].cluster < changes[j].cluster
+		}
+		return changes[i].group < changes[j].group
+	})
+
+	var regressed, improved int
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tGROUP\tBEFORE\tAFTER\tCHANGE\tRESULT")
+	for _, c := range changes {
+		result, change := "", "-"
+		switch {
+		case c.before < 0:
+			result = "new"
+		case c.after < 0:
+			result = "gone"
+		default:
+			delta := c.after - c.before
+			if delta <= minChange && delta >= -minChange {
+				continue
+			}
+			change = fmt.Sprintf("%+d", delta)
+			if delta > 0 {
+				result = "regressed"
+				regressed++
+			} else {
+				result = "improved"
+				improved++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.cluster, c.group, lagString(c.before), lagString(c.after), change, result)
+	}
+	w.Flush()
+	fmt.Printf("\n%d groups regressed, %d improved\n", regressed, improved)
+	return nil
+}
+
+// readStateLags returns the total lag of the last evaluation of every group of an exported state
+func readStateLags(file string) (map[[2]string]int64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var state monitor.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	lags := make(map[[2]string]int64)
+	for cluster, cs := range state.Clusters {
+		for group, window := range cs.Windows {
+			if len(window) > 0 {
+				lags[[2]string{cluster, group}] = window[len(window)-1].TotalLag
+			}
+		}
+	}
+	return lags, nil
+}
+
+func lagString(lag int64) string {
+	if lag < 0 {
+		return "-"
+	}
+	return fmt.Sprint(lag)
+}
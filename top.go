@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	. "github.com/sundy-li/burrowx/config"
+	mylog "github.com/sundy-li/burrowx/log"
+	"github.com/sundy-li/burrowx/monitor"
+)
+
+// topCmd redraws the lag of the groups sorted by lag every interval, or the partitions of one group
+func topCmd(args []string) error {
+	var cfgFile, cluster, group string
+	var interval time.Duration
+	fs := newFlagSet("top", &cfgFile)
+	fs.StringVar(&cluster, "cluster", "", "cluster to watch, all clusters if empty")
+	fs.StringVar(&group, "group", "", "show the partitions of this group")
+	fs.DurationVar(&interval, "interval", 5*time.Second, "refresh interval")
+	fs.Parse(args)
+
+	cfg := ReadConfig(cfgFile)
+	// keep the log lines off the screen unless they go to a file
+	if cfg.General.Log.File == "" {
+		cfg.General.Log.Level = "fatal"
+	}
+	if err := mylog.InitLogger(cfg.General.Log); err != nil {
+		return err
+	}
+	var clients []*monitor.KafkaClient
+	for name := range cfg.Kafka {
+		if cluster != "" && cluster != name {
+			continue
+		}
+		client, err := monitor.NewKafkaClient(cfg, name)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return fmt.Errorf("unknown cluster %s", cluster)
+	}
+
+	exit := make(chan os.Signal, 1)
+	signal.Notify(exit, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var msgs []*monitor.ConsumerFullOffset
+		var errs []string
+		for _, client := range clients {
+			groupOffsets, err := client.Dump(context.Background())
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			if group != "" {
+				msgs = append(msgs, groupOffsets[group]...)
+				continue
+			}
+			for _, offsets := range groupOffsets {
+				msgs = append(msgs, offsets...)
+			}
+		}
+
+		var buf bytes.Buffer
+		// clear the screen and move to the top left
+		buf.WriteString("\033[H\033[2J")
+		fmt.Fprintf(&buf, "burrowx top - %s, refresh every %v, ctrl+c to quit\n", time.Now().Format("2006-01-02 15:04:05"), interval)
+		for _, e := range errs {
+			fmt.Fprintf(&buf, "error: %s\n", e)
+		}
+		buf.WriteString("\n")
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		if group == "" {
+			renderGroups(w, msgs)
+		} else {
+			renderPartitions(w, msgs)
+		}
+		w.Flush()
+		os.Stdout.Write(buf.Bytes())
+
+		select {
+		case <-exit:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func renderGroups(w *tabwriter.Writer, msgs []*monitor.ConsumerFullOffset) {
+	sort.Slice(msgs, func(i, j int) bool {
+		_, _, li, _ := summarize(msgs[i])
+		_, _, lj, _ := summarize(msgs[j])
+		return li > lj
+	})
+	fmt.Fprintln(w, "CLUSTER\tGROUP\tTOPIC\tPARTITIONS\tLAG\tMAX LAG")
+	for _, msg := range msgs {
+		_, _, lag, maxLag := summarize(msg)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", msg.Cluster, msg.Group, msg.Topic, len(msg.Partitions()), lag, maxLag)
+	}
+}
+
+func renderPartitions(w *tabwriter.Writer, msgs []*monitor.ConsumerFullOffset) {
+	type row struct {
+		msg       *monitor.ConsumerFullOffset
+		partition int32
+		offset    monitor.LogOffset
+	}
+	var rows []row
+	for _, msg := range msgs {
+		for partition, offset := range msg.Partitions() {
+			rows = append(rows, row{msg, partition, offset})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].offset.Lag > rows[j].offset.Lag
+	})
+	fmt.Fprintln(w, "CLUSTER\tTOPIC\tPARTITION\tLOGSIZE\tOFFSET\tLAG\tOWNER")
+	for _, r := range rows {
+		owner := strings.TrimPrefix(r.offset.ClientHost, "/")
+		if r.offset.ClientID != "" {
+			owner = r.offset.ClientID + "@" + owner
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", r.msg.Cluster, r.msg.Topic, r.partition, r.offset.Logsize, r.offset.Offset, r.offset.Lag, owner)
+	}
+}